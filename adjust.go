@@ -0,0 +1,130 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+)
+
+// Adjustment is a relative change to a stock level, e.g. -2 used or +12
+// delivered, so simultaneous adjustments all count
+type Adjustment struct {
+	Delta  float64 `json:"delta"`
+	Reason string  `json:"reason"`
+}
+
+const maxReasonLength = 255
+
+func (data Adjustment) validate() error {
+	if data.Delta == 0 || math.IsNaN(data.Delta) || math.IsInf(data.Delta, 0) {
+		return fmt.Errorf("delta must be a non zero number")
+	}
+	if len(data.Reason) > maxReasonLength {
+		return fmt.Errorf("reason must be at most %d characters", maxReasonLength)
+	}
+	return nil
+}
+
+// stockAdjust serves POST /stock/{id}/adjust with an Adjustment, returning
+// the resulting level change. If-Match is optional, an adjustment does not
+// depend on the level it was made against.
+func stockAdjust(w http.ResponseWriter, r *http.Request) {
+	stockID, ok := pathID(w, r, "stockID")
+	if !ok {
+		return
+	}
+
+	var data Adjustment
+	err := json.NewDecoder(r.Body).Decode(&data)
+	if err != nil {
+		http.Error(w, "invalid body", http.StatusBadRequest)
+		return
+	}
+	if err = data.validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	version, err := parseIfMatch(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	res, version, err := adjustStock(stockID, data, version)
+	if err != nil {
+		writeUpdateError(w, r, err)
+		return
+	}
+	w.Header().Set("ETag", etag(version))
+	json.NewEncoder(w).Encode(res)
+}
+
+// adjustStock adds data.Delta to the level and logs it, version is the one
+// the client expects to change (0 for any)
+func adjustStock(stockID int, data Adjustment, version int) (res levelChange, newVersion int, err error) {
+	const selectOld = `SELECT level, roomID, version FROM stock WHERE stockID=? LIMIT 1 FOR UPDATE`
+	const updateLevel = `UPDATE stock SET level = level + ?, version = version + 1 WHERE stockID=?`
+	const selectNew = `SELECT level, version FROM stock WHERE stockID=?`
+	const insertLog = `INSERT INTO logs(stockID,differance,totalAfter,incidentTime,daily,reason) VALUES (?,?,?,NOW(),0,?)`
+
+	tx, err := db.Begin()
+	if err != nil {
+		return res, 0, err
+	}
+	defer tx.Rollback()
+
+	var oldlevel float64
+	err = tx.QueryRow(selectOld, stockID).Scan(&oldlevel, &res.RoomID, &newVersion)
+	if err != nil {
+		return res, 0, err
+	}
+	err = checkVersion(newVersion, version)
+	if err != nil {
+		return res, 0, err
+	}
+
+	_, err = tx.Exec(updateLevel, data.Delta, stockID)
+	if err != nil {
+		return res, 0, err
+	}
+	// READ BACK WHAT THE COLUMN STORED RATHER THAN ADDING IN GO
+	err = tx.QueryRow(selectNew, stockID).Scan(&res.Level, &newVersion)
+	if err != nil {
+		return res, 0, err
+	}
+
+	inserted, err := tx.Exec(insertLog, stockID, data.Delta, res.Level, data.Reason)
+	if err != nil {
+		return res, 0, err
+	}
+	logID, err := inserted.LastInsertId()
+	if err != nil {
+		return res, 0, err
+	}
+	_, err = tx.Exec("UPDATE stock SET lastLogID=? WHERE stockID=?", logID, stockID)
+	if err != nil {
+		return res, 0, err
+	}
+
+	alert, err := checkLowStock(tx, stockID, oldlevel, res.Level)
+	if err != nil {
+		return res, 0, err
+	}
+
+	res.StockID = stockID
+	res.Differance = data.Delta
+	res.LogID = int(logID)
+	res.Reason = data.Reason
+	err = emitEvent(tx, eventStockLevelChanged, res)
+	if err != nil {
+		return res, 0, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return res, 0, err
+	}
+	notifyLowStock(alert)
+
+	return res, newVersion, nil
+}
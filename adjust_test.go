@@ -0,0 +1,36 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestStockAdjustInvalid(t *testing.T) {
+	tests := []struct {
+		name    string
+		stockID string
+		body    string
+		ifMatch string
+	}{
+		{"not json", "1", "-2", ""},
+		{"no delta", "1", `{"reason":"spilt"}`, ""},
+		{"zero delta", "1", `{"delta":0}`, ""},
+		{"long reason", "1", `{"delta":-1,"reason":"` + strings.Repeat("x", maxReasonLength+1) + `"}`, ""},
+		{"bad If-Match", "1", `{"delta":-1}`, "3"},
+		{"bad id", "one", `{"delta":-1}`, ""},
+	}
+	for _, test := range tests {
+		r := httptest.NewRequest("POST", "/api/v1/stock/1/adjust", strings.NewReader(test.body))
+		r.SetPathValue("stockID", test.stockID)
+		if test.ifMatch != "" {
+			r.Header.Set("If-Match", test.ifMatch)
+		}
+		w := httptest.NewRecorder()
+		stockAdjust(w, r)
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("%s: got %d %q, want 400", test.name, w.Code, w.Body.String())
+		}
+	}
+}
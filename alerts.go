@@ -0,0 +1,483 @@
+package main
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"mime"
+	"net/http"
+	"net/smtp"
+	"slices"
+	"time"
+)
+
+// Alert is raised when a stock level drops below its incident level. It stays
+// unresolved until the level is back at or above the incident level, and no
+// new alert is raised for the item while it is unresolved.
+type Alert struct {
+	AlertID        int      `json:"alertID"`
+	StockID        int      `json:"stockID"`
+	ItemName       string   `json:"itemName"`
+	RoomID         int      `json:"roomID"`
+	Room           string   `json:"room"`
+	SiteID         int      `json:"siteID"`
+	CategoryID     int      `json:"categoryID"`
+	Level          float64  `json:"level"` // LEVEL WHEN THE ALERT WAS RAISED
+	IncidentLevel  float64  `json:"incidentLevel"`
+	CreatedAt      NullTime `json:"createdAt"`
+	AcknowledgedAt NullTime `json:"acknowledgedAt"`
+	ResolvedAt     NullTime `json:"resolvedAt"`
+}
+
+// AlertChannel is somewhere alerts are sent. Channels belong to the site
+// they were added at and only get its alerts. A channel with a roomID or
+// categoryID only gets alerts for stock in that room or category (including
+// subcategories), one with neither gets every alert of its site.
+type AlertChannel struct {
+	ChannelID  int    `json:"channelID"`
+	Type       string `json:"type"`   // email, webhook OR slack
+	Target     string `json:"target"` // EMAIL ADDRESS OR URL
+	RoomID     int    `json:"roomID"`
+	CategoryID int    `json:"categoryID"`
+	SiteID     int    `json:"siteID"` // SET BY THE SERVER FROM THE REQUEST'S SITE
+}
+
+// SMTPConfig is used by email alert channels
+type SMTPConfig struct {
+	Host     string `yaml:"host" toml:"host"`
+	Port     string `yaml:"port" toml:"port"`
+	User     string `yaml:"user" toml:"user"`
+	Password string `yaml:"password" toml:"password"`
+	From     string `yaml:"from" toml:"from"`
+}
+
+const (
+	channelEmail   = "email"
+	channelWebhook = "webhook"
+	channelSlack   = "slack"
+
+	createAlerts = `
+	CREATE TABLE IF NOT EXISTS alerts (
+		alertID int NOT NULL AUTO_INCREMENT,
+		stockID int NOT NULL,
+		level float NOT NULL,
+		incidentLevel float NOT NULL,
+		createdAt datetime NOT NULL,
+		acknowledgedAt datetime,
+		resolvedAt datetime,
+		PRIMARY KEY (alertID),
+		INDEX (stockID, resolvedAt),
+		FOREIGN KEY (stockID) REFERENCES stock(stockID));
+	`
+	createAlertChannels = `
+	CREATE TABLE IF NOT EXISTS alertChannels (
+		channelID int NOT NULL AUTO_INCREMENT,
+		type varchar(16) NOT NULL,
+		target varchar(512) NOT NULL,
+		roomID int,
+		categoryID int,
+		PRIMARY KEY (channelID),
+		FOREIGN KEY (roomID) REFERENCES rooms(roomID),
+		FOREIGN KEY (categoryID) REFERENCES categories(categoryID));
+	`
+)
+
+var smtpConfig SMTPConfig
+
+// notifier sends one alert to one channel
+type notifier interface {
+	Notify(alert Alert) error
+}
+
+type emailNotifier struct {
+	to string
+}
+type webhookNotifier struct {
+	url string
+}
+type slackNotifier struct {
+	url string
+}
+
+var alertClient = &http.Client{Timeout: 10 * time.Second}
+
+func newNotifier(channel AlertChannel) (notifier, error) {
+	switch channel.Type {
+	case channelEmail:
+		return emailNotifier{to: channel.Target}, nil
+	case channelWebhook:
+		return webhookNotifier{url: channel.Target}, nil
+	case channelSlack:
+		return slackNotifier{url: channel.Target}, nil
+	}
+	return nil, fmt.Errorf("unknown alert channel type %q", channel.Type)
+}
+func alertText(alert Alert) string {
+	return fmt.Sprintf("Low stock: %s in %s is at %v, below its incident level of %v",
+		alert.ItemName, alert.Room, alert.Level, alert.IncidentLevel)
+}
+func (e emailNotifier) Notify(alert Alert) error {
+	if smtpConfig.Host == "" {
+		return fmt.Errorf("SMTP_HOST is not set")
+	}
+	msg := "To: " + e.to + "\r\n" +
+		"From: " + smtpConfig.From + "\r\n" +
+		// ENCODED SO A LINE BREAK IN THE NAME CANNOT ADD HEADERS
+		"Subject: " + mime.QEncoding.Encode("utf-8", "Low stock: "+alert.ItemName) + "\r\n" +
+		"\r\n" + alertText(alert) + "\r\n"
+
+	var auth smtp.Auth
+	if smtpConfig.User != "" {
+		auth = smtp.PlainAuth("", smtpConfig.User, smtpConfig.Password, smtpConfig.Host)
+	}
+	return smtp.SendMail(smtpConfig.Host+":"+smtpConfig.Port, auth, smtpConfig.From, []string{e.to}, []byte(msg))
+}
+func (n webhookNotifier) Notify(alert Alert) error {
+	return postJSON(n.url, alert)
+}
+func (n slackNotifier) Notify(alert Alert) error {
+	return postJSON(n.url, map[string]string{"text": alertText(alert)})
+}
+func postJSON(url string, body any) error {
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	res, err := alertClient.Post(url, "application/json", bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode >= 300 {
+		return fmt.Errorf("%s responded %s", url, res.Status)
+	}
+	return nil
+}
+
+// checkLowStock is called inside the transaction that changes a stock level.
+// It resolves open alerts when the level has recovered and returns a new
+// alert when the level has just crossed below the incident level, which the
+// caller passes to notifyLowStock once the transaction has committed.
+func checkLowStock(tx *sql.Tx, stockID int, oldLevel float64, newLevel float64) (alert *Alert, err error) {
+	var incident sql.NullFloat64
+	err = tx.QueryRow("SELECT incidentLevel FROM stock WHERE stockID=?", stockID).Scan(&incident)
+	if err != nil {
+		return nil, err
+	}
+	if !incident.Valid {
+		return nil, nil
+	}
+
+	if newLevel >= incident.Float64 {
+		_, err = tx.Exec("UPDATE alerts SET resolvedAt=NOW() WHERE stockID=? AND resolvedAt IS NULL", stockID)
+		return nil, err
+	}
+	if oldLevel < incident.Float64 {
+		// ALREADY BELOW, ONLY THE CROSSING RAISES AN ALERT
+		return nil, nil
+	}
+
+	var open int
+	err = tx.QueryRow("SELECT COUNT(*) FROM alerts WHERE stockID=? AND resolvedAt IS NULL", stockID).Scan(&open)
+	if err != nil || open > 0 {
+		return nil, err
+	}
+
+	res, err := tx.Exec("INSERT INTO alerts(stockID,level,incidentLevel,createdAt) VALUES (?,?,?,NOW())", stockID, newLevel, incident.Float64)
+	if err != nil {
+		return nil, err
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return nil, err
+	}
+
+	alert = &Alert{AlertID: int(id), StockID: stockID, Level: newLevel, IncidentLevel: incident.Float64}
+	var categoryID sql.NullInt64
+	err = tx.QueryRow(`SELECT stock.itemName, stock.roomID, rooms.roomName, rooms.siteID, stock.categoryID
+		FROM stock JOIN rooms ON stock.roomID = rooms.roomID WHERE stock.stockID=?`, stockID).Scan(&alert.ItemName, &alert.RoomID, &alert.Room, &alert.SiteID, &categoryID)
+	alert.CategoryID = int(categoryID.Int64)
+	return alert, err
+}
+
+// notifyLowStock sends alert to every matching channel in the background
+func notifyLowStock(alert *Alert) {
+	if alert == nil {
+		return
+	}
+	background.Add(1)
+	go func() {
+		defer background.Done()
+		channels, err := getAlertChannels(alert.SiteID)
+		if err != nil {
+			slog.Error("alerts", "err", err)
+			return
+		}
+		var categories []int
+		if alert.CategoryID != 0 {
+			categories, err = categoryAncestors(alert.CategoryID)
+			if err != nil {
+				slog.Error("alerts", "err", err)
+			}
+		}
+
+		for _, channel := range channels {
+			if channel.RoomID != 0 && channel.RoomID != alert.RoomID {
+				continue
+			}
+			if channel.CategoryID != 0 && !containsInt(categories, channel.CategoryID) {
+				continue
+			}
+			n, err := newNotifier(channel)
+			if err == nil {
+				err = n.Notify(*alert)
+			}
+			if err != nil {
+				slog.Error("alerts: sending failed", "channel", channel.ChannelID, "err", err)
+			}
+		}
+	}()
+}
+
+// categoryAncestors returns id and every category above it
+func categoryAncestors(id int) (res []int, err error) {
+	all, err := getCategories()
+	if err != nil {
+		return res, err
+	}
+	parents := map[int]int{}
+	for _, category := range all {
+		parents[category.CategoryID] = category.ParentID
+	}
+	for id != 0 && !containsInt(res, id) {
+		res = append(res, id)
+		id = parents[id]
+	}
+	return res, nil
+}
+func containsInt(list []int, value int) bool {
+	for _, v := range list {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// alertStatuses are what GET /alerts/ may filter by
+var alertStatuses = []string{"open", "acknowledged", "resolved", "all"}
+
+// alertsList serves GET /alerts/, open alerts or ?status=acknowledged,
+// resolved or all
+func alertsList(w http.ResponseWriter, r *http.Request) {
+	status := r.URL.Query().Get("status")
+	if status == "" {
+		status = "open"
+	}
+	if !slices.Contains(alertStatuses, status) {
+		http.Error(w, "status must be open, acknowledged, resolved or all", http.StatusBadRequest)
+		return
+	}
+	res, err := getAlerts(status, siteFrom(r.Context()))
+	if err != nil {
+		internalError(w, r, err)
+		return
+	}
+	json.NewEncoder(w).Encode(res)
+}
+
+// alertsAcknowledge serves POST /alerts/{id}/acknowledge
+func alertsAcknowledge(w http.ResponseWriter, r *http.Request) {
+	idnum, ok := pathID(w, r, "alertID")
+	if !ok {
+		return
+	}
+	err := acknowledgeAlert(idnum)
+	if err != nil {
+		logRequestError(r, err)
+		http.Error(w, "could not acknowledge alert", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte("data updated sucesfully"))
+}
+func alertChannelsList(w http.ResponseWriter, r *http.Request) {
+	res, err := getAlertChannels(siteFrom(r.Context()))
+	if err != nil {
+		logRequestError(r, err)
+		http.Error(w, "could not load channels", http.StatusInternalServerError)
+		return
+	}
+	json.NewEncoder(w).Encode(res)
+}
+func alertChannelsCreate(w http.ResponseWriter, r *http.Request) {
+	var data AlertChannel
+	err := json.NewDecoder(r.Body).Decode(&data)
+	if err != nil {
+		http.Error(w, "invalid body", http.StatusBadRequest)
+		return
+	}
+	_, err = newNotifier(data)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if data.Target == "" {
+		http.Error(w, "target is required", http.StatusBadRequest)
+		return
+	}
+	data.SiteID = siteFrom(r.Context())
+	if data.RoomID != 0 {
+		ok, err := atSite(r.Context(), "roomID", data.RoomID)
+		if err != nil {
+			internalError(w, r, err)
+			return
+		}
+		if !ok {
+			http.Error(w, "the room is not at this site", http.StatusBadRequest)
+			return
+		}
+	}
+	if data.CategoryID != 0 {
+		// CATEGORIES ARE SHARED BY EVERY SITE
+		var count int
+		err = db.QueryRow("SELECT COUNT(*) FROM categories WHERE categoryID=?", data.CategoryID).Scan(&count)
+		if err != nil {
+			internalError(w, r, err)
+			return
+		}
+		if count == 0 {
+			http.Error(w, "no category with that categoryID", http.StatusBadRequest)
+			return
+		}
+	}
+	err = addAlertChannel(data)
+	if err != nil {
+		internalError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte("data written sucesfuly"))
+}
+func alertChannelsDelete(w http.ResponseWriter, r *http.Request) {
+	idnum, ok := pathID(w, r, "channelID")
+	if !ok {
+		return
+	}
+	err := deleteAlertChannel(idnum)
+	if err != nil {
+		logRequestError(r, err)
+		http.Error(w, "could not delete channel", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte("data deleated sucesfuly"))
+}
+
+// CREATE
+
+func addAlertChannel(data AlertChannel) (err error) {
+	_, err = db.Exec("INSERT INTO alertChannels(type,target,roomID,categoryID,siteID) VALUES (?,?,?,?,?)",
+		data.Type, data.Target, nullInt(data.RoomID), nullInt(data.CategoryID), data.SiteID)
+	return err
+}
+
+// GET
+
+// getAlerts returns the alerts of site, or of every site for allSites
+func getAlerts(status string, site int) (res []Alert, err error) {
+	res = []Alert{}
+	query := `
+		SELECT
+		    alerts.alertID, alerts.stockID, stock.itemName, stock.roomID, rooms.roomName, rooms.siteID, stock.categoryID,
+		    alerts.level, alerts.incidentLevel, alerts.createdAt, alerts.acknowledgedAt, alerts.resolvedAt
+		FROM
+		    alerts
+		JOIN
+		    stock ON alerts.stockID = stock.stockID
+		JOIN
+		    rooms ON stock.roomID = rooms.roomID
+		WHERE 1=1`
+	switch status {
+	case "open":
+		query += " AND alerts.acknowledgedAt IS NULL AND alerts.resolvedAt IS NULL"
+	case "acknowledged":
+		query += " AND alerts.acknowledgedAt IS NOT NULL AND alerts.resolvedAt IS NULL"
+	case "resolved":
+		query += " AND alerts.resolvedAt IS NOT NULL"
+	case "all":
+	default:
+		return res, fmt.Errorf("status must be open, acknowledged, resolved or all")
+	}
+	var args []any
+	if site != allSites {
+		query += " AND rooms.siteID = ?"
+		args = append(args, site)
+	}
+	query += " ORDER BY alerts.createdAt DESC"
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return res, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var data Alert
+		var categoryID sql.NullInt64
+		err = rows.Scan(&data.AlertID, &data.StockID, &data.ItemName, &data.RoomID, &data.Room, &data.SiteID, &categoryID,
+			&data.Level, &data.IncidentLevel, &data.CreatedAt, &data.AcknowledgedAt, &data.ResolvedAt)
+		if err != nil {
+			return res, err
+		}
+		data.CategoryID = int(categoryID.Int64)
+		res = append(res, data)
+	}
+	return res, rows.Err()
+}
+
+// getAlertChannels returns the channels of site, or of every site for
+// allSites
+func getAlertChannels(site int) (res []AlertChannel, err error) {
+	res = []AlertChannel{}
+	query := "SELECT channelID, type, target, roomID, categoryID, siteID FROM alertChannels"
+	var args []any
+	if site != allSites {
+		query += " WHERE siteID=?"
+		args = append(args, site)
+	}
+	rows, err := db.Query(query+" ORDER BY channelID", args...)
+	if err != nil {
+		return res, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var data AlertChannel
+		var roomID, categoryID sql.NullInt64
+		err = rows.Scan(&data.ChannelID, &data.Type, &data.Target, &roomID, &categoryID, &data.SiteID)
+		if err != nil {
+			return res, err
+		}
+		data.RoomID = int(roomID.Int64)
+		data.CategoryID = int(categoryID.Int64)
+		res = append(res, data)
+	}
+	return res, rows.Err()
+}
+
+// UPDATE
+
+func acknowledgeAlert(id int) (err error) {
+	_, err = db.Exec("UPDATE alerts SET acknowledgedAt=NOW() WHERE alertID=? AND acknowledgedAt IS NULL", id)
+	return err
+}
+
+// DELETE
+
+func deleteAlertChannel(id int) (err error) {
+	_, err = db.Exec("DELETE FROM alertChannels WHERE channelID=?", id)
+	return err
+}
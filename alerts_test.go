@@ -0,0 +1,102 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestNewNotifier(t *testing.T) {
+	tests := []struct {
+		channel AlertChannel
+		want    notifier
+	}{
+		{AlertChannel{Type: channelEmail, Target: "bar@example.com"}, emailNotifier{to: "bar@example.com"}},
+		{AlertChannel{Type: channelWebhook, Target: "https://example.com/hook"}, webhookNotifier{url: "https://example.com/hook"}},
+		{AlertChannel{Type: channelSlack, Target: "https://hooks.slack.com/x"}, slackNotifier{url: "https://hooks.slack.com/x"}},
+		{AlertChannel{Type: "sms", Target: "0123"}, nil},
+	}
+	for _, test := range tests {
+		got, err := newNotifier(test.channel)
+		if (err != nil) != (test.want == nil) || got != test.want {
+			t.Errorf("newNotifier(%+v) = %#v, %v, want %#v", test.channel, got, err, test.want)
+		}
+	}
+}
+
+func TestAlertNotify(t *testing.T) {
+	alert := Alert{AlertID: 4, StockID: 12, ItemName: "Lager", Room: "Cellar", Level: 1.5, IncidentLevel: 3}
+	const text = "Low stock: Lager in Cellar is at 1.5, below its incident level of 3"
+
+	var got map[string]any
+	status := http.StatusOK
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = nil
+		json.NewDecoder(r.Body).Decode(&got)
+		w.WriteHeader(status)
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		notifier notifier
+		field    string
+		want     any
+	}{
+		{webhookNotifier{url: server.URL}, "itemName", "Lager"},
+		{webhookNotifier{url: server.URL}, "alertID", 4.0},
+		{slackNotifier{url: server.URL}, "text", text},
+	}
+	for _, test := range tests {
+		err := test.notifier.Notify(alert)
+		if err != nil {
+			t.Fatalf("%T: %v", test.notifier, err)
+		}
+		if got[test.field] != test.want {
+			t.Errorf("%T sent %s = %v, want %v", test.notifier, test.field, got[test.field], test.want)
+		}
+	}
+
+	status = http.StatusInternalServerError
+	if err := (webhookNotifier{url: server.URL}).Notify(alert); err == nil {
+		t.Error("a 500 from the channel was not reported")
+	}
+}
+
+func sendAlertChannel(body string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	alertChannelsCreate(w, httptest.NewRequest("POST", "/api/v1/alertChannels", strings.NewReader(body)))
+	return w
+}
+
+func TestAlertChannelsCreate(t *testing.T) {
+	openTestDB(t)
+	// REMOVED AFTERWARDS SO OTHER TESTS' ALERTS ARE NOT SENT TO IT
+	target := testKey(t) + "@example.com"
+	t.Cleanup(func() { db.Exec("DELETE FROM alertChannels WHERE target=?", target) })
+
+	tests := []struct {
+		name string
+		body string
+		want int
+	}{
+		{"unknown type", `{"type":"sms","target":"0123"}`, http.StatusBadRequest},
+		{"no target", `{"type":"email"}`, http.StatusBadRequest},
+		{"unknown category", `{"type":"email","target":"bar@example.com","categoryID":-1}`, http.StatusBadRequest},
+		{"valid", `{"type":"email","target":"` + target + `"}`, http.StatusOK},
+	}
+	for _, test := range tests {
+		if w := sendAlertChannel(test.body); w.Code != test.want {
+			t.Errorf("%s: got %d %q, want %d", test.name, w.Code, w.Body.String(), test.want)
+		}
+	}
+}
+
+func TestAlertChannelsCreateDatabaseDown(t *testing.T) {
+	openDownDB(t)
+	w := sendAlertChannel(`{"type":"email","target":"bar@example.com"}`)
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("got %d %q, want 500", w.Code, w.Body.String())
+	}
+}
@@ -0,0 +1,214 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// AuthConfig is who may call the API. When enabled every request needs
+// Authorization: Bearer <token> with the token of one of the users.
+type AuthConfig struct {
+	Enabled bool       `yaml:"enabled" toml:"enabled"`
+	Users   []AuthUser `yaml:"users" toml:"users"`
+}
+
+// AuthUser is one user. Sites are the sites they work at, the first is used
+// when a request does not pick one. Head office may use every site.
+type AuthUser struct {
+	Name       string `yaml:"name" toml:"name"`
+	Token      string `yaml:"token" toml:"token"`
+	Sites      []int  `yaml:"sites" toml:"sites"` // EMPTY FOR THE DEFAULT SITE
+	HeadOffice bool   `yaml:"headOffice" toml:"headOffice"`
+}
+
+func (user AuthUser) sites() []int {
+	if len(user.Sites) == 0 {
+		return []int{defaultSite}
+	}
+	return user.Sites
+}
+
+// minTokenLength keeps tokens long enough not to be guessed
+const minTokenLength = 16
+
+// publicPaths are served without a token, so load balancers and API
+// browsers can reach them. /metrics is not, Prometheus can send a token.
+var publicPaths = map[string]bool{
+	"/":                         true,
+	"/healthz":                  true,
+	"/readyz":                   true,
+	apiPrefix + "/openapi.yaml": true,
+	apiPrefix + "/openapi.json": true,
+}
+
+func (config AuthConfig) validate() error {
+	if config.Enabled && len(config.Users) == 0 {
+		return fmt.Errorf("auth: enabled without any users")
+	}
+	names := map[string]bool{}
+	tokens := map[string]bool{}
+	for _, user := range config.Users {
+		switch {
+		case user.Name == "":
+			return fmt.Errorf("auth: a user has no name")
+		case len(user.Token) < minTokenLength:
+			return fmt.Errorf("auth: the token of %s must be at least %d characters", user.Name, minTokenLength)
+		case names[user.Name]:
+			return fmt.Errorf("auth: user %s is listed twice", user.Name)
+		case tokens[user.Token]:
+			return fmt.Errorf("auth: %s has the same token as another user", user.Name)
+		}
+		for _, site := range user.Sites {
+			if site <= 0 {
+				return fmt.Errorf("auth: %s has an invalid site %d", user.Name, site)
+			}
+		}
+		names[user.Name] = true
+		tokens[user.Token] = true
+	}
+	return nil
+}
+
+// user returns the user with token, comparing every token in constant time
+func (config AuthConfig) user(token string) (found AuthUser, ok bool) {
+	for _, user := range config.Users {
+		if subtle.ConstantTimeCompare([]byte(user.Token), []byte(token)) == 1 {
+			found, ok = user, true
+		}
+	}
+	return found, ok
+}
+
+type userKey struct{}
+
+// userFrom returns the name of the user making the request, "" when auth is
+// off
+func userFrom(ctx context.Context) string {
+	user, _ := authUserFrom(ctx)
+	return user.Name
+}
+
+// authUserFrom returns the user making the request, ok is false when auth is
+// off
+func authUserFrom(ctx context.Context) (user AuthUser, ok bool) {
+	user, ok = ctx.Value(userKey{}).(AuthUser)
+	return user, ok
+}
+
+// withUser records who is making the request, for handlers and the access log
+func withUser(ctx context.Context, user AuthUser) context.Context {
+	if info := requestInfoFrom(ctx); info != nil {
+		info.user = user.Name
+	}
+	return context.WithValue(ctx, userKey{}, user)
+}
+
+// authenticate rejects requests without a valid token with 401 when auth is
+// enabled. EventSource cannot send headers, so /events also takes the token
+// as ?access_token=.
+func authenticate(config AuthConfig) middleware {
+	return func(next http.Handler) http.Handler {
+		if !config.Enabled {
+			return next
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if publicPaths[r.URL.Path] {
+				next.ServeHTTP(w, r)
+				return
+			}
+			token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+			if !ok && r.URL.Path == apiPrefix+"/events" {
+				token, ok = r.URL.Query().Get("access_token"), true
+			}
+			user, valid := config.user(token)
+			if !ok || !valid {
+				w.Header().Set("WWW-Authenticate", `Bearer realm="inventory"`)
+				http.Error(w, "a valid bearer token is required", http.StatusUnauthorized)
+				return
+			}
+			next.ServeHTTP(w, r.WithContext(withUser(r.Context(), user)))
+		})
+	}
+}
+
+// grpcAuth checks the "authorization" metadata of gRPC calls the same way
+func grpcAuth(config AuthConfig) []grpc.ServerOption {
+	if !config.Enabled {
+		return nil
+	}
+	check := func(ctx context.Context) (context.Context, error) {
+		md, _ := metadata.FromIncomingContext(ctx)
+		for _, v := range md.Get("authorization") {
+			if token, ok := strings.CutPrefix(v, "Bearer "); ok {
+				if user, ok := config.user(token); ok {
+					return withUser(ctx, user), nil
+				}
+			}
+		}
+		return nil, status.Error(codes.Unauthenticated, "a valid bearer token is required")
+	}
+	return []grpc.ServerOption{
+		grpc.ChainUnaryInterceptor(func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+			ctx, err := check(ctx)
+			if err != nil {
+				return nil, err
+			}
+			return handler(ctx, req)
+		}),
+		grpc.ChainStreamInterceptor(func(srv any, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+			ctx, err := check(stream.Context())
+			if err != nil {
+				return err
+			}
+			return handler(srv, contextStream{stream, ctx})
+		}),
+	}
+}
+
+// contextStream is a stream with its context replaced, e.g. to carry the user
+type contextStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s contextStream) Context() context.Context { return s.ctx }
+
+// authTokensVar adds users from "name:token,name:token". A user may be
+// followed by their sites, "name:token:1+2", or "name:token:*" for head
+// office.
+func authTokensVar(p *[]AuthUser) setter {
+	return setter{set: func(v string) error {
+		for _, pair := range splitList(v) {
+			name, token, ok := strings.Cut(pair, ":")
+			if !ok {
+				return fmt.Errorf("expected name:token, got %q", name)
+			}
+			user := AuthUser{Name: name, Token: token}
+			if token, sites, ok := strings.Cut(token, ":"); ok {
+				user.Token = token
+				if sites == "*" {
+					user.HeadOffice = true
+				} else {
+					for _, part := range strings.Split(sites, "+") {
+						site, err := strconv.Atoi(part)
+						if err != nil {
+							return fmt.Errorf("invalid site %q for %s", part, name)
+						}
+						user.Sites = append(user.Sites, site)
+					}
+				}
+			}
+			*p = append(*p, user)
+		}
+		return nil
+	}}
+}
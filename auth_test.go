@@ -0,0 +1,143 @@
+package main
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+var testAuth = AuthConfig{Enabled: true, Users: []AuthUser{
+	{Name: "pos", Token: "pos-0123456789abcdef"},
+	{Name: "office", Token: "office-0123456789abcdef"},
+}}
+
+func TestAuthConfigValidate(t *testing.T) {
+	tests := []struct {
+		name   string
+		config AuthConfig
+		want   string
+	}{
+		{"off", AuthConfig{}, ""},
+		{"valid", testAuth, ""},
+		{"no users", AuthConfig{Enabled: true}, "without any users"},
+		{"no name", AuthConfig{Users: []AuthUser{{Token: "0123456789abcdef"}}}, "no name"},
+		{"short token", AuthConfig{Users: []AuthUser{{Name: "pos", Token: "short"}}}, "at least"},
+		{"same name", AuthConfig{Users: []AuthUser{{Name: "pos", Token: "0123456789abcdef"}, {Name: "pos", Token: "fedcba9876543210"}}}, "listed twice"},
+		{"same token", AuthConfig{Users: []AuthUser{{Name: "pos", Token: "0123456789abcdef"}, {Name: "bar", Token: "0123456789abcdef"}}}, "same token"},
+	}
+	for _, test := range tests {
+		err := test.config.validate()
+		if (test.want == "") != (err == nil) || (err != nil && !strings.Contains(err.Error(), test.want)) {
+			t.Errorf("%s: got error %v, want one mentioning %q", test.name, err, test.want)
+		}
+	}
+}
+
+func TestAuthenticate(t *testing.T) {
+	tests := []struct {
+		name     string
+		config   AuthConfig
+		url      string
+		header   string
+		want     int
+		wantUser string
+	}{
+		{"auth off", AuthConfig{}, "/api/v1/stock", "", http.StatusOK, ""},
+		{"valid token", testAuth, "/api/v1/stock", "Bearer office-0123456789abcdef", http.StatusOK, "office"},
+		{"no token", testAuth, "/api/v1/stock", "", http.StatusUnauthorized, ""},
+		{"wrong token", testAuth, "/api/v1/stock", "Bearer pos-0123456789abcdeX", http.StatusUnauthorized, ""},
+		{"not bearer", testAuth, "/api/v1/stock", "Basic cG9zOnBvcw==", http.StatusUnauthorized, ""},
+		{"public path", testAuth, "/api/v1/openapi.yaml", "", http.StatusOK, ""},
+		{"events query token", testAuth, "/api/v1/events?access_token=pos-0123456789abcdef", "", http.StatusOK, "pos"},
+		{"query token elsewhere", testAuth, "/api/v1/stock?access_token=pos-0123456789abcdef", "", http.StatusUnauthorized, ""},
+	}
+	for _, test := range tests {
+		var user string
+		h := authenticate(test.config)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			user = userFrom(r.Context())
+		}))
+		r := httptest.NewRequest("GET", test.url, nil)
+		if test.header != "" {
+			r.Header.Set("Authorization", test.header)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		if w.Code != test.want || user != test.wantUser {
+			t.Errorf("%s: got %d as %q, want %d as %q", test.name, w.Code, user, test.want, test.wantUser)
+		}
+		if w.Code == http.StatusUnauthorized && w.Header().Get("WWW-Authenticate") == "" {
+			t.Errorf("%s: 401 without WWW-Authenticate", test.name)
+		}
+	}
+}
+
+// testHealthClient serves the gRPC health service in memory with options,
+// it needs no database behind the interceptors being tested
+func testHealthClient(t *testing.T, options ...grpc.ServerOption) healthpb.HealthClient {
+	t.Helper()
+	lis := bufconn.Listen(1 << 16)
+	srv := grpc.NewServer(options...)
+	healthpb.RegisterHealthServer(srv, health.NewServer())
+	go srv.Serve(lis)
+	t.Cleanup(srv.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return lis.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return healthpb.NewHealthClient(conn)
+}
+
+func TestGrpcAuth(t *testing.T) {
+	if opts := grpcAuth(AuthConfig{}); opts != nil {
+		t.Error("interceptors added with auth off")
+	}
+
+	client := testHealthClient(t, grpcAuth(testAuth)...)
+
+	tests := []struct {
+		name  string
+		token string
+		want  codes.Code
+	}{
+		{"valid token", "Bearer pos-0123456789abcdef", codes.OK},
+		{"no token", "", codes.Unauthenticated},
+		{"wrong token", "Bearer pos-0123456789abcdeX", codes.Unauthenticated},
+		{"not bearer", "pos-0123456789abcdef", codes.Unauthenticated},
+	}
+	for _, test := range tests {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		if test.token != "" {
+			ctx = metadata.AppendToOutgoingContext(ctx, "authorization", test.token)
+		}
+		_, err := client.Check(ctx, &healthpb.HealthCheckRequest{})
+		if status.Code(err) != test.want {
+			t.Errorf("%s unary: got %v, want %v", test.name, err, test.want)
+		}
+		// A STREAM'S STATUS ARRIVES WITH ITS FIRST MESSAGE
+		stream, err := client.Watch(ctx, &healthpb.HealthCheckRequest{})
+		if err == nil {
+			_, err = stream.Recv()
+		}
+		if status.Code(err) != test.want {
+			t.Errorf("%s stream: got %v, want %v", test.name, err, test.want)
+		}
+		cancel()
+	}
+}
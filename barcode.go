@@ -0,0 +1,330 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+type Barcode struct {
+	Barcode string `json:"barcode"`
+	StockID int    `json:"stockID"`
+	Type    string `json:"type"` // ean13, upc OR internal
+}
+
+// StockLookup is a stock item together with all of its barcodes
+type StockLookup struct {
+	FullStock
+	Barcodes []Barcode `json:"barcodes"`
+}
+
+const (
+	barcodeEAN13    = "ean13"
+	barcodeUPC      = "upc"
+	barcodeInternal = "internal"
+
+	createBarcodes = `
+	CREATE TABLE IF NOT EXISTS barcodes (
+		barcode varchar(64) NOT NULL,
+		stockID int NOT NULL,
+		type varchar(16) NOT NULL,
+		PRIMARY KEY (barcode),
+		FOREIGN KEY (stockID) REFERENCES stock(stockID));
+	`
+)
+
+var (
+	errBarcodeNotFound = errors.New("no stock item with that barcode")
+	errSKUInUse        = errors.New("sku is already in use")
+)
+
+// stockLookup serves GET /stock/lookup?barcode= (or ?sku=), the item with
+// its barcodes
+func stockLookup(w http.ResponseWriter, r *http.Request) {
+	stockID, ok := lookupStockID(w, r)
+	if !ok {
+		return
+	}
+	res, err := getStockLookup(stockID)
+	if err != nil {
+		logRequestError(r, err)
+		http.Error(w, "lookup failed", http.StatusInternalServerError)
+		return
+	}
+	json.NewEncoder(w).Encode(res)
+}
+
+// stockLookupSetLevel serves PATCH /stock/lookup?barcode= (or ?sku=) with
+// {"level": n}, setting the level the same way as /fullStock/ so scanners can
+// drive counts
+func stockLookupSetLevel(w http.ResponseWriter, r *http.Request) {
+	stockID, ok := lookupStockID(w, r)
+	if !ok {
+		return
+	}
+	var data FullStock
+	err := json.NewDecoder(r.Body).Decode(&data)
+	if err != nil {
+		http.Error(w, "invalid body", http.StatusBadRequest)
+		return
+	}
+	data.StockID = stockID
+	data.SiteID = siteFrom(r.Context())
+	data.Version, err = parseIfMatch(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	_, err = updateFullStockLevel(data)
+	if err != nil {
+		writeUpdateError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte("data updated sucesfuly"))
+}
+
+// lookupStockID finds the item named by ?barcode= or ?sku= at the request's
+// site, answering the request itself when there is none
+func lookupStockID(w http.ResponseWriter, r *http.Request) (stockID int, ok bool) {
+	barcode := r.URL.Query().Get("barcode")
+	sku := r.URL.Query().Get("sku")
+	if barcode == "" && sku == "" {
+		http.Error(w, "barcode or sku is required", http.StatusBadRequest)
+		return 0, false
+	}
+
+	stockID, err := findStockID(barcode, sku)
+	if err == nil {
+		var ok bool
+		ok, err = atSite(r.Context(), "stockID", stockID)
+		if err == nil && !ok {
+			err = errBarcodeNotFound
+		}
+	}
+	if err == errBarcodeNotFound {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return 0, false
+	}
+	if err != nil {
+		logRequestError(r, err)
+		http.Error(w, "lookup failed", http.StatusInternalServerError)
+		return 0, false
+	}
+	return stockID, true
+}
+
+// stockBarcodesList serves GET /stock/{id}/barcodes
+func stockBarcodesList(w http.ResponseWriter, r *http.Request) {
+	stockID, ok := pathID(w, r, "stockID")
+	if !ok {
+		return
+	}
+	res, err := getBarcodes(stockID)
+	if err != nil {
+		logRequestError(r, err)
+		http.Error(w, "could not load barcodes", http.StatusInternalServerError)
+		return
+	}
+	json.NewEncoder(w).Encode(res)
+}
+
+// stockBarcodesAdd serves POST /stock/{id}/barcodes
+func stockBarcodesAdd(w http.ResponseWriter, r *http.Request) {
+	stockID, ok := pathID(w, r, "stockID")
+	if !ok {
+		return
+	}
+	var data Barcode
+	err := json.NewDecoder(r.Body).Decode(&data)
+	if err != nil {
+		http.Error(w, "invalid body", http.StatusBadRequest)
+		return
+	}
+	data.StockID = stockID
+	err = validateBarcode(&data)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	err = addBarcode(data)
+	if isDuplicateKey(err) {
+		http.Error(w, "barcode is already in use", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		logRequestError(r, err)
+		http.Error(w, "could not add barcode", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte("data added sucesfuly"))
+}
+
+// stockBarcodesDelete serves DELETE /stock/{id}/barcodes/{code}
+func stockBarcodesDelete(w http.ResponseWriter, r *http.Request) {
+	stockID, ok := pathID(w, r, "stockID")
+	if !ok {
+		return
+	}
+	err := deleteBarcode(stockID, r.PathValue("barcode"))
+	if err == sql.ErrNoRows {
+		http.Error(w, "the item has no such barcode", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		logRequestError(r, err)
+		http.Error(w, "could not delete barcode", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte("data deleated sucesfuly"))
+}
+
+// validateBarcode normalises the type and checks the check digit of EAN-13
+// and UPC-A codes
+func validateBarcode(data *Barcode) error {
+	data.Barcode = strings.TrimSpace(data.Barcode)
+	data.Type = strings.ToLower(strings.TrimSpace(data.Type))
+	if data.Type == "" {
+		data.Type = barcodeInternal
+	}
+	if data.Barcode == "" {
+		return fmt.Errorf("barcode is required")
+	}
+
+	switch data.Type {
+	case barcodeEAN13:
+		if !validGTIN(data.Barcode, 13) {
+			return fmt.Errorf("%q is not a valid EAN-13", data.Barcode)
+		}
+	case barcodeUPC:
+		if !validGTIN(data.Barcode, 12) {
+			return fmt.Errorf("%q is not a valid UPC-A", data.Barcode)
+		}
+	case barcodeInternal:
+		if len(data.Barcode) > 64 {
+			return fmt.Errorf("barcode is longer than 64 characters")
+		}
+	default:
+		return fmt.Errorf("unknown barcode type %q", data.Type)
+	}
+	return nil
+}
+
+// validGTIN checks the length and mod 10 check digit shared by EAN and UPC
+func validGTIN(code string, length int) bool {
+	if len(code) != length {
+		return false
+	}
+	sum := 0
+	for i := 0; i < length-1; i++ {
+		digit := int(code[i] - '0')
+		if digit < 0 || digit > 9 {
+			return false
+		}
+		// WEIGHTS ALTERNATE 3,1 FROM THE DIGIT NEXT TO THE CHECK DIGIT
+		if (length-1-i)%2 == 1 {
+			sum += digit * 3
+		} else {
+			sum += digit
+		}
+	}
+	check := int(code[length-1] - '0')
+	return check >= 0 && check <= 9 && (10-sum%10)%10 == check
+}
+
+// isDuplicateKey reports whether err is a MySQL unique constraint violation
+func isDuplicateKey(err error) bool {
+	var mysqlErr *mysql.MySQLError
+	return errors.As(err, &mysqlErr) && mysqlErr.Number == 1062
+}
+
+// CREATE
+
+func addBarcode(data Barcode) (err error) {
+	_, err = db.Exec("INSERT INTO barcodes(barcode,stockID,type) VALUES (?,?,?)", data.Barcode, data.StockID, data.Type)
+	return err
+}
+
+// GET
+
+// findStockID finds the item with barcode, or with sku when barcode is "".
+// A scanned label is looked up as a barcode, then as a SKU, then as a code
+// /labels/ printed for an item without one.
+func findStockID(barcode string, sku string) (id int, err error) {
+	if barcode == "" {
+		err = db.QueryRow("SELECT stockID FROM stock WHERE sku=?", sku).Scan(&id)
+	} else {
+		err = db.QueryRow("SELECT stockID FROM barcodes WHERE barcode=?", barcode).Scan(&id)
+		if err == sql.ErrNoRows {
+			err = db.QueryRow("SELECT stockID FROM stock WHERE sku=?", barcode).Scan(&id)
+		}
+		if generated, ok := strings.CutPrefix(barcode, stockLabelPrefix); ok && err == sql.ErrNoRows {
+			if labelID, convErr := strconv.Atoi(generated); convErr == nil {
+				err = db.QueryRow("SELECT stockID FROM stock WHERE stockID=?", labelID).Scan(&id)
+			}
+		}
+	}
+	if err == sql.ErrNoRows {
+		return 0, errBarcodeNotFound
+	}
+	return id, err
+}
+func getBarcodes(stockID int) (res []Barcode, err error) {
+	res = []Barcode{}
+	rows, err := db.Query("SELECT barcode, stockID, type FROM barcodes WHERE stockID=? ORDER BY barcode", stockID)
+	if err != nil {
+		return res, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var data Barcode
+		err = rows.Scan(&data.Barcode, &data.StockID, &data.Type)
+		if err != nil {
+			return res, err
+		}
+		res = append(res, data)
+	}
+	return res, rows.Err()
+}
+func getStockLookup(stockID int) (res StockLookup, err error) {
+	found := false
+	err = eachFullStock(stockFilter{StockID: stockID}, func(data FullStock) error {
+		res.FullStock = data
+		found = true
+		return nil
+	})
+	if err != nil {
+		return res, err
+	}
+	if !found {
+		return res, errBarcodeNotFound
+	}
+	res.Barcodes, err = getBarcodes(stockID)
+	return res, err
+}
+
+// DELETE
+
+func deleteBarcode(stockID int, barcode string) (err error) {
+	res, err := db.Exec("DELETE FROM barcodes WHERE stockID=? AND barcode=?", stockID, barcode)
+	if err != nil {
+		return err
+	}
+	deleted, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if deleted == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+func TestValidGTIN(t *testing.T) {
+	tests := []struct {
+		code   string
+		length int
+		want   bool
+	}{
+		{"4006381333931", 13, true},
+		{"5901234123457", 13, true},
+		{"0000000000000", 13, true},
+		{"4006381333932", 13, false}, // WRONG CHECK DIGIT
+		{"400638133393", 13, false},  // TOO SHORT
+		{"40063813339311", 13, false},
+		{"40063813a3931", 13, false},
+		{"400638133393/", 13, false}, // CHECK DIGIT NOT A DIGIT
+		{"036000291452", 12, true},
+		{"042100005264", 12, true},
+		{"036000291453", 12, false},
+		{"4006381333931", 12, false}, // AN EAN-13 IS NOT A UPC-A
+		{"", 12, false},
+	}
+	for _, test := range tests {
+		if got := validGTIN(test.code, test.length); got != test.want {
+			t.Errorf("validGTIN(%q, %d) = %v, want %v", test.code, test.length, got, test.want)
+		}
+	}
+}
+
+func TestValidateBarcode(t *testing.T) {
+	tests := []struct {
+		barcode  string
+		typ      string
+		wantType string
+		wantErr  bool
+	}{
+		{" 4006381333931 ", "EAN13", barcodeEAN13, false},
+		{"4006381333932", "ean13", barcodeEAN13, true},
+		{"036000291452", "upc", barcodeUPC, false},
+		{"shelf-7", "", barcodeInternal, false},
+		{"", "internal", barcodeInternal, true},
+		{"x", "qr", "qr", true},
+	}
+	for _, test := range tests {
+		data := Barcode{Barcode: test.barcode, Type: test.typ}
+		err := validateBarcode(&data)
+		if (err != nil) != test.wantErr {
+			t.Errorf("validateBarcode(%q, %q) error = %v, want error %v", test.barcode, test.typ, err, test.wantErr)
+		}
+		if data.Type != test.wantType {
+			t.Errorf("validateBarcode(%q, %q) type = %q, want %q", test.barcode, test.typ, data.Type, test.wantType)
+		}
+	}
+}
+
+func TestIsDuplicateKey(t *testing.T) {
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{nil, false},
+		{&mysql.MySQLError{Number: 1062, Message: "Duplicate entry"}, true},
+		{fmt.Errorf("adding barcode: %w", &mysql.MySQLError{Number: 1062}), true},
+		{&mysql.MySQLError{Number: 1452, Message: "foreign key"}, false},
+		{errors.New("Duplicate entry"), false},
+	}
+	for _, test := range tests {
+		if got := isDuplicateKey(test.err); got != test.want {
+			t.Errorf("isDuplicateKey(%v) = %v, want %v", test.err, got, test.want)
+		}
+	}
+}
+
+func TestStockBarcodesDelete(t *testing.T) {
+	openTestDB(t)
+	stockID := testStock(t, 1)
+	code := testKey(t)
+	err := addBarcode(Barcode{Barcode: code, StockID: stockID, Type: barcodeInternal})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// THE SECOND DELETE FINDS NOTHING LEFT TO DELETE
+	for _, want := range []int{http.StatusOK, http.StatusNotFound} {
+		r := httptest.NewRequest("DELETE", fmt.Sprintf("/api/v1/stock/%d/barcodes/%s", stockID, code), nil)
+		r.SetPathValue("stockID", fmt.Sprint(stockID))
+		r.SetPathValue("barcode", code)
+		w := httptest.NewRecorder()
+		stockBarcodesDelete(w, r)
+		if w.Code != want {
+			t.Errorf("got %d %q, want %d", w.Code, w.Body.String(), want)
+		}
+	}
+}
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sort"
+)
+
+// BatchResult is the outcome of one level change in a batch
+type BatchResult struct {
+	StockID    int     `json:"stockID"`
+	Status     string  `json:"status"`
+	Level      float64 `json:"level"`
+	Differance float64 `json:"differance"`
+	LogID      int     `json:"logID,omitempty"`
+	Error      string  `json:"error,omitempty"`
+}
+
+const (
+	batchAtomic = "atomic"
+	batchEach   = "each"
+
+	// ok: applied. failed: not applied, see Error. skipped: not applied
+	// because another change in an atomic batch failed, so it rolled back
+	batchOK      = "ok"
+	batchFailed  = "failed"
+	batchSkipped = "skipped"
+
+	maxBatchSize = 500
+)
+
+// stockBatch serves POST /fullStock/batch with an array of
+// {"stockID", "level"} like PATCH /fullStock/, plus an optional "version".
+// By default the batch is all or nothing and any failure returns 409 with
+// the results. With ?mode=each every change is applied on its own and the
+// results say which failed.
+func stockBatch(w http.ResponseWriter, r *http.Request) {
+	mode := r.URL.Query().Get("mode")
+	if mode == "" {
+		mode = batchAtomic
+	}
+	if mode != batchAtomic && mode != batchEach {
+		http.Error(w, "mode must be atomic or each", http.StatusBadRequest)
+		return
+	}
+
+	var data []FullStock
+	err := json.NewDecoder(r.Body).Decode(&data)
+	if err != nil {
+		http.Error(w, "invalid body, expected an array of level changes", http.StatusBadRequest)
+		return
+	}
+	if len(data) == 0 || len(data) > maxBatchSize {
+		http.Error(w, fmt.Sprintf("a batch has 1 to %d changes", maxBatchSize), http.StatusBadRequest)
+		return
+	}
+	for i := range data {
+		// ITEMS AT ANOTHER SITE ARE NOT FOUND
+		data[i].SiteID = siteFrom(r.Context())
+	}
+
+	var res []BatchResult
+	var rolledBack bool
+	if mode == batchEach {
+		res = updateLevelsEach(r.Context(), data)
+	} else {
+		res, rolledBack, err = updateLevelsAtomic(data)
+	}
+	if err != nil {
+		logRequestError(r, err)
+		http.Error(w, "batch failed", http.StatusInternalServerError)
+		return
+	}
+
+	if rolledBack {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusConflict)
+	}
+	json.NewEncoder(w).Encode(res)
+}
+
+// updateLevelsAtomic applies every change in one transaction. If one fails
+// it is rolled back, that change is reported as failed and every other as
+// skipped. Only unexpected database errors are returned as err. Results are
+// in the order of data.
+func updateLevelsAtomic(data []FullStock) (res []BatchResult, rolledBack bool, err error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return res, false, err
+	}
+	defer tx.Rollback()
+
+	res = make([]BatchResult, len(data))
+	var alerts []*Alert
+	for _, i := range lockOrder(data) {
+		item := data[i]
+		change, alert, err := setStockLevel(tx, item)
+		if message := batchError(err); message != "" {
+			res = make([]BatchResult, len(data))
+			for j, skipped := range data {
+				res[j] = BatchResult{StockID: skipped.StockID, Status: batchSkipped}
+			}
+			res[i] = BatchResult{StockID: item.StockID, Status: batchFailed, Error: message}
+			return res, true, nil
+		}
+		if err != nil {
+			return res, false, err
+		}
+		alerts = append(alerts, alert)
+		res[i] = batchResult(change)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return res, false, err
+	}
+	for _, alert := range alerts {
+		notifyLowStock(alert)
+	}
+	return res, false, nil
+}
+
+// lockOrder returns the indexes of data by stockID, keeping the order of
+// changes to the same item. Rows are locked in stockID order so two batches
+// over the same items sent in different orders cannot deadlock.
+func lockOrder(data []FullStock) []int {
+	order := make([]int, len(data))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool {
+		return data[order[a]].StockID < data[order[b]].StockID
+	})
+	return order
+}
+
+// updateLevelsEach applies every change in its own transaction. A database
+// error fails only its own change, which is logged, so the results still say
+// which changes were applied.
+func updateLevelsEach(ctx context.Context, data []FullStock) (res []BatchResult) {
+	for _, item := range data {
+		change, alert, err := updateLevelOwnTx(item)
+		message := batchError(err)
+		if err != nil && message == "" {
+			slog.ErrorContext(ctx, "batch change failed", "stockID", item.StockID, "err", err)
+			message = "could not be applied, send it again"
+		}
+		if message != "" {
+			res = append(res, BatchResult{StockID: item.StockID, Status: batchFailed, Error: message})
+			continue
+		}
+		notifyLowStock(alert)
+		res = append(res, batchResult(change))
+	}
+	return res
+}
+
+// updateLevelOwnTx applies one change in a transaction of its own
+func updateLevelOwnTx(item FullStock) (change levelChange, alert *Alert, err error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return change, nil, err
+	}
+	defer tx.Rollback()
+	change, alert, err = setStockLevel(tx, item)
+	if err != nil {
+		return change, nil, err
+	}
+	return change, alert, tx.Commit()
+}
+
+func batchResult(change levelChange) BatchResult {
+	return BatchResult{StockID: change.StockID, Status: batchOK, Level: change.Level, Differance: change.Differance, LogID: change.LogID}
+}
+
+// batchError describes the errors caused by the change itself rather than
+// the database, "" for any other error
+func batchError(err error) string {
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		return "stock item not found"
+	case errors.Is(err, errVersionMismatch):
+		return "changed by someone else since it was read"
+	}
+	return ""
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestBatchError(t *testing.T) {
+	tests := []struct {
+		err  error
+		want string
+	}{
+		{nil, ""},
+		{sql.ErrNoRows, "stock item not found"},
+		{fmt.Errorf("stock 3: %w", errVersionMismatch), "changed by someone else since it was read"},
+		{errors.New("connection refused"), ""},
+	}
+	for _, test := range tests {
+		if got := batchError(test.err); got != test.want {
+			t.Errorf("batchError(%v) = %q, want %q", test.err, got, test.want)
+		}
+	}
+}
+
+func TestLockOrder(t *testing.T) {
+	tests := []struct {
+		stockIDs []int
+		want     []int
+	}{
+		{nil, []int{}},
+		{[]int{4}, []int{0}},
+		{[]int{1, 2, 3}, []int{0, 1, 2}},
+		{[]int{9, 2, 5}, []int{1, 2, 0}},
+		{[]int{5, 2, 5, 2}, []int{1, 3, 0, 2}}, // CHANGES TO ONE ITEM KEEP THEIR ORDER
+	}
+	for _, test := range tests {
+		data := make([]FullStock, len(test.stockIDs))
+		for i, id := range test.stockIDs {
+			data[i].StockID = id
+		}
+		if got := lockOrder(data); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("lockOrder(%v) = %v, want %v", test.stockIDs, got, test.want)
+		}
+	}
+}
+
+// sendBatch posts body to stockBatch with the query in url
+func sendBatch(url string, body string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	stockBatch(w, httptest.NewRequest("POST", url, strings.NewReader(body)))
+	return w
+}
+
+func TestStockBatchInvalid(t *testing.T) {
+	tests := []struct {
+		name string
+		url  string
+		body string
+	}{
+		{"unknown mode", "/fullStock/batch?mode=some", `[{"stockID":1,"level":2}]`},
+		{"not an array", "/fullStock/batch", `{"stockID":1,"level":2}`},
+		{"empty", "/fullStock/batch", `[]`},
+		{"too big", "/fullStock/batch?mode=each", "[" + strings.Repeat(`{"stockID":1,"level":2},`, maxBatchSize) + `{"stockID":1,"level":2}]`},
+	}
+	for _, test := range tests {
+		if w := sendBatch(test.url, test.body); w.Code != http.StatusBadRequest {
+			t.Errorf("%s: got %d %q, want 400", test.name, w.Code, w.Body.String())
+		}
+	}
+}
+
+func TestStockBatch(t *testing.T) {
+	openTestDB(t)
+
+	tests := []struct {
+		name       string
+		mode       string
+		missing    bool // A CHANGE TO AN ITEM THAT DOES NOT EXIST IS SENT SECOND
+		wantCode   int
+		wantStatus []string
+		wantLevels []float64
+	}{
+		{"atomic", "", false, http.StatusOK, []string{batchOK, batchOK, batchOK}, []float64{1, 2, 3}},
+		{"atomic rolls back", "atomic", true, http.StatusConflict, []string{batchSkipped, batchFailed, batchSkipped}, []float64{10, 10, 10}},
+		{"each", "each", false, http.StatusOK, []string{batchOK, batchOK, batchOK}, []float64{1, 2, 3}},
+		{"each applies the rest", "each", true, http.StatusOK, []string{batchOK, batchFailed, batchOK}, []float64{1, 10, 3}},
+	}
+	for _, test := range tests {
+		// SENT HIGHEST stockID FIRST, RESULTS MUST STILL BE IN REQUEST ORDER
+		ids := []int{testStock(t, 10), testStock(t, 10), testStock(t, 10)}
+		ids[0], ids[2] = ids[2], ids[0]
+		sent := append([]int{}, ids...)
+		if test.missing {
+			sent[1] = -1
+		}
+		var changes []string
+		for i, id := range sent {
+			changes = append(changes, fmt.Sprintf(`{"stockID":%d,"level":%d}`, id, i+1))
+		}
+
+		w := sendBatch("/fullStock/batch?mode="+test.mode, "["+strings.Join(changes, ",")+"]")
+		if w.Code != test.wantCode {
+			t.Errorf("%s: got %d, want %d", test.name, w.Code, test.wantCode)
+		}
+		var res []BatchResult
+		err := json.NewDecoder(w.Body).Decode(&res)
+		if err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+		if len(res) != len(sent) {
+			t.Fatalf("%s: got %d results for %d changes", test.name, len(res), len(sent))
+		}
+		for i := range res {
+			if res[i].StockID != sent[i] || res[i].Status != test.wantStatus[i] {
+				t.Errorf("%s: result %d is %+v, want %s for stock %d", test.name, i, res[i], test.wantStatus[i], sent[i])
+			}
+			if res[i].Status == batchOK && (res[i].LogID == 0 || res[i].Level != test.wantLevels[i]) {
+				t.Errorf("%s: result %d is %+v, want level %v with a logID", test.name, i, res[i], test.wantLevels[i])
+			}
+			if level := stockLevel(t, ids[i]); level != test.wantLevels[i] {
+				t.Errorf("%s: stock %d level is %v, want %v", test.name, ids[i], level, test.wantLevels[i])
+			}
+		}
+	}
+}
+
+func TestStockBatchVersion(t *testing.T) {
+	openTestDB(t)
+	stockID := testStock(t, 10)
+
+	body := fmt.Sprintf(`[{"stockID":%d,"level":4,"version":1},{"stockID":%d,"level":5,"version":1}]`, stockID, stockID)
+	w := sendBatch("/fullStock/batch?mode=each", body)
+	var res []BatchResult
+	err := json.NewDecoder(w.Body).Decode(&res)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// THE FIRST CHANGE BUMPS THE VERSION THE SECOND WAS READ AT
+	if len(res) != 2 || res[0].Status != batchOK || res[1].Status != batchFailed || !strings.Contains(res[1].Error, "someone else") {
+		t.Errorf("got %+v", res)
+	}
+	if level := stockLevel(t, stockID); level != 4 {
+		t.Errorf("stock level is %v, want 4", level)
+	}
+}
@@ -0,0 +1,511 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+type Category struct {
+	CategoryID   int         `json:"categoryID"`
+	CategoryName string      `json:"categoryName"`
+	ParentID     int         `json:"parentID"`           // 0 FOR A TOP LEVEL CATEGORY
+	Children     []*Category `json:"children,omitempty"` // ONLY FILLED FOR ?tree=true
+}
+type CategoryReport struct {
+	CategoryID    int     `json:"categoryID"` // 0 FOR UNCATEGORISED STOCK
+	CategoryName  string  `json:"categoryName"`
+	ParentID      int     `json:"parentID"`
+	Items         int     `json:"items"`
+	TotalLevel    float64 `json:"totalLevel"`
+	BelowIncident int     `json:"belowIncident"`
+	Movement      float64 `json:"movement"` // SUM OF LOG DIFFERANCES IN THE PERIOD
+}
+
+const (
+	createCategories = `
+	CREATE TABLE IF NOT EXISTS categories (
+		categoryID int NOT NULL AUTO_INCREMENT,
+		categoryName varchar(255) NOT NULL,
+		parentID int,
+		PRIMARY KEY (categoryID),
+		FOREIGN KEY (parentID) REFERENCES categories(categoryID));
+	`
+	createStockTags = `
+	CREATE TABLE IF NOT EXISTS stockTags (
+		stockID int NOT NULL,
+		tag varchar(64) NOT NULL,
+		PRIMARY KEY (stockID, tag),
+		INDEX (tag),
+		FOREIGN KEY (stockID) REFERENCES stock(stockID));
+	`
+)
+
+var (
+	errCategoryCycle          = errors.New("a category cannot be its own parent or a child of its own subcategory")
+	errCategoryParentNotFound = errors.New("no category with that parentID")
+)
+
+// categoriesList serves GET /categories/, nested into a tree with ?tree=true
+func categoriesList(w http.ResponseWriter, r *http.Request) {
+	res, err := getCategories()
+	if err != nil {
+		logRequestError(r, err)
+		http.Error(w, "could not load categories", http.StatusInternalServerError)
+		return
+	}
+	if r.URL.Query().Get("tree") == "true" {
+		json.NewEncoder(w).Encode(categoryTree(res))
+		return
+	}
+	json.NewEncoder(w).Encode(res)
+}
+func categoriesCreate(w http.ResponseWriter, r *http.Request) {
+	var data Category
+	err := json.NewDecoder(r.Body).Decode(&data)
+	if err != nil || strings.TrimSpace(data.CategoryName) == "" {
+		http.Error(w, "categoryName is required", http.StatusBadRequest)
+		return
+	}
+	err = addCategory(data)
+	if err == errCategoryParentNotFound {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if isDuplicateKey(err) {
+		http.Error(w, "already exists", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		internalError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte("data written sucesfuly"))
+}
+func categoriesUpdate(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(w, r, "categoryID")
+	if !ok {
+		return
+	}
+	var data Category
+	err := json.NewDecoder(r.Body).Decode(&data)
+	if err != nil || strings.TrimSpace(data.CategoryName) == "" {
+		http.Error(w, "categoryName is required", http.StatusBadRequest)
+		return
+	}
+	data.CategoryID = id
+	err = updateCategory(data)
+	if err == errCategoryCycle || err == errCategoryParentNotFound {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		logRequestError(r, err)
+		http.Error(w, "could not update category", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte("data updated sucesfully"))
+}
+func categoriesDelete(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(w, r, "categoryID")
+	if !ok {
+		return
+	}
+	err := deleteCategory(id)
+	if err != nil {
+		logRequestError(r, err)
+		http.Error(w, "could not delete category", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte("data deleated sucesfuly"))
+}
+
+// stockTagsList serves GET /stock/{id}/tags
+func stockTagsList(w http.ResponseWriter, r *http.Request) {
+	stockID, ok := pathID(w, r, "stockID")
+	if !ok {
+		return
+	}
+	res, err := getTags(stockID)
+	if err != nil {
+		logRequestError(r, err)
+		http.Error(w, "could not load tags", http.StatusInternalServerError)
+		return
+	}
+	json.NewEncoder(w).Encode(res)
+}
+
+// stockTagsSet serves PUT /stock/{id}/tags, replacing all tags with the JSON
+// array in the body
+func stockTagsSet(w http.ResponseWriter, r *http.Request) {
+	stockID, ok := pathID(w, r, "stockID")
+	if !ok {
+		return
+	}
+	var tags []string
+	err := json.NewDecoder(r.Body).Decode(&tags)
+	if err != nil {
+		http.Error(w, "expected a JSON array of tags", http.StatusBadRequest)
+		return
+	}
+	for i, tag := range tags {
+		tags[i] = normaliseTag(tag)
+		if tags[i] == "" || strings.Contains(tags[i], ",") || len(tags[i]) > 64 {
+			http.Error(w, fmt.Sprintf("invalid tag %q", tag), http.StatusBadRequest)
+			return
+		}
+	}
+	err = setTags(stockID, tags)
+	if err != nil {
+		logRequestError(r, err)
+		http.Error(w, "could not set tags", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte("data updated sucesfully"))
+}
+
+// categoryReport serves GET /reports/categories, stock totals per category
+// and log movement over the same ?from=, ?to= and ?month= as /logs/
+func categoryReport(w http.ResponseWriter, r *http.Request) {
+	filter, err := logFilterFromQuery(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	filter.SiteID = siteFrom(r.Context())
+	res, err := getCategoryReport(filter)
+	if err != nil {
+		logRequestError(r, err)
+		http.Error(w, "could not build report", http.StatusInternalServerError)
+		return
+	}
+
+	if format := exportFormat(r); format != formatJSON {
+		out, err := newRowWriter(w, format, "categories", []string{
+			"categoryID", "categoryName", "parentID", "items", "totalLevel", "belowIncident", "movement",
+		})
+		if err == nil {
+			for _, row := range res {
+				err = out.WriteRow([]any{row.CategoryID, row.CategoryName, row.ParentID, row.Items, row.TotalLevel, row.BelowIncident, row.Movement})
+				if err != nil {
+					break
+				}
+			}
+		}
+		if err == nil {
+			err = out.Close()
+		}
+		if err != nil {
+			logRequestError(r, err)
+		}
+		return
+	}
+	json.NewEncoder(w).Encode(res)
+}
+
+func normaliseTag(tag string) string {
+	return strings.ToLower(strings.TrimSpace(tag))
+}
+
+// categoryTree nests a flat list of categories under their parents
+func categoryTree(flat []Category) (roots []*Category) {
+	byID := map[int]*Category{}
+	for i := range flat {
+		byID[flat[i].CategoryID] = &flat[i]
+	}
+	roots = []*Category{}
+	for i := range flat {
+		category := &flat[i]
+		if parent, ok := byID[category.ParentID]; ok {
+			parent.Children = append(parent.Children, category)
+		} else {
+			roots = append(roots, category)
+		}
+	}
+	return roots
+}
+
+// categoryAndDescendants returns id and the ids of every category below it
+func categoryAndDescendants(id int) (res []int, err error) {
+	all, err := getCategories()
+	if err != nil {
+		return res, err
+	}
+	children := map[int][]int{}
+	for _, category := range all {
+		children[category.ParentID] = append(children[category.ParentID], category.CategoryID)
+	}
+	return descendants(children, id), nil
+}
+
+// descendants returns id and every category below it, from each category's
+// children
+func descendants(children map[int][]int, id int) []int {
+	res := []int{id}
+	for i := 0; i < len(res); i++ {
+		res = append(res, children[res[i]]...)
+	}
+	return res
+}
+
+// sqlIn builds "column IN (?,?,...)" and its arguments
+func sqlIn(column string, ids []int) (string, []any) {
+	args := make([]any, len(ids))
+	for i, id := range ids {
+		args[i] = id
+	}
+	return column + " IN (" + strings.TrimSuffix(strings.Repeat("?,", len(ids)), ",") + ")", args
+}
+
+func nullInt(i int) sql.NullInt64 {
+	return sql.NullInt64{Int64: int64(i), Valid: i != 0}
+}
+
+// CREATE
+
+func addCategory(data Category) (err error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if data.ParentID != 0 {
+		// LOCKED SO THE PARENT CANNOT BE DELETED BEFORE THE INSERT
+		var count int
+		err = tx.QueryRow("SELECT COUNT(*) FROM categories WHERE categoryID=? FOR SHARE", data.ParentID).Scan(&count)
+		if err != nil {
+			return err
+		}
+		if count == 0 {
+			return errCategoryParentNotFound
+		}
+	}
+	_, err = tx.Exec("INSERT INTO categories(categoryName,parentID) VALUES (?,?)", strings.TrimSpace(data.CategoryName), nullInt(data.ParentID))
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// GET
+
+func getCategories() (res []Category, err error) {
+	res = []Category{}
+	rows, err := db.Query("SELECT categoryID, categoryName, parentID FROM categories ORDER BY categoryName")
+	if err != nil {
+		return res, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var data Category
+		var parent sql.NullInt64
+		err = rows.Scan(&data.CategoryID, &data.CategoryName, &parent)
+		if err != nil {
+			return res, err
+		}
+		data.ParentID = int(parent.Int64)
+		res = append(res, data)
+	}
+	return res, rows.Err()
+}
+func getTags(stockID int) (res []string, err error) {
+	res = []string{}
+	rows, err := db.Query("SELECT tag FROM stockTags WHERE stockID=? ORDER BY tag", stockID)
+	if err != nil {
+		return res, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var tag string
+		err = rows.Scan(&tag)
+		if err != nil {
+			return res, err
+		}
+		res = append(res, tag)
+	}
+	return res, rows.Err()
+}
+func getCategoryReport(filter logFilter) (res []CategoryReport, err error) {
+	movementQuery := "SELECT stockID, SUM(differance) AS movement FROM logs WHERE 1=1"
+	var args []any
+	if !filter.From.IsZero() {
+		movementQuery += " AND incidentTime >= ?"
+		args = append(args, filter.From)
+	}
+	if !filter.To.IsZero() {
+		movementQuery += " AND incidentTime < ?"
+		args = append(args, filter.To)
+	}
+	movementQuery += " GROUP BY stockID"
+	where := ""
+	if filter.SiteID != allSites {
+		where = " WHERE stock.roomID IN (SELECT roomID FROM rooms WHERE siteID = ?)"
+		args = append(args, filter.SiteID)
+	}
+
+	rows, err := db.Query(`
+		SELECT
+		    COALESCE(categories.categoryID, 0),
+		    COALESCE(categories.categoryName, 'uncategorised'),
+		    COALESCE(categories.parentID, 0),
+		    COUNT(stock.stockID),
+		    COALESCE(SUM(stock.level), 0),
+		    COALESCE(SUM(stock.level < stock.incidentLevel), 0),
+		    COALESCE(SUM(movement.movement), 0)
+		FROM
+		    stock
+		LEFT JOIN
+		    categories ON stock.categoryID = categories.categoryID
+		LEFT JOIN
+		    (`+movementQuery+`) AS movement ON movement.stockID = stock.stockID`+where+`
+		GROUP BY
+		    categories.categoryID, categories.categoryName, categories.parentID`, args...)
+	if err != nil {
+		return res, err
+	}
+	defer rows.Close()
+
+	reported := map[int]bool{}
+	for rows.Next() {
+		var data CategoryReport
+		err = rows.Scan(&data.CategoryID, &data.CategoryName, &data.ParentID, &data.Items, &data.TotalLevel, &data.BelowIncident, &data.Movement)
+		if err != nil {
+			return res, err
+		}
+		reported[data.CategoryID] = true
+		res = append(res, data)
+	}
+	if err = rows.Err(); err != nil {
+		return res, err
+	}
+
+	// CATEGORIES WITHOUT STOCK STILL GET A ROW SO THE TREE IS COMPLETE
+	all, err := getCategories()
+	if err != nil {
+		return res, err
+	}
+	for _, category := range all {
+		if !reported[category.CategoryID] {
+			res = append(res, CategoryReport{CategoryID: category.CategoryID, CategoryName: category.CategoryName, ParentID: category.ParentID})
+		}
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].CategoryName < res[j].CategoryName })
+	return res, nil
+}
+
+// UPDATE
+
+// updateCategory renames and re-parents a category. Every category is
+// locked while the tree is checked, so two concurrent re-parents cannot
+// together make a cycle.
+func updateCategory(data Category) (err error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.Query("SELECT categoryID, parentID FROM categories FOR UPDATE")
+	if err != nil {
+		return err
+	}
+	children := map[int][]int{}
+	exists := map[int]bool{}
+	for rows.Next() {
+		var id int
+		var parent sql.NullInt64
+		err = rows.Scan(&id, &parent)
+		if err != nil {
+			rows.Close()
+			return err
+		}
+		children[int(parent.Int64)] = append(children[int(parent.Int64)], id)
+		exists[id] = true
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return err
+	}
+
+	if data.ParentID != 0 {
+		if !exists[data.ParentID] {
+			return errCategoryParentNotFound
+		}
+		if containsInt(descendants(children, data.CategoryID), data.ParentID) {
+			return errCategoryCycle
+		}
+	}
+	_, err = tx.Exec("UPDATE categories SET categoryName=?, parentID=? WHERE categoryID=?", strings.TrimSpace(data.CategoryName), nullInt(data.ParentID), data.CategoryID)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+func setTags(stockID int, tags []string) (err error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec("DELETE FROM stockTags WHERE stockID=?", stockID)
+	if err != nil {
+		return err
+	}
+	for _, tag := range tags {
+		_, err = tx.Exec("INSERT IGNORE INTO stockTags(stockID,tag) VALUES (?,?)", stockID, tag)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// DELETE
+
+// deleteCategory moves its subcategories up to its parent and leaves its
+// stock uncategorised
+func deleteCategory(id int) (err error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var parent sql.NullInt64
+	err = tx.QueryRow("SELECT parentID FROM categories WHERE categoryID=?", id).Scan(&parent)
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec("UPDATE categories SET parentID=? WHERE parentID=?", parent, id)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec("UPDATE stock SET categoryID=NULL, version=version+1 WHERE categoryID=?", id)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec("DELETE FROM alertChannels WHERE categoryID=?", id)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec("DELETE FROM categories WHERE categoryID=?", id)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
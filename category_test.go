@@ -0,0 +1,42 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func sendCategory(body string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	categoriesCreate(w, httptest.NewRequest("POST", "/api/v1/categories", strings.NewReader(body)))
+	return w
+}
+
+func TestCategoriesCreate(t *testing.T) {
+	openTestDB(t)
+	name := testKey(t)
+
+	tests := []struct {
+		name string
+		body string
+		want int
+	}{
+		{"no name", `{"categoryName":" "}`, http.StatusBadRequest},
+		{"top level", `{"categoryName":"` + name + `"}`, http.StatusOK},
+		{"unknown parent", `{"categoryName":"` + name + `","parentID":-1}`, http.StatusBadRequest},
+	}
+	for _, test := range tests {
+		if w := sendCategory(test.body); w.Code != test.want {
+			t.Errorf("%s: got %d %q, want %d", test.name, w.Code, w.Body.String(), test.want)
+		}
+	}
+}
+
+func TestCategoriesCreateDatabaseDown(t *testing.T) {
+	openDownDB(t)
+	w := sendCategory(`{"categoryName":"dry goods"}`)
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("got %d %q, want 500", w.Code, w.Body.String())
+	}
+}
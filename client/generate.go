@@ -0,0 +1,5 @@
+// Package client is a Go client for the inventory API, generated from
+// openapi.yaml at the root of the repository.
+package client
+
+//go:generate go run github.com/oapi-codegen/oapi-codegen/v2/cmd/oapi-codegen@v2.5.1 -config oapi-codegen.yaml ../openapi.yaml
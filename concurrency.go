@@ -0,0 +1,96 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// errVersionMismatch is returned by an update or delete when the row has
+// changed since the client read the version it sent in If-Match
+var errVersionMismatch = errors.New("version mismatch")
+
+// etag is the ETag header value for a row version
+func etag(version int) string {
+	return `"` + strconv.Itoa(version) + `"`
+}
+
+// writeETag sets the ETag header, and writes 304 returning true when the
+// client's If-None-Match shows it already has this version
+func writeETag(w http.ResponseWriter, r *http.Request, version int) bool {
+	tag := etag(version)
+	w.Header().Set("ETag", tag)
+	for _, match := range strings.Split(r.Header.Get("If-None-Match"), ",") {
+		match = strings.TrimPrefix(strings.TrimSpace(match), "W/")
+		if match == tag || match == "*" {
+			w.WriteHeader(http.StatusNotModified)
+			return true
+		}
+	}
+	return false
+}
+
+// parseIfMatch reads the version from the If-Match header, 0 for "*" or when
+// there is no header
+func parseIfMatch(r *http.Request) (version int, err error) {
+	value := strings.TrimSpace(r.Header.Get("If-Match"))
+	if value == "" || value == "*" {
+		return 0, nil
+	}
+	// WEAK TAGS NEVER MATCH AN If-Match
+	unquoted, err := strconv.Unquote(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid If-Match %s", value)
+	}
+	version, err = strconv.Atoi(unquoted)
+	if err != nil || version < 1 {
+		return 0, fmt.Errorf("invalid If-Match %s", value)
+	}
+	return version, nil
+}
+
+// requireIfMatch is parseIfMatch for PATCH and DELETE, which must say which
+// version they change. It writes 428 or 400 and returns false when they don't.
+func requireIfMatch(w http.ResponseWriter, r *http.Request) (version int, ok bool) {
+	if r.Header.Get("If-Match") == "" {
+		http.Error(w, "If-Match header with the ETag from a GET is required", http.StatusPreconditionRequired)
+		return 0, false
+	}
+	version, err := parseIfMatch(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return 0, false
+	}
+	return version, true
+}
+
+// checkVersion compares the version of a row locked with FOR UPDATE to the
+// one the client expects, where 0 matches any version
+func checkVersion(current int, expected int) error {
+	if expected != 0 && current != expected {
+		return errVersionMismatch
+	}
+	return nil
+}
+
+// writeUpdateError writes the response for a failed update or delete
+func writeUpdateError(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(err, errVersionMismatch):
+		http.Error(w, "changed by someone else since it was read, fetch it again", http.StatusPreconditionFailed)
+	case errors.Is(err, sql.ErrNoRows):
+		http.Error(w, "not found", http.StatusNotFound)
+	case errors.Is(err, errSKUInUse):
+		http.Error(w, err.Error(), http.StatusConflict)
+	case isDuplicateKey(err):
+		http.Error(w, "already exists", http.StatusConflict)
+	case errors.Is(err, errNotAtSite):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	default:
+		logRequestError(r, err)
+		http.Error(w, "update failed", http.StatusInternalServerError)
+	}
+}
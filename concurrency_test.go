@@ -0,0 +1,118 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+func TestWriteETag(t *testing.T) {
+	tests := []struct {
+		ifNoneMatch string
+		want        bool
+	}{
+		{"", false},
+		{`"3"`, true},
+		{`W/"3"`, true},
+		{`"2", "3"`, true},
+		{"*", true},
+		{`"4"`, false},
+		{`3`, false},
+	}
+	for _, test := range tests {
+		r := httptest.NewRequest("GET", "/stock/1", nil)
+		r.Header.Set("If-None-Match", test.ifNoneMatch)
+		w := httptest.NewRecorder()
+		got := writeETag(w, r, 3)
+		if got != test.want || (w.Code == http.StatusNotModified) != test.want {
+			t.Errorf("If-None-Match %s: got %v with %d, want %v", test.ifNoneMatch, got, w.Code, test.want)
+		}
+		if w.Header().Get("ETag") != `"3"` {
+			t.Errorf("If-None-Match %s: ETag = %s", test.ifNoneMatch, w.Header().Get("ETag"))
+		}
+	}
+}
+
+func TestRequireIfMatch(t *testing.T) {
+	tests := []struct {
+		ifMatch     string
+		wantVersion int
+		wantStatus  int // 0 WHEN ACCEPTED
+	}{
+		{`"5"`, 5, 0},
+		{` "12" `, 12, 0},
+		{"*", 0, 0},
+		{"", 0, http.StatusPreconditionRequired},
+		{`W/"5"`, 0, http.StatusBadRequest}, // WEAK TAGS NEVER MATCH
+		{"5", 0, http.StatusBadRequest},
+		{`"0"`, 0, http.StatusBadRequest},
+		{`"five"`, 0, http.StatusBadRequest},
+	}
+	for _, test := range tests {
+		r := httptest.NewRequest("PATCH", "/stock/1", nil)
+		if test.ifMatch != "" {
+			r.Header.Set("If-Match", test.ifMatch)
+		}
+		w := httptest.NewRecorder()
+		version, ok := requireIfMatch(w, r)
+		if ok != (test.wantStatus == 0) || version != test.wantVersion || (!ok && w.Code != test.wantStatus) {
+			t.Errorf("If-Match %q: got %d, %v with %d, want %d, %d", test.ifMatch, version, ok, w.Code, test.wantVersion, test.wantStatus)
+		}
+	}
+}
+
+func TestCheckVersion(t *testing.T) {
+	tests := []struct {
+		current, expected int
+		want              error
+	}{
+		{3, 3, nil},
+		{3, 0, nil},
+		{3, 2, errVersionMismatch},
+	}
+	for _, test := range tests {
+		if got := checkVersion(test.current, test.expected); got != test.want {
+			t.Errorf("checkVersion(%d, %d) = %v, want %v", test.current, test.expected, got, test.want)
+		}
+	}
+}
+
+func TestWriteUpdateError(t *testing.T) {
+	tests := []struct {
+		err  error
+		want int
+	}{
+		{errVersionMismatch, http.StatusPreconditionFailed},
+		{fmt.Errorf("room 3: %w", errVersionMismatch), http.StatusPreconditionFailed},
+		{sql.ErrNoRows, http.StatusNotFound},
+		{&mysql.MySQLError{Number: 1062}, http.StatusConflict},
+		{errors.New("connection refused"), http.StatusInternalServerError},
+	}
+	for _, test := range tests {
+		w := httptest.NewRecorder()
+		writeUpdateError(w, httptest.NewRequest("PATCH", "/api/v1/rooms/3", nil), test.err)
+		if w.Code != test.want {
+			t.Errorf("writeUpdateError(%v) wrote %d, want %d", test.err, w.Code, test.want)
+		}
+	}
+}
+
+func TestFullStockGetNoETag(t *testing.T) {
+	openTestDB(t)
+	stockID := testStock(t, 3)
+
+	// THE VERSION STAYS 1 WHILE THE JOINED ROOM NAME CHANGES, SO A 304 WOULD BE STALE
+	r := httptest.NewRequest("GET", fmt.Sprintf("/api/v1/fullStock/%d", stockID), nil)
+	r.SetPathValue("stockID", fmt.Sprint(stockID))
+	r.Header.Set("If-None-Match", `"1"`)
+	w := httptest.NewRecorder()
+	fullStockGet(w, r)
+	if w.Code != http.StatusOK || w.Header().Get("ETag") != "" {
+		t.Errorf("got %d with ETag %q, want 200 and none", w.Code, w.Header().Get("ETag"))
+	}
+}
@@ -0,0 +1,349 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v2"
+)
+
+// Config is everything the server can be configured with. Each value comes
+// from, highest first: a command line flag, an environment variable (also
+// read from .env), the config file, then the default.
+type Config struct {
+	Listen     string        `yaml:"listen" toml:"listen"`
+	GRPCListen string        `yaml:"grpcListen" toml:"grpcListen"`
+	TLS        TLSConfig     `yaml:"tls" toml:"tls"`
+	Server     ServerConfig  `yaml:"server" toml:"server"`
+	DB         DBConfig      `yaml:"db" toml:"db"`
+	SMTP       SMTPConfig    `yaml:"smtp" toml:"smtp"`
+	CORS       CORSConfig    `yaml:"cors" toml:"cors"`
+	Auth       AuthConfig    `yaml:"auth" toml:"auth"`
+	Log        LogConfig     `yaml:"log" toml:"log"`
+	Features   FeatureConfig `yaml:"features" toml:"features"`
+}
+
+// TLSConfig serves HTTPS and gRPC over TLS when both files are set
+type TLSConfig struct {
+	CertFile string `yaml:"certFile" toml:"certFile"`
+	KeyFile  string `yaml:"keyFile" toml:"keyFile"`
+}
+
+type DBConfig struct {
+	User            string        `yaml:"user" toml:"user"`
+	Password        string        `yaml:"password" toml:"password"`
+	Name            string        `yaml:"name" toml:"name"`
+	Endpoint        string        `yaml:"endpoint" toml:"endpoint"`               // HOST:PORT
+	MaxOpenConns    int           `yaml:"maxOpenConns" toml:"maxOpenConns"`       // 0 FOR NO LIMIT
+	MaxIdleConns    int           `yaml:"maxIdleConns" toml:"maxIdleConns"`       // KEPT OPEN WHEN IDLE
+	ConnMaxLifetime time.Duration `yaml:"connMaxLifetime" toml:"connMaxLifetime"` // 0 FOR FOREVER
+	ConnectTimeout  time.Duration `yaml:"connectTimeout" toml:"connectTimeout"`   // HOW LONG TO RETRY AT STARTUP, 0 FOR FOREVER
+}
+
+type LogConfig struct {
+	Level  string `yaml:"level" toml:"level"`   // debug, info, warn OR error
+	Format string `yaml:"format" toml:"format"` // json, OR text TO READ LOCALLY
+}
+
+// FeatureConfig turns optional parts of the server off
+type FeatureConfig struct {
+	GraphQL     bool `yaml:"graphql" toml:"graphql"`
+	GRPC        bool `yaml:"grpc" toml:"grpc"`
+	Webhooks    bool `yaml:"webhooks" toml:"webhooks"`       // DELIVERING, EVENTS ARE STILL RECORDED
+	LegacyPaths bool `yaml:"legacyPaths" toml:"legacyPaths"` // THE UNVERSIONED ALIASES OF /api/v1
+	Validation  bool `yaml:"validation" toml:"validation"`   // CHECKING REQUESTS AGAINST openapi.yaml
+}
+
+func defaultConfig() Config {
+	return Config{
+		Listen:     ":5000",
+		GRPCListen: grpcPort,
+		Server: ServerConfig{
+			ReadHeaderTimeout: 5 * time.Second,
+			ReadTimeout:       30 * time.Second,
+			WriteTimeout:      60 * time.Second,
+			IdleTimeout:       2 * time.Minute,
+			ShutdownTimeout:   30 * time.Second,
+		},
+		DB: DBConfig{
+			MaxOpenConns:    25,
+			MaxIdleConns:    5,
+			ConnMaxLifetime: 5 * time.Minute,
+			ConnectTimeout:  2 * time.Minute,
+		},
+		SMTP:     SMTPConfig{Port: "587"},
+		CORS:     defaultCORS,
+		Log:      LogConfig{Level: "info", Format: "json"},
+		Features: FeatureConfig{GraphQL: true, GRPC: true, Webhooks: true, LegacyPaths: true, Validation: true},
+	}
+}
+
+// setting is a value that can be set by an environment variable and a flag
+type setting struct {
+	flag  string
+	env   string
+	usage string
+	value setter
+}
+
+// setter parses a value into a config field
+type setter struct {
+	set     func(v string) error
+	boolean bool // A FLAG WITHOUT A VALUE MEANS TRUE
+}
+
+func (c *Config) settings() []setting {
+	return []setting{
+		{"config", "CONFIG_FILE", "config file, .yaml, .yml or .toml", stringVar(new(string))},
+		{"listen", "LISTEN_ADDR", "HTTP listen address", stringVar(&c.Listen)},
+		{"grpc-listen", "GRPC_LISTEN_ADDR", "gRPC listen address", stringVar(&c.GRPCListen)},
+		{"tls-cert", "TLS_CERT_FILE", "TLS certificate file", stringVar(&c.TLS.CertFile)},
+		{"tls-key", "TLS_KEY_FILE", "TLS key file", stringVar(&c.TLS.KeyFile)},
+		{"server-read-header-timeout", "SERVER_READ_HEADER_TIMEOUT", "how long a client may take to send the headers", durationVar(&c.Server.ReadHeaderTimeout)},
+		{"server-read-timeout", "SERVER_READ_TIMEOUT", "how long a client may take to send a request", durationVar(&c.Server.ReadTimeout)},
+		{"server-write-timeout", "SERVER_WRITE_TIMEOUT", "how long a response may take to write", durationVar(&c.Server.WriteTimeout)},
+		{"server-idle-timeout", "SERVER_IDLE_TIMEOUT", "how long an idle keep alive connection stays open", durationVar(&c.Server.IdleTimeout)},
+		{"server-shutdown-timeout", "SERVER_SHUTDOWN_TIMEOUT", "how long to wait for requests to finish when stopping", durationVar(&c.Server.ShutdownTimeout)},
+		{"db-user", "DB_USER", "database user", stringVar(&c.DB.User)},
+		{"db-password", "DB_PASSWORD", "database password", stringVar(&c.DB.Password)},
+		{"db-name", "DB_NAME", "database name", stringVar(&c.DB.Name)},
+		{"db-endpoint", "DB_ENDPOINT", "database host:port", stringVar(&c.DB.Endpoint)},
+		{"db-max-open-conns", "DB_MAX_OPEN_CONNS", "most open database connections, 0 for no limit", intVar(&c.DB.MaxOpenConns)},
+		{"db-max-idle-conns", "DB_MAX_IDLE_CONNS", "idle database connections kept open", intVar(&c.DB.MaxIdleConns)},
+		{"db-conn-max-lifetime", "DB_CONN_MAX_LIFETIME", "how long a database connection is reused, e.g. 5m", durationVar(&c.DB.ConnMaxLifetime)},
+		{"db-connect-timeout", "DB_CONNECT_TIMEOUT", "how long to retry connecting to the database at startup, 0 for forever", durationVar(&c.DB.ConnectTimeout)},
+		{"smtp-host", "SMTP_HOST", "SMTP server for email alerts", stringVar(&c.SMTP.Host)},
+		{"smtp-port", "SMTP_PORT", "SMTP port", stringVar(&c.SMTP.Port)},
+		{"smtp-user", "SMTP_USER", "SMTP user", stringVar(&c.SMTP.User)},
+		{"smtp-password", "SMTP_PASSWORD", "SMTP password", stringVar(&c.SMTP.Password)},
+		{"smtp-from", "SMTP_FROM", "From address of alert emails", stringVar(&c.SMTP.From)},
+		{"cors-allowed-origins", "CORS_ALLOWED_ORIGINS", "comma separated origins, * for any", listVar(&c.CORS.AllowedOrigins)},
+		{"cors-allowed-methods", "CORS_ALLOWED_METHODS", "comma separated methods", listVar(&c.CORS.AllowedMethods)},
+		{"cors-allowed-headers", "CORS_ALLOWED_HEADERS", "comma separated request headers", listVar(&c.CORS.AllowedHeaders)},
+		{"cors-exposed-headers", "CORS_EXPOSED_HEADERS", "comma separated response headers", listVar(&c.CORS.ExposedHeaders)},
+		{"cors-allow-credentials", "CORS_ALLOW_CREDENTIALS", "allow cookies and Authorization", boolVar(&c.CORS.AllowCredentials)},
+		{"auth", "AUTH_ENABLED", "require a token on every request", boolVar(&c.Auth.Enabled)},
+		{"auth-tokens", "AUTH_TOKENS", "comma separated user:token pairs, each optionally :1+2 for its sites or :* for head office, added to the file's users", authTokensVar(&c.Auth.Users)},
+		{"log-level", "LOG_LEVEL", "debug, info, warn or error", stringVar(&c.Log.Level)},
+		{"log-format", "LOG_FORMAT", "json or text", stringVar(&c.Log.Format)},
+		{"feature-graphql", "FEATURE_GRAPHQL", "serve /api/v1/graphql", boolVar(&c.Features.GraphQL)},
+		{"feature-grpc", "FEATURE_GRPC", "serve the gRPC API", boolVar(&c.Features.GRPC)},
+		{"feature-webhooks", "FEATURE_WEBHOOKS", "deliver webhooks", boolVar(&c.Features.Webhooks)},
+		{"feature-legacy-paths", "FEATURE_LEGACY_PATHS", "serve the unversioned paths", boolVar(&c.Features.LegacyPaths)},
+		{"feature-validation", "FEATURE_VALIDATION", "validate requests against openapi.yaml", boolVar(&c.Features.Validation)},
+	}
+}
+
+// loadConfig reads the config from the flags in args, the environment and
+// the config file, returning the arguments after the flags, e.g. a command.
+// It does not validate, so config print can show a config that is invalid.
+func loadConfig(args []string) (config Config, rest []string, err error) {
+	config = defaultConfig()
+	settings := config.settings()
+
+	// FLAGS ARE APPLIED LAST BUT PARSED FIRST, THEY MAY NAME THE FILE
+	fs := flag.NewFlagSet("inventory", flag.ContinueOnError)
+	flags := map[string]string{}
+	for _, s := range settings {
+		name := s.flag
+		record := func(v string) error {
+			flags[name] = v
+			return nil
+		}
+		if s.value.boolean {
+			fs.BoolFunc(name, s.usage+" ($"+s.env+")", record)
+		} else {
+			fs.Func(name, s.usage+" ($"+s.env+")", record)
+		}
+	}
+	err = fs.Parse(args)
+	if err != nil {
+		return config, nil, err
+	}
+
+	path, ok := flags["config"]
+	if !ok {
+		path = os.Getenv("CONFIG_FILE")
+	}
+	if path != "" {
+		err = config.readFile(path)
+		if err != nil {
+			return config, nil, err
+		}
+	}
+
+	for _, s := range settings {
+		if v, ok := os.LookupEnv(s.env); ok {
+			if err = s.value.set(v); err != nil {
+				return config, nil, fmt.Errorf("%s: %v", s.env, err)
+			}
+		}
+	}
+	for _, s := range settings {
+		if v, ok := flags[s.flag]; ok {
+			if err = s.value.set(v); err != nil {
+				return config, nil, fmt.Errorf("-%s: %v", s.flag, err)
+			}
+		}
+	}
+	return config, fs.Args(), nil
+}
+
+// readFile reads a YAML or TOML file over config, unknown keys are an error
+// so a misspelt setting is not silently ignored
+func (config *Config) readFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err = yaml.UnmarshalStrict(data, config)
+	case ".toml":
+		var meta toml.MetaData
+		meta, err = toml.NewDecoder(bytes.NewReader(data)).Decode(config)
+		if err == nil && len(meta.Undecoded()) > 0 {
+			err = fmt.Errorf("unknown setting %s", meta.Undecoded()[0])
+		}
+	default:
+		return fmt.Errorf("config file %s must be .yaml, .yml or .toml", path)
+	}
+	if err != nil {
+		return fmt.Errorf("%s: %v", path, err)
+	}
+	return nil
+}
+
+// validate checks the config at startup, returning every problem at once
+func (config Config) validate() error {
+	var errs []error
+	for name, addr := range map[string]string{"listen": config.Listen, "grpcListen": config.GRPCListen} {
+		if _, _, err := net.SplitHostPort(addr); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %q is not host:port or :port", name, addr))
+		}
+	}
+	if config.Features.GRPC && config.Listen == config.GRPCListen {
+		errs = append(errs, fmt.Errorf("grpcListen must differ from listen"))
+	}
+	if (config.TLS.CertFile == "") != (config.TLS.KeyFile == "") {
+		errs = append(errs, fmt.Errorf("tls: certFile and keyFile must be set together"))
+	}
+	for _, file := range []string{config.TLS.CertFile, config.TLS.KeyFile} {
+		if _, err := os.Stat(file); file != "" && err != nil {
+			errs = append(errs, fmt.Errorf("tls: %v", err))
+		}
+	}
+
+	if err := config.Server.validate(); err != nil {
+		errs = append(errs, err)
+	}
+
+	for name, v := range map[string]string{"user": config.DB.User, "name": config.DB.Name, "endpoint": config.DB.Endpoint} {
+		if v == "" {
+			errs = append(errs, fmt.Errorf("db.%s is required", name))
+		}
+	}
+	if config.DB.MaxOpenConns < 0 || config.DB.MaxIdleConns < 0 || config.DB.ConnMaxLifetime < 0 || config.DB.ConnectTimeout < 0 {
+		errs = append(errs, fmt.Errorf("db: pool settings and the connect timeout cannot be negative"))
+	}
+	if config.DB.MaxOpenConns > 0 && config.DB.MaxIdleConns > config.DB.MaxOpenConns {
+		errs = append(errs, fmt.Errorf("db.maxIdleConns cannot be more than db.maxOpenConns"))
+	}
+
+	if err := config.CORS.validate(); err != nil {
+		errs = append(errs, err)
+	}
+	if err := config.Auth.validate(); err != nil {
+		errs = append(errs, err)
+	}
+	if err := config.Log.validate(); err != nil {
+		errs = append(errs, err)
+	}
+	return errors.Join(errs...)
+}
+
+func (config LogConfig) level() (level slog.Level, err error) {
+	err = level.UnmarshalText([]byte(config.Level))
+	if err != nil {
+		return level, fmt.Errorf("log.level must be debug, info, warn or error, not %q", config.Level)
+	}
+	return level, nil
+}
+
+// redacted is config with its secrets hidden, for printing
+func (config Config) redacted() Config {
+	hide := func(s *string) {
+		if *s != "" {
+			*s = "REDACTED"
+		}
+	}
+	hide(&config.DB.Password)
+	hide(&config.SMTP.Password)
+	users := make([]AuthUser, len(config.Auth.Users))
+	for i, user := range config.Auth.Users {
+		hide(&user.Token)
+		users[i] = user
+	}
+	config.Auth.Users = users
+	return config
+}
+
+// configCommand runs config subcommands, e.g.
+//
+//	inventory -config prod.yaml config print
+func configCommand(config Config, args []string) error {
+	if len(args) != 1 || args[0] != "print" {
+		return fmt.Errorf("usage: [flags] config print")
+	}
+	out, err := yaml.Marshal(config.redacted())
+	if err != nil {
+		return err
+	}
+	os.Stdout.Write(out)
+	return config.validate()
+}
+
+func stringVar(p *string) setter {
+	return setter{set: func(v string) error {
+		*p = v
+		return nil
+	}}
+}
+
+func intVar(p *int) setter {
+	return setter{set: func(v string) (err error) {
+		*p, err = strconv.Atoi(v)
+		return err
+	}}
+}
+
+func boolVar(p *bool) setter {
+	return setter{boolean: true, set: func(v string) (err error) {
+		*p, err = strconv.ParseBool(v)
+		return err
+	}}
+}
+
+func durationVar(p *time.Duration) setter {
+	return setter{set: func(v string) (err error) {
+		*p, err = time.ParseDuration(v)
+		return err
+	}}
+}
+
+func listVar(p *[]string) setter {
+	return setter{set: func(v string) error {
+		*p = splitList(v)
+		return nil
+	}}
+}
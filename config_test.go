@@ -0,0 +1,213 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writeConfigFile writes body to a file called name in a temporary directory
+func writeConfigFile(t *testing.T, name string, body string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	err := os.WriteFile(path, []byte(body), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadConfigPrecedence(t *testing.T) {
+	path := writeConfigFile(t, "config.yaml", `
+listen: ":6000"
+grpcListen: ":6001"
+db:
+  user: file
+  name: file
+  maxOpenConns: 10
+  connMaxLifetime: 90s
+log:
+  level: warn
+`)
+	t.Setenv("CONFIG_FILE", path)
+	t.Setenv("DB_USER", "env")
+	t.Setenv("LOG_LEVEL", "debug")
+	t.Setenv("CORS_ALLOWED_ORIGINS", "https://a.example.com, https://b.example.com")
+
+	config, rest, err := loadConfig([]string{"-log-level", "error", "-auth", "config", "print"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name      string
+		got, want any
+	}{
+		{"default", config.Server.ReadTimeout, 30 * time.Second},
+		{"file", config.Listen, ":6000"},
+		{"file", config.DB.Name, "file"},
+		{"file", config.DB.MaxOpenConns, 10},
+		{"file", config.DB.ConnMaxLifetime, 90 * time.Second},
+		{"env over file", config.DB.User, "env"},
+		{"flag over env and file", config.Log.Level, "error"},
+		{"boolean flag without a value", config.Auth.Enabled, true},
+		{"list", config.CORS.AllowedOrigins, []string{"https://a.example.com", "https://b.example.com"}},
+		{"arguments after the flags", rest, []string{"config", "print"}},
+	}
+	for _, test := range tests {
+		if !reflect.DeepEqual(test.got, test.want) {
+			t.Errorf("%s: got %v, want %v", test.name, test.got, test.want)
+		}
+	}
+}
+
+func TestLoadConfigFlagNamesFile(t *testing.T) {
+	path := writeConfigFile(t, "config.toml", `
+listen = ":7000"
+
+[features]
+graphql = false
+`)
+	t.Setenv("CONFIG_FILE", "/does/not/exist.yaml")
+	config, _, err := loadConfig([]string{"-config", path})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.Listen != ":7000" || config.Features.GraphQL || !config.Features.GRPC {
+		t.Errorf("the file named by -config was not read over the defaults: %+v", config)
+	}
+}
+
+func TestLoadConfigInvalidValues(t *testing.T) {
+	tests := []struct {
+		name string
+		env  map[string]string
+		args []string
+		want string
+	}{
+		{"env int", map[string]string{"DB_MAX_OPEN_CONNS": "many"}, nil, "DB_MAX_OPEN_CONNS"},
+		{"flag duration", nil, []string{"-server-read-timeout", "30"}, "-server-read-timeout"},
+		{"flag bool", nil, []string{"-auth=maybe"}, "-auth"},
+		{"auth tokens", map[string]string{"AUTH_TOKENS": "pos"}, nil, "AUTH_TOKENS"},
+		{"cors credentials", map[string]string{"CORS_ALLOW_CREDENTIALS": "sometimes"}, nil, "CORS_ALLOW_CREDENTIALS"},
+		{"auth token sites", map[string]string{"AUTH_TOKENS": "pos:0123456789abcdef:1+x"}, nil, "invalid site"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			for k, v := range test.env {
+				t.Setenv(k, v)
+			}
+			_, _, err := loadConfig(test.args)
+			if err == nil || !strings.Contains(err.Error(), test.want) {
+				t.Errorf("got error %v, want one mentioning %q", err, test.want)
+			}
+		})
+	}
+}
+
+func TestReadFileStrict(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want string
+	}{
+		{"config.yaml", "listen: \":5000\"\nlisen: \":5001\"\n", "lisen"},
+		{"config.yml", "db:\n  maxOpenConnections: 5\n", "maxOpenConnections"},
+		{"config.toml", "listen = \":5000\"\n[db]\nusr = \"x\"\n", "db.usr"},
+		{"config.json", "{}", "must be .yaml, .yml or .toml"},
+		{"config.yaml", "listen: [", "config.yaml"},
+	}
+	for _, test := range tests {
+		config := defaultConfig()
+		err := config.readFile(writeConfigFile(t, test.name, test.body))
+		if err == nil || !strings.Contains(err.Error(), test.want) {
+			t.Errorf("%s %q: got error %v, want one mentioning %q", test.name, test.body, err, test.want)
+		}
+	}
+}
+
+func TestAuthTokensVar(t *testing.T) {
+	var users []AuthUser
+	err := authTokensVar(&users).set("pos:token-one, office:token-two:*, bar:token-three:2+3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []AuthUser{
+		{Name: "pos", Token: "token-one"},
+		{Name: "office", Token: "token-two", HeadOffice: true},
+		{Name: "bar", Token: "token-three", Sites: []int{2, 3}},
+	}
+	if !reflect.DeepEqual(users, want) {
+		t.Errorf("got %+v, want %+v", users, want)
+	}
+}
+
+func TestConfigValidate(t *testing.T) {
+	valid := func() Config {
+		config := defaultConfig()
+		config.DB = DBConfig{User: "u", Name: "n", Endpoint: "db:3306", MaxOpenConns: 5, MaxIdleConns: 2}
+		return config
+	}
+	if err := valid().validate(); err != nil {
+		t.Fatalf("a valid config was rejected: %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		change func(*Config)
+		want   string
+	}{
+		{"listen", func(c *Config) { c.Listen = "5000" }, "listen"},
+		{"same ports", func(c *Config) { c.GRPCListen = c.Listen }, "grpcListen must differ"},
+		{"tls pair", func(c *Config) { c.TLS.CertFile = "cert.pem" }, "set together"},
+		{"db required", func(c *Config) { c.DB.Endpoint = "" }, "db.endpoint is required"},
+		{"idle over open", func(c *Config) { c.DB.MaxIdleConns = 10 }, "maxIdleConns"},
+		{"negative pool", func(c *Config) { c.DB.ConnMaxLifetime = -time.Second }, "cannot be negative"},
+		{"negative timeout", func(c *Config) { c.Server.WriteTimeout = -time.Second }, "timeouts cannot be negative"},
+		{"auth without users", func(c *Config) { c.Auth.Enabled = true }, "without any users"},
+		{"short token", func(c *Config) { c.Auth.Users = []AuthUser{{Name: "pos", Token: "short"}} }, "at least"},
+		{"credentials for any origin", func(c *Config) { c.CORS.AllowCredentials = true }, "credentials"},
+		{"bad site", func(c *Config) {
+			c.Auth.Users = []AuthUser{{Name: "pos", Token: "0123456789abcdef", Sites: []int{0}}}
+		}, "invalid site"},
+		{"log level", func(c *Config) { c.Log.Level = "loud" }, "log.level"},
+		{"log format", func(c *Config) { c.Log.Format = "xml" }, "log.format"},
+	}
+	for _, test := range tests {
+		config := valid()
+		test.change(&config)
+		err := config.validate()
+		if err == nil || !strings.Contains(err.Error(), test.want) {
+			t.Errorf("%s: got error %v, want one mentioning %q", test.name, err, test.want)
+		}
+	}
+}
+
+func TestConfigValidateReportsEveryProblem(t *testing.T) {
+	config := defaultConfig()
+	config.Log.Level = "loud"
+	err := config.validate()
+	if err == nil {
+		t.Fatal("want errors")
+	}
+	for _, want := range []string{"db.user", "db.name", "db.endpoint", "log.level"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error is missing %s: %v", want, err)
+		}
+	}
+}
+
+func TestRedacted(t *testing.T) {
+	config := defaultConfig()
+	config.DB.Password = "secret"
+	config.Auth.Users = []AuthUser{{Name: "pos", Token: "0123456789abcdef"}}
+	redacted := config.redacted()
+	if redacted.DB.Password != "REDACTED" || redacted.Auth.Users[0].Token != "REDACTED" {
+		t.Errorf("secrets are not hidden: %+v", redacted)
+	}
+	if config.Auth.Users[0].Token != "0123456789abcdef" {
+		t.Error("redacted changed the config it was called on")
+	}
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CORSConfig says which browser origins may call the API and what they may
+// send and read
+type CORSConfig struct {
+	AllowedOrigins   []string      `yaml:"allowedOrigins" toml:"allowedOrigins"` // "*" FOR ANY ORIGIN
+	AllowedMethods   []string      `yaml:"allowedMethods" toml:"allowedMethods"`
+	AllowedHeaders   []string      `yaml:"allowedHeaders" toml:"allowedHeaders"`     // REQUEST HEADERS
+	ExposedHeaders   []string      `yaml:"exposedHeaders" toml:"exposedHeaders"`     // RESPONSE HEADERS SCRIPTS MAY READ
+	AllowCredentials bool          `yaml:"allowCredentials" toml:"allowCredentials"` // COOKIES AND AUTHORIZATION, NEEDS LISTED ORIGINS
+	MaxAge           time.Duration `yaml:"maxAge" toml:"maxAge"`
+}
+
+var defaultCORS = CORSConfig{
+	AllowedOrigins: []string{"*"},
+	AllowedMethods: []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
+	AllowedHeaders: []string{"Content-Type", "Authorization", "If-Match", "If-None-Match", "Idempotency-Key", "Last-Event-ID", "X-Request-ID", "X-Site-ID"},
+	ExposedHeaders: []string{"ETag", "X-Total-Count", "Deprecation", "Link", "X-Request-ID"},
+	MaxAge:         10 * time.Minute,
+}
+
+func (config CORSConfig) validate() error {
+	// ANY SITE COULD MAKE REQUESTS WITH THE USER'S COOKIES
+	if config.AllowCredentials && slices.Contains(config.AllowedOrigins, "*") {
+		return fmt.Errorf("cors: credentials can only be allowed for listed origins, not *")
+	}
+	for _, origin := range config.AllowedOrigins {
+		if origin != "*" && !strings.HasPrefix(origin, "http://") && !strings.HasPrefix(origin, "https://") {
+			return fmt.Errorf("cors: origin %q must start with http:// or https://", origin)
+		}
+	}
+	return nil
+}
+
+func (config CORSConfig) allowedOrigin(origin string) bool {
+	for _, allowed := range config.AllowedOrigins {
+		if allowed == "*" || strings.EqualFold(allowed, strings.TrimSuffix(origin, "/")) {
+			return true
+		}
+	}
+	return false
+}
+
+// cors sets the CORS headers on every response and answers every OPTIONS
+// request itself, so each route is covered the same way without registering
+// anything. A preflight from an origin that is not allowed gets 403, other
+// requests from one are served without the headers so browsers block them.
+func cors(config CORSConfig) middleware {
+	methods := strings.Join(config.AllowedMethods, ", ")
+	headers := strings.Join(config.AllowedHeaders, ", ")
+	exposed := strings.Join(config.ExposedHeaders, ", ")
+	maxAge := strconv.Itoa(int(config.MaxAge.Seconds()))
+	// THE ORIGIN IS ECHOED BACK UNLESS ANY ORIGIN MAY CALL WITHOUT CREDENTIALS
+	echoOrigin := config.AllowCredentials || !slices.Contains(config.AllowedOrigins, "*")
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			origin := r.Header.Get("Origin")
+			allowed := origin != "" && config.allowedOrigin(origin)
+			if echoOrigin {
+				w.Header().Add("Vary", "Origin")
+			}
+			if allowed {
+				if echoOrigin {
+					w.Header().Set("Access-Control-Allow-Origin", origin)
+				} else {
+					w.Header().Set("Access-Control-Allow-Origin", "*")
+				}
+				if config.AllowCredentials {
+					w.Header().Set("Access-Control-Allow-Credentials", "true")
+				}
+			}
+
+			if r.Method != http.MethodOptions {
+				if allowed && exposed != "" {
+					w.Header().Set("Access-Control-Expose-Headers", exposed)
+				}
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			if origin != "" && !allowed {
+				http.Error(w, "origin not allowed", http.StatusForbidden)
+				return
+			}
+			if allowed {
+				w.Header().Set("Access-Control-Allow-Methods", methods)
+				w.Header().Set("Access-Control-Allow-Headers", headers)
+				w.Header().Set("Access-Control-Max-Age", maxAge)
+			}
+			w.WriteHeader(http.StatusNoContent)
+		})
+	}
+}
+
+// splitList splits a comma separated list, dropping blanks
+func splitList(v string) (res []string) {
+	for _, item := range strings.Split(v, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			res = append(res, item)
+		}
+	}
+	return res
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestSplitList(t *testing.T) {
+	tests := []struct {
+		in   string
+		want []string
+	}{
+		{"", nil},
+		{"GET", []string{"GET"}},
+		{" GET, POST ,,PATCH ", []string{"GET", "POST", "PATCH"}},
+	}
+	for _, test := range tests {
+		if got := splitList(test.in); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("splitList(%q) = %q, want %q", test.in, got, test.want)
+		}
+	}
+}
+
+func TestCORSConfigValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  CORSConfig
+		wantErr bool
+	}{
+		{"default", defaultCORS, false},
+		{"listed origins with credentials", CORSConfig{AllowedOrigins: []string{"https://app.example.com"}, AllowCredentials: true}, false},
+		{"any origin with credentials", CORSConfig{AllowedOrigins: []string{"*"}, AllowCredentials: true}, true},
+		{"origin without scheme", CORSConfig{AllowedOrigins: []string{"app.example.com"}}, true},
+	}
+	for _, test := range tests {
+		if err := test.config.validate(); (err != nil) != test.wantErr {
+			t.Errorf("%s: got %v", test.name, err)
+		}
+	}
+}
+
+func TestAllowedOrigin(t *testing.T) {
+	config := CORSConfig{AllowedOrigins: []string{"https://app.example.com"}}
+	tests := []struct {
+		origin string
+		want   bool
+	}{
+		{"https://app.example.com", true},
+		{"https://APP.example.com/", true},
+		{"http://app.example.com", false},
+		{"https://evil.example.com", false},
+	}
+	for _, test := range tests {
+		if got := config.allowedOrigin(test.origin); got != test.want {
+			t.Errorf("allowedOrigin(%q) = %v, want %v", test.origin, got, test.want)
+		}
+	}
+	if !defaultCORS.allowedOrigin("https://anything.example.com") {
+		t.Error("* did not allow every origin")
+	}
+}
+
+func TestCORS(t *testing.T) {
+	listed := CORSConfig{
+		AllowedOrigins:   []string{"https://app.example.com"},
+		AllowedMethods:   []string{"GET", "PATCH"},
+		AllowedHeaders:   []string{"If-Match"},
+		ExposedHeaders:   []string{"ETag"},
+		AllowCredentials: true,
+	}
+	tests := []struct {
+		name        string
+		config      CORSConfig
+		method      string
+		origin      string
+		wantStatus  int
+		wantOrigin  string
+		wantMethods string
+		wantExposed string
+		wantServed  bool
+	}{
+		{"preflight, any origin", defaultCORS, "OPTIONS", "https://x.example.com", http.StatusNoContent, "*", "GET, POST, PUT, PATCH, DELETE, OPTIONS", "", false},
+		{"preflight, listed origin", listed, "OPTIONS", "https://app.example.com", http.StatusNoContent, "https://app.example.com", "GET, PATCH", "", false},
+		{"preflight, other origin", listed, "OPTIONS", "https://evil.example.com", http.StatusForbidden, "", "", "", false},
+		{"OPTIONS without origin", listed, "OPTIONS", "", http.StatusNoContent, "", "", "", false},
+		{"request, listed origin", listed, "GET", "https://app.example.com", http.StatusOK, "https://app.example.com", "", "ETag", true},
+		{"request, other origin", listed, "GET", "https://evil.example.com", http.StatusOK, "", "", "", true},
+		{"request without origin", defaultCORS, "GET", "", http.StatusOK, "", "", "", true},
+	}
+	for _, test := range tests {
+		served := false
+		h := cors(test.config)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			served = true
+		}))
+		r := httptest.NewRequest(test.method, "/api/v1/stock/5", nil)
+		if test.origin != "" {
+			r.Header.Set("Origin", test.origin)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+
+		if w.Code != test.wantStatus || served != test.wantServed {
+			t.Errorf("%s: got %d served %v, want %d served %v", test.name, w.Code, served, test.wantStatus, test.wantServed)
+		}
+		if got := w.Header().Get("Access-Control-Allow-Origin"); got != test.wantOrigin {
+			t.Errorf("%s: Access-Control-Allow-Origin %q, want %q", test.name, got, test.wantOrigin)
+		}
+		if got := w.Header().Get("Access-Control-Allow-Methods"); got != test.wantMethods {
+			t.Errorf("%s: Access-Control-Allow-Methods %q, want %q", test.name, got, test.wantMethods)
+		}
+		if got := w.Header().Get("Access-Control-Expose-Headers"); got != test.wantExposed {
+			t.Errorf("%s: Access-Control-Expose-Headers %q, want %q", test.name, got, test.wantExposed)
+		}
+	}
+
+	// AN ECHOED ORIGIN MUST NOT BE CACHED FOR ANOTHER ONE
+	w := httptest.NewRecorder()
+	cors(listed)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})).ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+	if w.Header().Get("Vary") != "Origin" {
+		t.Error("no Vary: Origin when the origin is echoed")
+	}
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"html/template"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jung-kurt/gofpdf"
+)
+
+type countSheet struct {
+	RoomID   int
+	RoomName string
+	Printed  time.Time
+	Items    []FullStock
+}
+
+var countSheetHTML = template.Must(template.New("countSheet").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Count sheet - {{.RoomName}}</title>
+<style>
+	body { font-family: sans-serif; margin: 2em; }
+	table { width: 100%; border-collapse: collapse; }
+	th, td { border: 1px solid #000; padding: 0.4em; text-align: left; }
+	td.number { text-align: right; }
+	td.counted { width: 20%; }
+	@media print { body { margin: 0; } tr { page-break-inside: avoid; } }
+</style>
+</head>
+<body>
+<h1>Count sheet: {{.RoomName}}</h1>
+<p>Printed {{.Printed.Format "2006-01-02 15:04"}} &middot; Counted by ____________________</p>
+<table>
+<thead><tr><th>Item</th><th>Unit</th><th>Expected</th><th>Counted</th></tr></thead>
+<tbody>
+{{range .Items}}<tr><td>{{.ItemName}}</td><td>{{.Unit}}</td><td class="number">{{.Level}}</td><td class="counted"></td></tr>
+{{end}}</tbody>
+</table>
+</body>
+</html>
+`))
+
+// roomCountSheet serves GET /rooms/{id}/countSheet as a PDF, or as an HTML
+// print view with ?format=html or Accept: text/html. Items are ordered by
+// their shelfOrder, or by name with ?sort=name.
+func roomCountSheet(w http.ResponseWriter, r *http.Request) {
+	roomID, ok := pathID(w, r, "roomID")
+	if !ok {
+		return
+	}
+
+	roomName, err := getRoomName(roomID)
+	if err == sql.ErrNoRows {
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		logRequestError(r, err)
+		http.Error(w, "could not load room", http.StatusInternalServerError)
+		return
+	}
+
+	filter := stockFilter{RoomID: roomID, OrderBy: "stock.shelfOrder, stock.itemName"}
+	if r.URL.Query().Get("sort") == "name" {
+		filter.OrderBy = "stock.itemName"
+	}
+	sheet := countSheet{RoomID: roomID, RoomName: roomName, Printed: time.Now()}
+	err = eachFullStock(filter, func(data FullStock) error {
+		sheet.Items = append(sheet.Items, data)
+		return nil
+	})
+	if err != nil {
+		logRequestError(r, err)
+		http.Error(w, "could not load stock", http.StatusInternalServerError)
+		return
+	}
+
+	format := r.URL.Query().Get("format")
+	if format == "" && strings.Contains(r.Header.Get("Accept"), "text/html") {
+		format = "html"
+	}
+	if format == "html" {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		err = countSheetHTML.Execute(w, sheet)
+	} else {
+		w.Header().Set("Content-Type", "application/pdf")
+		w.Header().Set("Content-Disposition", fmt.Sprintf("inline; filename=\"countsheet-room%d.pdf\"", roomID))
+		err = writeCountSheetPDF(w, sheet)
+	}
+	if err != nil {
+		logRequestError(r, err)
+	}
+}
+
+func writeCountSheetPDF(w http.ResponseWriter, sheet countSheet) error {
+	pdf := gofpdf.New("P", "mm", "A4", "")
+	tr := pdf.UnicodeTranslatorFromDescriptor("")
+	widths := []float64{95, 25, 30, 40}
+	header := []string{"Item", "Unit", "Expected", "Counted"}
+
+	tableHeader := func() {
+		pdf.SetFont("Helvetica", "B", 11)
+		for i, column := range header {
+			pdf.CellFormat(widths[i], 8, column, "1", 0, "L", false, 0, "")
+		}
+		pdf.Ln(-1)
+		pdf.SetFont("Helvetica", "", 11)
+	}
+	pdf.SetHeaderFunc(func() {
+		if pdf.PageNo() > 1 {
+			tableHeader()
+		}
+	})
+
+	pdf.AddPage()
+	pdf.SetFont("Helvetica", "B", 16)
+	pdf.CellFormat(0, 10, tr("Count sheet: "+sheet.RoomName), "", 1, "L", false, 0, "")
+	pdf.SetFont("Helvetica", "", 10)
+	pdf.CellFormat(0, 8, "Printed "+sheet.Printed.Format("2006-01-02 15:04")+"    Counted by ____________________", "", 1, "L", false, 0, "")
+	pdf.Ln(2)
+	tableHeader()
+
+	for _, item := range sheet.Items {
+		pdf.CellFormat(widths[0], 9, tr(item.ItemName), "1", 0, "L", false, 0, "")
+		pdf.CellFormat(widths[1], 9, tr(item.Unit), "1", 0, "L", false, 0, "")
+		pdf.CellFormat(widths[2], 9, strconv.FormatFloat(item.Level, 'f', -1, 64), "1", 0, "R", false, 0, "")
+		pdf.CellFormat(widths[3], 9, "", "1", 1, "L", false, 0, "")
+	}
+
+	return pdf.Output(w)
+}
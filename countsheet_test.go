@@ -0,0 +1,63 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCountSheetHTML(t *testing.T) {
+	sheet := countSheet{
+		RoomName: "Bar & cellar",
+		Printed:  time.Date(2026, 9, 1, 8, 30, 0, 0, time.UTC),
+		Items:    []FullStock{{ItemName: "<b>Lager</b>", Unit: "keg", Level: 2.5}, {ItemName: "Cider", Unit: "case", Level: 4}},
+	}
+	var buf bytes.Buffer
+	err := countSheetHTML.Execute(&buf, sheet)
+	if err != nil {
+		t.Fatal(err)
+	}
+	page := buf.String()
+	for _, want := range []string{
+		"Count sheet: Bar &amp; cellar",
+		"Printed 2026-09-01 08:30",
+		`<tr><td>&lt;b&gt;Lager&lt;/b&gt;</td><td>keg</td><td class="number">2.5</td>`,
+		`<tr><td>Cider</td><td>case</td><td class="number">4</td>`,
+	} {
+		if !strings.Contains(page, want) {
+			t.Errorf("count sheet is missing %s:\n%s", want, page)
+		}
+	}
+}
+
+func TestCountSheetPDF(t *testing.T) {
+	tests := []struct {
+		items     int
+		wantPages int
+	}{
+		{0, 1},
+		{10, 1},
+		{40, 2}, // THE TABLE CARRIES ON WITH ITS HEADER ON A NEW PAGE
+	}
+	for _, test := range tests {
+		sheet := countSheet{RoomName: "Kühlraum", Printed: time.Now()}
+		for i := 0; i < test.items; i++ {
+			sheet.Items = append(sheet.Items, FullStock{ItemName: fmt.Sprintf("item %d", i), Unit: "each", Level: float64(i)})
+		}
+		w := httptest.NewRecorder()
+		err := writeCountSheetPDF(w, sheet)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body := w.Body.String()
+		if !strings.HasPrefix(body, "%PDF-") {
+			t.Fatalf("%d items: not a PDF: %.20q", test.items, body)
+		}
+		if pages := strings.Count(body, "/Type /Page\n"); pages != test.wantPages {
+			t.Errorf("%d items: got %d pages, want %d", test.items, pages, test.wantPages)
+		}
+	}
+}
@@ -0,0 +1,273 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// HOW LONG A MISSING EVENT ID IS WAITED FOR BEFORE IT IS TREATED AS A
+	// ROLLED BACK TRANSACTION, IDS ARE TAKEN BEFORE COMMIT SO CAN ARRIVE LATE
+	eventGapTimeout   = 5 * time.Second
+	eventHeartbeat    = 15 * time.Second
+	subscriberBacklog = 64
+)
+
+// eventHub fans outbox events out to the open /events streams
+type eventHub struct {
+	mu          sync.Mutex
+	subscribers map[chan Event]bool
+	closed      bool // SHUTTING DOWN, NO NEW STREAMS
+}
+
+var hub = &eventHub{subscribers: map[chan Event]bool{}}
+
+func (h *eventHub) subscribe() chan Event {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	ch := make(chan Event, subscriberBacklog)
+	if h.closed {
+		close(ch)
+		return ch
+	}
+	h.subscribers[ch] = true
+	return ch
+}
+
+func (h *eventHub) unsubscribe(ch chan Event) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.subscribers[ch] {
+		delete(h.subscribers, ch)
+		close(ch)
+	}
+}
+
+// close ends every stream, for shutting down
+func (h *eventHub) close() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.closed = true
+	for ch := range h.subscribers {
+		delete(h.subscribers, ch)
+		close(ch)
+	}
+}
+
+// publish never blocks, a subscriber too slow to keep up is closed and has
+// to reconnect with Last-Event-ID to catch up
+func (h *eventHub) publish(event Event) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for ch := range h.subscribers {
+		select {
+		case ch <- event:
+		default:
+			delete(h.subscribers, ch)
+			close(ch)
+		}
+	}
+}
+
+// startEventStream polls the outbox every interval and publishes new events
+// to the hub. Events are read by ID, so every instance sees every commit.
+func startEventStream(ctx context.Context, interval time.Duration) {
+	cursor := -1
+	seen := map[int]bool{}
+	var gapSince time.Time
+	every(ctx, interval, func() {
+		var err error
+		if cursor < 0 {
+			// ONLY NEW EVENTS ARE LIVE, OLDER ONES ARE SERVED BY CATCH UP
+			err = db.QueryRow("SELECT COALESCE(MAX(eventID), 0) FROM outbox").Scan(&cursor)
+		} else {
+			err = eachEventSince(cursor, func(event Event) error {
+				if !seen[event.EventID] {
+					seen[event.EventID] = true
+					hub.publish(event)
+				}
+				return nil
+			})
+			cursor, gapSince = advanceCursor(cursor, seen, gapSince)
+		}
+		if err != nil {
+			slog.Error("events", "err", err)
+		}
+	})
+}
+
+// advanceCursor moves cursor past the contiguous events already published,
+// skipping a gap once it has been open for eventGapTimeout
+func advanceCursor(cursor int, seen map[int]bool, gapSince time.Time) (int, time.Time) {
+	for len(seen) > 0 {
+		if seen[cursor+1] {
+			delete(seen, cursor+1)
+			cursor++
+			gapSince = time.Time{}
+			continue
+		}
+		if gapSince.IsZero() {
+			gapSince = time.Now()
+		}
+		if time.Since(gapSince) < eventGapTimeout {
+			break
+		}
+		cursor++
+	}
+	return cursor, gapSince
+}
+
+// eventFilter is an /events subscription, nil Rooms or Types means all and
+// Site is allSites for every site
+type eventFilter struct {
+	Site  int
+	Rooms []int
+	Types []string
+}
+
+func (filter eventFilter) match(event Event) bool {
+	if len(filter.Types) > 0 && !(Webhook{Events: filter.Types}).subscribed(event.Type) {
+		return false
+	}
+	// EVENTS WITHOUT A SITE ONLY GO TO HEAD OFFICE READING EVERY SITE
+	if filter.Site != allSites && event.SiteID != filter.Site {
+		return false
+	}
+	return filter.Rooms == nil || event.RoomID == 0 || containsInt(filter.Rooms, event.RoomID)
+}
+
+// events serves GET /events as a server-sent event stream of inventory
+// changes as they commit. ?rooms=1,2 limits it to those rooms and ?types=
+// to some event types (stock.* style wildcards work). A reconnecting client
+// sends Last-Event-ID, or ?lastEventID=, and first receives what it missed.
+func events(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming not supported", http.StatusInternalServerError)
+		return
+	}
+	// THE STREAM STAYS OPEN, THE SERVER'S WRITE TIMEOUT WOULD CUT IT OFF
+	err := http.NewResponseController(w).SetWriteDeadline(time.Time{})
+	if err != nil {
+		slog.ErrorContext(r.Context(), "events", "err", err)
+	}
+
+	q := r.URL.Query()
+	filter := eventFilter{Site: siteFrom(r.Context())}
+	if v := q.Get("rooms"); v != "" {
+		rooms, err := parseIDList(v)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		filter.Rooms = rooms
+	}
+	if v := q.Get("types"); v != "" {
+		filter.Types = strings.Split(v, ",")
+	}
+	lastID := -1
+	if v := r.Header.Get("Last-Event-ID"); v != "" {
+		q.Set("lastEventID", v)
+	}
+	if v := q.Get("lastEventID"); v != "" {
+		id, err := strconv.Atoi(v)
+		if err != nil || id < 0 {
+			http.Error(w, "invalid last event id", http.StatusBadRequest)
+			return
+		}
+		lastID = id
+	}
+
+	// SUBSCRIBE BEFORE CATCHING UP SO NOTHING COMMITTED MEANWHILE IS MISSED
+	ch := hub.subscribe()
+	defer hub.unsubscribe(ch)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprint(w, "retry: 3000\n\n")
+
+	caughtUp := map[int]bool{}
+	if lastID >= 0 {
+		err := eachEventSince(lastID, func(event Event) error {
+			caughtUp[event.EventID] = true
+			if !filter.match(event) {
+				return nil
+			}
+			return writeEvent(w, event)
+		})
+		if err != nil {
+			slog.ErrorContext(r.Context(), "events", "err", err)
+			return
+		}
+	}
+	flusher.Flush()
+
+	heartbeat := time.NewTicker(eventHeartbeat)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-heartbeat.C:
+			fmt.Fprint(w, ": heartbeat\n\n")
+		case event, ok := <-ch:
+			if !ok {
+				return
+			}
+			if caughtUp[event.EventID] || !filter.match(event) {
+				continue
+			}
+			err := writeEvent(w, event)
+			if err != nil {
+				return
+			}
+		}
+		flusher.Flush()
+	}
+}
+
+func writeEvent(w http.ResponseWriter, event Event) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", event.EventID, event.Type, data)
+	return err
+}
+
+// eachEventSince calls fn for each outbox event after id, in ID order
+func eachEventSince(id int, fn func(Event) error) (err error) {
+	rows, err := db.Query("SELECT eventID, type, roomID, siteID, payload, createdAt FROM outbox WHERE eventID > ? ORDER BY eventID", id)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var event Event
+		var roomID, siteID sql.NullInt64
+		var payload []byte
+		err = rows.Scan(&event.EventID, &event.Type, &roomID, &siteID, &payload, &event.CreatedAt)
+		if err != nil {
+			return err
+		}
+		event.RoomID = int(roomID.Int64)
+		event.SiteID = int(siteID.Int64)
+		event.Data = payload
+		err = fn(event)
+		if err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
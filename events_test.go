@@ -0,0 +1,133 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestAdvanceCursor(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		name         string
+		cursor       int
+		seen         []int
+		gapSince     time.Time
+		wantCursor   int
+		wantSeen     int
+		wantGapStart bool
+	}{
+		{"nothing new", 5, nil, time.Time{}, 5, 0, false},
+		{"contiguous", 5, []int{6, 7, 8}, time.Time{}, 8, 0, false},
+		{"gap opens", 5, []int{6, 8}, time.Time{}, 6, 1, true},
+		{"gap still waited for", 5, []int{7}, now.Add(-eventGapTimeout / 2), 5, 1, true},
+		{"gap filled late", 5, []int{6, 7}, now.Add(-eventGapTimeout / 2), 7, 0, false},
+		{"gap given up", 5, []int{7, 8}, now.Add(-eventGapTimeout - time.Second), 8, 0, false},
+	}
+	for _, test := range tests {
+		seen := map[int]bool{}
+		for _, id := range test.seen {
+			seen[id] = true
+		}
+		cursor, gapSince := advanceCursor(test.cursor, seen, test.gapSince)
+		if cursor != test.wantCursor || len(seen) != test.wantSeen || gapSince.IsZero() == test.wantGapStart {
+			t.Errorf("%s: got cursor %d with %d seen, gap since %v", test.name, cursor, len(seen), gapSince)
+		}
+	}
+}
+
+func TestEventHub(t *testing.T) {
+	h := &eventHub{subscribers: map[chan Event]bool{}}
+	fast := h.subscribe()
+	slow := h.subscribe()
+
+	for i := 1; i <= subscriberBacklog+1; i++ {
+		h.publish(Event{EventID: i})
+		if i <= subscriberBacklog {
+			if event := <-fast; event.EventID != i {
+				t.Fatalf("got event %d, want %d", event.EventID, i)
+			}
+		}
+	}
+	// THE SLOW SUBSCRIBER GOT A FULL BACKLOG, THEN WAS CLOSED RATHER THAN BLOCK
+	count := 0
+	for range slow {
+		count++
+	}
+	if count != subscriberBacklog {
+		t.Errorf("slow subscriber got %d events before closing, want %d", count, subscriberBacklog)
+	}
+	if event, ok := <-fast; !ok || event.EventID != subscriberBacklog+1 {
+		t.Errorf("fast subscriber got %v, %v", event, ok)
+	}
+
+	h.unsubscribe(fast)
+	h.unsubscribe(fast) // ALREADY CLOSED, MUST NOT PANIC
+	h.unsubscribe(slow)
+	if _, ok := <-fast; ok {
+		t.Error("unsubscribe did not close the channel")
+	}
+}
+
+func TestEventFilterMatch(t *testing.T) {
+	tests := []struct {
+		filter eventFilter
+		event  Event
+		want   bool
+	}{
+		{eventFilter{}, Event{Type: eventStockCreated, RoomID: 3}, true},
+		{eventFilter{Rooms: []int{3, 4}}, Event{Type: eventStockCreated, RoomID: 4}, true},
+		{eventFilter{Rooms: []int{3, 4}}, Event{Type: eventStockCreated, RoomID: 5}, false},
+		{eventFilter{Rooms: []int{3}}, Event{Type: "supplier.updated"}, true}, // NOT ABOUT A ROOM
+		{eventFilter{Types: []string{"stock.*"}}, Event{Type: eventStockLevelChanged, RoomID: 3}, true},
+		{eventFilter{Types: []string{"stock.*"}}, Event{Type: eventRoomCreated, RoomID: 3}, false},
+		{eventFilter{Rooms: []int{3}, Types: []string{eventRoomDeleted}}, Event{Type: eventRoomDeleted, RoomID: 4}, false},
+		{eventFilter{Site: 2}, Event{Type: eventStockCreated, RoomID: 3, SiteID: 2}, true},
+		{eventFilter{Site: 2}, Event{Type: eventStockCreated, RoomID: 3, SiteID: 1}, false},
+		{eventFilter{Site: 2}, Event{Type: "supplier.updated"}, false}, // SHARED, HEAD OFFICE ONLY
+		{eventFilter{Site: 2}, Event{Type: "supplier.created", SiteID: 2}, true},
+		{eventFilter{Site: allSites}, Event{Type: "supplier.updated"}, true},
+		{eventFilter{Site: allSites}, Event{Type: eventStockCreated, RoomID: 3, SiteID: 1}, true},
+	}
+	for _, test := range tests {
+		if got := test.filter.match(test.event); got != test.want {
+			t.Errorf("%+v match %+v = %v, want %v", test.filter, test.event, got, test.want)
+		}
+	}
+}
+
+func TestWriteEvent(t *testing.T) {
+	w := httptest.NewRecorder()
+	err := writeEvent(w, Event{EventID: 7, Type: eventStockDeleted, Data: json.RawMessage(`{"stockID":2}`)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "id: 7\nevent: stock.deleted\ndata: "
+	if got := w.Body.String(); len(got) < len(want) || got[:len(want)] != want || got[len(got)-2:] != "\n\n" {
+		t.Errorf("got %q", got)
+	}
+}
+
+func TestEventsInvalidQuery(t *testing.T) {
+	tests := []struct {
+		url    string
+		header string
+	}{
+		{"/events?rooms=kitchen", ""},
+		{"/events?lastEventID=-1", ""},
+		{"/events", "abc"},
+	}
+	for _, test := range tests {
+		r := httptest.NewRequest("GET", test.url, nil)
+		if test.header != "" {
+			r.Header.Set("Last-Event-ID", test.header)
+		}
+		w := httptest.NewRecorder()
+		events(w, r)
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("%s Last-Event-ID %q: got %d, want 400", test.url, test.header, w.Code)
+		}
+	}
+}
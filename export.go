@@ -0,0 +1,297 @@
+package main
+
+import (
+	"archive/zip"
+	"encoding/csv"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	formatJSON = "json"
+	formatCSV  = "csv"
+	formatXLSX = "xlsx"
+
+	mimeCSV  = "text/csv"
+	mimeXLSX = "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+)
+
+// exportFormat picks the response format from ?format= or the Accept header,
+// defaulting to json
+func exportFormat(r *http.Request) string {
+	switch r.URL.Query().Get("format") {
+	case formatCSV:
+		return formatCSV
+	case formatXLSX:
+		return formatXLSX
+	}
+	accept := r.Header.Get("Accept")
+	switch {
+	case strings.Contains(accept, mimeCSV):
+		return formatCSV
+	case strings.Contains(accept, mimeXLSX):
+		return formatXLSX
+	}
+	return formatJSON
+}
+
+// rowWriter streams a table out one row at a time
+type rowWriter interface {
+	WriteRow(cells []any) error
+	Close() error
+}
+
+// newRowWriter returns a writer for the format. The response headers and the
+// header row are only written with the first row, or on Close when there are
+// none, so an export that fails before then can still answer with an error.
+func newRowWriter(w http.ResponseWriter, format string, name string, header []string) (*exportWriter, error) {
+	if format != formatCSV && format != formatXLSX {
+		return nil, fmt.Errorf("unknown export format %q", format)
+	}
+	return &exportWriter{w: w, format: format, name: name, header: header}, nil
+}
+
+type exportWriter struct {
+	w       http.ResponseWriter
+	format  string
+	name    string
+	header  []string
+	out     rowWriter
+	started bool
+}
+
+func (e *exportWriter) start() (err error) {
+	e.started = true
+	filename := fmt.Sprintf("%s-%s.%s", e.name, time.Now().Format("2006-01-02"), e.format)
+	e.w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	switch e.format {
+	case formatCSV:
+		e.w.Header().Set("Content-Type", mimeCSV+"; charset=utf-8")
+		e.out = &csvRowWriter{w: csv.NewWriter(e.w)}
+	case formatXLSX:
+		e.w.Header().Set("Content-Type", mimeXLSX)
+		e.out, err = newXLSXRowWriter(e.w, e.name)
+		if err != nil {
+			return err
+		}
+	}
+
+	cells := make([]any, len(e.header))
+	for i, column := range e.header {
+		cells[i] = column
+	}
+	return e.out.WriteRow(cells)
+}
+func (e *exportWriter) WriteRow(cells []any) error {
+	if !e.started {
+		if err := e.start(); err != nil {
+			return err
+		}
+	}
+	return e.out.WriteRow(cells)
+}
+func (e *exportWriter) Close() error {
+	if !e.started {
+		if err := e.start(); err != nil {
+			return err
+		}
+	}
+	return e.out.Close()
+}
+
+// exportFailed answers an export's error with a 500 when nothing was sent
+// yet. After the first row the response is under way, so it is only logged.
+func exportFailed(w http.ResponseWriter, r *http.Request, out *exportWriter, err error) {
+	if out != nil && out.started {
+		logRequestError(r, err)
+		return
+	}
+	internalError(w, r, err)
+}
+
+// exportCell turns a scanned value into text, keeping numbers as numbers
+func exportCell(value any) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case int:
+		return strconv.Itoa(v)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(v)
+	case NullTime:
+		if !v.Valid {
+			return ""
+		}
+		return v.Time.Format("2006-01-02 15:04:05")
+	}
+	return fmt.Sprint(value)
+}
+
+// CSV
+
+type csvRowWriter struct {
+	w *csv.Writer
+}
+
+func (c *csvRowWriter) WriteRow(cells []any) error {
+	record := make([]string, len(cells))
+	for i, cell := range cells {
+		record[i] = exportCell(cell)
+	}
+	return c.w.Write(record)
+}
+func (c *csvRowWriter) Close() error {
+	c.w.Flush()
+	return c.w.Error()
+}
+
+// XLSX
+// a minimal single sheet workbook using inline strings, so the sheet can be
+// written straight into the zip without collecting a shared string table
+
+type xlsxRowWriter struct {
+	zip   *zip.Writer
+	sheet io.Writer
+	row   int
+}
+
+const (
+	xlsxContentTypes = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">
+<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>
+<Default Extension="xml" ContentType="application/xml"/>
+<Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/>
+<Override PartName="/xl/worksheets/sheet1.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/>
+</Types>`
+	xlsxRels = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">
+<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/>
+</Relationships>`
+	xlsxWorkbook = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">
+<sheets><sheet name="%s" sheetId="1" r:id="rId1"/></sheets>
+</workbook>`
+	xlsxWorkbookRels = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">
+<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet1.xml"/>
+</Relationships>`
+	xlsxSheetStart = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>`
+	xlsxSheetEnd = `</sheetData></worksheet>`
+)
+
+func newXLSXRowWriter(w io.Writer, sheetName string) (*xlsxRowWriter, error) {
+	z := zip.NewWriter(w)
+	parts := []struct{ name, body string }{
+		{"[Content_Types].xml", xlsxContentTypes},
+		{"_rels/.rels", xlsxRels},
+		{"xl/workbook.xml", fmt.Sprintf(xlsxWorkbook, xmlEscape(sheetName))},
+		{"xl/_rels/workbook.xml.rels", xlsxWorkbookRels},
+	}
+	for _, part := range parts {
+		f, err := z.Create(part.name)
+		if err != nil {
+			return nil, err
+		}
+		_, err = io.WriteString(f, part.body)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	sheet, err := z.Create("xl/worksheets/sheet1.xml")
+	if err != nil {
+		return nil, err
+	}
+	_, err = io.WriteString(sheet, xlsxSheetStart)
+	if err != nil {
+		return nil, err
+	}
+	return &xlsxRowWriter{zip: z, sheet: sheet}, nil
+}
+func (x *xlsxRowWriter) WriteRow(cells []any) error {
+	x.row++
+	var b strings.Builder
+	fmt.Fprintf(&b, `<row r="%d">`, x.row)
+	for i, cell := range cells {
+		ref := xlsxColumn(i) + strconv.Itoa(x.row)
+		switch cell.(type) {
+		case int, float64:
+			fmt.Fprintf(&b, `<c r="%s"><v>%s</v></c>`, ref, exportCell(cell))
+		default:
+			fmt.Fprintf(&b, `<c r="%s" t="inlineStr"><is><t>%s</t></is></c>`, ref, xmlEscape(exportCell(cell)))
+		}
+	}
+	b.WriteString("</row>")
+	_, err := io.WriteString(x.sheet, b.String())
+	return err
+}
+func (x *xlsxRowWriter) Close() error {
+	_, err := io.WriteString(x.sheet, xlsxSheetEnd)
+	if err != nil {
+		return err
+	}
+	return x.zip.Close()
+}
+
+// xlsxColumn turns a 0 based index into a column letter (0 -> A, 26 -> AA)
+func xlsxColumn(i int) string {
+	name := ""
+	for i++; i > 0; i = (i - 1) / 26 {
+		name = string(rune('A'+(i-1)%26)) + name
+	}
+	return name
+}
+func xmlEscape(s string) string {
+	var b strings.Builder
+	xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
+
+// EXPORTS
+
+func exportFullStock(w http.ResponseWriter, r *http.Request, format string, filter stockFilter) {
+	out, err := newRowWriter(w, format, "stock", []string{
+		"stockID", "itemName", "level", "roomID", "room", "supplierID", "supplier", "incidentLevel", "lastLogID", "lastChanged", "unit", "shelfOrder", "sku", "category", "tags",
+	})
+	if err == nil {
+		err = eachFullStock(filter, func(data FullStock) error {
+			return out.WriteRow([]any{
+				data.StockID, data.ItemName, data.Level, data.RoomID, data.Room, data.SupplierID, data.Supplier, data.IncidentLevel, data.LastLogID, data.LastChanged, data.Unit, data.ShelfOrder, data.SKU, data.Category, strings.Join(data.Tags, ","),
+			})
+		})
+	}
+	if err == nil {
+		err = out.Close()
+	}
+	if err != nil {
+		exportFailed(w, r, out, err)
+	}
+}
+func exportLogs(w http.ResponseWriter, r *http.Request, format string, filter logFilter) {
+	out, err := newRowWriter(w, format, "logs", []string{
+		"logID", "stockID", "itemName", "differance", "totalAfter", "incidentTime", "daily", "reason",
+	})
+	if err == nil {
+		err = eachLogName(filter, func(data Log) error {
+			return out.WriteRow([]any{
+				data.LogID, data.StockID, data.ItemName, data.Differance, data.TotalAfter, data.IncidentTime, data.Daily, data.Reason,
+			})
+		})
+	}
+	if err == nil {
+		err = out.Close()
+	}
+	if err != nil {
+		exportFailed(w, r, out, err)
+	}
+}
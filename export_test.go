@@ -0,0 +1,155 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+func TestXLSXColumn(t *testing.T) {
+	tests := []struct {
+		index int
+		want  string
+	}{
+		{0, "A"},
+		{1, "B"},
+		{25, "Z"},
+		{26, "AA"},
+		{27, "AB"},
+		{51, "AZ"},
+		{52, "BA"},
+		{701, "ZZ"},
+		{702, "AAA"},
+		{16383, "XFD"}, // THE LAST COLUMN EXCEL ALLOWS
+	}
+	for _, test := range tests {
+		if got := xlsxColumn(test.index); got != test.want {
+			t.Errorf("xlsxColumn(%d) = %q, want %q", test.index, got, test.want)
+		}
+	}
+}
+
+func TestExportCell(t *testing.T) {
+	tests := []struct {
+		value any
+		want  string
+	}{
+		{nil, ""},
+		{"a,b", "a,b"},
+		{7, "7"},
+		{2.5, "2.5"},
+		{0.1, "0.1"},
+		{true, "true"},
+		{NullTime{}, ""},
+		{NullTime{mysql.NullTime{Time: time.Date(2026, 9, 1, 8, 30, 0, 0, time.UTC), Valid: true}}, "2026-09-01 08:30:00"},
+	}
+	for _, test := range tests {
+		if got := exportCell(test.value); got != test.want {
+			t.Errorf("exportCell(%#v) = %q, want %q", test.value, got, test.want)
+		}
+	}
+}
+
+func TestExportFormat(t *testing.T) {
+	tests := []struct {
+		url    string
+		accept string
+		want   string
+	}{
+		{"/logs", "", formatJSON},
+		{"/logs?format=csv", "", formatCSV},
+		{"/logs?format=xlsx", mimeCSV, formatXLSX},
+		{"/logs?format=pdf", "", formatJSON},
+		{"/logs", "text/csv, */*", formatCSV},
+		{"/logs", mimeXLSX, formatXLSX},
+	}
+	for _, test := range tests {
+		r := httptest.NewRequest("GET", test.url, nil)
+		r.Header.Set("Accept", test.accept)
+		if got := exportFormat(r); got != test.want {
+			t.Errorf("exportFormat(%s, Accept: %s) = %q, want %q", test.url, test.accept, got, test.want)
+		}
+	}
+}
+
+func TestXLSXRowWriter(t *testing.T) {
+	w := httptest.NewRecorder()
+	out, err := newRowWriter(w, formatXLSX, "logs", []string{"logID", "reason"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = out.WriteRow([]any{12, "spilt <b> & more"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = out.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if got := w.Header().Get("Content-Type"); got != mimeXLSX {
+		t.Errorf("Content-Type = %q", got)
+	}
+
+	body := w.Body.Bytes()
+	archive, err := zip.NewReader(bytes.NewReader(body), int64(len(body)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var sheet string
+	for _, f := range archive.File {
+		if f.Name != "xl/worksheets/sheet1.xml" {
+			continue
+		}
+		r, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, _ := io.ReadAll(r)
+		r.Close()
+		sheet = string(b)
+	}
+	for _, want := range []string{
+		`<c r="A1" t="inlineStr"><is><t>logID</t></is></c>`,
+		`<c r="A2"><v>12</v></c>`,
+		`<c r="B2" t="inlineStr"><is><t>spilt &lt;b&gt; &amp; more</t></is></c>`,
+	} {
+		if !strings.Contains(sheet, want) {
+			t.Errorf("sheet is missing %s:\n%s", want, sheet)
+		}
+	}
+}
+
+func TestExportQueryFails(t *testing.T) {
+	openDownDB(t)
+	exports := map[string]func(http.ResponseWriter, *http.Request){
+		"stock": func(w http.ResponseWriter, r *http.Request) { exportFullStock(w, r, formatCSV, stockFilter{}) },
+		"logs":  func(w http.ResponseWriter, r *http.Request) { exportLogs(w, r, formatXLSX, logFilter{}) },
+	}
+	for name, export := range exports {
+		w := httptest.NewRecorder()
+		export(w, httptest.NewRequest("GET", "/"+name, nil))
+		if w.Code != http.StatusInternalServerError || w.Header().Get("Content-Disposition") != "" {
+			t.Errorf("%s: got %d with Content-Disposition %q, want a 500 and no file", name, w.Code, w.Header().Get("Content-Disposition"))
+		}
+	}
+}
+
+func TestExportNoRows(t *testing.T) {
+	w := httptest.NewRecorder()
+	out, err := newRowWriter(w, formatCSV, "stock", []string{"stockID", "itemName"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = out.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if w.Body.String() != "stockID,itemName\n" || !strings.HasPrefix(w.Header().Get("Content-Type"), mimeCSV) {
+		t.Errorf("got %q as %q, want just the header row", w.Body.String(), w.Header().Get("Content-Type"))
+	}
+}
@@ -0,0 +1,692 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+
+	graphql "github.com/graph-gophers/graphql-go"
+	"github.com/graph-gophers/graphql-go/relay"
+)
+
+const graphqlSchema = `
+schema {
+	query: Query
+	mutation: Mutation
+}
+
+scalar Time
+
+type Query {
+	stock(stockID: Int!): Stock
+	# the same filters as GET /fullStock
+	stockItems(search: String, match: String, roomID: Int, supplierID: Int, category: Int, tag: String,
+		belowIncident: Boolean, sort: String, limit: Int, offset: Int): [Stock!]!
+	room(roomID: Int!): Room
+	rooms: [Room!]!
+	supplier(supplierID: Int!): Supplier
+	suppliers: [Supplier!]!
+	# the same filters as GET /logs, from and to are YYYY-MM-DD and month is YYYY-MM
+	logs(stockID: Int, from: String, to: String, month: String, category: Int, tag: String): [Log!]!
+}
+
+type Mutation {
+	# sets an absolute level, e.g. from a count. version is checked when given
+	setLevel(stockID: Int!, level: Float!, version: Int): LevelChange!
+	# adds a signed delta to the level
+	adjustLevel(stockID: Int!, delta: Float!, reason: String, version: Int): LevelChange!
+}
+
+type Stock {
+	stockID: Int!
+	itemName: String!
+	level: Float!
+	incidentLevel: Float!
+	unit: String!
+	shelfOrder: Int!
+	sku: String!
+	categoryID: Int!
+	category: String!
+	tags: [String!]!
+	lastChange: Time
+	siteID: Int!
+	version: Int!
+	room: Room!
+	supplier: Supplier!
+	logs(from: String, to: String, month: String): [Log!]!
+}
+
+type Room {
+	roomID: Int!
+	roomName: String!
+	siteID: Int!
+	version: Int!
+	stock: [Stock!]!
+}
+
+type Supplier {
+	supplierID: Int!
+	supplierName: String!
+	supplierContactNo: String!
+	leadTime: Int!
+	mondayDeliver: Boolean!
+	tuesdayDeliver: Boolean!
+	wednesdayDeliver: Boolean!
+	thursdayDeliver: Boolean!
+	fridayDeliver: Boolean!
+	saturdayDeliver: Boolean!
+	sundayDeliver: Boolean!
+	version: Int!
+	stock: [Stock!]!
+}
+
+type Log {
+	logID: Int!
+	differance: Float!
+	totalAfter: Float!
+	incidentTime: Time
+	daily: Boolean!
+	reason: String!
+	stock: Stock
+}
+
+type LevelChange {
+	level: Float!
+	differance: Float!
+	logID: Int!
+	reason: String!
+	stock: Stock!
+}
+`
+
+// graphqlMaxDepth stops queries following Stock.room.stock.room... forever
+const graphqlMaxDepth = 8
+
+// loadGraphQL parses the schema and checks it against the resolvers
+func loadGraphQL() (*graphql.Schema, error) {
+	return graphql.ParseSchema(graphqlSchema, &graphqlResolver{}, graphql.MaxDepth(graphqlMaxDepth))
+}
+
+// graphqlHandler serves POST /graphql with {"query", "operationName",
+// "variables"}. Every request gets its own loaders so related rows are
+// fetched once per request and never served stale.
+func graphqlHandler(schema *graphql.Schema) http.HandlerFunc {
+	relayHandler := &relay.Handler{Schema: schema}
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := context.WithValue(r.Context(), graphqlLoadersKey{}, newGraphqlLoaders(siteFrom(r.Context())))
+		relayHandler.ServeHTTP(w, r.WithContext(ctx))
+	}
+}
+
+// batchLoader loads values by ID for every parent in a response at once.
+// Resolvers queue the IDs of the parents they return, and the first load
+// fetches every queued ID in one query, so a list of n items costs one query
+// per related field instead of n.
+type batchLoader[V any] struct {
+	fetch func(ids []int) (map[int]V, error)
+
+	mu     sync.Mutex
+	queued []int
+	loaded map[int]V
+	done   map[int]bool
+}
+
+func newBatchLoader[V any](fetch func(ids []int) (map[int]V, error)) *batchLoader[V] {
+	return &batchLoader[V]{fetch: fetch, loaded: map[int]V{}, done: map[int]bool{}}
+}
+
+func (l *batchLoader[V]) queue(ids ...int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, id := range ids {
+		if !l.done[id] {
+			l.queued = append(l.queued, id)
+		}
+	}
+}
+
+// load returns the value for id, the zero value when there is none.
+// Concurrent loads wait for the one fetching and are answered from its result.
+func (l *batchLoader[V]) load(id int) (res V, err error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.done[id] {
+		return l.loaded[id], nil
+	}
+
+	ids := []int{id}
+	seen := map[int]bool{id: true}
+	for _, queued := range l.queued {
+		if !l.done[queued] && !seen[queued] {
+			seen[queued] = true
+			ids = append(ids, queued)
+		}
+	}
+	l.queued = nil
+
+	fetched, err := l.fetch(ids)
+	if err != nil {
+		return res, err
+	}
+	for _, id := range ids {
+		l.done[id] = true
+		l.loaded[id] = fetched[id]
+	}
+	return l.loaded[id], nil
+}
+
+type graphqlLoadersKey struct{}
+
+// graphqlLoaders are the batch loaders of one request. Stock and logs are
+// only loaded from the request's site, rooms and suppliers are reached
+// through them.
+type graphqlLoaders struct {
+	site          int
+	rooms         *batchLoader[*Room]       // BY roomID
+	suppliers     *batchLoader[*Supplier]   // BY supplierID
+	stock         *batchLoader[*FullStock]  // BY stockID
+	roomStock     *batchLoader[[]FullStock] // BY roomID
+	supplierStock *batchLoader[[]FullStock] // BY supplierID
+
+	mu        sync.Mutex
+	stockIDs  []int                            // EVERY STOCK ITEM RETURNED SO FAR
+	stockLogs map[logRange]*batchLoader[[]Log] // BY stockID, ONE PER RANGE ASKED FOR
+}
+
+type logRange struct {
+	From, To time.Time
+}
+
+func newGraphqlLoaders(site int) *graphqlLoaders {
+	return &graphqlLoaders{
+		site:      site,
+		rooms:     newBatchLoader(fetchRooms),
+		suppliers: newBatchLoader(fetchSuppliers),
+		stock: newBatchLoader(func(ids []int) (map[int]*FullStock, error) {
+			res := map[int]*FullStock{}
+			err := eachFullStock(stockFilter{StockIDs: ids, SiteID: site}, func(data FullStock) error {
+				res[data.StockID] = &data
+				return nil
+			})
+			return res, err
+		}),
+		roomStock: newBatchLoader(func(ids []int) (map[int][]FullStock, error) {
+			return groupFullStock(stockFilter{RoomIDs: ids, SiteID: site}, func(data FullStock) int { return data.RoomID })
+		}),
+		supplierStock: newBatchLoader(func(ids []int) (map[int][]FullStock, error) {
+			return groupFullStock(stockFilter{SupplierIDs: ids, SiteID: site}, func(data FullStock) int { return data.SupplierID })
+		}),
+		stockLogs: map[logRange]*batchLoader[[]Log]{},
+	}
+}
+
+func loadersFrom(ctx context.Context) *graphqlLoaders {
+	return ctx.Value(graphqlLoadersKey{}).(*graphqlLoaders)
+}
+
+// logsFor returns the loader for logs in period, which starts with every
+// stock item returned so far queued
+func (l *graphqlLoaders) logsFor(period logRange) *batchLoader[[]Log] {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	loader, ok := l.stockLogs[period]
+	if !ok {
+		loader = newBatchLoader(func(ids []int) (map[int][]Log, error) {
+			res := map[int][]Log{}
+			err := eachLogName(logFilter{StockIDs: ids, SiteID: l.site, From: period.From, To: period.To}, func(data Log) error {
+				res[data.StockID] = append(res[data.StockID], data)
+				return nil
+			})
+			return res, err
+		})
+		loader.queue(l.stockIDs...)
+		l.stockLogs[period] = loader
+	}
+	return loader
+}
+
+func fetchRooms(ids []int) (map[int]*Room, error) {
+	in, args := sqlIn("roomID", ids)
+	rows, err := db.Query("SELECT roomID, roomName, siteID, version FROM rooms WHERE "+in, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	res := map[int]*Room{}
+	for rows.Next() {
+		var data Room
+		err = rows.Scan(&data.RoomId, &data.RoomName, &data.SiteID, &data.Version)
+		if err != nil {
+			return nil, err
+		}
+		res[data.RoomId] = &data
+	}
+	return res, rows.Err()
+}
+
+func fetchSuppliers(ids []int) (map[int]*Supplier, error) {
+	in, args := sqlIn("supplierID", ids)
+	rows, err := db.Query(selectSuppliers+" WHERE "+in, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	res := map[int]*Supplier{}
+	for rows.Next() {
+		data, err := scanSupplier(rows)
+		if err != nil {
+			return nil, err
+		}
+		res[int(data.SupplierID)] = &data
+	}
+	return res, rows.Err()
+}
+
+func groupFullStock(filter stockFilter, key func(FullStock) int) (map[int][]FullStock, error) {
+	res := map[int][]FullStock{}
+	err := eachFullStock(filter, func(data FullStock) error {
+		res[key(data)] = append(res[key(data)], data)
+		return nil
+	})
+	return res, err
+}
+
+// RESOLVERS
+
+// graphqlResolver resolves the Query and Mutation fields
+type graphqlResolver struct{}
+
+func (*graphqlResolver) Stock(ctx context.Context, args struct{ StockID int32 }) (*stockResolver, error) {
+	data, err := loadersFrom(ctx).stock.load(int(args.StockID))
+	if err != nil || data == nil {
+		return nil, graphqlError(ctx, err)
+	}
+	return newStockResolvers(ctx, []FullStock{*data})[0], nil
+}
+
+type stockItemsArgs struct {
+	Search        *string
+	Match         *string
+	RoomID        *int32
+	SupplierID    *int32
+	Category      *int32
+	Tag           *string
+	BelowIncident *bool
+	Sort          *string
+	Limit         *int32
+	Offset        *int32
+}
+
+func (*graphqlResolver) StockItems(ctx context.Context, args stockItemsArgs) ([]*stockResolver, error) {
+	q := url.Values{}
+	setQuery(q, "search", args.Search)
+	setQuery(q, "match", args.Match)
+	setQuery(q, "roomID", args.RoomID)
+	setQuery(q, "supplierID", args.SupplierID)
+	setQuery(q, "category", args.Category)
+	setQuery(q, "tag", args.Tag)
+	setQuery(q, "belowIncident", args.BelowIncident)
+	setQuery(q, "sort", args.Sort)
+	setQuery(q, "limit", args.Limit)
+	setQuery(q, "offset", args.Offset)
+	filter, err := stockFilterFromQuery(q)
+	if err != nil {
+		return nil, err
+	}
+	filter.SiteID = siteFrom(ctx)
+	res, err := getStockFull(filter)
+	if err != nil {
+		return nil, graphqlError(ctx, err)
+	}
+	return newStockResolvers(ctx, res), nil
+}
+
+func (*graphqlResolver) Room(ctx context.Context, args struct{ RoomID int32 }) (*roomResolver, error) {
+	ok, err := atSite(ctx, "roomID", int(args.RoomID))
+	if err != nil || !ok {
+		return nil, graphqlError(ctx, err)
+	}
+	data, err := loadersFrom(ctx).rooms.load(int(args.RoomID))
+	if err != nil || data == nil {
+		return nil, graphqlError(ctx, err)
+	}
+	return newRoomResolvers(ctx, []Room{*data})[0], nil
+}
+
+func (*graphqlResolver) Rooms(ctx context.Context) ([]*roomResolver, error) {
+	res, err := getRooms(siteFrom(ctx))
+	if err != nil {
+		return nil, graphqlError(ctx, err)
+	}
+	return newRoomResolvers(ctx, res), nil
+}
+
+func (*graphqlResolver) Supplier(ctx context.Context, args struct{ SupplierID int32 }) (*supplierResolver, error) {
+	ok, err := atSite(ctx, "supplierID", int(args.SupplierID))
+	if err != nil || !ok {
+		return nil, graphqlError(ctx, err)
+	}
+	data, err := loadersFrom(ctx).suppliers.load(int(args.SupplierID))
+	if err != nil || data == nil {
+		return nil, graphqlError(ctx, err)
+	}
+	return newSupplierResolvers(ctx, []Supplier{*data})[0], nil
+}
+
+func (*graphqlResolver) Suppliers(ctx context.Context) ([]*supplierResolver, error) {
+	res, err := getSuppliers(siteFrom(ctx))
+	if err != nil {
+		return nil, graphqlError(ctx, err)
+	}
+	return newSupplierResolvers(ctx, res), nil
+}
+
+type logsArgs struct {
+	StockID  *int32
+	From     *string
+	To       *string
+	Month    *string
+	Category *int32
+	Tag      *string
+}
+
+func (*graphqlResolver) Logs(ctx context.Context, args logsArgs) ([]*logResolver, error) {
+	q := url.Values{}
+	setQuery(q, "stockID", args.StockID)
+	setQuery(q, "from", args.From)
+	setQuery(q, "to", args.To)
+	setQuery(q, "month", args.Month)
+	setQuery(q, "category", args.Category)
+	setQuery(q, "tag", args.Tag)
+	filter, err := logFilterFromQuery(q)
+	if err != nil {
+		return nil, err
+	}
+	filter.SiteID = siteFrom(ctx)
+	res, err := getLogNames(filter)
+	if err != nil {
+		return nil, graphqlError(ctx, err)
+	}
+	return newLogResolvers(ctx, res), nil
+}
+
+func (*graphqlResolver) SetLevel(ctx context.Context, args struct {
+	StockID int32
+	Level   float64
+	Version *int32
+}) (*levelChangeResolver, error) {
+	if siteFrom(ctx) == allSites {
+		return nil, errAllSitesRead
+	}
+	data := FullStock{StockID: int(args.StockID), Level: args.Level, SiteID: siteFrom(ctx)}
+	if args.Version != nil {
+		data.Version = int(*args.Version)
+	}
+	res, err := updateFullStockLevel(data)
+	if err != nil {
+		return nil, graphqlError(ctx, err)
+	}
+	return &levelChangeResolver{res}, nil
+}
+
+func (*graphqlResolver) AdjustLevel(ctx context.Context, args struct {
+	StockID int32
+	Delta   float64
+	Reason  *string
+	Version *int32
+}) (*levelChangeResolver, error) {
+	data := Adjustment{Delta: args.Delta}
+	if args.Reason != nil {
+		data.Reason = *args.Reason
+	}
+	if err := data.validate(); err != nil {
+		return nil, err
+	}
+	if siteFrom(ctx) == allSites {
+		return nil, errAllSitesRead
+	}
+	ok, err := atSite(ctx, "stockID", int(args.StockID))
+	if err == nil && !ok {
+		err = sql.ErrNoRows
+	}
+	if err != nil {
+		return nil, graphqlError(ctx, err)
+	}
+	var version int
+	if args.Version != nil {
+		version = int(*args.Version)
+	}
+	res, _, err := adjustStock(int(args.StockID), data, version)
+	if err != nil {
+		return nil, graphqlError(ctx, err)
+	}
+	return &levelChangeResolver{res}, nil
+}
+
+type stockResolver struct{ data FullStock }
+
+// newStockResolvers wraps items, queueing them for their related fields
+func newStockResolvers(ctx context.Context, items []FullStock) []*stockResolver {
+	loaders := loadersFrom(ctx)
+	res := make([]*stockResolver, len(items))
+	stockIDs := make([]int, len(items))
+	for i, data := range items {
+		res[i] = &stockResolver{data}
+		stockIDs[i] = data.StockID
+		loaders.rooms.queue(data.RoomID)
+		loaders.suppliers.queue(data.SupplierID)
+	}
+
+	loaders.mu.Lock()
+	loaders.stockIDs = append(loaders.stockIDs, stockIDs...)
+	for _, logs := range loaders.stockLogs {
+		logs.queue(stockIDs...)
+	}
+	loaders.mu.Unlock()
+	return res
+}
+
+func (s *stockResolver) StockID() int32         { return int32(s.data.StockID) }
+func (s *stockResolver) ItemName() string       { return s.data.ItemName }
+func (s *stockResolver) Level() float64         { return s.data.Level }
+func (s *stockResolver) IncidentLevel() float64 { return s.data.IncidentLevel }
+func (s *stockResolver) Unit() string           { return s.data.Unit }
+func (s *stockResolver) ShelfOrder() int32      { return int32(s.data.ShelfOrder) }
+func (s *stockResolver) SKU() string            { return s.data.SKU }
+func (s *stockResolver) CategoryID() int32      { return int32(s.data.CategoryID) }
+func (s *stockResolver) Category() string       { return s.data.Category }
+func (s *stockResolver) Tags() []string         { return s.data.Tags }
+func (s *stockResolver) SiteID() int32          { return int32(s.data.SiteID) }
+func (s *stockResolver) LastChange() *graphql.Time {
+	return graphqlTime(s.data.LastChanged)
+}
+func (s *stockResolver) Version() int32 { return int32(s.data.Version) }
+
+func (s *stockResolver) Room(ctx context.Context) (*roomResolver, error) {
+	data, err := loadersFrom(ctx).rooms.load(s.data.RoomID)
+	if err == nil && data == nil {
+		err = fmt.Errorf("room %d not found", s.data.RoomID)
+	}
+	if err != nil {
+		return nil, graphqlError(ctx, err)
+	}
+	return newRoomResolvers(ctx, []Room{*data})[0], nil
+}
+
+func (s *stockResolver) Supplier(ctx context.Context) (*supplierResolver, error) {
+	data, err := loadersFrom(ctx).suppliers.load(s.data.SupplierID)
+	if err == nil && data == nil {
+		err = fmt.Errorf("supplier %d not found", s.data.SupplierID)
+	}
+	if err != nil {
+		return nil, graphqlError(ctx, err)
+	}
+	return newSupplierResolvers(ctx, []Supplier{*data})[0], nil
+}
+
+func (s *stockResolver) Logs(ctx context.Context, args struct {
+	From  *string
+	To    *string
+	Month *string
+}) ([]*logResolver, error) {
+	q := url.Values{}
+	setQuery(q, "from", args.From)
+	setQuery(q, "to", args.To)
+	setQuery(q, "month", args.Month)
+	filter, err := logFilterFromQuery(q)
+	if err != nil {
+		return nil, err
+	}
+	res, err := loadersFrom(ctx).logsFor(logRange{filter.From, filter.To}).load(s.data.StockID)
+	if err != nil {
+		return nil, graphqlError(ctx, err)
+	}
+	return newLogResolvers(ctx, res), nil
+}
+
+type roomResolver struct{ data Room }
+
+func newRoomResolvers(ctx context.Context, items []Room) []*roomResolver {
+	loaders := loadersFrom(ctx)
+	res := make([]*roomResolver, len(items))
+	for i, data := range items {
+		res[i] = &roomResolver{data}
+		loaders.roomStock.queue(data.RoomId)
+	}
+	return res
+}
+
+func (r *roomResolver) RoomID() int32    { return int32(r.data.RoomId) }
+func (r *roomResolver) RoomName() string { return r.data.RoomName }
+func (r *roomResolver) SiteID() int32    { return int32(r.data.SiteID) }
+func (r *roomResolver) Version() int32   { return int32(r.data.Version) }
+
+func (r *roomResolver) Stock(ctx context.Context) ([]*stockResolver, error) {
+	res, err := loadersFrom(ctx).roomStock.load(r.data.RoomId)
+	if err != nil {
+		return nil, graphqlError(ctx, err)
+	}
+	return newStockResolvers(ctx, res), nil
+}
+
+type supplierResolver struct{ data Supplier }
+
+func newSupplierResolvers(ctx context.Context, items []Supplier) []*supplierResolver {
+	loaders := loadersFrom(ctx)
+	res := make([]*supplierResolver, len(items))
+	for i, data := range items {
+		res[i] = &supplierResolver{data}
+		loaders.supplierStock.queue(int(data.SupplierID))
+	}
+	return res
+}
+
+func (s *supplierResolver) SupplierID() int32         { return int32(s.data.SupplierID) }
+func (s *supplierResolver) SupplierName() string      { return s.data.SupplierName }
+func (s *supplierResolver) SupplierContactNo() string { return s.data.SupplierContactNo }
+func (s *supplierResolver) LeadTime() int32           { return int32(s.data.LeadTime) }
+func (s *supplierResolver) MondayDeliver() bool       { return s.data.MondayDeliver }
+func (s *supplierResolver) TuesdayDeliver() bool      { return s.data.TuesdayDeliver }
+func (s *supplierResolver) WednesdayDeliver() bool    { return s.data.WednesdayDeliver }
+func (s *supplierResolver) ThursdayDeliver() bool     { return s.data.ThursdayDeliver }
+func (s *supplierResolver) FridayDeliver() bool       { return s.data.FridayDeliver }
+func (s *supplierResolver) SaturdayDeliver() bool     { return s.data.SaturdayDeliver }
+func (s *supplierResolver) SundayDeliver() bool       { return s.data.SundayDeliver }
+func (s *supplierResolver) Version() int32            { return int32(s.data.Version) }
+
+func (s *supplierResolver) Stock(ctx context.Context) ([]*stockResolver, error) {
+	res, err := loadersFrom(ctx).supplierStock.load(int(s.data.SupplierID))
+	if err != nil {
+		return nil, graphqlError(ctx, err)
+	}
+	return newStockResolvers(ctx, res), nil
+}
+
+type logResolver struct{ data Log }
+
+func newLogResolvers(ctx context.Context, items []Log) []*logResolver {
+	loaders := loadersFrom(ctx)
+	res := make([]*logResolver, len(items))
+	for i, data := range items {
+		res[i] = &logResolver{data}
+		loaders.stock.queue(data.StockID)
+	}
+	return res
+}
+
+func (l *logResolver) LogID() int32                { return int32(l.data.LogID) }
+func (l *logResolver) Differance() float64         { return l.data.Differance }
+func (l *logResolver) TotalAfter() float64         { return l.data.TotalAfter }
+func (l *logResolver) IncidentTime() *graphql.Time { return graphqlTime(l.data.IncidentTime) }
+func (l *logResolver) Daily() bool                 { return l.data.Daily }
+func (l *logResolver) Reason() string              { return l.data.Reason }
+
+func (l *logResolver) Stock(ctx context.Context) (*stockResolver, error) {
+	data, err := loadersFrom(ctx).stock.load(l.data.StockID)
+	if err != nil || data == nil {
+		return nil, graphqlError(ctx, err)
+	}
+	return newStockResolvers(ctx, []FullStock{*data})[0], nil
+}
+
+type levelChangeResolver struct{ data levelChange }
+
+func (c *levelChangeResolver) Level() float64      { return c.data.Level }
+func (c *levelChangeResolver) Differance() float64 { return c.data.Differance }
+func (c *levelChangeResolver) LogID() int32        { return int32(c.data.LogID) }
+func (c *levelChangeResolver) Reason() string      { return c.data.Reason }
+
+func (c *levelChangeResolver) Stock(ctx context.Context) (*stockResolver, error) {
+	data, err := loadersFrom(ctx).stock.load(c.data.StockID)
+	if err == nil && data == nil {
+		err = sql.ErrNoRows
+	}
+	if err != nil {
+		return nil, graphqlError(ctx, err)
+	}
+	return newStockResolvers(ctx, []FullStock{*data})[0], nil
+}
+
+// setQuery sets name in q when the optional argument v was given, so GraphQL
+// arguments go through the same parsing as query parameters
+func setQuery[T string | int32 | bool](q url.Values, name string, v *T) {
+	if v == nil {
+		return
+	}
+	switch v := any(*v).(type) {
+	case string:
+		q.Set(name, v)
+	case int32:
+		q.Set(name, strconv.Itoa(int(v)))
+	case bool:
+		q.Set(name, strconv.FormatBool(v))
+	}
+}
+
+func graphqlTime(t NullTime) *graphql.Time {
+	if !t.Valid {
+		return nil
+	}
+	return &graphql.Time{Time: t.Time}
+}
+
+// graphqlError keeps database details out of responses, nil stays nil
+func graphqlError(ctx context.Context, err error) error {
+	if err == nil {
+		return nil
+	}
+	if message := batchError(err); message != "" {
+		return errors.New(message)
+	}
+	slog.ErrorContext(ctx, "graphql", "err", err)
+	return errors.New("internal error")
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/url"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestBatchLoader(t *testing.T) {
+	var fetches [][]int
+	loader := newBatchLoader(func(ids []int) (map[int]string, error) {
+		fetches = append(fetches, ids)
+		res := map[int]string{}
+		for _, id := range ids {
+			if id != 404 {
+				res[id] = "item " + string(rune('0'+id))
+			}
+		}
+		return res, nil
+	})
+
+	loader.queue(1, 2, 3, 2)
+	tests := []struct {
+		id          int
+		want        string
+		wantFetches int
+	}{
+		{2, "item 2", 1}, // FETCHES EVERY QUEUED ID AT ONCE
+		{1, "item 1", 1},
+		{3, "item 3", 1},
+		{4, "item 4", 2},
+		{404, "", 3},
+		{404, "", 3}, // A MISSING ROW IS REMEMBERED TOO
+	}
+	for _, test := range tests {
+		got, err := loader.load(test.id)
+		if err != nil || got != test.want || len(fetches) != test.wantFetches {
+			t.Errorf("load(%d) = %q, %v after %d fetches, want %q after %d", test.id, got, err, len(fetches), test.want, test.wantFetches)
+		}
+	}
+	if !reflect.DeepEqual(fetches[0], []int{2, 1, 3}) {
+		t.Errorf("first fetch was %v, want [2 1 3]", fetches[0])
+	}
+
+	loader.queue(1, 5) // 1 IS ALREADY LOADED
+	loader.load(5)
+	if last := fetches[len(fetches)-1]; !reflect.DeepEqual(last, []int{5}) {
+		t.Errorf("fetched %v, want [5]", last)
+	}
+}
+
+func TestBatchLoaderConcurrent(t *testing.T) {
+	var mu sync.Mutex
+	fetches := 0
+	loader := newBatchLoader(func(ids []int) (map[int]int, error) {
+		mu.Lock()
+		fetches++
+		mu.Unlock()
+		time.Sleep(10 * time.Millisecond)
+		res := map[int]int{}
+		for _, id := range ids {
+			res[id] = id * 10
+		}
+		return res, nil
+	})
+	loader.queue(1, 2, 3, 4)
+
+	var wg sync.WaitGroup
+	for id := 1; id <= 4; id++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if got, err := loader.load(id); err != nil || got != id*10 {
+				t.Errorf("load(%d) = %d, %v", id, got, err)
+			}
+		}()
+	}
+	wg.Wait()
+	if fetches != 1 {
+		t.Errorf("fetched %d times, want 1", fetches)
+	}
+}
+
+func TestBatchLoaderError(t *testing.T) {
+	fail := true
+	loader := newBatchLoader(func(ids []int) (map[int]int, error) {
+		if fail {
+			return nil, errors.New("connection refused")
+		}
+		return map[int]int{1: 10}, nil
+	})
+	if _, err := loader.load(1); err == nil {
+		t.Fatal("the fetch error was not returned")
+	}
+	// A FAILED FETCH IS NOT REMEMBERED
+	fail = false
+	if got, err := loader.load(1); err != nil || got != 10 {
+		t.Errorf("load after a failed fetch = %d, %v", got, err)
+	}
+}
+
+func TestSetQuery(t *testing.T) {
+	search, limit, below := "ched", int32(20), true
+	q := url.Values{}
+	setQuery(q, "search", &search)
+	setQuery(q, "limit", &limit)
+	setQuery(q, "belowIncident", &below)
+	setQuery(q, "tag", (*string)(nil))
+	if got := q.Encode(); got != "belowIncident=true&limit=20&search=ched" {
+		t.Errorf("got %s", got)
+	}
+}
+
+func TestGraphqlError(t *testing.T) {
+	tests := []struct {
+		err  error
+		want string
+	}{
+		{nil, ""},
+		{sql.ErrNoRows, "stock item not found"},
+		{errVersionMismatch, "changed by someone else since it was read"},
+		{errors.New("Error 1045: Access denied for user 'inventory'"), "internal error"},
+	}
+	for _, test := range tests {
+		got := graphqlError(context.Background(), test.err)
+		if (got == nil) != (test.want == "") || (got != nil && got.Error() != test.want) {
+			t.Errorf("graphqlError(%v) = %v, want %q", test.err, got, test.want)
+		}
+	}
+}
+
+func TestGraphqlSchema(t *testing.T) {
+	schema, err := loadGraphQL()
+	if err != nil {
+		t.Fatalf("the schema does not match the resolvers: %v", err)
+	}
+	// TOO DEEP TO RUN, REJECTED BEFORE ANY RESOLVER IS CALLED
+	deep := "{ rooms { " + strings.Repeat("stock { room { ", 4) + "roomID" + strings.Repeat(" } }", 4) + " } }"
+	res := schema.Exec(context.Background(), deep, "", nil)
+	if len(res.Errors) == 0 {
+		t.Errorf("a query deeper than %d was run", graphqlMaxDepth)
+	}
+}
@@ -0,0 +1,507 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/ingar2005/inventory-backend-go/inventorypb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// grpcPort is where the gRPC API in inventorypb/inventory.proto is served by
+// default
+const grpcPort = ":5001"
+
+// stockChangeTypes are the events WatchStockChanges sends
+var stockChangeTypes = []string{"stock.*", eventLogDeleted}
+
+// newGRPCServer returns the gRPC API, over TLS and with tokens when config
+// has them
+func newGRPCServer(config Config) (*grpc.Server, error) {
+	options := append(grpcLogging(), grpcAuth(config.Auth)...)
+	options = append(options, grpcSites(config.Auth)...)
+	if config.TLS.CertFile != "" {
+		creds, err := credentials.NewServerTLSFromFile(config.TLS.CertFile, config.TLS.KeyFile)
+		if err != nil {
+			return nil, err
+		}
+		options = append(options, grpc.Creds(creds))
+	}
+	server := grpc.NewServer(options...)
+	inventorypb.RegisterInventoryServer(server, grpcServer{})
+	return server, nil
+}
+
+// grpcServer implements inventorypb.InventoryServer over the same data
+// functions as the HTTP handlers
+type grpcServer struct {
+	inventorypb.UnimplementedInventoryServer
+}
+
+func (grpcServer) ListSuppliers(ctx context.Context, req *inventorypb.ListSuppliersRequest) (*inventorypb.ListSuppliersResponse, error) {
+	res, err := getSuppliers(siteFrom(ctx))
+	if err != nil {
+		return nil, grpcError(ctx, err)
+	}
+	out := &inventorypb.ListSuppliersResponse{}
+	for _, data := range res {
+		out.Suppliers = append(out.Suppliers, supplierToProto(data))
+	}
+	return out, nil
+}
+
+func (grpcServer) GetSupplier(ctx context.Context, req *inventorypb.GetSupplierRequest) (*inventorypb.Supplier, error) {
+	data, err := getSupplier(int(req.SupplierId))
+	if err != nil {
+		return nil, grpcError(ctx, err)
+	}
+	return supplierToProto(data), nil
+}
+
+func (grpcServer) ListRooms(ctx context.Context, req *inventorypb.ListRoomsRequest) (*inventorypb.ListRoomsResponse, error) {
+	res, err := getRooms(siteFrom(ctx))
+	if err != nil {
+		return nil, grpcError(ctx, err)
+	}
+	out := &inventorypb.ListRoomsResponse{}
+	for _, data := range res {
+		out.Rooms = append(out.Rooms, roomToProto(data))
+	}
+	return out, nil
+}
+
+func (grpcServer) GetRoom(ctx context.Context, req *inventorypb.GetRoomRequest) (*inventorypb.Room, error) {
+	data, err := getRoom(int(req.RoomId))
+	if err != nil {
+		return nil, grpcError(ctx, err)
+	}
+	return roomToProto(data), nil
+}
+
+func (grpcServer) CreateRoom(ctx context.Context, req *inventorypb.CreateRoomRequest) (*inventorypb.Room, error) {
+	id, err := addRoom(req.RoomName, siteFrom(ctx))
+	if err != nil {
+		return nil, grpcError(ctx, err)
+	}
+	return roomToProto(Room{RoomId: id, RoomName: req.RoomName, SiteID: siteFrom(ctx), Version: 1}), nil
+}
+
+func (grpcServer) UpdateRoom(ctx context.Context, req *inventorypb.UpdateRoomRequest) (*inventorypb.Room, error) {
+	generic, err := isGenericRoom(int(req.RoomId))
+	if err != nil {
+		return nil, grpcError(ctx, err)
+	}
+	if generic {
+		return nil, status.Error(codes.InvalidArgument, "Cannot change this value")
+	}
+	if req.Version == 0 {
+		return nil, errVersionRequired
+	}
+	version, err := updateRoom(int(req.RoomId), req.RoomName, int(req.Version))
+	if err != nil {
+		return nil, grpcError(ctx, err)
+	}
+	return roomToProto(Room{RoomId: int(req.RoomId), RoomName: req.RoomName, Version: version}), nil
+}
+
+func (grpcServer) DeleteRoom(ctx context.Context, req *inventorypb.DeleteRoomRequest) (*inventorypb.DeleteRoomResponse, error) {
+	generic, err := isGenericRoom(int(req.RoomId))
+	if err != nil {
+		return nil, grpcError(ctx, err)
+	}
+	if generic {
+		return nil, status.Error(codes.InvalidArgument, "Cannot delete this value")
+	}
+	if req.Version == 0 {
+		return nil, errVersionRequired
+	}
+	err = deleteRoom(int(req.RoomId), int(req.Version))
+	if err != nil {
+		return nil, grpcError(ctx, err)
+	}
+	return &inventorypb.DeleteRoomResponse{}, nil
+}
+
+func (grpcServer) ListStock(ctx context.Context, req *inventorypb.ListStockRequest) (*inventorypb.ListStockResponse, error) {
+	// THE SAME PARSING AS THE QUERY OF GET /fullStock
+	q := url.Values{}
+	for name, v := range map[string]int32{"roomID": req.RoomId, "supplierID": req.SupplierId, "category": req.CategoryId, "limit": req.Limit, "offset": req.Offset} {
+		if v != 0 {
+			q.Set(name, strconv.Itoa(int(v)))
+		}
+	}
+	for name, v := range map[string]string{"tag": req.Tag, "search": req.Search, "match": req.Match, "sort": req.Sort} {
+		if v != "" {
+			q.Set(name, v)
+		}
+	}
+	if req.BelowIncident {
+		q.Set("belowIncident", "true")
+	}
+	if req.ChangedSince != nil {
+		q.Set("changedSince", req.ChangedSince.AsTime().Format(time.RFC3339))
+	}
+	filter, err := stockFilterFromQuery(q)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	filter.SiteID = siteFrom(ctx)
+
+	res, err := getStockFull(filter)
+	if err != nil {
+		return nil, grpcError(ctx, err)
+	}
+	total, err := countFullStock(filter)
+	if err != nil {
+		return nil, grpcError(ctx, err)
+	}
+	out := &inventorypb.ListStockResponse{TotalCount: int32(total)}
+	for _, data := range res {
+		out.Stock = append(out.Stock, fullStockToProto(data))
+	}
+	return out, nil
+}
+
+func (grpcServer) GetStock(ctx context.Context, req *inventorypb.GetStockRequest) (*inventorypb.Stock, error) {
+	return getStockProto(ctx, int(req.StockId))
+}
+
+func (grpcServer) CreateStock(ctx context.Context, req *inventorypb.CreateStockRequest) (*inventorypb.Stock, error) {
+	data := stockFromProto(req.Stock)
+	if data.SupplierID == 0 {
+		data.SupplierID = 1
+	}
+	err := checkStockRefs(ctx, data)
+	if err != nil {
+		return nil, grpcError(ctx, err)
+	}
+	id, err := addStock(data)
+	if err != nil {
+		return nil, grpcError(ctx, err)
+	}
+	return getStockProto(ctx, id)
+}
+
+func (grpcServer) UpdateStock(ctx context.Context, req *inventorypb.UpdateStockRequest) (*inventorypb.Stock, error) {
+	if req.Version == 0 {
+		return nil, errVersionRequired
+	}
+	data := stockFromProto(req.Stock)
+	data.StockID = int(req.StockId)
+	data.Version = int(req.Version)
+	err := checkStockRefs(ctx, data)
+	if err != nil {
+		return nil, grpcError(ctx, err)
+	}
+	_, err = updateStock(data)
+	if err != nil {
+		return nil, grpcError(ctx, err)
+	}
+	return getStockProto(ctx, data.StockID)
+}
+
+func (grpcServer) DeleteStock(ctx context.Context, req *inventorypb.DeleteStockRequest) (*inventorypb.DeleteStockResponse, error) {
+	if req.Version == 0 {
+		return nil, errVersionRequired
+	}
+	err := deleteStock(int(req.StockId), int(req.Version))
+	if err != nil {
+		return nil, grpcError(ctx, err)
+	}
+	return &inventorypb.DeleteStockResponse{}, nil
+}
+
+func (grpcServer) SetStockLevel(ctx context.Context, req *inventorypb.SetStockLevelRequest) (*inventorypb.LevelChange, error) {
+	res, err := updateFullStockLevel(FullStock{StockID: int(req.StockId), Level: req.Level, Version: int(req.Version), SiteID: siteFrom(ctx)})
+	if err != nil {
+		return nil, grpcError(ctx, err)
+	}
+	return levelChangeToProto(res), nil
+}
+
+func (grpcServer) AdjustStock(ctx context.Context, req *inventorypb.AdjustStockRequest) (*inventorypb.LevelChange, error) {
+	data := Adjustment{Delta: req.Delta, Reason: req.Reason}
+	if err := data.validate(); err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	res, _, err := adjustStock(int(req.StockId), data, int(req.Version))
+	if err != nil {
+		return nil, grpcError(ctx, err)
+	}
+	return levelChangeToProto(res), nil
+}
+
+func (grpcServer) ListLogs(ctx context.Context, req *inventorypb.ListLogsRequest) (*inventorypb.ListLogsResponse, error) {
+	// THE SAME PARSING AS THE QUERY OF GET /logs
+	q := url.Values{}
+	for name, v := range map[string]int32{"stockID": req.StockId, "category": req.CategoryId} {
+		if v != 0 {
+			q.Set(name, strconv.Itoa(int(v)))
+		}
+	}
+	for name, v := range map[string]string{"from": req.From, "to": req.To, "month": req.Month, "tag": req.Tag} {
+		if v != "" {
+			q.Set(name, v)
+		}
+	}
+	filter, err := logFilterFromQuery(q)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	filter.SiteID = siteFrom(ctx)
+
+	out := &inventorypb.ListLogsResponse{}
+	err = eachLogName(filter, func(data Log) error {
+		out.Logs = append(out.Logs, logToProto(data))
+		return nil
+	})
+	if err != nil {
+		return nil, grpcError(ctx, err)
+	}
+	return out, nil
+}
+
+func (grpcServer) DeleteLog(ctx context.Context, req *inventorypb.DeleteLogRequest) (*inventorypb.DeleteLogResponse, error) {
+	err := deleteLog(int(req.LogId))
+	if err != nil {
+		return nil, grpcError(ctx, err)
+	}
+	return &inventorypb.DeleteLogResponse{}, nil
+}
+
+// WatchStockChanges streams stock events from the hub the same way GET
+// /events does, first catching up from last_event_id when it is set
+func (grpcServer) WatchStockChanges(req *inventorypb.WatchStockChangesRequest, stream grpc.ServerStreamingServer[inventorypb.StockChange]) error {
+	filter := eventFilter{Types: stockChangeTypes, Site: siteFrom(stream.Context())}
+	for _, id := range req.RoomIds {
+		filter.Rooms = append(filter.Rooms, int(id))
+	}
+
+	// SUBSCRIBE BEFORE CATCHING UP SO NOTHING COMMITTED MEANWHILE IS MISSED
+	ch := hub.subscribe()
+	defer hub.unsubscribe(ch)
+
+	caughtUp := map[int]bool{}
+	if req.LastEventId > 0 {
+		err := eachEventSince(int(req.LastEventId), func(event Event) error {
+			caughtUp[event.EventID] = true
+			if !filter.match(event) {
+				return nil
+			}
+			return sendStockChange(stream, event)
+		})
+		if err != nil {
+			return grpcError(stream.Context(), err)
+		}
+	}
+
+	for {
+		select {
+		case <-stream.Context().Done():
+			return nil
+		case event, ok := <-ch:
+			if !ok {
+				return status.Error(codes.Unavailable, "stream closed, too slow to keep up or shutting down, reconnect with last_event_id")
+			}
+			if caughtUp[event.EventID] || !filter.match(event) {
+				continue
+			}
+			err := sendStockChange(stream, event)
+			if err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func sendStockChange(stream grpc.ServerStreamingServer[inventorypb.StockChange], event Event) error {
+	res := &inventorypb.StockChange{
+		EventId:   int64(event.EventID),
+		Type:      event.Type,
+		RoomId:    int32(event.RoomID),
+		CreatedAt: timestampToProto(event.CreatedAt),
+	}
+
+	var err error
+	switch event.Type {
+	case eventStockCreated, eventStockUpdated:
+		var data Stock
+		err = json.Unmarshal(event.Data, &data)
+		res.StockId = int32(data.StockID)
+		res.Change = &inventorypb.StockChange_Stock{Stock: stockToProto(data)}
+	case eventStockLevelChanged:
+		var data levelChange
+		err = json.Unmarshal(event.Data, &data)
+		res.StockId = int32(data.StockID)
+		res.Change = &inventorypb.StockChange_LevelChanged{LevelChanged: levelChangeToProto(data)}
+	case eventLogDeleted:
+		var data logDeleted
+		err = json.Unmarshal(event.Data, &data)
+		res.StockId = int32(data.StockID)
+		res.Change = &inventorypb.StockChange_LevelChanged{LevelChanged: &inventorypb.LevelChange{
+			StockId: int32(data.StockID),
+			RoomId:  int32(data.RoomID),
+			Level:   data.Level,
+			LogId:   int32(data.LogID),
+		}}
+	case eventStockDeleted:
+		var data stockDeleted
+		err = json.Unmarshal(event.Data, &data)
+		res.StockId = int32(data.StockID)
+	}
+	if err != nil {
+		return grpcError(stream.Context(), err)
+	}
+	return stream.Send(res)
+}
+
+// errVersionRequired answers updates and deletes without a version, like the
+// 428 of the HTTP API when If-Match is missing
+var errVersionRequired = status.Error(codes.FailedPrecondition, "version from a read is required")
+
+// grpcError maps data errors to status codes the same way writeUpdateError
+// maps them to HTTP statuses
+func grpcError(ctx context.Context, err error) error {
+	switch {
+	case errors.Is(err, errVersionMismatch):
+		return status.Error(codes.FailedPrecondition, "changed by someone else since it was read, fetch it again")
+	case errors.Is(err, sql.ErrNoRows):
+		return status.Error(codes.NotFound, "not found")
+	case errors.Is(err, errSKUInUse):
+		return status.Error(codes.AlreadyExists, err.Error())
+	case isDuplicateKey(err):
+		return status.Error(codes.AlreadyExists, "already exists")
+	case errors.Is(err, errNotAtSite):
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+	slog.ErrorContext(ctx, "grpc", "err", err)
+	return status.Error(codes.Internal, "internal error")
+}
+
+func getStockProto(ctx context.Context, id int) (*inventorypb.Stock, error) {
+	res, err := getFullStockById(id)
+	if err != nil {
+		return nil, grpcError(ctx, err)
+	}
+	if len(res) == 0 {
+		return nil, grpcError(ctx, sql.ErrNoRows)
+	}
+	return fullStockToProto(res[0]), nil
+}
+
+// CONVERSIONS
+
+func supplierToProto(data Supplier) *inventorypb.Supplier {
+	return &inventorypb.Supplier{
+		SupplierId:        int32(data.SupplierID),
+		SupplierName:      data.SupplierName,
+		SupplierContactNo: data.SupplierContactNo,
+		LeadTime:          int32(data.LeadTime),
+		MondayDeliver:     data.MondayDeliver,
+		TuesdayDeliver:    data.TuesdayDeliver,
+		WednesdayDeliver:  data.WednesdayDeliver,
+		ThursdayDeliver:   data.ThursdayDeliver,
+		FridayDeliver:     data.FridayDeliver,
+		SaturdayDeliver:   data.SaturdayDeliver,
+		SundayDeliver:     data.SundayDeliver,
+		Version:           int32(data.Version),
+	}
+}
+
+func roomToProto(data Room) *inventorypb.Room {
+	return &inventorypb.Room{RoomId: int32(data.RoomId), RoomName: data.RoomName, Version: int32(data.Version)}
+}
+
+func stockToProto(data Stock) *inventorypb.Stock {
+	return &inventorypb.Stock{
+		StockId:       int32(data.StockID),
+		ItemName:      data.ItemName,
+		Level:         data.Level,
+		RoomId:        int32(data.RoomID),
+		SupplierId:    int32(data.SupplierID),
+		IncidentLevel: data.IncidentLevel,
+		Unit:          data.Unit,
+		ShelfOrder:    int32(data.ShelfOrder),
+		Sku:           data.SKU,
+		CategoryId:    int32(data.CategoryID),
+		Version:       int32(data.Version),
+		LastLogId:     int32(data.LastLogID),
+	}
+}
+
+func fullStockToProto(data FullStock) *inventorypb.Stock {
+	return &inventorypb.Stock{
+		StockId:       int32(data.StockID),
+		ItemName:      data.ItemName,
+		Level:         data.Level,
+		RoomId:        int32(data.RoomID),
+		SupplierId:    int32(data.SupplierID),
+		IncidentLevel: data.IncidentLevel,
+		Unit:          data.Unit,
+		ShelfOrder:    int32(data.ShelfOrder),
+		Sku:           data.SKU,
+		CategoryId:    int32(data.CategoryID),
+		Version:       int32(data.Version),
+		LastLogId:     int32(data.LastLogID),
+		RoomName:      data.Room,
+		SupplierName:  data.Supplier,
+		Category:      data.Category,
+		Tags:          data.Tags,
+		LastChange:    timestampToProto(data.LastChanged),
+	}
+}
+
+func stockFromProto(data *inventorypb.StockInput) Stock {
+	return Stock{
+		ItemName:      data.GetItemName(),
+		Level:         data.GetLevel(),
+		RoomID:        int(data.GetRoomId()),
+		SupplierID:    int(data.GetSupplierId()),
+		IncidentLevel: data.GetIncidentLevel(),
+		Unit:          data.GetUnit(),
+		ShelfOrder:    int(data.GetShelfOrder()),
+		SKU:           data.GetSku(),
+		CategoryID:    int(data.GetCategoryId()),
+	}
+}
+
+func levelChangeToProto(data levelChange) *inventorypb.LevelChange {
+	return &inventorypb.LevelChange{
+		StockId:    int32(data.StockID),
+		RoomId:     int32(data.RoomID),
+		Level:      data.Level,
+		Differance: data.Differance,
+		LogId:      int32(data.LogID),
+		Reason:     data.Reason,
+	}
+}
+
+func logToProto(data Log) *inventorypb.Log {
+	return &inventorypb.Log{
+		LogId:        int32(data.LogID),
+		StockId:      int32(data.StockID),
+		ItemName:     data.ItemName,
+		Differance:   data.Differance,
+		TotalAfter:   data.TotalAfter,
+		IncidentTime: timestampToProto(data.IncidentTime),
+		Daily:        data.Daily,
+		Reason:       data.Reason,
+	}
+}
+
+func timestampToProto(t NullTime) *timestamppb.Timestamp {
+	if !t.Valid {
+		return nil
+	}
+	return timestamppb.New(t.Time)
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/ingar2005/inventory-backend-go/inventorypb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestGrpcError(t *testing.T) {
+	tests := []struct {
+		err  error
+		want codes.Code
+	}{
+		{errVersionMismatch, codes.FailedPrecondition},
+		{fmt.Errorf("update: %w", errVersionMismatch), codes.FailedPrecondition},
+		{sql.ErrNoRows, codes.NotFound},
+		{&mysql.MySQLError{Number: 1062, Message: "Duplicate entry"}, codes.AlreadyExists},
+		{errors.New("connection refused"), codes.Internal},
+	}
+	for _, test := range tests {
+		got := status.Code(grpcError(context.Background(), test.err))
+		if got != test.want {
+			t.Errorf("grpcError(%v) = %v, want %v", test.err, got, test.want)
+		}
+	}
+
+	// THE DATABASE ERROR ITSELF IS ONLY LOGGED
+	if msg := status.Convert(grpcError(context.Background(), errors.New("Error 1045: Access denied"))).Message(); msg != "internal error" {
+		t.Errorf("internal error message was %q", msg)
+	}
+}
+
+func TestStockFromProto(t *testing.T) {
+	got := stockFromProto(&inventorypb.StockInput{
+		ItemName:      "Cheddar",
+		Level:         4.5,
+		RoomId:        2,
+		SupplierId:    3,
+		IncidentLevel: 1,
+		Unit:          "kg",
+		ShelfOrder:    7,
+		Sku:           "CHD-01",
+		CategoryId:    5,
+	})
+	want := Stock{ItemName: "Cheddar", Level: 4.5, RoomID: 2, SupplierID: 3, IncidentLevel: 1, Unit: "kg", ShelfOrder: 7, SKU: "CHD-01", CategoryID: 5}
+	if got != want {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+
+	// A MISSING INPUT READS AS ALL ZERO VALUES, LEFT TO Stock.validate
+	if got := stockFromProto(nil); got != (Stock{}) {
+		t.Errorf("stockFromProto(nil) = %+v", got)
+	}
+}
+
+func TestTimestampToProto(t *testing.T) {
+	at := time.Date(2026, 3, 14, 9, 30, 0, 0, time.UTC)
+	tests := []struct {
+		in   NullTime
+		want *time.Time
+	}{
+		{NullTime{}, nil},
+		{NullTime{mysql.NullTime{Time: at, Valid: true}}, &at},
+	}
+	for _, test := range tests {
+		got := timestampToProto(test.in)
+		if (got == nil) != (test.want == nil) || (got != nil && !got.AsTime().Equal(*test.want)) {
+			t.Errorf("timestampToProto(%v) = %v, want %v", test.in, got, test.want)
+		}
+	}
+}
+
+func TestFullStockToProto(t *testing.T) {
+	data := FullStock{
+		StockID:     12,
+		ItemName:    "Cheddar",
+		RoomID:      2,
+		Room:        "Walk-in",
+		Supplier:    "Dairy Co",
+		Category:    "Cheese",
+		Tags:        []string{"chilled"},
+		LastChanged: NullTime{mysql.NullTime{Time: time.Now(), Valid: true}},
+		Version:     3,
+	}
+	got := fullStockToProto(data)
+	if got.StockId != 12 || got.RoomName != "Walk-in" || got.SupplierName != "Dairy Co" || got.Category != "Cheese" ||
+		len(got.Tags) != 1 || got.LastChange == nil || got.Version != 3 {
+		t.Errorf("got %v", got)
+	}
+}
+
+// fakeStockStream records what WatchStockChanges would send
+type fakeStockStream struct {
+	grpc.ServerStream
+	sent []*inventorypb.StockChange
+}
+
+func (s *fakeStockStream) Send(res *inventorypb.StockChange) error {
+	s.sent = append(s.sent, res)
+	return nil
+}
+
+func (s *fakeStockStream) Context() context.Context { return context.Background() }
+
+func TestSendStockChange(t *testing.T) {
+	tests := []struct {
+		event       Event
+		wantStockID int32
+		wantLevel   float64
+		wantStock   bool
+	}{
+		{Event{EventID: 1, Type: eventStockCreated, RoomID: 2, Data: []byte(`{"stockID":12,"itemName":"Cheddar","roomID":2}`)}, 12, 0, true},
+		{Event{EventID: 2, Type: eventStockLevelChanged, RoomID: 2, Data: []byte(`{"stockID":12,"roomID":2,"level":4,"differance":-1,"logID":9}`)}, 12, 4, false},
+		{Event{EventID: 3, Type: eventLogDeleted, RoomID: 2, Data: []byte(`{"logID":9,"stockID":12,"roomID":2,"level":5}`)}, 12, 5, false},
+		{Event{EventID: 4, Type: eventStockDeleted, RoomID: 2, Data: []byte(`{"stockID":12,"roomID":2}`)}, 12, 0, false},
+	}
+	for _, test := range tests {
+		stream := &fakeStockStream{}
+		err := sendStockChange(stream, test.event)
+		if err != nil || len(stream.sent) != 1 {
+			t.Errorf("%s: sent %d with %v", test.event.Type, len(stream.sent), err)
+			continue
+		}
+		got := stream.sent[0]
+		if got.EventId != int64(test.event.EventID) || got.Type != test.event.Type || got.StockId != test.wantStockID || got.RoomId != 2 {
+			t.Errorf("%s: got %v", test.event.Type, got)
+		}
+		if got.GetLevelChanged().GetLevel() != test.wantLevel || (got.GetStock() != nil) != test.wantStock {
+			t.Errorf("%s: got change %v", test.event.Type, got.Change)
+		}
+	}
+
+	stream := &fakeStockStream{}
+	err := sendStockChange(stream, Event{Type: eventStockUpdated, Data: []byte(`{"stockID":"twelve"}`)})
+	if status.Code(err) != codes.Internal || len(stream.sent) != 0 {
+		t.Errorf("bad event data sent %d with %v", len(stream.sent), err)
+	}
+}
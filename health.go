@@ -0,0 +1,173 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// readyTimeout is how long /readyz waits for the database
+const readyTimeout = 2 * time.Second
+
+// schemaTables are the tables initialiseTables creates, the newest last.
+// /readyz checks they all exist, so an instance pointed at a database that
+// has not been migrated yet is taken out of the load balancer.
+var schemaTables = []string{
+	"suppliers", "rooms", "stock", "logs", "barcodes", "categories", "stockTags", "alerts",
+	"alertChannels", "outbox", "webhooks", "webhookDeliveries", "idempotencyKeys", "syncChanges",
+	"sites", "supplierSites",
+}
+
+// metrics is what /metrics serves
+var metrics = prometheus.NewRegistry()
+
+var (
+	httpRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "http_requests_total",
+		Help: "HTTP requests by route, method and status code.",
+	}, []string{"route", "method", "code"})
+	httpDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "http_request_duration_seconds",
+		Help:    "How long HTTP requests took by route and method, /events streams last as long as the client stays.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"route", "method"})
+)
+
+// registerMetrics registers the runtime, request and database metrics
+func registerMetrics(db *sql.DB, dbName string) {
+	metrics.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		httpRequests,
+		httpDuration,
+		collectors.NewDBStatsCollector(db, dbName),
+		stockCollector{db},
+	)
+}
+
+// stockCollector counts stock from the database on every scrape
+type stockCollector struct {
+	db *sql.DB
+}
+
+var (
+	stockItemsDesc = prometheus.NewDesc("inventory_stock_items",
+		"Stock items by site and room.", []string{"site", "room"}, nil)
+	stockBelowIncidentDesc = prometheus.NewDesc("inventory_stock_below_incident_level",
+		"Stock items whose level is below their incident level, by site and room.", []string{"site", "room"}, nil)
+	openAlertsDesc = prometheus.NewDesc("inventory_open_alerts",
+		"Low stock alerts neither acknowledged nor resolved, by site.", []string{"site"}, nil)
+)
+
+func (c stockCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- stockItemsDesc
+	ch <- stockBelowIncidentDesc
+	ch <- openAlertsDesc
+}
+
+func (c stockCollector) Collect(ch chan<- prometheus.Metric) {
+	// EVERY SITE HAS A ROOM CALLED generic, SO ROOMS ARE LABELLED WITH THEIR SITE
+	rows, err := c.db.Query(`SELECT sites.siteName, rooms.roomName, COUNT(stock.stockID), COALESCE(SUM(stock.level < stock.incidentLevel), 0)
+		FROM rooms JOIN sites ON rooms.siteID = sites.siteID LEFT JOIN stock ON stock.roomID = rooms.roomID
+		GROUP BY rooms.roomID, sites.siteName, rooms.roomName`)
+	if err != nil {
+		ch <- prometheus.NewInvalidMetric(stockItemsDesc, err)
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var site, room string
+		var items, below float64
+		err = rows.Scan(&site, &room, &items, &below)
+		if err != nil {
+			ch <- prometheus.NewInvalidMetric(stockItemsDesc, err)
+			return
+		}
+		ch <- prometheus.MustNewConstMetric(stockItemsDesc, prometheus.GaugeValue, items, site, room)
+		ch <- prometheus.MustNewConstMetric(stockBelowIncidentDesc, prometheus.GaugeValue, below, site, room)
+	}
+	if err = rows.Err(); err != nil {
+		ch <- prometheus.NewInvalidMetric(stockItemsDesc, err)
+	}
+
+	alerts, err := c.db.Query(`SELECT sites.siteName, COUNT(*) FROM alerts
+		JOIN stock ON alerts.stockID = stock.stockID JOIN rooms ON stock.roomID = rooms.roomID JOIN sites ON rooms.siteID = sites.siteID
+		WHERE alerts.acknowledgedAt IS NULL AND alerts.resolvedAt IS NULL GROUP BY sites.siteID, sites.siteName`)
+	if err != nil {
+		ch <- prometheus.NewInvalidMetric(openAlertsDesc, err)
+		return
+	}
+	defer alerts.Close()
+	for alerts.Next() {
+		var site string
+		var open float64
+		err = alerts.Scan(&site, &open)
+		if err != nil {
+			ch <- prometheus.NewInvalidMetric(openAlertsDesc, err)
+			return
+		}
+		ch <- prometheus.MustNewConstMetric(openAlertsDesc, prometheus.GaugeValue, open, site)
+	}
+	if err = alerts.Err(); err != nil {
+		ch <- prometheus.NewInvalidMetric(openAlertsDesc, err)
+	}
+}
+
+// metricsHandler serves the metrics in the Prometheus text format
+func metricsHandler() http.Handler {
+	return promhttp.HandlerFor(metrics, promhttp.HandlerOpts{
+		ErrorLog: log.Default(),
+		// THE POOL AND REQUEST METRICS MATTER MOST WHEN THE DATABASE IS DOWN
+		ErrorHandling: promhttp.ContinueOnError,
+	})
+}
+
+// healthz answers as long as the process is serving, for liveness probes
+func healthz(w http.ResponseWriter, r *http.Request) {
+	fmt.Fprint(w, "ok")
+}
+
+// readyz answers 503 until the database can be reached and has every table,
+// for readiness probes and load balancer health checks
+func readyz(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), readyTimeout)
+	defer cancel()
+	err := checkReady(ctx)
+	if err != nil {
+		// THE REASON IS LOGGED, NOT SENT, IT MAY NAME THE DATABASE HOST
+		logRequestError(r, err)
+		http.Error(w, "database unavailable", http.StatusServiceUnavailable)
+		return
+	}
+	fmt.Fprint(w, "ok")
+}
+
+func checkReady(ctx context.Context) error {
+	err := db.PingContext(ctx)
+	if err != nil {
+		return fmt.Errorf("database: %w", err)
+	}
+	var count int
+	query := "SELECT COUNT(*) FROM information_schema.TABLES WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME IN (" +
+		strings.TrimSuffix(strings.Repeat("?,", len(schemaTables)), ",") + ")"
+	args := make([]any, len(schemaTables))
+	for i, table := range schemaTables {
+		args[i] = table
+	}
+	err = db.QueryRowContext(ctx, query, args...).Scan(&count)
+	if err != nil {
+		return fmt.Errorf("database: %w", err)
+	}
+	if count < len(schemaTables) {
+		return fmt.Errorf("migrations not applied, %d of %d tables exist", count, len(schemaTables))
+	}
+	return nil
+}
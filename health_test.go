@@ -0,0 +1,42 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestHealthz(t *testing.T) {
+	w := httptest.NewRecorder()
+	healthz(w, httptest.NewRequest("GET", "/healthz", nil))
+	if w.Code != http.StatusOK || w.Body.String() != "ok" {
+		t.Errorf("got %d %q", w.Code, w.Body.String())
+	}
+}
+
+func TestReadyzDatabaseDown(t *testing.T) {
+	openDownDB(t)
+
+	logs := captureLogs(t)
+	w := httptest.NewRecorder()
+	readyz(w, httptest.NewRequest("GET", "/readyz", nil))
+	if w.Code != http.StatusServiceUnavailable || w.Body.String() != "database unavailable\n" {
+		t.Errorf("got %d %q", w.Code, w.Body.String())
+	}
+	// THE DETAILS ONLY GO TO THE LOG
+	records := logRecords(t, logs)
+	if len(records) != 1 || !strings.HasPrefix(fmt.Sprint(records[0]["err"]), "database:") {
+		t.Errorf("logged %v, want the database error", records)
+	}
+}
+
+func TestReadyz(t *testing.T) {
+	openTestDB(t)
+	w := httptest.NewRecorder()
+	readyz(w, httptest.NewRequest("GET", "/readyz", nil))
+	if w.Code != http.StatusOK {
+		t.Errorf("got %d %q", w.Code, w.Body.String())
+	}
+}
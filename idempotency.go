@@ -0,0 +1,210 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+const (
+	// HOW LONG A KEY IS REMEMBERED, RETRIES AFTER THIS ARE RUN AGAIN
+	idempotencyRetention = 24 * time.Hour
+	// A CLAIM NOT COMPLETED IN THIS TIME IS TREATED AS ABANDONED, E.G. THE
+	// SERVER STOPPED PART WAY THROUGH
+	idempotencyLockTimeout = time.Minute
+	maxIdempotencyKey      = 255
+	// REQUESTS WITH A KEY ARE READ INTO MEMORY TO HASH AND REPLAY THEM
+	maxIdempotentBody = 8 << 20
+
+	createIdempotencyKeys = `
+	CREATE TABLE IF NOT EXISTS idempotencyKeys (
+		userName varchar(255) NOT NULL DEFAULT '',
+		idemKey varchar(255) NOT NULL,
+		requestHash char(64) NOT NULL,
+		status int,
+		headers json,
+		body mediumblob,
+		createdAt datetime NOT NULL,
+		completedAt datetime,
+		PRIMARY KEY (userName, idemKey),
+		INDEX (createdAt));
+	`
+)
+
+// replayedHeaders are the response headers stored with an idempotent
+// response and sent again when it is replayed
+var replayedHeaders = []string{"Content-Type", "Content-Disposition", "ETag", "Location", "X-Total-Count"}
+
+// idempotent makes POST, PATCH and DELETE requests carrying an
+// Idempotency-Key header safe to retry. Keys are per user. The first request
+// with a key is run and its response stored, a repeat with the same method,
+// path and body gets the stored response back with Idempotent-Replayed: true,
+// and a repeat with a different request is rejected with 422. Server errors
+// are not stored so the retry runs again.
+func idempotent(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get("Idempotency-Key")
+		if key == "" || (r.Method != http.MethodPost && r.Method != http.MethodPatch && r.Method != http.MethodDelete) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if len(key) > maxIdempotencyKey {
+			http.Error(w, "Idempotency-Key is too long", http.StatusBadRequest)
+			return
+		}
+
+		body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxIdempotentBody))
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			http.Error(w, fmt.Sprintf("body must be at most %d bytes", maxIdempotentBody), http.StatusRequestEntityTooLarge)
+			return
+		}
+		if err != nil {
+			http.Error(w, "could not read body", http.StatusBadRequest)
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		user := userFrom(r.Context())
+		requestHash := idempotencyHash(r, user, body)
+
+		claimed, err := claimIdempotencyKey(user, key, requestHash)
+		if err != nil {
+			slog.ErrorContext(r.Context(), "idempotency", "err", err)
+			http.Error(w, "could not check Idempotency-Key", http.StatusInternalServerError)
+			return
+		}
+		if !claimed {
+			replayIdempotent(w, r, user, key, requestHash)
+			return
+		}
+
+		rec := &recordingWriter{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(rec, r)
+
+		if rec.status >= 500 {
+			_, err = db.Exec("DELETE FROM idempotencyKeys WHERE userName=? AND idemKey=?", user, key)
+		} else {
+			headers := map[string]string{}
+			for _, name := range replayedHeaders {
+				if v := w.Header().Get(name); v != "" {
+					headers[name] = v
+				}
+			}
+			stored, _ := json.Marshal(headers)
+			_, err = db.Exec("UPDATE idempotencyKeys SET status=?, headers=?, body=?, completedAt=NOW() WHERE userName=? AND idemKey=?",
+				rec.status, stored, rec.body.Bytes(), user, key)
+		}
+		if err != nil {
+			slog.ErrorContext(r.Context(), "idempotency", "err", err)
+		}
+	})
+}
+
+// idempotencyHash identifies what a key was first sent with, so a repeat of
+// it can be told from another request reusing the key. The same key and body
+// sent to another site is another request.
+func idempotencyHash(r *http.Request, user string, body []byte) string {
+	hash := sha256.New()
+	fmt.Fprintf(hash, "%s %s %d %s\n", r.Method, r.URL.RequestURI(), siteFrom(r.Context()), user)
+	hash.Write(body)
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// claimIdempotencyKey records user's key as in progress, returning false when
+// it is already known. Expired keys and abandoned claims are taken over.
+func claimIdempotencyKey(user string, key string, requestHash string) (claimed bool, err error) {
+	_, err = db.Exec("DELETE FROM idempotencyKeys WHERE userName=? AND idemKey=? AND createdAt < NOW() - INTERVAL ? SECOND", user, key, int(idempotencyRetention/time.Second))
+	if err != nil {
+		return false, err
+	}
+	_, err = db.Exec("INSERT INTO idempotencyKeys(userName,idemKey,requestHash,createdAt) VALUES (?,?,?,NOW())", user, key, requestHash)
+	if err == nil {
+		return true, nil
+	}
+	if !isDuplicateKey(err) {
+		return false, err
+	}
+	res, err := db.Exec("UPDATE idempotencyKeys SET createdAt=NOW() WHERE userName=? AND idemKey=? AND requestHash=? AND completedAt IS NULL AND createdAt < NOW() - INTERVAL ? SECOND",
+		user, key, requestHash, int(idempotencyLockTimeout/time.Second))
+	if err != nil {
+		return false, err
+	}
+	taken, err := res.RowsAffected()
+	return taken == 1, err
+}
+
+// replayIdempotent answers a user's repeated key from what was stored for it
+func replayIdempotent(w http.ResponseWriter, r *http.Request, user string, key string, requestHash string) {
+	var storedHash string
+	var status sql.NullInt64
+	var headers, body []byte
+	err := db.QueryRow("SELECT requestHash, status, headers, body FROM idempotencyKeys WHERE userName=? AND idemKey=?", user, key).Scan(&storedHash, &status, &headers, &body)
+	if err == sql.ErrNoRows {
+		// REMOVED AFTER A SERVER ERROR SINCE IT WAS CLAIMED, LET THE CLIENT RETRY
+		http.Error(w, "request with this Idempotency-Key failed, retry it", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		slog.ErrorContext(r.Context(), "idempotency", "err", err)
+		http.Error(w, "could not check Idempotency-Key", http.StatusInternalServerError)
+		return
+	}
+	if storedHash != requestHash {
+		http.Error(w, "Idempotency-Key was already used for a different request", http.StatusUnprocessableEntity)
+		return
+	}
+	if !status.Valid {
+		http.Error(w, "request with this Idempotency-Key is still in progress", http.StatusConflict)
+		return
+	}
+
+	var stored map[string]string
+	json.Unmarshal(headers, &stored)
+	for name, v := range stored {
+		w.Header().Set(name, v)
+	}
+	w.Header().Set("Idempotent-Replayed", "true")
+	w.WriteHeader(int(status.Int64))
+	w.Write(body)
+}
+
+// startIdempotencySweeper deletes expired keys every interval
+func startIdempotencySweeper(ctx context.Context, interval time.Duration) {
+	every(ctx, interval, func() {
+		_, err := db.Exec("DELETE FROM idempotencyKeys WHERE createdAt < NOW() - INTERVAL ? SECOND", int(idempotencyRetention/time.Second))
+		if err != nil {
+			slog.Error("idempotency", "err", err)
+		}
+	})
+}
+
+// recordingWriter passes a response through while keeping a copy of it
+type recordingWriter struct {
+	http.ResponseWriter
+	status      int
+	body        bytes.Buffer
+	wroteHeader bool
+}
+
+func (rec *recordingWriter) WriteHeader(status int) {
+	if !rec.wroteHeader {
+		rec.status = status
+		rec.wroteHeader = true
+	}
+	rec.ResponseWriter.WriteHeader(status)
+}
+
+func (rec *recordingWriter) Write(b []byte) (int, error) {
+	rec.wroteHeader = true
+	rec.body.Write(b)
+	return rec.ResponseWriter.Write(b)
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestIdempotent(t *testing.T) {
+	openTestDB(t)
+	key := testKey(t)
+
+	calls := 0
+	status := http.StatusCreated
+	handler := idempotent(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		body, _ := io.ReadAll(r.Body)
+		w.Header().Set("Location", "/api/v1/stock/7")
+		w.WriteHeader(status)
+		fmt.Fprintf(w, "call %d %s", calls, body)
+	}))
+	send := func(user string, method string, body string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, "/api/v1/stock", strings.NewReader(body))
+		r.Header.Set("Idempotency-Key", key)
+		r = r.WithContext(withUser(r.Context(), AuthUser{Name: user}))
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		return w
+	}
+
+	tests := []struct {
+		name       string
+		user       string
+		method     string
+		body       string
+		wantStatus int
+		wantBody   string
+		wantCalls  int
+		replayed   bool
+	}{
+		{"first request runs", "pos", "POST", "a", http.StatusCreated, "call 1 a", 1, false},
+		{"retry is replayed", "pos", "POST", "a", http.StatusCreated, "call 1 a", 1, true},
+		{"another body is refused", "pos", "POST", "b", http.StatusUnprocessableEntity, "different request", 1, false},
+		{"another method is refused", "pos", "PATCH", "a", http.StatusUnprocessableEntity, "different request", 1, false},
+		{"GET ignores the key", "pos", "GET", "", http.StatusCreated, "call 2", 2, false},
+		{"keys are per user", "office", "POST", "a", http.StatusCreated, "call 3 a", 3, false},
+	}
+	for _, test := range tests {
+		w := send(test.user, test.method, test.body)
+		if w.Code != test.wantStatus || !strings.Contains(w.Body.String(), test.wantBody) {
+			t.Errorf("%s: got %d %q, want %d %q", test.name, w.Code, w.Body.String(), test.wantStatus, test.wantBody)
+		}
+		if calls != test.wantCalls {
+			t.Errorf("%s: handler ran %d times, want %d", test.name, calls, test.wantCalls)
+		}
+		if got := w.Header().Get("Idempotent-Replayed") == "true"; got != test.replayed {
+			t.Errorf("%s: replayed = %v, want %v", test.name, got, test.replayed)
+		}
+		if test.replayed && w.Header().Get("Location") != "/api/v1/stock/7" {
+			t.Errorf("%s: stored headers were not replayed: %v", test.name, w.Header())
+		}
+	}
+
+	// A SERVER ERROR IS NOT STORED, SO THE RETRY RUNS AGAIN
+	key = testKey(t)
+	status = http.StatusInternalServerError
+	send("bar", "POST", "c")
+	status = http.StatusOK
+	if w := send("bar", "POST", "c"); w.Code != http.StatusOK || calls != 5 {
+		t.Errorf("retry after a server error: got %d after %d calls, want 200 after 5", w.Code, calls)
+	}
+}
+
+func TestIdempotencyHash(t *testing.T) {
+	request := func(method string, url string, site int) *http.Request {
+		r := httptest.NewRequest(method, url, nil)
+		return r.WithContext(withSite(r.Context(), siteAccess{site: site}))
+	}
+	first := idempotencyHash(request("POST", "/api/v1/stock", 1), "pos", []byte(`{"itemName":"Cheddar"}`))
+
+	tests := []struct {
+		name     string
+		r        *http.Request
+		user     string
+		body     string
+		wantSame bool
+	}{
+		{"the same request", request("POST", "/api/v1/stock", 1), "pos", `{"itemName":"Cheddar"}`, true},
+		{"another method", request("PATCH", "/api/v1/stock", 1), "pos", `{"itemName":"Cheddar"}`, false},
+		{"another path", request("POST", "/api/v1/rooms", 1), "pos", `{"itemName":"Cheddar"}`, false},
+		{"another query", request("POST", "/api/v1/stock?mode=each", 1), "pos", `{"itemName":"Cheddar"}`, false},
+		{"another site", request("POST", "/api/v1/stock", 2), "pos", `{"itemName":"Cheddar"}`, false},
+		{"another user", request("POST", "/api/v1/stock", 1), "office", `{"itemName":"Cheddar"}`, false},
+		{"another body", request("POST", "/api/v1/stock", 1), "pos", `{"itemName":"Brie"}`, false},
+	}
+	for _, test := range tests {
+		got := idempotencyHash(test.r, test.user, []byte(test.body))
+		if (got == first) != test.wantSame || len(got) != 64 {
+			t.Errorf("%s: got %s, same as the first %v", test.name, got, got == first)
+		}
+	}
+}
+
+func TestIdempotentKeyTooLong(t *testing.T) {
+	handler := idempotent(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("handler ran")
+	}))
+	r := httptest.NewRequest("POST", "/api/v1/stock", strings.NewReader("a"))
+	r.Header.Set("Idempotency-Key", strings.Repeat("k", maxIdempotencyKey+1))
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("got %d, want 400", w.Code)
+	}
+}
+
+func TestIdempotentBodyTooLarge(t *testing.T) {
+	handler := idempotent(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("handler ran")
+	}))
+	r := httptest.NewRequest("POST", "/api/v1/stock", strings.NewReader(strings.Repeat("a", maxIdempotentBody+1)))
+	r.Header.Set("Idempotency-Key", "k")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	if w.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("got %d, want 413", w.Code)
+	}
+}
+
+func TestClaimIdempotencyKey(t *testing.T) {
+	openTestDB(t)
+	key := testKey(t)
+
+	claimed, err := claimIdempotencyKey("pos", key, "hash")
+	if err != nil || !claimed {
+		t.Fatalf("first claim: got %v, %v", claimed, err)
+	}
+	claimed, err = claimIdempotencyKey("pos", key, "hash")
+	if err != nil || claimed {
+		t.Fatalf("a key in progress was claimed again: %v, %v", claimed, err)
+	}
+
+	w := httptest.NewRecorder()
+	replayIdempotent(w, httptest.NewRequest("POST", "/api/v1/rooms", nil), "pos", key, "hash")
+	if w.Code != http.StatusConflict || !strings.Contains(w.Body.String(), "in progress") {
+		t.Errorf("replay while in progress: got %d %q", w.Code, w.Body.String())
+	}
+
+	// A CLAIM LEFT BY A CRASHED REQUEST IS TAKEN OVER AFTER THE LOCK TIMEOUT
+	_, err = db.Exec("UPDATE idempotencyKeys SET createdAt = NOW() - INTERVAL ? SECOND WHERE userName=? AND idemKey=?",
+		int(idempotencyLockTimeout/time.Second)+1, "pos", key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	claimed, err = claimIdempotencyKey("pos", key, "hash")
+	if err != nil || !claimed {
+		t.Errorf("stale claim was not taken over: %v, %v", claimed, err)
+	}
+}
@@ -0,0 +1,581 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// rows of an import are kept as column name -> raw value so CSV and JSON
+// can share the same validation
+type importRecord map[string]string
+
+type ImportSet struct {
+	Rooms     []importRecord `json:"rooms"`
+	Suppliers []importRecord `json:"suppliers"`
+	Stock     []importRecord `json:"stock"`
+}
+type ImportError struct {
+	Kind    string `json:"kind"`
+	Row     int    `json:"row"` // 1 BASED, NOT COUNTING THE CSV HEADER
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+type ImportResult struct {
+	DryRun    bool          `json:"dryRun"`
+	Rooms     int           `json:"rooms"`
+	Suppliers int           `json:"suppliers"`
+	Stock     int           `json:"stock"`
+	Errors    []ImportError `json:"errors"`
+}
+
+const (
+	importRooms     = "rooms"
+	importSuppliers = "suppliers"
+	importStock     = "stock"
+
+	// NAMES ARE ONLY LOOKED UP AT THE SITE BEING IMPORTED INTO
+	selectSiteRooms     = "SELECT roomID, roomName FROM rooms WHERE siteID=?"
+	selectSiteSuppliers = "SELECT suppliers.supplierID, suppliers.supplierName FROM suppliers JOIN supplierSites ON suppliers.supplierID = supplierSites.supplierID WHERE supplierSites.siteID=?"
+)
+
+// importHandler serves POST /import/{kind}, or /import/ for a combined set
+func importHandler(w http.ResponseWriter, r *http.Request) {
+	kind := r.PathValue("kind")
+	dryRun, _ := strconv.ParseBool(r.URL.Query().Get("dryRun"))
+
+	format := "json"
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "text/csv") {
+		format = "csv"
+	}
+	set, err := parseImport(r.Body, format, kind)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	res, err := runImport(set, siteFrom(r.Context()), dryRun)
+	if err != nil {
+		logRequestError(r, err)
+		http.Error(w, "import failed", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if len(res.Errors) > 0 {
+		w.WriteHeader(http.StatusUnprocessableEntity)
+	}
+	json.NewEncoder(w).Encode(res)
+}
+
+// importCommand runs an import from the command line, e.g.
+//
+//	inventory import -kind stock -dry-run stock.csv
+func importCommand(args []string) error {
+	fs := flag.NewFlagSet("import", flag.ExitOnError)
+	kind := fs.String("kind", "", "rooms, suppliers or stock (may be omitted for a combined JSON file)")
+	format := fs.String("format", "", "csv or json (defaults to the file extension)")
+	dryRun := fs.Bool("dry-run", false, "validate only, do not write anything")
+	site := fs.Int("site", defaultSite, "the site to import into")
+	fs.Parse(args)
+
+	if fs.NArg() != 1 {
+		return fmt.Errorf("usage: import [-kind k] [-format f] [-site n] [-dry-run] <file>")
+	}
+	path := fs.Arg(0)
+	if *format == "" {
+		*format = strings.TrimPrefix(strings.ToLower(filepath.Ext(path)), ".")
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	set, err := parseImport(file, *format, *kind)
+	if err != nil {
+		return err
+	}
+	exists, err := siteExists(context.Background(), *site)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return fmt.Errorf("there is no site %d", *site)
+	}
+	res, err := runImport(set, *site, *dryRun)
+	if err != nil {
+		return err
+	}
+
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	enc.Encode(res)
+	if len(res.Errors) > 0 {
+		return fmt.Errorf("import rejected with %d errors", len(res.Errors))
+	}
+	return nil
+}
+
+// PARSING
+
+func parseImport(r io.Reader, format string, kind string) (set ImportSet, err error) {
+	var records []importRecord
+
+	switch format {
+	case "csv":
+		if kind == "" {
+			return set, fmt.Errorf("csv imports need a kind (rooms, suppliers or stock)")
+		}
+		records, err = parseImportCSV(r)
+	case "json":
+		if kind == "" {
+			return parseImportJSONSet(r)
+		}
+		records, err = parseImportJSON(r)
+	default:
+		return set, fmt.Errorf("unknown import format %q", format)
+	}
+	if err != nil {
+		return set, err
+	}
+
+	switch kind {
+	case importRooms:
+		set.Rooms = records
+	case importSuppliers:
+		set.Suppliers = records
+	case importStock:
+		set.Stock = records
+	default:
+		return set, fmt.Errorf("unknown import kind %q", kind)
+	}
+	return set, nil
+}
+func parseImportCSV(r io.Reader) (res []importRecord, err error) {
+	reader := csv.NewReader(r)
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err != nil {
+		return res, fmt.Errorf("reading csv header: %w", err)
+	}
+	for {
+		line, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return res, err
+		}
+		record := importRecord{}
+		for i, column := range header {
+			if i < len(line) {
+				record[strings.TrimSpace(column)] = strings.TrimSpace(line[i])
+			}
+		}
+		res = append(res, record)
+	}
+	return res, nil
+}
+func parseImportJSON(r io.Reader) (res []importRecord, err error) {
+	var raw []map[string]any
+	dec := json.NewDecoder(r)
+	dec.UseNumber()
+	err = dec.Decode(&raw)
+	if err != nil {
+		return res, err
+	}
+	for _, item := range raw {
+		res = append(res, toImportRecord(item))
+	}
+	return res, nil
+}
+func parseImportJSONSet(r io.Reader) (set ImportSet, err error) {
+	var raw struct {
+		Rooms     []map[string]any `json:"rooms"`
+		Suppliers []map[string]any `json:"suppliers"`
+		Stock     []map[string]any `json:"stock"`
+	}
+	dec := json.NewDecoder(r)
+	dec.UseNumber()
+	err = dec.Decode(&raw)
+	if err != nil {
+		return set, err
+	}
+	for _, item := range raw.Rooms {
+		set.Rooms = append(set.Rooms, toImportRecord(item))
+	}
+	for _, item := range raw.Suppliers {
+		set.Suppliers = append(set.Suppliers, toImportRecord(item))
+	}
+	for _, item := range raw.Stock {
+		set.Stock = append(set.Stock, toImportRecord(item))
+	}
+	return set, nil
+}
+func toImportRecord(item map[string]any) importRecord {
+	record := importRecord{}
+	for key, value := range item {
+		if value == nil {
+			continue
+		}
+		switch v := value.(type) {
+		case json.Number:
+			// AS WRITTEN, fmt WOULD TURN 1000000 INTO 1e+06
+			record[key] = v.String()
+		default:
+			record[key] = strings.TrimSpace(fmt.Sprint(value))
+		}
+	}
+	return record
+}
+
+// VALIDATION
+
+type importedStock struct {
+	ItemName      string
+	Level         float64
+	Room          string
+	Supplier      string
+	IncidentLevel float64
+	Unit          string
+	ShelfOrder    int
+	SKU           string
+	Category      string
+}
+
+// validateImport checks every row before anything is written. Room and
+// supplier names used by stock rows may refer to existing rows at site or to
+// rows in the same import.
+func validateImport(tx *sql.Tx, set ImportSet, site int) (rooms []string, suppliers []Supplier, stock []importedStock, errs []ImportError, err error) {
+	roomIDs, err := namesToIDs(tx, selectSiteRooms, site)
+	if err != nil {
+		return
+	}
+	supplierIDs, err := namesToIDs(tx, selectSiteSuppliers, site)
+	if err != nil {
+		return
+	}
+	skus, err := namesToIDs(tx, "SELECT stockID, sku FROM stock WHERE sku IS NOT NULL")
+	if err != nil {
+		return
+	}
+	categoryIDs, err := namesToIDs(tx, "SELECT categoryID, categoryName FROM categories")
+	if err != nil {
+		return
+	}
+	fail := func(kind string, row int, field string, format string, a ...any) {
+		errs = append(errs, ImportError{Kind: kind, Row: row + 1, Field: field, Message: fmt.Sprintf(format, a...)})
+	}
+	// refer checks a stock row names exactly one room, supplier or category
+	refer := func(row int, field string, ids map[string]int64, name string) bool {
+		id, exists := ids[strings.ToLower(name)]
+		if !exists {
+			fail(importStock, row, field, "no %s named %q", field, name)
+		} else if id == ambiguousName {
+			fail(importStock, row, field, "more than one %s is named %q", field, name)
+		}
+		return exists && id != ambiguousName
+	}
+
+	for i, record := range set.Rooms {
+		name := record["roomName"]
+		key := strings.ToLower(name)
+		if name == "" {
+			fail(importRooms, i, "roomName", "is required")
+			continue
+		}
+		if _, exists := roomIDs[key]; exists {
+			fail(importRooms, i, "roomName", "room %q already exists", name)
+			continue
+		}
+		roomIDs[key] = 0
+		rooms = append(rooms, name)
+	}
+
+	days := []string{"mondayDeliver", "tuesdayDeliver", "wednesdayDeliver", "thursdayDeliver", "fridayDeliver", "saturdayDeliver", "sundayDeliver"}
+	for i, record := range set.Suppliers {
+		var data Supplier
+		ok := true
+
+		data.SupplierName = record["supplierName"]
+		key := strings.ToLower(data.SupplierName)
+		if data.SupplierName == "" {
+			fail(importSuppliers, i, "supplierName", "is required")
+			ok = false
+		} else if _, exists := supplierIDs[key]; exists {
+			fail(importSuppliers, i, "supplierName", "supplier %q already exists", data.SupplierName)
+			ok = false
+		}
+		data.SupplierContactNo = record["supplierContactNo"]
+
+		if value := record["leadTime"]; value != "" {
+			data.LeadTime, err = strconv.ParseInt(value, 10, 64)
+			if err != nil || data.LeadTime < 0 {
+				fail(importSuppliers, i, "leadTime", "%q is not a whole number of days", value)
+				ok = false
+			}
+			err = nil
+		}
+
+		deliver := make([]bool, len(days))
+		for d, day := range days {
+			value := record[day]
+			if value == "" {
+				continue
+			}
+			deliver[d], err = parseImportBool(value)
+			if err != nil {
+				fail(importSuppliers, i, day, "%q is not true or false", value)
+				ok = false
+			}
+			err = nil
+		}
+		data.MondayDeliver, data.TuesdayDeliver, data.WednesdayDeliver, data.ThursdayDeliver = deliver[0], deliver[1], deliver[2], deliver[3]
+		data.FridayDeliver, data.SaturdayDeliver, data.SundayDeliver = deliver[4], deliver[5], deliver[6]
+
+		if ok {
+			supplierIDs[key] = 0
+			suppliers = append(suppliers, data)
+		}
+	}
+
+	for i, record := range set.Stock {
+		var data importedStock
+		ok := true
+
+		data.ItemName = record["itemName"]
+		if data.ItemName == "" {
+			fail(importStock, i, "itemName", "is required")
+			ok = false
+		}
+		for _, field := range []string{"level", "incidentLevel"} {
+			value := record[field]
+			if value == "" {
+				continue
+			}
+			number, parseErr := strconv.ParseFloat(value, 64)
+			if parseErr != nil {
+				fail(importStock, i, field, "%q is not a number", value)
+				ok = false
+			}
+			if field == "level" {
+				data.Level = number
+			} else {
+				data.IncidentLevel = number
+			}
+		}
+
+		data.Unit = record["unit"]
+		data.SKU = record["sku"]
+		if data.SKU != "" {
+			if _, exists := skus[strings.ToLower(data.SKU)]; exists {
+				fail(importStock, i, "sku", "sku %q is already in use", data.SKU)
+				ok = false
+			}
+			skus[strings.ToLower(data.SKU)] = 0
+		}
+		if value := record["shelfOrder"]; value != "" {
+			data.ShelfOrder, err = strconv.Atoi(value)
+			if err != nil {
+				fail(importStock, i, "shelfOrder", "%q is not a whole number", value)
+				ok = false
+			}
+			err = nil
+		}
+
+		data.Room = record["room"]
+		if data.Room == "" {
+			data.Room = "generic"
+		}
+		if !refer(i, "room", roomIDs, data.Room) {
+			ok = false
+		}
+		data.Supplier = record["supplier"]
+		if data.Supplier == "" {
+			data.Supplier = "generic"
+		}
+		if !refer(i, "supplier", supplierIDs, data.Supplier) {
+			ok = false
+		}
+
+		data.Category = record["category"]
+		if data.Category != "" && !refer(i, "category", categoryIDs, data.Category) {
+			ok = false
+		}
+
+		if ok {
+			stock = append(stock, data)
+		}
+	}
+	return rooms, suppliers, stock, errs, nil
+}
+func parseImportBool(value string) (bool, error) {
+	switch strings.ToLower(value) {
+	case "y", "yes":
+		return true, nil
+	case "n", "no":
+		return false, nil
+	}
+	return strconv.ParseBool(value)
+}
+
+// ambiguousName is the id namesToIDs gives a name more than one row has
+const ambiguousName = -1
+
+// namesToIDs maps lower cased names to ids for a two column id, name query.
+// Names are matched ignoring case, so a name shared by several rows, e.g.
+// categories under different parents, maps to ambiguousName.
+func namesToIDs(tx *sql.Tx, query string, args ...any) (res map[string]int64, err error) {
+	res = map[string]int64{}
+	rows, err := tx.Query(query, args...)
+	if err != nil {
+		return res, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id int64
+		var name string
+		err = rows.Scan(&id, &name)
+		if err != nil {
+			return res, err
+		}
+		key := strings.ToLower(name)
+		if _, seen := res[key]; seen {
+			id = ambiguousName
+		}
+		res[key] = id
+	}
+	return res, rows.Err()
+}
+
+// APPLY
+
+// runImport validates the whole set and, unless it is a dry run or any row
+// failed, writes it in a single transaction. Rooms and suppliers are added
+// to site.
+func runImport(set ImportSet, site int, dryRun bool) (res ImportResult, err error) {
+	res.DryRun = dryRun
+	res.Errors = []ImportError{}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return res, err
+	}
+	defer tx.Rollback()
+
+	rooms, suppliers, stock, errs, err := validateImport(tx, set, site)
+	if err != nil {
+		return res, err
+	}
+	res.Rooms, res.Suppliers, res.Stock = len(rooms), len(suppliers), len(stock)
+	if len(errs) > 0 {
+		res.Errors = errs
+		return res, nil
+	}
+	if dryRun {
+		return res, nil
+	}
+
+	for _, name := range rooms {
+		inserted, err := tx.Exec("INSERT INTO rooms(roomName,siteID) VALUES (?,?)", name, site)
+		if err != nil {
+			return res, err
+		}
+		id, err := inserted.LastInsertId()
+		if err != nil {
+			return res, err
+		}
+		err = emitEvent(tx, eventRoomCreated, Room{RoomId: int(id), RoomName: name, SiteID: site, Version: 1})
+		if err != nil {
+			return res, err
+		}
+	}
+	for _, data := range suppliers {
+		var contactNo sql.NullString
+		if data.SupplierContactNo != "" {
+			contactNo = sql.NullString{String: data.SupplierContactNo, Valid: true}
+		}
+		inserted, err := tx.Exec(`INSERT INTO suppliers
+			(supplierName, supplierContact_no, leadTime,
+				mondayDeliver, tuesdayDeliver, wednesdayDeliver, thursdayDeliver, fridayDeliver, saturdayDeliver, sundayDeliver)
+			VALUES (?,?,?,?,?,?,?,?,?,?)`,
+			data.SupplierName, contactNo, data.LeadTime,
+			data.MondayDeliver, data.TuesdayDeliver, data.WednesdayDeliver, data.ThursdayDeliver, data.FridayDeliver, data.SaturdayDeliver, data.SundayDeliver)
+		if err != nil {
+			return res, err
+		}
+		data.SupplierID, err = inserted.LastInsertId()
+		if err != nil {
+			return res, err
+		}
+		_, err = tx.Exec("INSERT INTO supplierSites(supplierID,siteID) VALUES (?,?)", data.SupplierID, site)
+		if err != nil {
+			return res, err
+		}
+		data.SiteIDs = []int{site}
+		data.Version = 1
+		err = emitEvent(tx, eventSupplierCreated, data)
+		if err != nil {
+			return res, err
+		}
+	}
+
+	// RE-READ NOW THE NEW ROOMS AND SUPPLIERS HAVE IDS
+	roomIDs, err := namesToIDs(tx, selectSiteRooms, site)
+	if err != nil {
+		return res, err
+	}
+	supplierIDs, err := namesToIDs(tx, selectSiteSuppliers, site)
+	if err != nil {
+		return res, err
+	}
+	categoryIDs, err := namesToIDs(tx, "SELECT categoryID, categoryName FROM categories")
+	if err != nil {
+		return res, err
+	}
+	for _, data := range stock {
+		created := Stock{
+			ItemName:      data.ItemName,
+			Level:         data.Level,
+			RoomID:        int(roomIDs[strings.ToLower(data.Room)]),
+			SupplierID:    int(supplierIDs[strings.ToLower(data.Supplier)]),
+			IncidentLevel: data.IncidentLevel,
+			Unit:          data.Unit,
+			ShelfOrder:    data.ShelfOrder,
+			SKU:           data.SKU,
+			CategoryID:    int(categoryIDs[strings.ToLower(data.Category)]),
+			Version:       1,
+		}
+		inserted, err := tx.Exec("INSERT INTO stock(itemName,level,roomID,supplierID,incidentLevel,unit,shelfOrder,sku,categoryID) VALUES (?,?,?,?,?,?,?,?,?)",
+			created.ItemName, created.Level, created.RoomID, created.SupplierID, created.IncidentLevel, created.Unit, created.ShelfOrder, nullString(created.SKU), nullInt(created.CategoryID))
+		if err != nil {
+			return res, err
+		}
+		id, err := inserted.LastInsertId()
+		if err != nil {
+			return res, err
+		}
+		created.StockID = int(id)
+		err = emitEvent(tx, eventStockCreated, created)
+		if err != nil {
+			return res, err
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return res, err
+	}
+	return res, nil
+}
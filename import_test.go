@@ -0,0 +1,54 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseImport(t *testing.T) {
+	tests := []struct {
+		name   string
+		format string
+		kind   string
+		body   string
+		want   ImportSet
+	}{
+		{"csv", "csv", importStock, "itemName, level\n flour ,1000000\n",
+			ImportSet{Stock: []importRecord{{"itemName": "flour", "level": "1000000"}}}},
+		// NUMBERS STAY AS WRITTEN, NOT 1e+06
+		{"json", "json", importStock, `[{"itemName":"flour","level":1000000,"incidentLevel":0.25,"sku":null}]`,
+			ImportSet{Stock: []importRecord{{"itemName": "flour", "level": "1000000", "incidentLevel": "0.25"}}}},
+		{"json set", "json", "", `{"rooms":[{"roomName":"cellar"}],"stock":[{"itemName":"salt","shelfOrder":12000000}]}`,
+			ImportSet{Rooms: []importRecord{{"roomName": "cellar"}}, Stock: []importRecord{{"itemName": "salt", "shelfOrder": "12000000"}}}},
+	}
+	for _, test := range tests {
+		got, err := parseImport(strings.NewReader(test.body), test.format, test.kind)
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: got %+v, want %+v", test.name, got, test.want)
+		}
+	}
+}
+
+func TestParseImportInvalid(t *testing.T) {
+	tests := []struct {
+		name   string
+		format string
+		kind   string
+		body   string
+	}{
+		{"csv without a kind", "csv", "", "roomName\ncellar\n"},
+		{"unknown kind", "json", "widgets", `[]`},
+		{"unknown format", "xml", importRooms, `<rooms/>`},
+		{"bad json", "json", importRooms, `[{"roomName":`},
+	}
+	for _, test := range tests {
+		if _, err := parseImport(strings.NewReader(test.body), test.format, test.kind); err == nil {
+			t.Errorf("%s: no error", test.name)
+		}
+	}
+}
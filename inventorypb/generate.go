@@ -0,0 +1,4 @@
+// Package inventorypb is the gRPC API, generated from inventory.proto.
+package inventorypb
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative inventory.proto
@@ -0,0 +1,2372 @@
+// The gRPC API, the same operations as the HTTP API in openapi.yaml. Served on
+// its own port by the same process, see grpc.go.
+
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.6
+// 	protoc        v5.29.3
+// source: inventory.proto
+
+package inventorypb
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	timestamppb "google.golang.org/protobuf/types/known/timestamppb"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+type Supplier struct {
+	state             protoimpl.MessageState `protogen:"open.v1"`
+	SupplierId        int32                  `protobuf:"varint,1,opt,name=supplier_id,json=supplierId,proto3" json:"supplier_id,omitempty"`
+	SupplierName      string                 `protobuf:"bytes,2,opt,name=supplier_name,json=supplierName,proto3" json:"supplier_name,omitempty"`
+	SupplierContactNo string                 `protobuf:"bytes,3,opt,name=supplier_contact_no,json=supplierContactNo,proto3" json:"supplier_contact_no,omitempty"`
+	LeadTime          int32                  `protobuf:"varint,4,opt,name=lead_time,json=leadTime,proto3" json:"lead_time,omitempty"`
+	MondayDeliver     bool                   `protobuf:"varint,5,opt,name=monday_deliver,json=mondayDeliver,proto3" json:"monday_deliver,omitempty"`
+	TuesdayDeliver    bool                   `protobuf:"varint,6,opt,name=tuesday_deliver,json=tuesdayDeliver,proto3" json:"tuesday_deliver,omitempty"`
+	WednesdayDeliver  bool                   `protobuf:"varint,7,opt,name=wednesday_deliver,json=wednesdayDeliver,proto3" json:"wednesday_deliver,omitempty"`
+	ThursdayDeliver   bool                   `protobuf:"varint,8,opt,name=thursday_deliver,json=thursdayDeliver,proto3" json:"thursday_deliver,omitempty"`
+	FridayDeliver     bool                   `protobuf:"varint,9,opt,name=friday_deliver,json=fridayDeliver,proto3" json:"friday_deliver,omitempty"`
+	SaturdayDeliver   bool                   `protobuf:"varint,10,opt,name=saturday_deliver,json=saturdayDeliver,proto3" json:"saturday_deliver,omitempty"`
+	SundayDeliver     bool                   `protobuf:"varint,11,opt,name=sunday_deliver,json=sundayDeliver,proto3" json:"sunday_deliver,omitempty"`
+	Version           int32                  `protobuf:"varint,12,opt,name=version,proto3" json:"version,omitempty"`
+	unknownFields     protoimpl.UnknownFields
+	sizeCache         protoimpl.SizeCache
+}
+
+func (x *Supplier) Reset() {
+	*x = Supplier{}
+	mi := &file_inventory_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Supplier) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Supplier) ProtoMessage() {}
+
+func (x *Supplier) ProtoReflect() protoreflect.Message {
+	mi := &file_inventory_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Supplier.ProtoReflect.Descriptor instead.
+func (*Supplier) Descriptor() ([]byte, []int) {
+	return file_inventory_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *Supplier) GetSupplierId() int32 {
+	if x != nil {
+		return x.SupplierId
+	}
+	return 0
+}
+
+func (x *Supplier) GetSupplierName() string {
+	if x != nil {
+		return x.SupplierName
+	}
+	return ""
+}
+
+func (x *Supplier) GetSupplierContactNo() string {
+	if x != nil {
+		return x.SupplierContactNo
+	}
+	return ""
+}
+
+func (x *Supplier) GetLeadTime() int32 {
+	if x != nil {
+		return x.LeadTime
+	}
+	return 0
+}
+
+func (x *Supplier) GetMondayDeliver() bool {
+	if x != nil {
+		return x.MondayDeliver
+	}
+	return false
+}
+
+func (x *Supplier) GetTuesdayDeliver() bool {
+	if x != nil {
+		return x.TuesdayDeliver
+	}
+	return false
+}
+
+func (x *Supplier) GetWednesdayDeliver() bool {
+	if x != nil {
+		return x.WednesdayDeliver
+	}
+	return false
+}
+
+func (x *Supplier) GetThursdayDeliver() bool {
+	if x != nil {
+		return x.ThursdayDeliver
+	}
+	return false
+}
+
+func (x *Supplier) GetFridayDeliver() bool {
+	if x != nil {
+		return x.FridayDeliver
+	}
+	return false
+}
+
+func (x *Supplier) GetSaturdayDeliver() bool {
+	if x != nil {
+		return x.SaturdayDeliver
+	}
+	return false
+}
+
+func (x *Supplier) GetSundayDeliver() bool {
+	if x != nil {
+		return x.SundayDeliver
+	}
+	return false
+}
+
+func (x *Supplier) GetVersion() int32 {
+	if x != nil {
+		return x.Version
+	}
+	return 0
+}
+
+type Room struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	RoomId        int32                  `protobuf:"varint,1,opt,name=room_id,json=roomId,proto3" json:"room_id,omitempty"`
+	RoomName      string                 `protobuf:"bytes,2,opt,name=room_name,json=roomName,proto3" json:"room_name,omitempty"`
+	Version       int32                  `protobuf:"varint,3,opt,name=version,proto3" json:"version,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Room) Reset() {
+	*x = Room{}
+	mi := &file_inventory_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Room) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Room) ProtoMessage() {}
+
+func (x *Room) ProtoReflect() protoreflect.Message {
+	mi := &file_inventory_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Room.ProtoReflect.Descriptor instead.
+func (*Room) Descriptor() ([]byte, []int) {
+	return file_inventory_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *Room) GetRoomId() int32 {
+	if x != nil {
+		return x.RoomId
+	}
+	return 0
+}
+
+func (x *Room) GetRoomName() string {
+	if x != nil {
+		return x.RoomName
+	}
+	return ""
+}
+
+func (x *Room) GetVersion() int32 {
+	if x != nil {
+		return x.Version
+	}
+	return 0
+}
+
+type Stock struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	StockId       int32                  `protobuf:"varint,1,opt,name=stock_id,json=stockId,proto3" json:"stock_id,omitempty"`
+	ItemName      string                 `protobuf:"bytes,2,opt,name=item_name,json=itemName,proto3" json:"item_name,omitempty"`
+	Level         float64                `protobuf:"fixed64,3,opt,name=level,proto3" json:"level,omitempty"`
+	RoomId        int32                  `protobuf:"varint,4,opt,name=room_id,json=roomId,proto3" json:"room_id,omitempty"`
+	SupplierId    int32                  `protobuf:"varint,5,opt,name=supplier_id,json=supplierId,proto3" json:"supplier_id,omitempty"`
+	IncidentLevel float64                `protobuf:"fixed64,6,opt,name=incident_level,json=incidentLevel,proto3" json:"incident_level,omitempty"`
+	Unit          string                 `protobuf:"bytes,7,opt,name=unit,proto3" json:"unit,omitempty"`
+	ShelfOrder    int32                  `protobuf:"varint,8,opt,name=shelf_order,json=shelfOrder,proto3" json:"shelf_order,omitempty"`
+	Sku           string                 `protobuf:"bytes,9,opt,name=sku,proto3" json:"sku,omitempty"`
+	CategoryId    int32                  `protobuf:"varint,10,opt,name=category_id,json=categoryId,proto3" json:"category_id,omitempty"` // 0 when uncategorised
+	Version       int32                  `protobuf:"varint,11,opt,name=version,proto3" json:"version,omitempty"`
+	LastLogId     int32                  `protobuf:"varint,12,opt,name=last_log_id,json=lastLogId,proto3" json:"last_log_id,omitempty"`
+	// Only set when read, not in StockChange
+	RoomName      string                 `protobuf:"bytes,13,opt,name=room_name,json=roomName,proto3" json:"room_name,omitempty"`
+	SupplierName  string                 `protobuf:"bytes,14,opt,name=supplier_name,json=supplierName,proto3" json:"supplier_name,omitempty"`
+	Category      string                 `protobuf:"bytes,15,opt,name=category,proto3" json:"category,omitempty"`
+	Tags          []string               `protobuf:"bytes,16,rep,name=tags,proto3" json:"tags,omitempty"`
+	LastChange    *timestamppb.Timestamp `protobuf:"bytes,17,opt,name=last_change,json=lastChange,proto3" json:"last_change,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Stock) Reset() {
+	*x = Stock{}
+	mi := &file_inventory_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Stock) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Stock) ProtoMessage() {}
+
+func (x *Stock) ProtoReflect() protoreflect.Message {
+	mi := &file_inventory_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Stock.ProtoReflect.Descriptor instead.
+func (*Stock) Descriptor() ([]byte, []int) {
+	return file_inventory_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *Stock) GetStockId() int32 {
+	if x != nil {
+		return x.StockId
+	}
+	return 0
+}
+
+func (x *Stock) GetItemName() string {
+	if x != nil {
+		return x.ItemName
+	}
+	return ""
+}
+
+func (x *Stock) GetLevel() float64 {
+	if x != nil {
+		return x.Level
+	}
+	return 0
+}
+
+func (x *Stock) GetRoomId() int32 {
+	if x != nil {
+		return x.RoomId
+	}
+	return 0
+}
+
+func (x *Stock) GetSupplierId() int32 {
+	if x != nil {
+		return x.SupplierId
+	}
+	return 0
+}
+
+func (x *Stock) GetIncidentLevel() float64 {
+	if x != nil {
+		return x.IncidentLevel
+	}
+	return 0
+}
+
+func (x *Stock) GetUnit() string {
+	if x != nil {
+		return x.Unit
+	}
+	return ""
+}
+
+func (x *Stock) GetShelfOrder() int32 {
+	if x != nil {
+		return x.ShelfOrder
+	}
+	return 0
+}
+
+func (x *Stock) GetSku() string {
+	if x != nil {
+		return x.Sku
+	}
+	return ""
+}
+
+func (x *Stock) GetCategoryId() int32 {
+	if x != nil {
+		return x.CategoryId
+	}
+	return 0
+}
+
+func (x *Stock) GetVersion() int32 {
+	if x != nil {
+		return x.Version
+	}
+	return 0
+}
+
+func (x *Stock) GetLastLogId() int32 {
+	if x != nil {
+		return x.LastLogId
+	}
+	return 0
+}
+
+func (x *Stock) GetRoomName() string {
+	if x != nil {
+		return x.RoomName
+	}
+	return ""
+}
+
+func (x *Stock) GetSupplierName() string {
+	if x != nil {
+		return x.SupplierName
+	}
+	return ""
+}
+
+func (x *Stock) GetCategory() string {
+	if x != nil {
+		return x.Category
+	}
+	return ""
+}
+
+func (x *Stock) GetTags() []string {
+	if x != nil {
+		return x.Tags
+	}
+	return nil
+}
+
+func (x *Stock) GetLastChange() *timestamppb.Timestamp {
+	if x != nil {
+		return x.LastChange
+	}
+	return nil
+}
+
+type LevelChange struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	StockId       int32                  `protobuf:"varint,1,opt,name=stock_id,json=stockId,proto3" json:"stock_id,omitempty"`
+	RoomId        int32                  `protobuf:"varint,2,opt,name=room_id,json=roomId,proto3" json:"room_id,omitempty"`
+	Level         float64                `protobuf:"fixed64,3,opt,name=level,proto3" json:"level,omitempty"`
+	Differance    float64                `protobuf:"fixed64,4,opt,name=differance,proto3" json:"differance,omitempty"`
+	LogId         int32                  `protobuf:"varint,5,opt,name=log_id,json=logId,proto3" json:"log_id,omitempty"`
+	Reason        string                 `protobuf:"bytes,6,opt,name=reason,proto3" json:"reason,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *LevelChange) Reset() {
+	*x = LevelChange{}
+	mi := &file_inventory_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *LevelChange) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*LevelChange) ProtoMessage() {}
+
+func (x *LevelChange) ProtoReflect() protoreflect.Message {
+	mi := &file_inventory_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use LevelChange.ProtoReflect.Descriptor instead.
+func (*LevelChange) Descriptor() ([]byte, []int) {
+	return file_inventory_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *LevelChange) GetStockId() int32 {
+	if x != nil {
+		return x.StockId
+	}
+	return 0
+}
+
+func (x *LevelChange) GetRoomId() int32 {
+	if x != nil {
+		return x.RoomId
+	}
+	return 0
+}
+
+func (x *LevelChange) GetLevel() float64 {
+	if x != nil {
+		return x.Level
+	}
+	return 0
+}
+
+func (x *LevelChange) GetDifferance() float64 {
+	if x != nil {
+		return x.Differance
+	}
+	return 0
+}
+
+func (x *LevelChange) GetLogId() int32 {
+	if x != nil {
+		return x.LogId
+	}
+	return 0
+}
+
+func (x *LevelChange) GetReason() string {
+	if x != nil {
+		return x.Reason
+	}
+	return ""
+}
+
+type Log struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	LogId         int32                  `protobuf:"varint,1,opt,name=log_id,json=logId,proto3" json:"log_id,omitempty"`
+	StockId       int32                  `protobuf:"varint,2,opt,name=stock_id,json=stockId,proto3" json:"stock_id,omitempty"`
+	ItemName      string                 `protobuf:"bytes,3,opt,name=item_name,json=itemName,proto3" json:"item_name,omitempty"`
+	Differance    float64                `protobuf:"fixed64,4,opt,name=differance,proto3" json:"differance,omitempty"`
+	TotalAfter    float64                `protobuf:"fixed64,5,opt,name=total_after,json=totalAfter,proto3" json:"total_after,omitempty"`
+	IncidentTime  *timestamppb.Timestamp `protobuf:"bytes,6,opt,name=incident_time,json=incidentTime,proto3" json:"incident_time,omitempty"`
+	Daily         bool                   `protobuf:"varint,7,opt,name=daily,proto3" json:"daily,omitempty"`
+	Reason        string                 `protobuf:"bytes,8,opt,name=reason,proto3" json:"reason,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Log) Reset() {
+	*x = Log{}
+	mi := &file_inventory_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Log) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Log) ProtoMessage() {}
+
+func (x *Log) ProtoReflect() protoreflect.Message {
+	mi := &file_inventory_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Log.ProtoReflect.Descriptor instead.
+func (*Log) Descriptor() ([]byte, []int) {
+	return file_inventory_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *Log) GetLogId() int32 {
+	if x != nil {
+		return x.LogId
+	}
+	return 0
+}
+
+func (x *Log) GetStockId() int32 {
+	if x != nil {
+		return x.StockId
+	}
+	return 0
+}
+
+func (x *Log) GetItemName() string {
+	if x != nil {
+		return x.ItemName
+	}
+	return ""
+}
+
+func (x *Log) GetDifferance() float64 {
+	if x != nil {
+		return x.Differance
+	}
+	return 0
+}
+
+func (x *Log) GetTotalAfter() float64 {
+	if x != nil {
+		return x.TotalAfter
+	}
+	return 0
+}
+
+func (x *Log) GetIncidentTime() *timestamppb.Timestamp {
+	if x != nil {
+		return x.IncidentTime
+	}
+	return nil
+}
+
+func (x *Log) GetDaily() bool {
+	if x != nil {
+		return x.Daily
+	}
+	return false
+}
+
+func (x *Log) GetReason() string {
+	if x != nil {
+		return x.Reason
+	}
+	return ""
+}
+
+type ListSuppliersRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListSuppliersRequest) Reset() {
+	*x = ListSuppliersRequest{}
+	mi := &file_inventory_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListSuppliersRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListSuppliersRequest) ProtoMessage() {}
+
+func (x *ListSuppliersRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_inventory_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListSuppliersRequest.ProtoReflect.Descriptor instead.
+func (*ListSuppliersRequest) Descriptor() ([]byte, []int) {
+	return file_inventory_proto_rawDescGZIP(), []int{5}
+}
+
+type ListSuppliersResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Suppliers     []*Supplier            `protobuf:"bytes,1,rep,name=suppliers,proto3" json:"suppliers,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListSuppliersResponse) Reset() {
+	*x = ListSuppliersResponse{}
+	mi := &file_inventory_proto_msgTypes[6]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListSuppliersResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListSuppliersResponse) ProtoMessage() {}
+
+func (x *ListSuppliersResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_inventory_proto_msgTypes[6]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListSuppliersResponse.ProtoReflect.Descriptor instead.
+func (*ListSuppliersResponse) Descriptor() ([]byte, []int) {
+	return file_inventory_proto_rawDescGZIP(), []int{6}
+}
+
+func (x *ListSuppliersResponse) GetSuppliers() []*Supplier {
+	if x != nil {
+		return x.Suppliers
+	}
+	return nil
+}
+
+type GetSupplierRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	SupplierId    int32                  `protobuf:"varint,1,opt,name=supplier_id,json=supplierId,proto3" json:"supplier_id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetSupplierRequest) Reset() {
+	*x = GetSupplierRequest{}
+	mi := &file_inventory_proto_msgTypes[7]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetSupplierRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetSupplierRequest) ProtoMessage() {}
+
+func (x *GetSupplierRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_inventory_proto_msgTypes[7]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetSupplierRequest.ProtoReflect.Descriptor instead.
+func (*GetSupplierRequest) Descriptor() ([]byte, []int) {
+	return file_inventory_proto_rawDescGZIP(), []int{7}
+}
+
+func (x *GetSupplierRequest) GetSupplierId() int32 {
+	if x != nil {
+		return x.SupplierId
+	}
+	return 0
+}
+
+type ListRoomsRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListRoomsRequest) Reset() {
+	*x = ListRoomsRequest{}
+	mi := &file_inventory_proto_msgTypes[8]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListRoomsRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListRoomsRequest) ProtoMessage() {}
+
+func (x *ListRoomsRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_inventory_proto_msgTypes[8]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListRoomsRequest.ProtoReflect.Descriptor instead.
+func (*ListRoomsRequest) Descriptor() ([]byte, []int) {
+	return file_inventory_proto_rawDescGZIP(), []int{8}
+}
+
+type ListRoomsResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Rooms         []*Room                `protobuf:"bytes,1,rep,name=rooms,proto3" json:"rooms,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListRoomsResponse) Reset() {
+	*x = ListRoomsResponse{}
+	mi := &file_inventory_proto_msgTypes[9]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListRoomsResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListRoomsResponse) ProtoMessage() {}
+
+func (x *ListRoomsResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_inventory_proto_msgTypes[9]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListRoomsResponse.ProtoReflect.Descriptor instead.
+func (*ListRoomsResponse) Descriptor() ([]byte, []int) {
+	return file_inventory_proto_rawDescGZIP(), []int{9}
+}
+
+func (x *ListRoomsResponse) GetRooms() []*Room {
+	if x != nil {
+		return x.Rooms
+	}
+	return nil
+}
+
+type GetRoomRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	RoomId        int32                  `protobuf:"varint,1,opt,name=room_id,json=roomId,proto3" json:"room_id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetRoomRequest) Reset() {
+	*x = GetRoomRequest{}
+	mi := &file_inventory_proto_msgTypes[10]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetRoomRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetRoomRequest) ProtoMessage() {}
+
+func (x *GetRoomRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_inventory_proto_msgTypes[10]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetRoomRequest.ProtoReflect.Descriptor instead.
+func (*GetRoomRequest) Descriptor() ([]byte, []int) {
+	return file_inventory_proto_rawDescGZIP(), []int{10}
+}
+
+func (x *GetRoomRequest) GetRoomId() int32 {
+	if x != nil {
+		return x.RoomId
+	}
+	return 0
+}
+
+type CreateRoomRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	RoomName      string                 `protobuf:"bytes,1,opt,name=room_name,json=roomName,proto3" json:"room_name,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *CreateRoomRequest) Reset() {
+	*x = CreateRoomRequest{}
+	mi := &file_inventory_proto_msgTypes[11]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *CreateRoomRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*CreateRoomRequest) ProtoMessage() {}
+
+func (x *CreateRoomRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_inventory_proto_msgTypes[11]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use CreateRoomRequest.ProtoReflect.Descriptor instead.
+func (*CreateRoomRequest) Descriptor() ([]byte, []int) {
+	return file_inventory_proto_rawDescGZIP(), []int{11}
+}
+
+func (x *CreateRoomRequest) GetRoomName() string {
+	if x != nil {
+		return x.RoomName
+	}
+	return ""
+}
+
+type UpdateRoomRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	RoomId        int32                  `protobuf:"varint,1,opt,name=room_id,json=roomId,proto3" json:"room_id,omitempty"`
+	RoomName      string                 `protobuf:"bytes,2,opt,name=room_name,json=roomName,proto3" json:"room_name,omitempty"`
+	Version       int32                  `protobuf:"varint,3,opt,name=version,proto3" json:"version,omitempty"` // required
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *UpdateRoomRequest) Reset() {
+	*x = UpdateRoomRequest{}
+	mi := &file_inventory_proto_msgTypes[12]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *UpdateRoomRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*UpdateRoomRequest) ProtoMessage() {}
+
+func (x *UpdateRoomRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_inventory_proto_msgTypes[12]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use UpdateRoomRequest.ProtoReflect.Descriptor instead.
+func (*UpdateRoomRequest) Descriptor() ([]byte, []int) {
+	return file_inventory_proto_rawDescGZIP(), []int{12}
+}
+
+func (x *UpdateRoomRequest) GetRoomId() int32 {
+	if x != nil {
+		return x.RoomId
+	}
+	return 0
+}
+
+func (x *UpdateRoomRequest) GetRoomName() string {
+	if x != nil {
+		return x.RoomName
+	}
+	return ""
+}
+
+func (x *UpdateRoomRequest) GetVersion() int32 {
+	if x != nil {
+		return x.Version
+	}
+	return 0
+}
+
+type DeleteRoomRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	RoomId        int32                  `protobuf:"varint,1,opt,name=room_id,json=roomId,proto3" json:"room_id,omitempty"`
+	Version       int32                  `protobuf:"varint,2,opt,name=version,proto3" json:"version,omitempty"` // required
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *DeleteRoomRequest) Reset() {
+	*x = DeleteRoomRequest{}
+	mi := &file_inventory_proto_msgTypes[13]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *DeleteRoomRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*DeleteRoomRequest) ProtoMessage() {}
+
+func (x *DeleteRoomRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_inventory_proto_msgTypes[13]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use DeleteRoomRequest.ProtoReflect.Descriptor instead.
+func (*DeleteRoomRequest) Descriptor() ([]byte, []int) {
+	return file_inventory_proto_rawDescGZIP(), []int{13}
+}
+
+func (x *DeleteRoomRequest) GetRoomId() int32 {
+	if x != nil {
+		return x.RoomId
+	}
+	return 0
+}
+
+func (x *DeleteRoomRequest) GetVersion() int32 {
+	if x != nil {
+		return x.Version
+	}
+	return 0
+}
+
+type DeleteRoomResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *DeleteRoomResponse) Reset() {
+	*x = DeleteRoomResponse{}
+	mi := &file_inventory_proto_msgTypes[14]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *DeleteRoomResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*DeleteRoomResponse) ProtoMessage() {}
+
+func (x *DeleteRoomResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_inventory_proto_msgTypes[14]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use DeleteRoomResponse.ProtoReflect.Descriptor instead.
+func (*DeleteRoomResponse) Descriptor() ([]byte, []int) {
+	return file_inventory_proto_rawDescGZIP(), []int{14}
+}
+
+// The same filters as GET /fullStock
+type ListStockRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	RoomId        int32                  `protobuf:"varint,1,opt,name=room_id,json=roomId,proto3" json:"room_id,omitempty"`
+	SupplierId    int32                  `protobuf:"varint,2,opt,name=supplier_id,json=supplierId,proto3" json:"supplier_id,omitempty"`
+	CategoryId    int32                  `protobuf:"varint,3,opt,name=category_id,json=categoryId,proto3" json:"category_id,omitempty"` // including its subcategories
+	Tag           string                 `protobuf:"bytes,4,opt,name=tag,proto3" json:"tag,omitempty"`
+	Search        string                 `protobuf:"bytes,5,opt,name=search,proto3" json:"search,omitempty"`
+	Match         string                 `protobuf:"bytes,6,opt,name=match,proto3" json:"match,omitempty"` // prefix (the default) or fuzzy
+	BelowIncident bool                   `protobuf:"varint,7,opt,name=below_incident,json=belowIncident,proto3" json:"below_incident,omitempty"`
+	ChangedSince  *timestamppb.Timestamp `protobuf:"bytes,8,opt,name=changed_since,json=changedSince,proto3" json:"changed_since,omitempty"`
+	Sort          string                 `protobuf:"bytes,9,opt,name=sort,proto3" json:"sort,omitempty"` // comma separated fields, - in front for descending
+	Limit         int32                  `protobuf:"varint,10,opt,name=limit,proto3" json:"limit,omitempty"`
+	Offset        int32                  `protobuf:"varint,11,opt,name=offset,proto3" json:"offset,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListStockRequest) Reset() {
+	*x = ListStockRequest{}
+	mi := &file_inventory_proto_msgTypes[15]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListStockRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListStockRequest) ProtoMessage() {}
+
+func (x *ListStockRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_inventory_proto_msgTypes[15]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListStockRequest.ProtoReflect.Descriptor instead.
+func (*ListStockRequest) Descriptor() ([]byte, []int) {
+	return file_inventory_proto_rawDescGZIP(), []int{15}
+}
+
+func (x *ListStockRequest) GetRoomId() int32 {
+	if x != nil {
+		return x.RoomId
+	}
+	return 0
+}
+
+func (x *ListStockRequest) GetSupplierId() int32 {
+	if x != nil {
+		return x.SupplierId
+	}
+	return 0
+}
+
+func (x *ListStockRequest) GetCategoryId() int32 {
+	if x != nil {
+		return x.CategoryId
+	}
+	return 0
+}
+
+func (x *ListStockRequest) GetTag() string {
+	if x != nil {
+		return x.Tag
+	}
+	return ""
+}
+
+func (x *ListStockRequest) GetSearch() string {
+	if x != nil {
+		return x.Search
+	}
+	return ""
+}
+
+func (x *ListStockRequest) GetMatch() string {
+	if x != nil {
+		return x.Match
+	}
+	return ""
+}
+
+func (x *ListStockRequest) GetBelowIncident() bool {
+	if x != nil {
+		return x.BelowIncident
+	}
+	return false
+}
+
+func (x *ListStockRequest) GetChangedSince() *timestamppb.Timestamp {
+	if x != nil {
+		return x.ChangedSince
+	}
+	return nil
+}
+
+func (x *ListStockRequest) GetSort() string {
+	if x != nil {
+		return x.Sort
+	}
+	return ""
+}
+
+func (x *ListStockRequest) GetLimit() int32 {
+	if x != nil {
+		return x.Limit
+	}
+	return 0
+}
+
+func (x *ListStockRequest) GetOffset() int32 {
+	if x != nil {
+		return x.Offset
+	}
+	return 0
+}
+
+type ListStockResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Stock         []*Stock               `protobuf:"bytes,1,rep,name=stock,proto3" json:"stock,omitempty"`
+	TotalCount    int32                  `protobuf:"varint,2,opt,name=total_count,json=totalCount,proto3" json:"total_count,omitempty"` // ignoring limit and offset
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListStockResponse) Reset() {
+	*x = ListStockResponse{}
+	mi := &file_inventory_proto_msgTypes[16]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListStockResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListStockResponse) ProtoMessage() {}
+
+func (x *ListStockResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_inventory_proto_msgTypes[16]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListStockResponse.ProtoReflect.Descriptor instead.
+func (*ListStockResponse) Descriptor() ([]byte, []int) {
+	return file_inventory_proto_rawDescGZIP(), []int{16}
+}
+
+func (x *ListStockResponse) GetStock() []*Stock {
+	if x != nil {
+		return x.Stock
+	}
+	return nil
+}
+
+func (x *ListStockResponse) GetTotalCount() int32 {
+	if x != nil {
+		return x.TotalCount
+	}
+	return 0
+}
+
+type GetStockRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	StockId       int32                  `protobuf:"varint,1,opt,name=stock_id,json=stockId,proto3" json:"stock_id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetStockRequest) Reset() {
+	*x = GetStockRequest{}
+	mi := &file_inventory_proto_msgTypes[17]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetStockRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetStockRequest) ProtoMessage() {}
+
+func (x *GetStockRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_inventory_proto_msgTypes[17]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetStockRequest.ProtoReflect.Descriptor instead.
+func (*GetStockRequest) Descriptor() ([]byte, []int) {
+	return file_inventory_proto_rawDescGZIP(), []int{17}
+}
+
+func (x *GetStockRequest) GetStockId() int32 {
+	if x != nil {
+		return x.StockId
+	}
+	return 0
+}
+
+type StockInput struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	ItemName      string                 `protobuf:"bytes,1,opt,name=item_name,json=itemName,proto3" json:"item_name,omitempty"`
+	Level         float64                `protobuf:"fixed64,2,opt,name=level,proto3" json:"level,omitempty"`
+	RoomId        int32                  `protobuf:"varint,3,opt,name=room_id,json=roomId,proto3" json:"room_id,omitempty"`
+	SupplierId    int32                  `protobuf:"varint,4,opt,name=supplier_id,json=supplierId,proto3" json:"supplier_id,omitempty"`
+	IncidentLevel float64                `protobuf:"fixed64,5,opt,name=incident_level,json=incidentLevel,proto3" json:"incident_level,omitempty"`
+	Unit          string                 `protobuf:"bytes,6,opt,name=unit,proto3" json:"unit,omitempty"`
+	ShelfOrder    int32                  `protobuf:"varint,7,opt,name=shelf_order,json=shelfOrder,proto3" json:"shelf_order,omitempty"`
+	Sku           string                 `protobuf:"bytes,8,opt,name=sku,proto3" json:"sku,omitempty"`
+	CategoryId    int32                  `protobuf:"varint,9,opt,name=category_id,json=categoryId,proto3" json:"category_id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *StockInput) Reset() {
+	*x = StockInput{}
+	mi := &file_inventory_proto_msgTypes[18]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *StockInput) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*StockInput) ProtoMessage() {}
+
+func (x *StockInput) ProtoReflect() protoreflect.Message {
+	mi := &file_inventory_proto_msgTypes[18]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use StockInput.ProtoReflect.Descriptor instead.
+func (*StockInput) Descriptor() ([]byte, []int) {
+	return file_inventory_proto_rawDescGZIP(), []int{18}
+}
+
+func (x *StockInput) GetItemName() string {
+	if x != nil {
+		return x.ItemName
+	}
+	return ""
+}
+
+func (x *StockInput) GetLevel() float64 {
+	if x != nil {
+		return x.Level
+	}
+	return 0
+}
+
+func (x *StockInput) GetRoomId() int32 {
+	if x != nil {
+		return x.RoomId
+	}
+	return 0
+}
+
+func (x *StockInput) GetSupplierId() int32 {
+	if x != nil {
+		return x.SupplierId
+	}
+	return 0
+}
+
+func (x *StockInput) GetIncidentLevel() float64 {
+	if x != nil {
+		return x.IncidentLevel
+	}
+	return 0
+}
+
+func (x *StockInput) GetUnit() string {
+	if x != nil {
+		return x.Unit
+	}
+	return ""
+}
+
+func (x *StockInput) GetShelfOrder() int32 {
+	if x != nil {
+		return x.ShelfOrder
+	}
+	return 0
+}
+
+func (x *StockInput) GetSku() string {
+	if x != nil {
+		return x.Sku
+	}
+	return ""
+}
+
+func (x *StockInput) GetCategoryId() int32 {
+	if x != nil {
+		return x.CategoryId
+	}
+	return 0
+}
+
+type CreateStockRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Stock         *StockInput            `protobuf:"bytes,1,opt,name=stock,proto3" json:"stock,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *CreateStockRequest) Reset() {
+	*x = CreateStockRequest{}
+	mi := &file_inventory_proto_msgTypes[19]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *CreateStockRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*CreateStockRequest) ProtoMessage() {}
+
+func (x *CreateStockRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_inventory_proto_msgTypes[19]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use CreateStockRequest.ProtoReflect.Descriptor instead.
+func (*CreateStockRequest) Descriptor() ([]byte, []int) {
+	return file_inventory_proto_rawDescGZIP(), []int{19}
+}
+
+func (x *CreateStockRequest) GetStock() *StockInput {
+	if x != nil {
+		return x.Stock
+	}
+	return nil
+}
+
+type UpdateStockRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	StockId       int32                  `protobuf:"varint,1,opt,name=stock_id,json=stockId,proto3" json:"stock_id,omitempty"`
+	Stock         *StockInput            `protobuf:"bytes,2,opt,name=stock,proto3" json:"stock,omitempty"`
+	Version       int32                  `protobuf:"varint,3,opt,name=version,proto3" json:"version,omitempty"` // required
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *UpdateStockRequest) Reset() {
+	*x = UpdateStockRequest{}
+	mi := &file_inventory_proto_msgTypes[20]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *UpdateStockRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*UpdateStockRequest) ProtoMessage() {}
+
+func (x *UpdateStockRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_inventory_proto_msgTypes[20]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use UpdateStockRequest.ProtoReflect.Descriptor instead.
+func (*UpdateStockRequest) Descriptor() ([]byte, []int) {
+	return file_inventory_proto_rawDescGZIP(), []int{20}
+}
+
+func (x *UpdateStockRequest) GetStockId() int32 {
+	if x != nil {
+		return x.StockId
+	}
+	return 0
+}
+
+func (x *UpdateStockRequest) GetStock() *StockInput {
+	if x != nil {
+		return x.Stock
+	}
+	return nil
+}
+
+func (x *UpdateStockRequest) GetVersion() int32 {
+	if x != nil {
+		return x.Version
+	}
+	return 0
+}
+
+type DeleteStockRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	StockId       int32                  `protobuf:"varint,1,opt,name=stock_id,json=stockId,proto3" json:"stock_id,omitempty"`
+	Version       int32                  `protobuf:"varint,2,opt,name=version,proto3" json:"version,omitempty"` // required
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *DeleteStockRequest) Reset() {
+	*x = DeleteStockRequest{}
+	mi := &file_inventory_proto_msgTypes[21]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *DeleteStockRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*DeleteStockRequest) ProtoMessage() {}
+
+func (x *DeleteStockRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_inventory_proto_msgTypes[21]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use DeleteStockRequest.ProtoReflect.Descriptor instead.
+func (*DeleteStockRequest) Descriptor() ([]byte, []int) {
+	return file_inventory_proto_rawDescGZIP(), []int{21}
+}
+
+func (x *DeleteStockRequest) GetStockId() int32 {
+	if x != nil {
+		return x.StockId
+	}
+	return 0
+}
+
+func (x *DeleteStockRequest) GetVersion() int32 {
+	if x != nil {
+		return x.Version
+	}
+	return 0
+}
+
+type DeleteStockResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *DeleteStockResponse) Reset() {
+	*x = DeleteStockResponse{}
+	mi := &file_inventory_proto_msgTypes[22]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *DeleteStockResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*DeleteStockResponse) ProtoMessage() {}
+
+func (x *DeleteStockResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_inventory_proto_msgTypes[22]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use DeleteStockResponse.ProtoReflect.Descriptor instead.
+func (*DeleteStockResponse) Descriptor() ([]byte, []int) {
+	return file_inventory_proto_rawDescGZIP(), []int{22}
+}
+
+type SetStockLevelRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	StockId       int32                  `protobuf:"varint,1,opt,name=stock_id,json=stockId,proto3" json:"stock_id,omitempty"`
+	Level         float64                `protobuf:"fixed64,2,opt,name=level,proto3" json:"level,omitempty"`
+	Version       int32                  `protobuf:"varint,3,opt,name=version,proto3" json:"version,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *SetStockLevelRequest) Reset() {
+	*x = SetStockLevelRequest{}
+	mi := &file_inventory_proto_msgTypes[23]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SetStockLevelRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SetStockLevelRequest) ProtoMessage() {}
+
+func (x *SetStockLevelRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_inventory_proto_msgTypes[23]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SetStockLevelRequest.ProtoReflect.Descriptor instead.
+func (*SetStockLevelRequest) Descriptor() ([]byte, []int) {
+	return file_inventory_proto_rawDescGZIP(), []int{23}
+}
+
+func (x *SetStockLevelRequest) GetStockId() int32 {
+	if x != nil {
+		return x.StockId
+	}
+	return 0
+}
+
+func (x *SetStockLevelRequest) GetLevel() float64 {
+	if x != nil {
+		return x.Level
+	}
+	return 0
+}
+
+func (x *SetStockLevelRequest) GetVersion() int32 {
+	if x != nil {
+		return x.Version
+	}
+	return 0
+}
+
+type AdjustStockRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	StockId       int32                  `protobuf:"varint,1,opt,name=stock_id,json=stockId,proto3" json:"stock_id,omitempty"`
+	Delta         float64                `protobuf:"fixed64,2,opt,name=delta,proto3" json:"delta,omitempty"`
+	Reason        string                 `protobuf:"bytes,3,opt,name=reason,proto3" json:"reason,omitempty"`
+	Version       int32                  `protobuf:"varint,4,opt,name=version,proto3" json:"version,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *AdjustStockRequest) Reset() {
+	*x = AdjustStockRequest{}
+	mi := &file_inventory_proto_msgTypes[24]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *AdjustStockRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*AdjustStockRequest) ProtoMessage() {}
+
+func (x *AdjustStockRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_inventory_proto_msgTypes[24]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use AdjustStockRequest.ProtoReflect.Descriptor instead.
+func (*AdjustStockRequest) Descriptor() ([]byte, []int) {
+	return file_inventory_proto_rawDescGZIP(), []int{24}
+}
+
+func (x *AdjustStockRequest) GetStockId() int32 {
+	if x != nil {
+		return x.StockId
+	}
+	return 0
+}
+
+func (x *AdjustStockRequest) GetDelta() float64 {
+	if x != nil {
+		return x.Delta
+	}
+	return 0
+}
+
+func (x *AdjustStockRequest) GetReason() string {
+	if x != nil {
+		return x.Reason
+	}
+	return ""
+}
+
+func (x *AdjustStockRequest) GetVersion() int32 {
+	if x != nil {
+		return x.Version
+	}
+	return 0
+}
+
+// The same filters as GET /logs
+type ListLogsRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	StockId       int32                  `protobuf:"varint,1,opt,name=stock_id,json=stockId,proto3" json:"stock_id,omitempty"`
+	From          string                 `protobuf:"bytes,2,opt,name=from,proto3" json:"from,omitempty"`   // YYYY-MM-DD
+	To            string                 `protobuf:"bytes,3,opt,name=to,proto3" json:"to,omitempty"`       // YYYY-MM-DD, exclusive
+	Month         string                 `protobuf:"bytes,4,opt,name=month,proto3" json:"month,omitempty"` // YYYY-MM
+	CategoryId    int32                  `protobuf:"varint,5,opt,name=category_id,json=categoryId,proto3" json:"category_id,omitempty"`
+	Tag           string                 `protobuf:"bytes,6,opt,name=tag,proto3" json:"tag,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListLogsRequest) Reset() {
+	*x = ListLogsRequest{}
+	mi := &file_inventory_proto_msgTypes[25]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListLogsRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListLogsRequest) ProtoMessage() {}
+
+func (x *ListLogsRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_inventory_proto_msgTypes[25]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListLogsRequest.ProtoReflect.Descriptor instead.
+func (*ListLogsRequest) Descriptor() ([]byte, []int) {
+	return file_inventory_proto_rawDescGZIP(), []int{25}
+}
+
+func (x *ListLogsRequest) GetStockId() int32 {
+	if x != nil {
+		return x.StockId
+	}
+	return 0
+}
+
+func (x *ListLogsRequest) GetFrom() string {
+	if x != nil {
+		return x.From
+	}
+	return ""
+}
+
+func (x *ListLogsRequest) GetTo() string {
+	if x != nil {
+		return x.To
+	}
+	return ""
+}
+
+func (x *ListLogsRequest) GetMonth() string {
+	if x != nil {
+		return x.Month
+	}
+	return ""
+}
+
+func (x *ListLogsRequest) GetCategoryId() int32 {
+	if x != nil {
+		return x.CategoryId
+	}
+	return 0
+}
+
+func (x *ListLogsRequest) GetTag() string {
+	if x != nil {
+		return x.Tag
+	}
+	return ""
+}
+
+type ListLogsResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Logs          []*Log                 `protobuf:"bytes,1,rep,name=logs,proto3" json:"logs,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListLogsResponse) Reset() {
+	*x = ListLogsResponse{}
+	mi := &file_inventory_proto_msgTypes[26]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListLogsResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListLogsResponse) ProtoMessage() {}
+
+func (x *ListLogsResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_inventory_proto_msgTypes[26]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListLogsResponse.ProtoReflect.Descriptor instead.
+func (*ListLogsResponse) Descriptor() ([]byte, []int) {
+	return file_inventory_proto_rawDescGZIP(), []int{26}
+}
+
+func (x *ListLogsResponse) GetLogs() []*Log {
+	if x != nil {
+		return x.Logs
+	}
+	return nil
+}
+
+type DeleteLogRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	LogId         int32                  `protobuf:"varint,1,opt,name=log_id,json=logId,proto3" json:"log_id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *DeleteLogRequest) Reset() {
+	*x = DeleteLogRequest{}
+	mi := &file_inventory_proto_msgTypes[27]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *DeleteLogRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*DeleteLogRequest) ProtoMessage() {}
+
+func (x *DeleteLogRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_inventory_proto_msgTypes[27]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use DeleteLogRequest.ProtoReflect.Descriptor instead.
+func (*DeleteLogRequest) Descriptor() ([]byte, []int) {
+	return file_inventory_proto_rawDescGZIP(), []int{27}
+}
+
+func (x *DeleteLogRequest) GetLogId() int32 {
+	if x != nil {
+		return x.LogId
+	}
+	return 0
+}
+
+type DeleteLogResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *DeleteLogResponse) Reset() {
+	*x = DeleteLogResponse{}
+	mi := &file_inventory_proto_msgTypes[28]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *DeleteLogResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*DeleteLogResponse) ProtoMessage() {}
+
+func (x *DeleteLogResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_inventory_proto_msgTypes[28]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use DeleteLogResponse.ProtoReflect.Descriptor instead.
+func (*DeleteLogResponse) Descriptor() ([]byte, []int) {
+	return file_inventory_proto_rawDescGZIP(), []int{28}
+}
+
+type WatchStockChangesRequest struct {
+	state   protoimpl.MessageState `protogen:"open.v1"`
+	RoomIds []int32                `protobuf:"varint,1,rep,packed,name=room_ids,json=roomIds,proto3" json:"room_ids,omitempty"` // empty for every room
+	// Sends the changes after this event first, for catching up after a
+	// reconnect. 0 only sends new changes.
+	LastEventId   int64 `protobuf:"varint,2,opt,name=last_event_id,json=lastEventId,proto3" json:"last_event_id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *WatchStockChangesRequest) Reset() {
+	*x = WatchStockChangesRequest{}
+	mi := &file_inventory_proto_msgTypes[29]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *WatchStockChangesRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*WatchStockChangesRequest) ProtoMessage() {}
+
+func (x *WatchStockChangesRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_inventory_proto_msgTypes[29]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use WatchStockChangesRequest.ProtoReflect.Descriptor instead.
+func (*WatchStockChangesRequest) Descriptor() ([]byte, []int) {
+	return file_inventory_proto_rawDescGZIP(), []int{29}
+}
+
+func (x *WatchStockChangesRequest) GetRoomIds() []int32 {
+	if x != nil {
+		return x.RoomIds
+	}
+	return nil
+}
+
+func (x *WatchStockChangesRequest) GetLastEventId() int64 {
+	if x != nil {
+		return x.LastEventId
+	}
+	return 0
+}
+
+type StockChange struct {
+	state   protoimpl.MessageState `protogen:"open.v1"`
+	EventId int64                  `protobuf:"varint,1,opt,name=event_id,json=eventId,proto3" json:"event_id,omitempty"`
+	// stock.created, stock.updated, stock.deleted, stock.levelChanged or
+	// log.deleted
+	Type      string                 `protobuf:"bytes,2,opt,name=type,proto3" json:"type,omitempty"`
+	StockId   int32                  `protobuf:"varint,3,opt,name=stock_id,json=stockId,proto3" json:"stock_id,omitempty"`
+	RoomId    int32                  `protobuf:"varint,4,opt,name=room_id,json=roomId,proto3" json:"room_id,omitempty"`
+	CreatedAt *timestamppb.Timestamp `protobuf:"bytes,5,opt,name=created_at,json=createdAt,proto3" json:"created_at,omitempty"`
+	// Types that are valid to be assigned to Change:
+	//
+	//	*StockChange_Stock
+	//	*StockChange_LevelChanged
+	Change        isStockChange_Change `protobuf_oneof:"change"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *StockChange) Reset() {
+	*x = StockChange{}
+	mi := &file_inventory_proto_msgTypes[30]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *StockChange) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*StockChange) ProtoMessage() {}
+
+func (x *StockChange) ProtoReflect() protoreflect.Message {
+	mi := &file_inventory_proto_msgTypes[30]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use StockChange.ProtoReflect.Descriptor instead.
+func (*StockChange) Descriptor() ([]byte, []int) {
+	return file_inventory_proto_rawDescGZIP(), []int{30}
+}
+
+func (x *StockChange) GetEventId() int64 {
+	if x != nil {
+		return x.EventId
+	}
+	return 0
+}
+
+func (x *StockChange) GetType() string {
+	if x != nil {
+		return x.Type
+	}
+	return ""
+}
+
+func (x *StockChange) GetStockId() int32 {
+	if x != nil {
+		return x.StockId
+	}
+	return 0
+}
+
+func (x *StockChange) GetRoomId() int32 {
+	if x != nil {
+		return x.RoomId
+	}
+	return 0
+}
+
+func (x *StockChange) GetCreatedAt() *timestamppb.Timestamp {
+	if x != nil {
+		return x.CreatedAt
+	}
+	return nil
+}
+
+func (x *StockChange) GetChange() isStockChange_Change {
+	if x != nil {
+		return x.Change
+	}
+	return nil
+}
+
+func (x *StockChange) GetStock() *Stock {
+	if x != nil {
+		if x, ok := x.Change.(*StockChange_Stock); ok {
+			return x.Stock
+		}
+	}
+	return nil
+}
+
+func (x *StockChange) GetLevelChanged() *LevelChange {
+	if x != nil {
+		if x, ok := x.Change.(*StockChange_LevelChanged); ok {
+			return x.LevelChanged
+		}
+	}
+	return nil
+}
+
+type isStockChange_Change interface {
+	isStockChange_Change()
+}
+
+type StockChange_Stock struct {
+	Stock *Stock `protobuf:"bytes,6,opt,name=stock,proto3,oneof"` // stock.created and stock.updated
+}
+
+type StockChange_LevelChanged struct {
+	LevelChanged *LevelChange `protobuf:"bytes,7,opt,name=level_changed,json=levelChanged,proto3,oneof"` // stock.levelChanged and log.deleted
+}
+
+func (*StockChange_Stock) isStockChange_Change() {}
+
+func (*StockChange_LevelChanged) isStockChange_Change() {}
+
+var File_inventory_proto protoreflect.FileDescriptor
+
+const file_inventory_proto_rawDesc = "" +
+	"\n" +
+	"\x0finventory.proto\x12\finventory.v1\x1a\x1fgoogle/protobuf/timestamp.proto\"\xd8\x03\n" +
+	"\bSupplier\x12\x1f\n" +
+	"\vsupplier_id\x18\x01 \x01(\x05R\n" +
+	"supplierId\x12#\n" +
+	"\rsupplier_name\x18\x02 \x01(\tR\fsupplierName\x12.\n" +
+	"\x13supplier_contact_no\x18\x03 \x01(\tR\x11supplierContactNo\x12\x1b\n" +
+	"\tlead_time\x18\x04 \x01(\x05R\bleadTime\x12%\n" +
+	"\x0emonday_deliver\x18\x05 \x01(\bR\rmondayDeliver\x12'\n" +
+	"\x0ftuesday_deliver\x18\x06 \x01(\bR\x0etuesdayDeliver\x12+\n" +
+	"\x11wednesday_deliver\x18\a \x01(\bR\x10wednesdayDeliver\x12)\n" +
+	"\x10thursday_deliver\x18\b \x01(\bR\x0fthursdayDeliver\x12%\n" +
+	"\x0efriday_deliver\x18\t \x01(\bR\rfridayDeliver\x12)\n" +
+	"\x10saturday_deliver\x18\n" +
+	" \x01(\bR\x0fsaturdayDeliver\x12%\n" +
+	"\x0esunday_deliver\x18\v \x01(\bR\rsundayDeliver\x12\x18\n" +
+	"\aversion\x18\f \x01(\x05R\aversion\"V\n" +
+	"\x04Room\x12\x17\n" +
+	"\aroom_id\x18\x01 \x01(\x05R\x06roomId\x12\x1b\n" +
+	"\troom_name\x18\x02 \x01(\tR\broomName\x12\x18\n" +
+	"\aversion\x18\x03 \x01(\x05R\aversion\"\x87\x04\n" +
+	"\x05Stock\x12\x19\n" +
+	"\bstock_id\x18\x01 \x01(\x05R\astockId\x12\x1b\n" +
+	"\titem_name\x18\x02 \x01(\tR\bitemName\x12\x14\n" +
+	"\x05level\x18\x03 \x01(\x01R\x05level\x12\x17\n" +
+	"\aroom_id\x18\x04 \x01(\x05R\x06roomId\x12\x1f\n" +
+	"\vsupplier_id\x18\x05 \x01(\x05R\n" +
+	"supplierId\x12%\n" +
+	"\x0eincident_level\x18\x06 \x01(\x01R\rincidentLevel\x12\x12\n" +
+	"\x04unit\x18\a \x01(\tR\x04unit\x12\x1f\n" +
+	"\vshelf_order\x18\b \x01(\x05R\n" +
+	"shelfOrder\x12\x10\n" +
+	"\x03sku\x18\t \x01(\tR\x03sku\x12\x1f\n" +
+	"\vcategory_id\x18\n" +
+	" \x01(\x05R\n" +
+	"categoryId\x12\x18\n" +
+	"\aversion\x18\v \x01(\x05R\aversion\x12\x1e\n" +
+	"\vlast_log_id\x18\f \x01(\x05R\tlastLogId\x12\x1b\n" +
+	"\troom_name\x18\r \x01(\tR\broomName\x12#\n" +
+	"\rsupplier_name\x18\x0e \x01(\tR\fsupplierName\x12\x1a\n" +
+	"\bcategory\x18\x0f \x01(\tR\bcategory\x12\x12\n" +
+	"\x04tags\x18\x10 \x03(\tR\x04tags\x12;\n" +
+	"\vlast_change\x18\x11 \x01(\v2\x1a.google.protobuf.TimestampR\n" +
+	"lastChange\"\xa6\x01\n" +
+	"\vLevelChange\x12\x19\n" +
+	"\bstock_id\x18\x01 \x01(\x05R\astockId\x12\x17\n" +
+	"\aroom_id\x18\x02 \x01(\x05R\x06roomId\x12\x14\n" +
+	"\x05level\x18\x03 \x01(\x01R\x05level\x12\x1e\n" +
+	"\n" +
+	"differance\x18\x04 \x01(\x01R\n" +
+	"differance\x12\x15\n" +
+	"\x06log_id\x18\x05 \x01(\x05R\x05logId\x12\x16\n" +
+	"\x06reason\x18\x06 \x01(\tR\x06reason\"\x84\x02\n" +
+	"\x03Log\x12\x15\n" +
+	"\x06log_id\x18\x01 \x01(\x05R\x05logId\x12\x19\n" +
+	"\bstock_id\x18\x02 \x01(\x05R\astockId\x12\x1b\n" +
+	"\titem_name\x18\x03 \x01(\tR\bitemName\x12\x1e\n" +
+	"\n" +
+	"differance\x18\x04 \x01(\x01R\n" +
+	"differance\x12\x1f\n" +
+	"\vtotal_after\x18\x05 \x01(\x01R\n" +
+	"totalAfter\x12?\n" +
+	"\rincident_time\x18\x06 \x01(\v2\x1a.google.protobuf.TimestampR\fincidentTime\x12\x14\n" +
+	"\x05daily\x18\a \x01(\bR\x05daily\x12\x16\n" +
+	"\x06reason\x18\b \x01(\tR\x06reason\"\x16\n" +
+	"\x14ListSuppliersRequest\"M\n" +
+	"\x15ListSuppliersResponse\x124\n" +
+	"\tsuppliers\x18\x01 \x03(\v2\x16.inventory.v1.SupplierR\tsuppliers\"5\n" +
+	"\x12GetSupplierRequest\x12\x1f\n" +
+	"\vsupplier_id\x18\x01 \x01(\x05R\n" +
+	"supplierId\"\x12\n" +
+	"\x10ListRoomsRequest\"=\n" +
+	"\x11ListRoomsResponse\x12(\n" +
+	"\x05rooms\x18\x01 \x03(\v2\x12.inventory.v1.RoomR\x05rooms\")\n" +
+	"\x0eGetRoomRequest\x12\x17\n" +
+	"\aroom_id\x18\x01 \x01(\x05R\x06roomId\"0\n" +
+	"\x11CreateRoomRequest\x12\x1b\n" +
+	"\troom_name\x18\x01 \x01(\tR\broomName\"c\n" +
+	"\x11UpdateRoomRequest\x12\x17\n" +
+	"\aroom_id\x18\x01 \x01(\x05R\x06roomId\x12\x1b\n" +
+	"\troom_name\x18\x02 \x01(\tR\broomName\x12\x18\n" +
+	"\aversion\x18\x03 \x01(\x05R\aversion\"F\n" +
+	"\x11DeleteRoomRequest\x12\x17\n" +
+	"\aroom_id\x18\x01 \x01(\x05R\x06roomId\x12\x18\n" +
+	"\aversion\x18\x02 \x01(\x05R\aversion\"\x14\n" +
+	"\x12DeleteRoomResponse\"\xd7\x02\n" +
+	"\x10ListStockRequest\x12\x17\n" +
+	"\aroom_id\x18\x01 \x01(\x05R\x06roomId\x12\x1f\n" +
+	"\vsupplier_id\x18\x02 \x01(\x05R\n" +
+	"supplierId\x12\x1f\n" +
+	"\vcategory_id\x18\x03 \x01(\x05R\n" +
+	"categoryId\x12\x10\n" +
+	"\x03tag\x18\x04 \x01(\tR\x03tag\x12\x16\n" +
+	"\x06search\x18\x05 \x01(\tR\x06search\x12\x14\n" +
+	"\x05match\x18\x06 \x01(\tR\x05match\x12%\n" +
+	"\x0ebelow_incident\x18\a \x01(\bR\rbelowIncident\x12?\n" +
+	"\rchanged_since\x18\b \x01(\v2\x1a.google.protobuf.TimestampR\fchangedSince\x12\x12\n" +
+	"\x04sort\x18\t \x01(\tR\x04sort\x12\x14\n" +
+	"\x05limit\x18\n" +
+	" \x01(\x05R\x05limit\x12\x16\n" +
+	"\x06offset\x18\v \x01(\x05R\x06offset\"_\n" +
+	"\x11ListStockResponse\x12)\n" +
+	"\x05stock\x18\x01 \x03(\v2\x13.inventory.v1.StockR\x05stock\x12\x1f\n" +
+	"\vtotal_count\x18\x02 \x01(\x05R\n" +
+	"totalCount\",\n" +
+	"\x0fGetStockRequest\x12\x19\n" +
+	"\bstock_id\x18\x01 \x01(\x05R\astockId\"\x88\x02\n" +
+	"\n" +
+	"StockInput\x12\x1b\n" +
+	"\titem_name\x18\x01 \x01(\tR\bitemName\x12\x14\n" +
+	"\x05level\x18\x02 \x01(\x01R\x05level\x12\x17\n" +
+	"\aroom_id\x18\x03 \x01(\x05R\x06roomId\x12\x1f\n" +
+	"\vsupplier_id\x18\x04 \x01(\x05R\n" +
+	"supplierId\x12%\n" +
+	"\x0eincident_level\x18\x05 \x01(\x01R\rincidentLevel\x12\x12\n" +
+	"\x04unit\x18\x06 \x01(\tR\x04unit\x12\x1f\n" +
+	"\vshelf_order\x18\a \x01(\x05R\n" +
+	"shelfOrder\x12\x10\n" +
+	"\x03sku\x18\b \x01(\tR\x03sku\x12\x1f\n" +
+	"\vcategory_id\x18\t \x01(\x05R\n" +
+	"categoryId\"D\n" +
+	"\x12CreateStockRequest\x12.\n" +
+	"\x05stock\x18\x01 \x01(\v2\x18.inventory.v1.StockInputR\x05stock\"y\n" +
+	"\x12UpdateStockRequest\x12\x19\n" +
+	"\bstock_id\x18\x01 \x01(\x05R\astockId\x12.\n" +
+	"\x05stock\x18\x02 \x01(\v2\x18.inventory.v1.StockInputR\x05stock\x12\x18\n" +
+	"\aversion\x18\x03 \x01(\x05R\aversion\"I\n" +
+	"\x12DeleteStockRequest\x12\x19\n" +
+	"\bstock_id\x18\x01 \x01(\x05R\astockId\x12\x18\n" +
+	"\aversion\x18\x02 \x01(\x05R\aversion\"\x15\n" +
+	"\x13DeleteStockResponse\"a\n" +
+	"\x14SetStockLevelRequest\x12\x19\n" +
+	"\bstock_id\x18\x01 \x01(\x05R\astockId\x12\x14\n" +
+	"\x05level\x18\x02 \x01(\x01R\x05level\x12\x18\n" +
+	"\aversion\x18\x03 \x01(\x05R\aversion\"w\n" +
+	"\x12AdjustStockRequest\x12\x19\n" +
+	"\bstock_id\x18\x01 \x01(\x05R\astockId\x12\x14\n" +
+	"\x05delta\x18\x02 \x01(\x01R\x05delta\x12\x16\n" +
+	"\x06reason\x18\x03 \x01(\tR\x06reason\x12\x18\n" +
+	"\aversion\x18\x04 \x01(\x05R\aversion\"\x99\x01\n" +
+	"\x0fListLogsRequest\x12\x19\n" +
+	"\bstock_id\x18\x01 \x01(\x05R\astockId\x12\x12\n" +
+	"\x04from\x18\x02 \x01(\tR\x04from\x12\x0e\n" +
+	"\x02to\x18\x03 \x01(\tR\x02to\x12\x14\n" +
+	"\x05month\x18\x04 \x01(\tR\x05month\x12\x1f\n" +
+	"\vcategory_id\x18\x05 \x01(\x05R\n" +
+	"categoryId\x12\x10\n" +
+	"\x03tag\x18\x06 \x01(\tR\x03tag\"9\n" +
+	"\x10ListLogsResponse\x12%\n" +
+	"\x04logs\x18\x01 \x03(\v2\x11.inventory.v1.LogR\x04logs\")\n" +
+	"\x10DeleteLogRequest\x12\x15\n" +
+	"\x06log_id\x18\x01 \x01(\x05R\x05logId\"\x13\n" +
+	"\x11DeleteLogResponse\"Y\n" +
+	"\x18WatchStockChangesRequest\x12\x19\n" +
+	"\broom_ids\x18\x01 \x03(\x05R\aroomIds\x12\"\n" +
+	"\rlast_event_id\x18\x02 \x01(\x03R\vlastEventId\"\xa4\x02\n" +
+	"\vStockChange\x12\x19\n" +
+	"\bevent_id\x18\x01 \x01(\x03R\aeventId\x12\x12\n" +
+	"\x04type\x18\x02 \x01(\tR\x04type\x12\x19\n" +
+	"\bstock_id\x18\x03 \x01(\x05R\astockId\x12\x17\n" +
+	"\aroom_id\x18\x04 \x01(\x05R\x06roomId\x129\n" +
+	"\n" +
+	"created_at\x18\x05 \x01(\v2\x1a.google.protobuf.TimestampR\tcreatedAt\x12+\n" +
+	"\x05stock\x18\x06 \x01(\v2\x13.inventory.v1.StockH\x00R\x05stock\x12@\n" +
+	"\rlevel_changed\x18\a \x01(\v2\x19.inventory.v1.LevelChangeH\x00R\flevelChangedB\b\n" +
+	"\x06change2\x8d\n" +
+	"\n" +
+	"\tInventory\x12X\n" +
+	"\rListSuppliers\x12\".inventory.v1.ListSuppliersRequest\x1a#.inventory.v1.ListSuppliersResponse\x12G\n" +
+	"\vGetSupplier\x12 .inventory.v1.GetSupplierRequest\x1a\x16.inventory.v1.Supplier\x12L\n" +
+	"\tListRooms\x12\x1e.inventory.v1.ListRoomsRequest\x1a\x1f.inventory.v1.ListRoomsResponse\x12;\n" +
+	"\aGetRoom\x12\x1c.inventory.v1.GetRoomRequest\x1a\x12.inventory.v1.Room\x12A\n" +
+	"\n" +
+	"CreateRoom\x12\x1f.inventory.v1.CreateRoomRequest\x1a\x12.inventory.v1.Room\x12A\n" +
+	"\n" +
+	"UpdateRoom\x12\x1f.inventory.v1.UpdateRoomRequest\x1a\x12.inventory.v1.Room\x12O\n" +
+	"\n" +
+	"DeleteRoom\x12\x1f.inventory.v1.DeleteRoomRequest\x1a .inventory.v1.DeleteRoomResponse\x12L\n" +
+	"\tListStock\x12\x1e.inventory.v1.ListStockRequest\x1a\x1f.inventory.v1.ListStockResponse\x12>\n" +
+	"\bGetStock\x12\x1d.inventory.v1.GetStockRequest\x1a\x13.inventory.v1.Stock\x12D\n" +
+	"\vCreateStock\x12 .inventory.v1.CreateStockRequest\x1a\x13.inventory.v1.Stock\x12D\n" +
+	"\vUpdateStock\x12 .inventory.v1.UpdateStockRequest\x1a\x13.inventory.v1.Stock\x12R\n" +
+	"\vDeleteStock\x12 .inventory.v1.DeleteStockRequest\x1a!.inventory.v1.DeleteStockResponse\x12N\n" +
+	"\rSetStockLevel\x12\".inventory.v1.SetStockLevelRequest\x1a\x19.inventory.v1.LevelChange\x12J\n" +
+	"\vAdjustStock\x12 .inventory.v1.AdjustStockRequest\x1a\x19.inventory.v1.LevelChange\x12I\n" +
+	"\bListLogs\x12\x1d.inventory.v1.ListLogsRequest\x1a\x1e.inventory.v1.ListLogsResponse\x12L\n" +
+	"\tDeleteLog\x12\x1e.inventory.v1.DeleteLogRequest\x1a\x1f.inventory.v1.DeleteLogResponse\x12X\n" +
+	"\x11WatchStockChanges\x12&.inventory.v1.WatchStockChangesRequest\x1a\x19.inventory.v1.StockChange0\x01B7Z5github.com/ingar2005/inventory-backend-go/inventorypbb\x06proto3"
+
+var (
+	file_inventory_proto_rawDescOnce sync.Once
+	file_inventory_proto_rawDescData []byte
+)
+
+func file_inventory_proto_rawDescGZIP() []byte {
+	file_inventory_proto_rawDescOnce.Do(func() {
+		file_inventory_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_inventory_proto_rawDesc), len(file_inventory_proto_rawDesc)))
+	})
+	return file_inventory_proto_rawDescData
+}
+
+var file_inventory_proto_msgTypes = make([]protoimpl.MessageInfo, 31)
+var file_inventory_proto_goTypes = []any{
+	(*Supplier)(nil),                 // 0: inventory.v1.Supplier
+	(*Room)(nil),                     // 1: inventory.v1.Room
+	(*Stock)(nil),                    // 2: inventory.v1.Stock
+	(*LevelChange)(nil),              // 3: inventory.v1.LevelChange
+	(*Log)(nil),                      // 4: inventory.v1.Log
+	(*ListSuppliersRequest)(nil),     // 5: inventory.v1.ListSuppliersRequest
+	(*ListSuppliersResponse)(nil),    // 6: inventory.v1.ListSuppliersResponse
+	(*GetSupplierRequest)(nil),       // 7: inventory.v1.GetSupplierRequest
+	(*ListRoomsRequest)(nil),         // 8: inventory.v1.ListRoomsRequest
+	(*ListRoomsResponse)(nil),        // 9: inventory.v1.ListRoomsResponse
+	(*GetRoomRequest)(nil),           // 10: inventory.v1.GetRoomRequest
+	(*CreateRoomRequest)(nil),        // 11: inventory.v1.CreateRoomRequest
+	(*UpdateRoomRequest)(nil),        // 12: inventory.v1.UpdateRoomRequest
+	(*DeleteRoomRequest)(nil),        // 13: inventory.v1.DeleteRoomRequest
+	(*DeleteRoomResponse)(nil),       // 14: inventory.v1.DeleteRoomResponse
+	(*ListStockRequest)(nil),         // 15: inventory.v1.ListStockRequest
+	(*ListStockResponse)(nil),        // 16: inventory.v1.ListStockResponse
+	(*GetStockRequest)(nil),          // 17: inventory.v1.GetStockRequest
+	(*StockInput)(nil),               // 18: inventory.v1.StockInput
+	(*CreateStockRequest)(nil),       // 19: inventory.v1.CreateStockRequest
+	(*UpdateStockRequest)(nil),       // 20: inventory.v1.UpdateStockRequest
+	(*DeleteStockRequest)(nil),       // 21: inventory.v1.DeleteStockRequest
+	(*DeleteStockResponse)(nil),      // 22: inventory.v1.DeleteStockResponse
+	(*SetStockLevelRequest)(nil),     // 23: inventory.v1.SetStockLevelRequest
+	(*AdjustStockRequest)(nil),       // 24: inventory.v1.AdjustStockRequest
+	(*ListLogsRequest)(nil),          // 25: inventory.v1.ListLogsRequest
+	(*ListLogsResponse)(nil),         // 26: inventory.v1.ListLogsResponse
+	(*DeleteLogRequest)(nil),         // 27: inventory.v1.DeleteLogRequest
+	(*DeleteLogResponse)(nil),        // 28: inventory.v1.DeleteLogResponse
+	(*WatchStockChangesRequest)(nil), // 29: inventory.v1.WatchStockChangesRequest
+	(*StockChange)(nil),              // 30: inventory.v1.StockChange
+	(*timestamppb.Timestamp)(nil),    // 31: google.protobuf.Timestamp
+}
+var file_inventory_proto_depIdxs = []int32{
+	31, // 0: inventory.v1.Stock.last_change:type_name -> google.protobuf.Timestamp
+	31, // 1: inventory.v1.Log.incident_time:type_name -> google.protobuf.Timestamp
+	0,  // 2: inventory.v1.ListSuppliersResponse.suppliers:type_name -> inventory.v1.Supplier
+	1,  // 3: inventory.v1.ListRoomsResponse.rooms:type_name -> inventory.v1.Room
+	31, // 4: inventory.v1.ListStockRequest.changed_since:type_name -> google.protobuf.Timestamp
+	2,  // 5: inventory.v1.ListStockResponse.stock:type_name -> inventory.v1.Stock
+	18, // 6: inventory.v1.CreateStockRequest.stock:type_name -> inventory.v1.StockInput
+	18, // 7: inventory.v1.UpdateStockRequest.stock:type_name -> inventory.v1.StockInput
+	4,  // 8: inventory.v1.ListLogsResponse.logs:type_name -> inventory.v1.Log
+	31, // 9: inventory.v1.StockChange.created_at:type_name -> google.protobuf.Timestamp
+	2,  // 10: inventory.v1.StockChange.stock:type_name -> inventory.v1.Stock
+	3,  // 11: inventory.v1.StockChange.level_changed:type_name -> inventory.v1.LevelChange
+	5,  // 12: inventory.v1.Inventory.ListSuppliers:input_type -> inventory.v1.ListSuppliersRequest
+	7,  // 13: inventory.v1.Inventory.GetSupplier:input_type -> inventory.v1.GetSupplierRequest
+	8,  // 14: inventory.v1.Inventory.ListRooms:input_type -> inventory.v1.ListRoomsRequest
+	10, // 15: inventory.v1.Inventory.GetRoom:input_type -> inventory.v1.GetRoomRequest
+	11, // 16: inventory.v1.Inventory.CreateRoom:input_type -> inventory.v1.CreateRoomRequest
+	12, // 17: inventory.v1.Inventory.UpdateRoom:input_type -> inventory.v1.UpdateRoomRequest
+	13, // 18: inventory.v1.Inventory.DeleteRoom:input_type -> inventory.v1.DeleteRoomRequest
+	15, // 19: inventory.v1.Inventory.ListStock:input_type -> inventory.v1.ListStockRequest
+	17, // 20: inventory.v1.Inventory.GetStock:input_type -> inventory.v1.GetStockRequest
+	19, // 21: inventory.v1.Inventory.CreateStock:input_type -> inventory.v1.CreateStockRequest
+	20, // 22: inventory.v1.Inventory.UpdateStock:input_type -> inventory.v1.UpdateStockRequest
+	21, // 23: inventory.v1.Inventory.DeleteStock:input_type -> inventory.v1.DeleteStockRequest
+	23, // 24: inventory.v1.Inventory.SetStockLevel:input_type -> inventory.v1.SetStockLevelRequest
+	24, // 25: inventory.v1.Inventory.AdjustStock:input_type -> inventory.v1.AdjustStockRequest
+	25, // 26: inventory.v1.Inventory.ListLogs:input_type -> inventory.v1.ListLogsRequest
+	27, // 27: inventory.v1.Inventory.DeleteLog:input_type -> inventory.v1.DeleteLogRequest
+	29, // 28: inventory.v1.Inventory.WatchStockChanges:input_type -> inventory.v1.WatchStockChangesRequest
+	6,  // 29: inventory.v1.Inventory.ListSuppliers:output_type -> inventory.v1.ListSuppliersResponse
+	0,  // 30: inventory.v1.Inventory.GetSupplier:output_type -> inventory.v1.Supplier
+	9,  // 31: inventory.v1.Inventory.ListRooms:output_type -> inventory.v1.ListRoomsResponse
+	1,  // 32: inventory.v1.Inventory.GetRoom:output_type -> inventory.v1.Room
+	1,  // 33: inventory.v1.Inventory.CreateRoom:output_type -> inventory.v1.Room
+	1,  // 34: inventory.v1.Inventory.UpdateRoom:output_type -> inventory.v1.Room
+	14, // 35: inventory.v1.Inventory.DeleteRoom:output_type -> inventory.v1.DeleteRoomResponse
+	16, // 36: inventory.v1.Inventory.ListStock:output_type -> inventory.v1.ListStockResponse
+	2,  // 37: inventory.v1.Inventory.GetStock:output_type -> inventory.v1.Stock
+	2,  // 38: inventory.v1.Inventory.CreateStock:output_type -> inventory.v1.Stock
+	2,  // 39: inventory.v1.Inventory.UpdateStock:output_type -> inventory.v1.Stock
+	22, // 40: inventory.v1.Inventory.DeleteStock:output_type -> inventory.v1.DeleteStockResponse
+	3,  // 41: inventory.v1.Inventory.SetStockLevel:output_type -> inventory.v1.LevelChange
+	3,  // 42: inventory.v1.Inventory.AdjustStock:output_type -> inventory.v1.LevelChange
+	26, // 43: inventory.v1.Inventory.ListLogs:output_type -> inventory.v1.ListLogsResponse
+	28, // 44: inventory.v1.Inventory.DeleteLog:output_type -> inventory.v1.DeleteLogResponse
+	30, // 45: inventory.v1.Inventory.WatchStockChanges:output_type -> inventory.v1.StockChange
+	29, // [29:46] is the sub-list for method output_type
+	12, // [12:29] is the sub-list for method input_type
+	12, // [12:12] is the sub-list for extension type_name
+	12, // [12:12] is the sub-list for extension extendee
+	0,  // [0:12] is the sub-list for field type_name
+}
+
+func init() { file_inventory_proto_init() }
+func file_inventory_proto_init() {
+	if File_inventory_proto != nil {
+		return
+	}
+	file_inventory_proto_msgTypes[30].OneofWrappers = []any{
+		(*StockChange_Stock)(nil),
+		(*StockChange_LevelChanged)(nil),
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_inventory_proto_rawDesc), len(file_inventory_proto_rawDesc)),
+			NumEnums:      0,
+			NumMessages:   31,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_inventory_proto_goTypes,
+		DependencyIndexes: file_inventory_proto_depIdxs,
+		MessageInfos:      file_inventory_proto_msgTypes,
+	}.Build()
+	File_inventory_proto = out.File
+	file_inventory_proto_goTypes = nil
+	file_inventory_proto_depIdxs = nil
+}
@@ -0,0 +1,301 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"image"
+	"image/draw"
+	"image/png"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/boombuler/barcode"
+	"github.com/boombuler/barcode/code128"
+	"github.com/boombuler/barcode/qr"
+	"github.com/jung-kurt/gofpdf"
+)
+
+// label is one printable tag, Code is what the barcode encodes
+type label struct {
+	Title string
+	Code  string
+}
+
+// labelLayout describes a sheet of label paper, all sizes in mm
+type labelLayout struct {
+	Page        string
+	Columns     int
+	Rows        int
+	Width       float64
+	Height      float64
+	TopMargin   float64
+	LeftMargin  float64
+	ColumnPitch float64
+	RowPitch    float64
+}
+
+var labelLayouts = map[string]labelLayout{
+	// AVERY L7160, 21 PER A4 SHEET
+	"l7160": {Page: "A4", Columns: 3, Rows: 7, Width: 63.5, Height: 38.1, TopMargin: 15.15, LeftMargin: 7.25, ColumnPitch: 66.0, RowPitch: 38.1},
+	// AVERY L7163, 14 PER A4 SHEET
+	"l7163": {Page: "A4", Columns: 2, Rows: 7, Width: 99.1, Height: 38.1, TopMargin: 15.15, LeftMargin: 4.65, ColumnPitch: 101.6, RowPitch: 38.1},
+	// AVERY 5160, 30 PER US LETTER SHEET
+	"5160": {Page: "Letter", Columns: 3, Rows: 10, Width: 66.7, Height: 25.4, TopMargin: 12.7, LeftMargin: 4.8, ColumnPitch: 69.85, RowPitch: 25.4},
+}
+
+const (
+	symbologyCode128 = "code128"
+	symbologyQR      = "qr"
+
+	// PREFIXES FOR GENERATED CODES, SO A SCAN TELLS ITEMS AND ROOMS APART
+	stockLabelPrefix = "STK-"
+	roomLabelPrefix  = "RM-"
+)
+
+// labels serves GET /labels/?stock=1,2&rooms=3 as a PDF sheet of labels.
+// ?stock=all or ?rooms=all selects everything, ?type= is code128 (default)
+// or qr, ?layout= picks the label paper and ?skip= leaves that many labels
+// blank at the start so a part used sheet can be reused. With ?format=png a
+// single label is returned as just its barcode image.
+func labels(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	symbology := q.Get("type")
+	if symbology == "" {
+		symbology = symbologyCode128
+	}
+	if symbology != symbologyCode128 && symbology != symbologyQR {
+		http.Error(w, "type must be code128 or qr", http.StatusBadRequest)
+		return
+	}
+
+	items, err := collectLabels(r.Context(), q.Get("stock"), q.Get("rooms"))
+	if err == sql.ErrNoRows {
+		http.Error(w, "unknown stock or room id", http.StatusNotFound)
+		return
+	}
+	if errors.Is(err, errInvalidID) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		internalError(w, r, err)
+		return
+	}
+	if len(items) == 0 {
+		http.Error(w, "no labels selected, use ?stock= or ?rooms=", http.StatusBadRequest)
+		return
+	}
+
+	if q.Get("format") == "png" {
+		if len(items) != 1 {
+			http.Error(w, "png output is for a single label", http.StatusBadRequest)
+			return
+		}
+		code, err := encodeLabel(items[0].Code, symbology, 600, 200)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "image/png")
+		err = png.Encode(w, toGray(code))
+		if err != nil {
+			logRequestError(r, err)
+		}
+		return
+	}
+
+	layoutName := q.Get("layout")
+	if layoutName == "" {
+		layoutName = "l7160"
+	}
+	layout, ok := labelLayouts[layoutName]
+	if !ok {
+		http.Error(w, fmt.Sprintf("unknown layout %q", layoutName), http.StatusBadRequest)
+		return
+	}
+	var skip int
+	if v := q.Get("skip"); v != "" {
+		skip, err = strconv.Atoi(v)
+		if err != nil || skip < 0 || skip >= layout.Columns*layout.Rows {
+			http.Error(w, fmt.Sprintf("skip must be from 0 to %d for this layout", layout.Columns*layout.Rows-1), http.StatusBadRequest)
+			return
+		}
+	}
+
+	var buf bytes.Buffer
+	err = writeLabelSheet(&buf, items, symbology, layout, skip)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	w.Header().Set("Content-Type", "application/pdf")
+	w.Header().Set("Content-Disposition", "inline; filename=\"labels.pdf\"")
+	buf.WriteTo(w)
+}
+
+// collectLabels turns comma separated id lists (or "all") into labels for
+// the request's site. Stock items encode their SKU when they have one.
+func collectLabels(ctx context.Context, stockIDs string, roomIDs string) (res []label, err error) {
+	site := siteFrom(ctx)
+	if stockIDs != "" {
+		wanted, err := parseIDList(stockIDs)
+		if err != nil {
+			return res, err
+		}
+		for _, id := range wanted {
+			data, err := getStockFull(stockFilter{StockID: id, SiteID: site})
+			if err != nil {
+				return res, err
+			}
+			if len(data) == 0 {
+				return res, sql.ErrNoRows
+			}
+			res = append(res, stockLabel(data[0]))
+		}
+		if wanted == nil {
+			err = eachFullStock(stockFilter{SiteID: site, OrderBy: "stock.roomID, stock.shelfOrder, stock.itemName"}, func(data FullStock) error {
+				res = append(res, stockLabel(data))
+				return nil
+			})
+			if err != nil {
+				return res, err
+			}
+		}
+	}
+
+	if roomIDs != "" {
+		wanted, err := parseIDList(roomIDs)
+		if err != nil {
+			return res, err
+		}
+		for _, id := range wanted {
+			ok, err := atSite(ctx, "roomID", id)
+			if err == nil && !ok {
+				err = sql.ErrNoRows
+			}
+			if err != nil {
+				return res, err
+			}
+			name, err := getRoomName(id)
+			if err != nil {
+				return res, err
+			}
+			res = append(res, label{Title: name, Code: roomLabelPrefix + strconv.Itoa(id)})
+		}
+		if wanted == nil {
+			rooms, err := getRooms(site)
+			if err != nil {
+				return res, err
+			}
+			for _, room := range rooms {
+				res = append(res, label{Title: room.RoomName, Code: roomLabelPrefix + strconv.Itoa(room.RoomId)})
+			}
+		}
+	}
+	return res, nil
+}
+func stockLabel(data FullStock) label {
+	code := data.SKU
+	if code == "" {
+		code = stockLabelPrefix + strconv.Itoa(data.StockID)
+	}
+	return label{Title: data.ItemName, Code: code}
+}
+
+// errInvalidID is wrapped by parseIDList errors
+var errInvalidID = errors.New("invalid id")
+
+// parseIDList parses "1,2,3", returning nil for "all"
+func parseIDList(list string) (res []int, err error) {
+	if list == "all" {
+		return nil, nil
+	}
+	for _, part := range strings.Split(list, ",") {
+		id, err := strconv.Atoi(strings.TrimSpace(part))
+		if err != nil {
+			return res, fmt.Errorf("%w %q", errInvalidID, part)
+		}
+		res = append(res, id)
+	}
+	return res, nil
+}
+
+// encodeLabel renders code as a barcode of at least the given pixel size
+func encodeLabel(code string, symbology string, width int, height int) (barcode.Barcode, error) {
+	var bc barcode.Barcode
+	var err error
+	if symbology == symbologyQR {
+		bc, err = qr.Encode(code, qr.M, qr.Auto)
+		width = height
+	} else {
+		bc, err = code128.Encode(code)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// SCALING ONLY WORKS UPWARDS, LONG CODES MAY NEED A WIDER IMAGE
+	if bounds := bc.Bounds(); bounds.Dx() > width {
+		width = bounds.Dx()
+	}
+	return barcode.Scale(bc, width, height)
+}
+
+// toGray converts to 8 bit greyscale, barcodes are 16 bit which PDF
+// embedding does not support
+func toGray(src image.Image) *image.Gray {
+	dst := image.NewGray(src.Bounds())
+	draw.Draw(dst, dst.Bounds(), src, src.Bounds().Min, draw.Src)
+	return dst
+}
+
+func writeLabelSheet(buf *bytes.Buffer, items []label, symbology string, layout labelLayout, skip int) error {
+	pdf := gofpdf.New("P", "mm", layout.Page, "")
+	pdf.SetMargins(0, 0, 0)
+	pdf.SetAutoPageBreak(false, 0)
+	tr := pdf.UnicodeTranslatorFromDescriptor("")
+	perPage := layout.Columns * layout.Rows
+	const padding = 2.0
+
+	for i, item := range items {
+		slot := (i + skip) % perPage
+		if i == 0 || slot == 0 {
+			pdf.AddPage()
+		}
+		x := layout.LeftMargin + float64(slot%layout.Columns)*layout.ColumnPitch
+		y := layout.TopMargin + float64(slot/layout.Columns)*layout.RowPitch
+
+		code, err := encodeLabel(item.Code, symbology, 600, 200)
+		if err != nil {
+			return fmt.Errorf("label %q: %w", item.Code, err)
+		}
+		var img bytes.Buffer
+		err = png.Encode(&img, toGray(code))
+		if err != nil {
+			return err
+		}
+		name := fmt.Sprintf("label%d", i)
+		pdf.RegisterImageOptionsReader(name, gofpdf.ImageOptions{ImageType: "PNG"}, &img)
+
+		// TITLE ON TOP, BARCODE IN THE MIDDLE, HUMAN READABLE CODE BELOW
+		pdf.SetFont("Helvetica", "B", 9)
+		pdf.SetXY(x+padding, y+padding)
+		pdf.CellFormat(layout.Width-2*padding, 4, tr(item.Title), "", 0, "C", false, 0, "")
+
+		imageHeight := layout.Height - 2*padding - 9
+		imageWidth := layout.Width - 2*padding
+		if symbology == symbologyQR {
+			imageWidth = imageHeight
+		}
+		pdf.ImageOptions(name, x+(layout.Width-imageWidth)/2, y+padding+4.5, imageWidth, imageHeight, false, gofpdf.ImageOptions{ImageType: "PNG"}, 0, "")
+
+		pdf.SetFont("Helvetica", "", 8)
+		pdf.SetXY(x+padding, y+layout.Height-padding-4)
+		pdf.CellFormat(layout.Width-2*padding, 4, item.Code, "", 0, "C", false, 0, "")
+	}
+	return pdf.Output(buf)
+}
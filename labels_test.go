@@ -0,0 +1,110 @@
+package main
+
+import (
+	"bytes"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestParseIDList(t *testing.T) {
+	tests := []struct {
+		list    string
+		want    []int
+		wantErr bool
+	}{
+		{"all", nil, false},
+		{"7", []int{7}, false},
+		{"1, 2,3", []int{1, 2, 3}, false},
+		{"", nil, true},
+		{"1,,2", nil, true},
+		{"1,two", nil, true},
+	}
+	for _, test := range tests {
+		got, err := parseIDList(test.list)
+		if (err != nil) != test.wantErr {
+			t.Errorf("parseIDList(%q) error = %v, want error %v", test.list, err, test.wantErr)
+			continue
+		}
+		if !test.wantErr && !reflect.DeepEqual(got, test.want) {
+			t.Errorf("parseIDList(%q) = %v, want %v", test.list, got, test.want)
+		}
+	}
+}
+
+func TestStockLabel(t *testing.T) {
+	tests := []struct {
+		data FullStock
+		want label
+	}{
+		{FullStock{StockID: 12, ItemName: "Lager", SKU: "LAG-50"}, label{Title: "Lager", Code: "LAG-50"}},
+		{FullStock{StockID: 12, ItemName: "Lager"}, label{Title: "Lager", Code: stockLabelPrefix + "12"}},
+	}
+	for _, test := range tests {
+		if got := stockLabel(test.data); got != test.want {
+			t.Errorf("stockLabel(%+v) = %+v, want %+v", test.data, got, test.want)
+		}
+	}
+}
+
+func TestEncodeLabel(t *testing.T) {
+	tests := []struct {
+		code       string
+		symbology  string
+		wantSquare bool
+		wantErr    bool
+	}{
+		{stockLabelPrefix + "12", symbologyCode128, false, false},
+		{roomLabelPrefix + "3", symbologyQR, true, false},
+		{strings.Repeat("LONG", 20), symbologyCode128, false, false}, // WIDER THAN ASKED,
+		{"Kühlraum", symbologyQR, true, false},
+		{"Kühlraum", symbologyCode128, false, true}, // CODE 128 IS ASCII ONLY
+	}
+	for _, test := range tests {
+		bc, err := encodeLabel(test.code, test.symbology, 600, 200)
+		if (err != nil) != test.wantErr {
+			t.Errorf("encodeLabel(%q, %s) error = %v, want error %v", test.code, test.symbology, err, test.wantErr)
+			continue
+		}
+		if test.wantErr {
+			continue
+		}
+		bounds := bc.Bounds()
+		if bounds.Dy() != 200 || bounds.Dx() < 200 || (bounds.Dx() == bounds.Dy()) != test.wantSquare {
+			t.Errorf("encodeLabel(%q, %s) is %dx%d", test.code, test.symbology, bounds.Dx(), bounds.Dy())
+		}
+	}
+}
+
+func TestWriteLabelSheet(t *testing.T) {
+	layout := labelLayouts["l7160"] // 21 PER SHEET
+	tests := []struct {
+		items     int
+		skip      int
+		wantPages int
+	}{
+		{1, 0, 1},
+		{21, 0, 1},
+		{22, 0, 2},
+		{1, 20, 1},
+		{2, 20, 2}, // THE SECOND LABEL STARTS A NEW SHEET
+		{21, 1, 2},
+	}
+	for _, test := range tests {
+		var items []label
+		for i := 0; i < test.items; i++ {
+			items = append(items, label{Title: "item", Code: stockLabelPrefix + strconv.Itoa(i)})
+		}
+		for _, symbology := range []string{symbologyCode128, symbologyQR} {
+			var buf bytes.Buffer
+			err := writeLabelSheet(&buf, items, symbology, layout, test.skip)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if pages := strings.Count(buf.String(), "/Type /Page\n"); pages != test.wantPages {
+				t.Errorf("%d %s labels skipping %d: got %d pages, want %d", test.items, symbology, test.skip, pages, test.wantPages)
+			}
+		}
+	}
+}
@@ -0,0 +1,233 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// requestIDHeader carries the ID of a request, taken from the client or a
+// proxy in front of us when it sends one, so one ID follows the request
+// through every log
+const requestIDHeader = "X-Request-ID"
+
+// maxRequestIDLength keeps IDs sent by clients from filling the logs
+const maxRequestIDLength = 128
+
+// quietPaths are probed every few seconds, their access logs are debug only
+var quietPaths = map[string]bool{"/healthz": true, "/readyz": true, "/metrics": true}
+
+func (config LogConfig) validate() error {
+	if _, err := config.level(); err != nil {
+		return err
+	}
+	if config.Format != "json" && config.Format != "text" {
+		return fmt.Errorf("log.format must be json or text, not %q", config.Format)
+	}
+	return nil
+}
+
+// logger returns the logger the config asks for, writing to w. Everything
+// logged with a request's context carries its ID.
+func (config LogConfig) logger(w io.Writer) *slog.Logger {
+	level, _ := config.level()
+	options := &slog.HandlerOptions{Level: level}
+	var handler slog.Handler = slog.NewJSONHandler(w, options)
+	if config.Format == "text" {
+		handler = slog.NewTextHandler(w, options)
+	}
+	return slog.New(contextHandler{handler})
+}
+
+// requestInfo is what the access log says about a request. Handlers further
+// in get a copy of the request, so they fill it in through a pointer.
+type requestInfo struct {
+	id    string
+	route string // THE PATTERN THAT MATCHED, "" FOR NONE
+	user  string
+}
+
+type requestInfoKey struct{}
+
+func requestInfoFrom(ctx context.Context) *requestInfo {
+	info, _ := ctx.Value(requestInfoKey{}).(*requestInfo)
+	return info
+}
+
+// contextHandler adds the request ID of the context to each record
+type contextHandler struct {
+	slog.Handler
+}
+
+func (h contextHandler) Handle(ctx context.Context, record slog.Record) error {
+	if info := requestInfoFrom(ctx); info != nil {
+		record.AddAttrs(slog.String("requestID", info.id))
+	}
+	return h.Handler.Handle(ctx, record)
+}
+
+func (h contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return contextHandler{h.Handler.WithAttrs(attrs)}
+}
+
+func (h contextHandler) WithGroup(name string) slog.Handler {
+	return contextHandler{h.Handler.WithGroup(name)}
+}
+
+// requestID returns id when a client may choose it, otherwise a new one
+func requestID(id string) string {
+	if id != "" && len(id) <= maxRequestIDLength && printable(id) {
+		return id
+	}
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+func printable(s string) bool {
+	for _, c := range s {
+		if c <= ' ' || c > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+// logRequestError logs an error from a handler with the ID of the request, so
+// it can be found from the response
+func logRequestError(r *http.Request, err error) {
+	slog.ErrorContext(r.Context(), "request failed", "err", err)
+}
+
+// internalError logs err and answers 500 without the details
+func internalError(w http.ResponseWriter, r *http.Request, err error) {
+	logRequestError(r, err)
+	http.Error(w, "internal error", http.StatusInternalServerError)
+}
+
+// observe gives every request an ID, sent back in X-Request-ID, counts it in
+// the metrics and writes its access log. recordRoute must wrap the router
+// for the route to be known.
+func observe(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		info := &requestInfo{id: requestID(r.Header.Get(requestIDHeader))}
+		w.Header().Set(requestIDHeader, info.id)
+		ctx := context.WithValue(r.Context(), requestInfoKey{}, info)
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(rec, r.WithContext(ctx))
+		duration := time.Since(start)
+
+		// PREFLIGHTS, 401s AND UNKNOWN PATHS NEVER REACH A ROUTE, IDS IN
+		// PATHS WOULD MAKE A SERIES EACH
+		route := info.route
+		if route == "" {
+			route = "unmatched"
+		}
+		httpRequests.WithLabelValues(route, r.Method, strconv.Itoa(rec.status)).Inc()
+		httpDuration.WithLabelValues(route, r.Method).Observe(duration.Seconds())
+
+		level := slog.LevelInfo
+		if quietPaths[r.URL.Path] {
+			level = slog.LevelDebug
+		}
+		slog.LogAttrs(ctx, level, "request",
+			slog.String("method", r.Method),
+			slog.String("path", r.URL.Path),
+			slog.String("route", info.route),
+			slog.Int("status", rec.status),
+			slog.Int("bytes", rec.bytes),
+			slog.Float64("durationMs", float64(duration.Microseconds())/1000),
+			slog.String("user", info.user),
+			slog.String("remote", r.RemoteAddr),
+		)
+	})
+}
+
+// recordRoute passes the pattern the router matched back to observe
+func recordRoute(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		next.ServeHTTP(w, r)
+		if info := requestInfoFrom(r.Context()); info != nil {
+			info.route = r.Pattern
+		}
+	})
+}
+
+// statusRecorder remembers the status code and size written. It flushes and
+// unwraps so /events can still stream and set its deadline through it.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+	bytes  int
+}
+
+func (rec *statusRecorder) WriteHeader(status int) {
+	rec.status = status
+	rec.ResponseWriter.WriteHeader(status)
+}
+
+func (rec *statusRecorder) Write(b []byte) (int, error) {
+	n, err := rec.ResponseWriter.Write(b)
+	rec.bytes += n
+	return n, err
+}
+
+func (rec *statusRecorder) Flush() {
+	if flusher, ok := rec.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+func (rec *statusRecorder) Unwrap() http.ResponseWriter {
+	return rec.ResponseWriter
+}
+
+// grpcLogging gives gRPC calls a request ID from the "x-request-id" metadata
+// or a new one, sent back in the header, and logs each call like observe
+func grpcLogging() []grpc.ServerOption {
+	begin := func(ctx context.Context) (context.Context, *requestInfo) {
+		md, _ := metadata.FromIncomingContext(ctx)
+		var id string
+		if ids := md.Get(requestIDHeader); len(ids) > 0 {
+			id = ids[0]
+		}
+		info := &requestInfo{id: requestID(id)}
+		grpc.SetHeader(ctx, metadata.Pairs(requestIDHeader, info.id))
+		return context.WithValue(ctx, requestInfoKey{}, info), info
+	}
+	end := func(ctx context.Context, info *requestInfo, method string, start time.Time, err error) {
+		slog.LogAttrs(ctx, slog.LevelInfo, "grpc call",
+			slog.String("method", method),
+			slog.String("code", status.Code(err).String()),
+			slog.Float64("durationMs", float64(time.Since(start).Microseconds())/1000),
+			slog.String("user", info.user),
+		)
+	}
+	return []grpc.ServerOption{
+		grpc.ChainUnaryInterceptor(func(ctx context.Context, req any, call *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+			start := time.Now()
+			ctx, info := begin(ctx)
+			res, err := handler(ctx, req)
+			end(ctx, info, call.FullMethod, start, err)
+			return res, err
+		}),
+		grpc.ChainStreamInterceptor(func(srv any, stream grpc.ServerStream, call *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+			start := time.Now()
+			ctx, info := begin(stream.Context())
+			err := handler(srv, contextStream{stream, ctx})
+			end(ctx, info, call.FullMethod, start, err)
+			return err
+		}),
+	}
+}
@@ -0,0 +1,211 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	dto "github.com/prometheus/client_model/go"
+	"google.golang.org/grpc"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+)
+
+func TestLogConfigValidate(t *testing.T) {
+	tests := []struct {
+		config  LogConfig
+		wantErr bool
+	}{
+		{LogConfig{Level: "info", Format: "json"}, false},
+		{LogConfig{Level: "debug", Format: "text"}, false},
+		{LogConfig{Level: "loud", Format: "json"}, true},
+		{LogConfig{Level: "info", Format: "xml"}, true},
+	}
+	for _, test := range tests {
+		if err := test.config.validate(); (err != nil) != test.wantErr {
+			t.Errorf("%+v: got %v", test.config, err)
+		}
+	}
+}
+
+func TestRequestID(t *testing.T) {
+	tests := []struct {
+		sent     string
+		wantKept bool
+	}{
+		{"", false},
+		{"abc-123", true},
+		{strings.Repeat("a", maxRequestIDLength), true},
+		{strings.Repeat("a", maxRequestIDLength+1), false},
+		{"two words", false},
+		{"line\nbreak", false},
+		{"kühl", false},
+	}
+	for _, test := range tests {
+		got := requestID(test.sent)
+		if (got == test.sent) != test.wantKept || got == "" {
+			t.Errorf("requestID(%q) = %q, want it kept %v", test.sent, got, test.wantKept)
+		}
+	}
+	if requestID("") == requestID("") {
+		t.Error("two new IDs were the same")
+	}
+}
+
+// captureLogs sends the default logger to a buffer as JSON for the rest of
+// the test
+func captureLogs(t *testing.T) *bytes.Buffer {
+	t.Helper()
+	var buf bytes.Buffer
+	old := slog.Default()
+	slog.SetDefault(LogConfig{Level: "debug", Format: "json"}.logger(&buf))
+	t.Cleanup(func() { slog.SetDefault(old) })
+	return &buf
+}
+
+// logRecords decodes the JSON records logged to buf
+func logRecords(t *testing.T, buf *bytes.Buffer) (records []map[string]any) {
+	t.Helper()
+	dec := json.NewDecoder(buf)
+	for dec.More() {
+		var record map[string]any
+		if err := dec.Decode(&record); err != nil {
+			t.Fatal(err)
+		}
+		records = append(records, record)
+	}
+	return records
+}
+
+func TestInternalError(t *testing.T) {
+	logs := captureLogs(t)
+	r := httptest.NewRequest("GET", "/api/v1/stock", nil)
+	r = r.WithContext(context.WithValue(r.Context(), requestInfoKey{}, &requestInfo{id: "req-1"}))
+	w := httptest.NewRecorder()
+	internalError(w, r, errors.New("Error 1045: Access denied for user 'inventory'"))
+
+	if w.Code != http.StatusInternalServerError || strings.TrimSpace(w.Body.String()) != "internal error" {
+		t.Errorf("got %d %q", w.Code, w.Body.String())
+	}
+	records := logRecords(t, logs)
+	if len(records) != 1 || records[0]["requestID"] != "req-1" || !strings.Contains(records[0]["err"].(string), "Access denied") {
+		t.Errorf("logged %v", records)
+	}
+}
+
+// requestCount is how many requests observe has counted with labels
+func requestCount(t *testing.T, labels ...string) float64 {
+	t.Helper()
+	var m dto.Metric
+	err := httpRequests.WithLabelValues(labels...).Write(&m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return m.GetCounter().GetValue()
+}
+
+func TestObserve(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/v1/stock/{stockID}", func(w http.ResponseWriter, r *http.Request) {
+		if r.PathValue("stockID") == "0" {
+			http.Error(w, "stock item not found", http.StatusNotFound)
+		}
+	})
+	mux.HandleFunc("GET /healthz", healthz)
+	h := chain(mux, observe, recordRoute)
+
+	tests := []struct {
+		url       string
+		sentID    string
+		route     string
+		code      string
+		wantLevel string
+	}{
+		{"/api/v1/stock/5", "", "GET /api/v1/stock/{stockID}", "200", "INFO"},
+		{"/api/v1/stock/6", "lb-42", "GET /api/v1/stock/{stockID}", "200", "INFO"}, // ONE SERIES FOR EVERY ID
+		{"/api/v1/stock/0", "", "GET /api/v1/stock/{stockID}", "404", "INFO"},
+		{"/api/v1/nothing", "", "unmatched", "404", "INFO"},
+		{"/healthz", "", "GET /healthz", "200", "DEBUG"},
+	}
+	for _, test := range tests {
+		logs := captureLogs(t)
+		before := requestCount(t, test.route, "GET", test.code)
+		r := httptest.NewRequest("GET", test.url, nil)
+		if test.sentID != "" {
+			r.Header.Set(requestIDHeader, test.sentID)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+
+		if got := requestCount(t, test.route, "GET", test.code) - before; got != 1 {
+			t.Errorf("%s: counted %v under %s %s", test.url, got, test.route, test.code)
+		}
+		id := w.Header().Get(requestIDHeader)
+		if id == "" || (test.sentID != "" && id != test.sentID) {
+			t.Errorf("%s: sent back request ID %q", test.url, id)
+		}
+		records := logRecords(t, logs)
+		if len(records) != 1 {
+			t.Fatalf("%s: logged %v", test.url, records)
+		}
+		record := records[0]
+		if record["level"] != test.wantLevel || record["requestID"] != id || record["path"] != test.url ||
+			record["status"] != float64(w.Code) || record["bytes"] != float64(w.Body.Len()) {
+			t.Errorf("%s: logged %v", test.url, record)
+		}
+	}
+}
+
+func TestGrpcLogging(t *testing.T) {
+	logs := captureLogs(t)
+	client := testHealthClient(t, grpcLogging()...)
+
+	tests := []struct {
+		sent string
+	}{
+		{""},
+		{"pos-7"},
+	}
+	for _, test := range tests {
+		ctx := context.Background()
+		if test.sent != "" {
+			ctx = metadata.AppendToOutgoingContext(ctx, requestIDHeader, test.sent)
+		}
+		var header metadata.MD
+		_, err := client.Check(ctx, &healthpb.HealthCheckRequest{}, grpc.Header(&header))
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids := header.Get(requestIDHeader)
+		if len(ids) != 1 || (test.sent != "" && ids[0] != test.sent) {
+			t.Errorf("sent %q, got back %q", test.sent, ids)
+		}
+	}
+	records := logRecords(t, logs)
+	if len(records) != 2 || records[1]["requestID"] != "pos-7" || records[1]["method"] != "/grpc.health.v1.Health/Check" || records[1]["code"] != "OK" {
+		t.Errorf("logged %v", records)
+	}
+}
+
+func TestStatusRecorder(t *testing.T) {
+	w := httptest.NewRecorder()
+	rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+	var _ http.Flusher = rec
+
+	rec.WriteHeader(http.StatusTeapot)
+	rec.Write([]byte("short and stout"))
+	rec.Flush()
+	if rec.status != http.StatusTeapot || rec.bytes != 15 || w.Code != http.StatusTeapot || !w.Flushed {
+		t.Errorf("recorded %d %d bytes, wrote %d, flushed %v", rec.status, rec.bytes, w.Code, w.Flushed)
+	}
+	// /events SETS ITS WRITE DEADLINE THROUGH IT
+	if http.NewResponseController(rec).Flush() != nil || rec.Unwrap() != w {
+		t.Error("does not unwrap to the writer it wraps")
+	}
+}
@@ -1,15 +1,24 @@
 package main
 
 import (
+	"context"
 	"database/sql"
 	"encoding/json"
 	_ "encoding/json"
+	"errors"
+	"flag"
 	"fmt"
 	"log"
+	"log/slog"
 	"net/http"
+	"net/url"
 	"os"
+	"os/signal"
+	"slices"
 	"strconv"
 	"strings"
+	"syscall"
+	"time"
 
 	"github.com/go-sql-driver/mysql"
 	_ "github.com/go-sql-driver/mysql"
@@ -17,59 +26,90 @@ import (
 )
 
 type Supplier struct {
-	SupplierID        int64  `json:supplierID`
-	SupplierName      string `json:supplierName`
-	SupplierContactNo string `json:supplierContactNo` // IF NULLL WILL BE VALUE N/A
-	LeadTime          int64  `json:leadTime`
-	MondayDeliver     bool   `json:mondayDeliver`
-	TuesdayDeliver    bool   `json:tuesdayDeliver`
-	WednesdayDeliver  bool   `json:wednesdayDeliver`
-	ThursdayDeliver   bool   `json:thursdayDeliver`
-	FridayDeliver     bool   `json:fridayDeliver`
-	SaturdayDeliver   bool   `json:saturdayDeliver`
-	SundayDeliver     bool   `json:sundayDeliver`
+	SupplierID        int64  `json:"supplierID"`
+	SupplierName      string `json:"supplierName"`
+	SupplierContactNo string `json:"supplierContactNo"` // IF NULLL WILL BE VALUE N/A
+	LeadTime          int64  `json:"leadTime"`
+	MondayDeliver     bool   `json:"mondayDeliver"`
+	TuesdayDeliver    bool   `json:"tuesdayDeliver"`
+	WednesdayDeliver  bool   `json:"wednesdayDeliver"`
+	ThursdayDeliver   bool   `json:"thursdayDeliver"`
+	FridayDeliver     bool   `json:"fridayDeliver"`
+	SaturdayDeliver   bool   `json:"saturdayDeliver"`
+	SundayDeliver     bool   `json:"sundayDeliver"`
+	SiteIDs           []int  `json:"siteIDs"` // THE SITES IT IS SHARED WITH
+	Version           int    `json:"version"`
 }
 type Room struct {
-	RoomId   int    `json:roomId`
-	RoomName string `json:roomName`
+	RoomId   int    `json:"roomId"`
+	RoomName string `json:"roomName"`
+	SiteID   int    `json:"siteID,omitempty"` // SET BY THE SERVER FROM THE REQUEST'S SITE
+	Version  int    `json:"version"`
 }
 type Stock struct {
-	StockID       int     `json:stockID`
-	ItemName      string  `json:itemName`
-	Level         float64 `json:level`
-	RoomID        int     `json:roomID`
-	SupplierID    int     `json:supplierID`
-	IncidentLevel float64 `json:incidentLevel`
-	LastLogID     int     `json:lastLogID` // IF NONE WILL BE VALUE 0
+	StockID       int     `json:"stockID"`
+	ItemName      string  `json:"itemName"`
+	Level         float64 `json:"level"`
+	RoomID        int     `json:"roomID"`
+	SupplierID    int     `json:"supplierID"`
+	IncidentLevel float64 `json:"incidentLevel"`
+	LastLogID     int     `json:"lastLogID"` // IF NONE WILL BE VALUE 0
+	Unit          string  `json:"unit"`
+	ShelfOrder    int     `json:"shelfOrder"`
+	SKU           string  `json:"sku"`        // STORED AS NULL WHEN EMPTY
+	CategoryID    int     `json:"categoryID"` // 0 WHEN UNCATEGORISED
+	Version       int     `json:"version"`    // BUMPED ON EVERY CHANGE, SENT AS THE ETag
 }
 type LogRow struct {
-	LogID        int            `json:logID`
-	StockID      int            `json:stockID`
-	Differance   float64        `json:differance`
-	TotalAfter   float64        `json:totalAfter`
-	IncidentTime mysql.NullTime `json:incidentTime`
-	Daily        bool           `json:daily`
+	LogID        int      `json:"logID"`
+	StockID      int      `json:"stockID"`
+	Differance   float64  `json:"differance"`
+	TotalAfter   float64  `json:"totalAfter"`
+	IncidentTime NullTime `json:"incidentTime"`
+	Daily        bool     `json:"daily"`
+	Reason       string   `json:"reason"` // WHY A RELATIVE ADJUSTMENT WAS MADE
 }
 type Log struct {
-	LogID        int            `json:logID`
-	StockID      int            `json:stockID`
-	ItemName     string         `json:itemName`
-	Differance   float64        `json:differance`
-	TotalAfter   float64        `json:totalAfter`
-	IncidentTime mysql.NullTime `json:incidentTime`
-	Daily        bool           `json:daily`
+	LogID        int      `json:"logID"`
+	StockID      int      `json:"stockID"`
+	ItemName     string   `json:"itemName"`
+	Differance   float64  `json:"differance"`
+	TotalAfter   float64  `json:"totalAfter"`
+	IncidentTime NullTime `json:"incidentTime"`
+	Daily        bool     `json:"daily"`
+	Reason       string   `json:"reason"`
 }
 type FullStock struct {
-	StockID       int            `json:stockID`
-	ItemName      string         `json:itemName`
-	Level         float64        `json:level`
-	RoomID        int            `json:roomID`
-	Room          string         `json:room`
-	SupplierID    int            `json:supplierID`
-	Supplier      string         `json:supplier`
-	IncidentLevel float64        `json:incidentLevel`
-	LastLogID     int            `json:lastLogID`
-	LastChanged   mysql.NullTime `json:lastChange`
+	StockID       int      `json:"stockID"`
+	ItemName      string   `json:"itemName"`
+	Level         float64  `json:"level"`
+	RoomID        int      `json:"roomID"`
+	Room          string   `json:"room"`
+	SiteID        int      `json:"siteID"`
+	SupplierID    int      `json:"supplierID"`
+	Supplier      string   `json:"supplier"`
+	IncidentLevel float64  `json:"incidentLevel"`
+	LastLogID     int      `json:"lastLogID"`
+	LastChanged   NullTime `json:"lastChange"`
+	Unit          string   `json:"unit"`
+	ShelfOrder    int      `json:"shelfOrder"`
+	SKU           string   `json:"sku"`
+	CategoryID    int      `json:"categoryID"`
+	Category      string   `json:"category"`
+	Tags          []string `json:"tags"`
+	Version       int      `json:"version"`
+}
+
+// NullTime is a nullable datetime column, written in JSON as RFC 3339 or null
+type NullTime struct {
+	mysql.NullTime
+}
+
+func (t NullTime) MarshalJSON() ([]byte, error) {
+	if !t.Valid {
+		return []byte("null"), nil
+	}
+	return json.Marshal(t.Time)
 }
 
 const (
@@ -85,6 +125,7 @@ const (
 	    fridayDeliver boolean  NOT NULL,
 	    saturdayDeliver boolean  NOT NULL,
 	    sundayDeliver boolean  NOT NULL,
+	    version int NOT NULL DEFAULT 1,
 	    PRIMARY KEY (supplierID));
 					`
 	genericSupplier = `
@@ -97,6 +138,7 @@ const (
 	CREATE TABLE IF NOT EXISTS rooms(
 	roomID int NOT NULL AUTO_INCREMENT,
 	roomName varchar(255) NOT NULL,
+	version int NOT NULL DEFAULT 1,
 	primary key(roomID));
 	`
 	genericRoom = `
@@ -112,6 +154,11 @@ const (
 		supplierID int NOT NULL,
 		incidentLevel float,
 		lastLogID int,
+		unit varchar(32) NOT NULL DEFAULT '',
+		shelfOrder int NOT NULL DEFAULT 0,
+		sku varchar(64) UNIQUE,
+		categoryID int,
+		version int NOT NULL DEFAULT 1,
 
 		PRIMARY KEY (stockID),
 		FOREIGN KEY (roomID) REFERENCES rooms(roomID),
@@ -126,6 +173,7 @@ const (
     totalAfter float NOT NULL,
     incidentTime datetime NOT NULL,
     daily boolean NOT NULL,
+    reason varchar(255) NOT NULL DEFAULT '',
     PRIMARY KEY (logID),
     FOREIGN KEY (stockID) REFERENCES stock(stockID));
 	`
@@ -134,16 +182,33 @@ const (
 var db *sql.DB
 
 func main() {
-	var err error
-
 	godotenv.Load()
-	db_user := os.Getenv("DB_USER")
-	db_pass := os.Getenv("DB_PASSWORD")
-	db_name := os.Getenv("DB_NAME")
-	db_endpoint := os.Getenv("DB_ENDPOINT")
-	port := ":5000"
+	config, args, err := loadConfig(os.Args[1:])
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+	if len(args) > 0 && args[0] == "config" {
+		err = configCommand(config, args[1:])
+		if err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+	err = config.validate()
+	if err != nil {
+		log.Fatal("invalid config:\n", err)
+	}
+	slog.SetDefault(config.Log.logger(os.Stdout))
+	smtpConfig = config.SMTP
+	// SIGTERM IS HOW ECS AND KUBERNETES ASK US TO STOP
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
 	// CRETE A CONNECTION
-	db, err = connection(db_user, db_pass, db_name, db_endpoint)
+	db, err = connectWithRetry(ctx, config.DB)
 	if err != nil {
 		log.Fatal(err)
 	}
@@ -153,314 +218,462 @@ func main() {
 	if err != nil {
 		log.Fatal(err)
 	}
+	if len(args) > 0 && args[0] == "import" {
+		err = importCommand(args[1:])
+		if err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
 	// err = addStock("cheese", 3, 2, 1, 4)
 	// if err != nil {
 	// 	log.Fatal(err)
 	// }
+	spec, specRouter, err := loadOpenAPI()
+	if err != nil {
+		log.Fatal("openapi.yaml: ", err)
+	}
+	var graphql http.HandlerFunc
+	if config.Features.GraphQL {
+		schema, err := loadGraphQL()
+		if err != nil {
+			log.Fatal("graphql schema: ", err)
+		}
+		graphql = graphqlHandler(schema)
+	}
 	// CREATE server
-	http.HandleFunc("/logs/", logs)
-	http.HandleFunc("/suppliers/", suppliers)
-	http.HandleFunc("/rooms/", rooms)
-	http.HandleFunc("/stock/", stock)
-	http.HandleFunc("/fullStock/", stockFull)
-
-	http.HandleFunc("/", root)
-	fmt.Printf("attempting to connect on port%v \n", port)
-	log.Fatal(http.ListenAndServe(port, nil))
-}
-func root(w http.ResponseWriter, r *http.Request) {
+	router := newRouter(openAPI(spec), graphql)
+	registerMetrics(db, config.DB.Name)
+	middlewares := []middleware{observe, cors(config.CORS)}
+	if config.Features.LegacyPaths {
+		middlewares = append(middlewares, legacyAliases)
+	}
+	middlewares = append(middlewares, authenticate(config.Auth), selectSite(config.Auth))
+	if config.Features.Validation {
+		middlewares = append(middlewares, validateRequests(specRouter))
+	}
+	middlewares = append(middlewares, idempotent, recordRoute)
 
-	if r.URL.Path != "/" {
-		http.NotFound(w, r)
-	} else {
+	if config.Features.Webhooks {
+		startWebhookDispatcher(ctx, 2*time.Second)
+	}
+	startEventStream(ctx, time.Second)
+	startIdempotencySweeper(ctx, time.Hour)
+	startOutboxSweeper(ctx, time.Hour, config.Features.Webhooks)
 
-		fmt.Fprintf(w, "Welcome to the HomePage!")
-		fmt.Println("Endpoint Hit: root")
+	err = serve(ctx, config, chain(router, middlewares...))
+	if err != nil {
+		// NOT log.Fatal, THE DEFERRED CLOSES MUST STILL RUN
+		slog.Error("server stopped", "err", err)
+		return
 	}
 }
-func logs(w http.ResponseWriter, r *http.Request) {
-	switch r.Method {
-	case http.MethodOptions:
-		fmt.Println("Endpoint Hit: logs OPTIONS")
-		w.WriteHeader(http.StatusOK)
-
-	case http.MethodGet:
-		var res []Log
-		var err error
-		fmt.Println("Endpoint Hit: logs GET")
-		res, err = getLogNames()
-		if err != nil {
-			log.Fatal(err)
-		}
+func root(w http.ResponseWriter, r *http.Request) {
+	fmt.Fprintf(w, "Welcome to the HomePage!")
+}
+func logsList(w http.ResponseWriter, r *http.Request) {
+	var res []Log
+	var err error
+	filter, err := logFilterFromQuery(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	filter.SiteID = siteFrom(r.Context())
 
-		json.NewEncoder(w).Encode(res)
+	if format := exportFormat(r); format != formatJSON {
+		exportLogs(w, r, format, filter)
+		return
+	}
 
-	case http.MethodDelete:
-		fmt.Println("Endpoint Hit: logs DELETE")
+	res, err = getLogNames(filter)
+	if err != nil {
+		internalError(w, r, err)
+		return
+	}
 
-		id := strings.TrimPrefix(r.URL.Path, "/logs/")
-		idnum, err := strconv.Atoi(id)
-		if err != nil {
-			log.Fatal(err)
-		}
-		err = deleteLog(idnum)
-		if err != nil {
-			log.Fatal(err)
-		}
+	json.NewEncoder(w).Encode(res)
+}
+func logsDelete(w http.ResponseWriter, r *http.Request) {
+	idnum, ok := pathID(w, r, "logID")
+	if !ok {
+		return
+	}
+	err := deleteLog(idnum)
+	if err != nil {
+		internalError(w, r, err)
+		return
+	}
 
-		w.WriteHeader(http.StatusOK)
-		w.Write([]byte("data deleated sucesfuly"))
-	default:
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte("data deleated sucesfuly"))
+}
+func suppliersList(w http.ResponseWriter, r *http.Request) {
+	res, err := getSuppliers(siteFrom(r.Context()))
+	if err != nil {
+		internalError(w, r, err)
+		return
 	}
+	json.NewEncoder(w).Encode(res)
 }
-func suppliers(w http.ResponseWriter, r *http.Request) {
-
-	switch r.Method {
-	case http.MethodGet:
-		fmt.Println("Endpoint Hit: suppliers GET")
-		res, err := getSuppliers()
-		if err != nil {
-			log.Fatal(err)
-		}
-		json.NewEncoder(w).Encode(res)
-	default:
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+func suppliersGet(w http.ResponseWriter, r *http.Request) {
+	idnum, ok := pathID(w, r, "supplierID")
+	if !ok {
+		return
 	}
-
+	data, err := getSupplier(idnum)
+	if err == sql.ErrNoRows {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		internalError(w, r, err)
+		return
+	}
+	if writeETag(w, r, data.Version) {
+		return
+	}
+	json.NewEncoder(w).Encode(data)
 }
-func rooms(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Access-Control-Allow-Origin", "*")
-	w.Header().Set("Access-Control-Allow-Methods", "GET, DELETE, PATCH, OPTIONS, POST")
-	w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
-
-	switch r.Method {
-	case http.MethodOptions:
-		fmt.Println("Endpoint Hit: rooms OPTIONS")
-		w.WriteHeader(http.StatusOK)
-
-	case http.MethodGet:
-		fmt.Println("Endpoint Hit: rooms GET")
-		res, err := getRooms()
-		if err != nil {
-			log.Fatal(err)
-		}
-		json.NewEncoder(w).Encode(res)
-	case http.MethodDelete:
-		fmt.Println("Endpoint Hit: rooms DELETE")
-
-		id := strings.TrimPrefix(r.URL.Path, "/rooms/")
-		idnum, err := strconv.Atoi(id)
-		if err != nil {
-			log.Fatal(err)
-		}
-		if idnum == 1 {
-			http.Error(w, "Cannot delete this value", http.StatusBadRequest)
-			return
-		}
-
-		err = deleteRoom(idnum)
-		if err != nil {
-			log.Fatal(err)
-		}
-		w.WriteHeader(http.StatusOK)
-		w.Write([]byte("data deleated sucesfuly"))
-
-	case http.MethodPost:
-		fmt.Println("Endpoint Hit: rooms POST")
-		var data Room
-		err := json.NewDecoder(r.Body).Decode(&data)
-		if err != nil {
-			log.Fatal(err)
-		}
-		fmt.Println(data)
-		err = addRoom(data.RoomName)
-		if err != nil {
-			log.Fatal(err)
-		}
-		w.WriteHeader(http.StatusOK)
-		w.Write([]byte("data written sucesfuly"))
-
-	case http.MethodPatch:
-		fmt.Println(("Endpoint Hit: rooms PATCH"))
-		var data Room
-		id := strings.TrimPrefix(r.URL.Path, "/rooms/")
-		idnum, err := strconv.Atoi(id)
-		if err != nil {
-			log.Fatal(err)
-		}
-
-		err = json.NewDecoder(r.Body).Decode(&data)
-		if err != nil {
-			log.Fatal(err)
-		}
-		if idnum == 1 {
-			http.Error(w, "Cannot change this value", http.StatusBadRequest)
-			return
-		}
-		err = updateRoom(idnum, data.RoomName)
-		if err != nil {
-			log.Fatal(err)
-		}
-		w.WriteHeader(http.StatusOK)
-		w.Write([]byte("data updated sucesfully"))
-	default:
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+func roomsList(w http.ResponseWriter, r *http.Request) {
+	res, err := getRooms(siteFrom(r.Context()))
+	if err != nil {
+		internalError(w, r, err)
+		return
 	}
-
+	json.NewEncoder(w).Encode(res)
 }
-func stock(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Access-Control-Allow-Origin", "*")
-	w.Header().Set("Access-Control-Allow-Methods", "GET, DELETE, PATCH, OPTIONS")
-	w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
-
-	switch r.Method {
-	case http.MethodOptions:
-		fmt.Println("Endpoint Hit: stock OPTIONS")
-		w.WriteHeader(http.StatusOK)
-	case http.MethodGet:
-		fmt.Println("Endpoint Hit: stock GET")
-
-		res, err := getStock()
+func roomsGet(w http.ResponseWriter, r *http.Request) {
+	idnum, ok := pathID(w, r, "roomID")
+	if !ok {
+		return
+	}
+	data, err := getRoom(idnum)
+	if err == sql.ErrNoRows {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		internalError(w, r, err)
+		return
+	}
+	if writeETag(w, r, data.Version) {
+		return
+	}
+	json.NewEncoder(w).Encode(data)
+}
+func roomsDelete(w http.ResponseWriter, r *http.Request) {
+	idnum, ok := pathID(w, r, "roomID")
+	if !ok {
+		return
+	}
+	generic, err := isGenericRoom(idnum)
+	if err != nil {
+		internalError(w, r, err)
+		return
+	}
+	if generic {
+		http.Error(w, "Cannot delete this value", http.StatusBadRequest)
+		return
+	}
+	version, ok := requireIfMatch(w, r)
+	if !ok {
+		return
+	}
 
-		if err != nil {
-			log.Fatal(err)
-		}
-		json.NewEncoder(w).Encode(res)
-	case http.MethodDelete:
-		fmt.Println("Endpoint Hit: stock DELETE")
+	err = deleteRoom(idnum, version)
+	if err != nil {
+		writeUpdateError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte("data deleated sucesfuly"))
+}
+func roomsCreate(w http.ResponseWriter, r *http.Request) {
+	var data Room
+	err := json.NewDecoder(r.Body).Decode(&data)
+	if err != nil {
+		http.Error(w, "invalid body", http.StatusBadRequest)
+		return
+	}
+	slog.Debug("creating room", "room", data)
+	_, err = addRoom(data.RoomName, siteFrom(r.Context()))
+	if err != nil {
+		internalError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte("data written sucesfuly"))
+}
+func roomsUpdate(w http.ResponseWriter, r *http.Request) {
+	var data Room
+	idnum, ok := pathID(w, r, "roomID")
+	if !ok {
+		return
+	}
 
-		id := strings.TrimPrefix(r.URL.Path, "/stock/")
-		idnum, err := strconv.Atoi(id)
-		if err != nil {
-			log.Fatal(err)
-		}
-		err = deleteStock(idnum)
-		if err != nil {
-			log.Fatal(err)
-		}
+	err := json.NewDecoder(r.Body).Decode(&data)
+	if err != nil {
+		http.Error(w, "invalid body", http.StatusBadRequest)
+		return
+	}
+	generic, err := isGenericRoom(idnum)
+	if err != nil {
+		internalError(w, r, err)
+		return
+	}
+	if generic {
+		http.Error(w, "Cannot change this value", http.StatusBadRequest)
+		return
+	}
+	version, ok := requireIfMatch(w, r)
+	if !ok {
+		return
+	}
+	version, err = updateRoom(idnum, data.RoomName, version)
+	if err != nil {
+		writeUpdateError(w, r, err)
+		return
+	}
+	w.Header().Set("ETag", etag(version))
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte("data updated sucesfully"))
+}
+func stockList(w http.ResponseWriter, r *http.Request) {
+	res, err := getStock(siteFrom(r.Context()))
 
-		w.WriteHeader(http.StatusOK)
-		w.Write([]byte("data deleated sucesfuly"))
-	case http.MethodPost:
-		fmt.Println("Endpoint Hit: stock POST")
-		var data Stock
-		data.SupplierID = 1
-		data.LastLogID = 0
-		err := json.NewDecoder(r.Body).Decode(&data)
-		if err != nil {
-			log.Fatal(err)
-		}
-		fmt.Println(data)
-		err = addStock(data.ItemName, data.Level, data.RoomID, data.SupplierID, data.IncidentLevel)
-		if err != nil {
-			log.Fatal(err)
-		}
+	if err != nil {
+		internalError(w, r, err)
+		return
+	}
+	json.NewEncoder(w).Encode(res)
+}
+func stockGet(w http.ResponseWriter, r *http.Request) {
+	idnum, ok := pathID(w, r, "stockID")
+	if !ok {
+		return
+	}
+	data, err := getStockByID(idnum)
+	if err == sql.ErrNoRows {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		internalError(w, r, err)
+		return
+	}
+	if writeETag(w, r, data.Version) {
+		return
+	}
+	json.NewEncoder(w).Encode(data)
+}
+func stockDelete(w http.ResponseWriter, r *http.Request) {
+	idnum, ok := pathID(w, r, "stockID")
+	if !ok {
+		return
+	}
+	version, ok := requireIfMatch(w, r)
+	if !ok {
+		return
+	}
+	err := deleteStock(idnum, version)
+	if err != nil {
+		writeUpdateError(w, r, err)
+		return
+	}
 
-		w.WriteHeader(http.StatusOK)
-		w.Write([]byte("data added sucesfuly"))
-	case http.MethodPatch:
-		fmt.Println("Endpoint Hit: stock PATCH")
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte("data deleated sucesfuly"))
+}
+func stockCreate(w http.ResponseWriter, r *http.Request) {
+	var data Stock
+	data.SupplierID = 1
+	data.LastLogID = 0
+	err := json.NewDecoder(r.Body).Decode(&data)
+	if err != nil {
+		http.Error(w, "invalid body", http.StatusBadRequest)
+		return
+	}
+	slog.Debug("creating stock", "stock", data)
+	err = checkStockRefs(r.Context(), data)
+	if err == errNotAtSite {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		internalError(w, r, err)
+		return
+	}
+	_, err = addStock(data)
+	if errors.Is(err, errSKUInUse) {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if err != nil {
+		internalError(w, r, err)
+		return
+	}
 
-		id := strings.TrimPrefix(r.URL.Path, "/stock/")
-		idnum, err := strconv.Atoi(id)
-		if err != nil {
-			log.Fatal(err)
-		}
-		var data Stock
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte("data added sucesfuly"))
+}
+func stockUpdate(w http.ResponseWriter, r *http.Request) {
+	idnum, ok := pathID(w, r, "stockID")
+	if !ok {
+		return
+	}
+	var data Stock
 
-		data.StockID = idnum
-		data.LastLogID = 0
+	data.StockID = idnum
+	data.LastLogID = 0
 
-		err = json.NewDecoder(r.Body).Decode(&data)
-		if err != nil {
-			log.Fatal(err)
-		}
+	err := json.NewDecoder(r.Body).Decode(&data)
+	if err != nil {
+		http.Error(w, "invalid body", http.StatusBadRequest)
+		return
+	}
+	// THE VERSION COMES FROM If-Match, NOT THE BODY
+	data.Version, ok = requireIfMatch(w, r)
+	if !ok {
+		return
+	}
+	err = checkStockRefs(r.Context(), data)
+	if err != nil {
+		writeUpdateError(w, r, err)
+		return
+	}
 
-		updateStock(data)
+	version, err := updateStock(data)
+	if err != nil {
+		writeUpdateError(w, r, err)
+		return
+	}
 
-		w.WriteHeader(http.StatusOK)
-		w.Write([]byte("data updated sucesfuly"))
+	w.Header().Set("ETag", etag(version))
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte("data updated sucesfuly"))
+}
+func fullStockList(w http.ResponseWriter, r *http.Request) {
+	filter, err := stockFilterFromQuery(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	filter.SiteID = siteFrom(r.Context())
 
-	default:
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	if format := exportFormat(r); format != formatJSON {
+		exportFullStock(w, r, format, filter)
+		return
+	}
 
+	res, err := getStockFull(filter)
+	if err != nil {
+		internalError(w, r, err)
+		return
+	}
+	total, err := countFullStock(filter)
+	if err != nil {
+		internalError(w, r, err)
+		return
 	}
+	w.Header().Set("X-Total-Count", strconv.Itoa(total))
+	json.NewEncoder(w).Encode(res)
 }
-func stockFull(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Access-Control-Allow-Origin", "*")
-	w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PATCH, OPTIONS")
-	w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
-
-	switch r.Method {
-	case http.MethodOptions:
-		fmt.Println("Endpoint Hit: stock_full OPTIONS")
-		w.WriteHeader(http.StatusOK)
-
-	case http.MethodGet:
-		var res []FullStock
-		var err error
-
-		fmt.Println("Endpoint Hit: stock_full GET")
-
-		id := strings.TrimPrefix(r.URL.Path, "/fullStock/")
-		idnum, err := strconv.Atoi(id)
-
-		if id != "" && err == nil {
-			res, err = getFullStockById(idnum)
-			if err != nil {
-				log.Fatal(err)
-			}
-		} else {
-			res, err = getStockFull()
-			if err != nil {
-				log.Fatal(err)
-			}
-		}
-		json.NewEncoder(w).Encode(res)
-	case http.MethodPatch:
+func fullStockGet(w http.ResponseWriter, r *http.Request) {
+	idnum, ok := pathID(w, r, "stockID")
+	if !ok {
+		return
+	}
 
-		fmt.Println("Endpoint Hit: stock PATCH")
-		var data FullStock
-		err := json.NewDecoder(r.Body).Decode(&data)
+	if format := exportFormat(r); format != formatJSON {
+		filter, err := stockFilterFromQuery(r.URL.Query())
 		if err != nil {
-			log.Fatal(err)
-		}
-		err = updateFullStockLevel(data)
-		if err != nil {
-			log.Fatal(err)
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
 		}
-		w.WriteHeader(http.StatusOK)
-		w.Write([]byte("data received successfully"))
+		filter.StockID = idnum
+		filter.SiteID = siteFrom(r.Context())
+		exportFullStock(w, r, format, filter)
+		return
+	}
 
-	default:
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	res, err := getFullStockById(idnum)
+	if err != nil {
+		internalError(w, r, err)
+		return
+	}
+	// NO ETag, THE NAMES AND TAGS JOINED IN CAN CHANGE WITHOUT THE ITEM'S
+	// VERSION. IT IS IN THE BODY FOR If-Match
+	json.NewEncoder(w).Encode(res)
+}
+func fullStockSetLevel(w http.ResponseWriter, r *http.Request) {
+	var data FullStock
+	err := json.NewDecoder(r.Body).Decode(&data)
+	if err != nil {
+		http.Error(w, "invalid body", http.StatusBadRequest)
+		return
+	}
+	// LEVEL COUNTS ONLY CHECK THE VERSION WHEN If-Match IS SENT
+	data.Version, err = parseIfMatch(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	data.SiteID = siteFrom(r.Context())
+	_, err = updateFullStockLevel(data)
+	if err != nil {
+		writeUpdateError(w, r, err)
+		return
 	}
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte("data received successfully"))
 }
 
-func connection(db_user string, db_pass string, db_name string, db_endpoint string) (*sql.DB, error) {
-	var dsn string = fmt.Sprintf("%s:%s@tcp(%s)/%s", db_user, db_pass, db_endpoint, db_name)
-	db, err := sql.Open("mysql", dsn)
-	fmt.Println("attempting to connect to the database")
+func connection(config DBConfig) (*sql.DB, error) {
+	cfg := mysql.NewConfig()
+	cfg.User = config.User
+	cfg.Passwd = config.Password
+	cfg.Net = "tcp"
+	cfg.Addr = config.Endpoint
+	cfg.DBName = config.Name
+	db, err := sql.Open("mysql", inUTC(cfg))
+	slog.Info("attempting to connect to the database", "endpoint", config.Endpoint)
 	if err != nil {
 		return nil, err
 	}
+	db.SetMaxOpenConns(config.MaxOpenConns)
+	db.SetMaxIdleConns(config.MaxIdleConns)
+	db.SetConnMaxLifetime(config.ConnMaxLifetime)
 
 	err = db.Ping()
 	if err != nil {
+		db.Close()
 		return nil, err
 	}
-	fmt.Println("Successfully connected to the database")
+	slog.Info("successfully connected to the database")
 
 	var version string
 	err = db.QueryRow("SELECT VERSION()").Scan(&version)
 	if err != nil {
-		panic(err.Error())
+		db.Close()
+		return nil, err
 	}
-	fmt.Println("Database version: ", version)
+	slog.Info("database version", "version", version)
 
 	return db, nil
 }
+
+// inUTC returns the DSN for cfg with its sessions in UTC, so NOW() and times
+// sent from Go, e.g. a synced change's recordedAt, are on the same clock
+func inUTC(cfg *mysql.Config) string {
+	if cfg.Params == nil {
+		cfg.Params = map[string]string{}
+	}
+	cfg.Params["time_zone"] = "'+00:00'"
+	cfg.Loc = time.UTC
+	return cfg.FormatDSN()
+}
+
 func initialiseTables() (err error) {
 
 	_, err = db.Exec(createSuppliers)
@@ -493,131 +706,554 @@ func initialiseTables() (err error) {
 		return err
 	}
 
+	// COLUMNS ADDED AFTER THE TABLES WERE FIRST CREATED
+	err = addColumn("stock", "unit", "varchar(32) NOT NULL DEFAULT ''")
+	if err != nil {
+		return err
+	}
+	err = addColumn("stock", "shelfOrder", "int NOT NULL DEFAULT 0")
+	if err != nil {
+		return err
+	}
+	err = addColumn("stock", "sku", "varchar(64) UNIQUE")
+	if err != nil {
+		return err
+	}
+	err = addColumn("stock", "categoryID", "int")
+	if err != nil {
+		return err
+	}
+	err = addColumn("logs", "reason", "varchar(255) NOT NULL DEFAULT ''")
+	if err != nil {
+		return err
+	}
+	for _, table := range []string{"stock", "rooms", "suppliers"} {
+		err = addColumn(table, "version", "int NOT NULL DEFAULT 1")
+		if err != nil {
+			return err
+		}
+	}
+
+	err = initialiseSites()
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Exec(createBarcodes)
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Exec(createCategories)
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Exec(createStockTags)
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Exec(createAlerts)
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Exec(createAlertChannels)
+	if err != nil {
+		return err
+	}
+	err = addColumn("alertChannels", "siteID", "int NOT NULL DEFAULT 1")
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Exec(createOutbox)
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Exec(createWebhooks)
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Exec(createWebhookDeliveries)
+	if err != nil {
+		return err
+	}
+	err = addColumn("outbox", "roomID", "int")
+	if err != nil {
+		return err
+	}
+	err = addColumn("outbox", "siteID", "int")
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Exec(createIdempotencyKeys)
+	if err != nil {
+		return err
+	}
+	// KEYS ARE PER USER, SO ONE USER CANNOT BE REPLAYED ANOTHER'S RESPONSE
+	err = addColumn("idempotencyKeys", "userName", "varchar(255) NOT NULL DEFAULT '' FIRST")
+	if err != nil {
+		return err
+	}
+	err = setPrimaryKey("idempotencyKeys", "userName", "idemKey")
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Exec(createSyncChanges)
+	if err != nil {
+		return err
+	}
+	// CHANGE IDS ARE ONLY UNIQUE ON THE DEVICE THAT MADE THEM
+	err = setPrimaryKey("syncChanges", "deviceID", "changeID")
+	if err != nil {
+		return err
+	}
+
 	return nil
 }
 
-// CREATE
+// nullString stores empty strings as NULL, e.g. for columns with a unique index
+func nullString(s string) sql.NullString {
+	return sql.NullString{String: s, Valid: s != ""}
+}
+
+// addColumn adds a column to an existing table unless it is already there
+func addColumn(table string, column string, definition string) (err error) {
+	var count int
+	err = db.QueryRow(`SELECT COUNT(*) FROM information_schema.COLUMNS
+		WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = ? AND COLUMN_NAME = ?`, table, column).Scan(&count)
+	if err != nil {
+		return err
+	}
+	if count > 0 {
+		return nil
+	}
 
-func addStock(name string, level float64, roomID int, supplierID int, incident float64) (err error) {
-	query := "INSERT INTO stock(itemName,level,roomID,supplierID,incidentLevel) VALUES (?,?,?,?,?)"
+	_, err = db.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, column, definition))
+	return err
+}
 
-	_, err = db.Exec(query, name, level, roomID, supplierID, incident)
+// addForeignKey makes column of an existing table reference refTable(refColumn)
+// unless it already does
+func addForeignKey(table string, column string, refTable string, refColumn string) (err error) {
+	var count int
+	err = db.QueryRow(`SELECT COUNT(*) FROM information_schema.KEY_COLUMN_USAGE
+		WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = ? AND COLUMN_NAME = ?
+		AND REFERENCED_TABLE_NAME = ? AND REFERENCED_COLUMN_NAME = ?`, table, column, refTable, refColumn).Scan(&count)
 	if err != nil {
 		return err
 	}
+	if count > 0 {
+		return nil
+	}
 
-	return nil
+	_, err = db.Exec(fmt.Sprintf("ALTER TABLE %s ADD FOREIGN KEY (%s) REFERENCES %s(%s)", table, column, refTable, refColumn))
+	return err
 }
-func addRoom(roomName string) (err error) {
-	query := "INSERT INTO rooms(roomName) VALUES (?)"
 
-	_, err = db.Exec(query, roomName)
+// setPrimaryKey makes columns, in order, the primary key of an existing table
+// unless they already are
+func setPrimaryKey(table string, columns ...string) (err error) {
+	rows, err := db.Query(`SELECT COLUMN_NAME FROM information_schema.STATISTICS
+		WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = ? AND INDEX_NAME = 'PRIMARY' ORDER BY SEQ_IN_INDEX`, table)
 	if err != nil {
 		return err
 	}
-	return nil
+	defer rows.Close()
+	var current []string
+	for rows.Next() {
+		var column string
+		err = rows.Scan(&column)
+		if err != nil {
+			return err
+		}
+		current = append(current, column)
+	}
+	if err = rows.Err(); err != nil {
+		return err
+	}
+	if slices.Equal(current, columns) {
+		return nil
+	}
+
+	alter := fmt.Sprintf("ALTER TABLE %s ADD PRIMARY KEY (%s)", table, strings.Join(columns, ", "))
+	if len(current) > 0 {
+		alter = fmt.Sprintf("ALTER TABLE %s DROP PRIMARY KEY, ADD PRIMARY KEY (%s)", table, strings.Join(columns, ", "))
+	}
+	_, err = db.Exec(alter)
+	return err
+}
+
+// CREATE
+
+func addStock(data Stock) (id int, err error) {
+	query := "INSERT INTO stock(itemName,level,roomID,supplierID,incidentLevel,unit,shelfOrder,sku,categoryID) VALUES (?,?,?,?,?,?,?,?,?)"
+
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.Exec(query, data.ItemName, data.Level, data.RoomID, data.SupplierID, data.IncidentLevel, data.Unit, data.ShelfOrder, nullString(data.SKU), nullInt(data.CategoryID))
+	if isDuplicateKey(err) {
+		// SKU IS THE ONLY UNIQUE COLUMN SET HERE
+		return 0, errSKUInUse
+	}
+	if err != nil {
+		return 0, err
+	}
+	newID, err := res.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+	data.StockID = int(newID)
+	data.Version = 1
+
+	err = emitEvent(tx, eventStockCreated, data)
+	if err != nil {
+		return 0, err
+	}
+
+	return data.StockID, tx.Commit()
+}
+func addRoom(roomName string, site int) (id int, err error) {
+	query := "INSERT INTO rooms(roomName,siteID) VALUES (?,?)"
+
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.Exec(query, roomName, site)
+	if err != nil {
+		return 0, err
+	}
+	newID, err := res.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+	id = int(newID)
+
+	err = emitEvent(tx, eventRoomCreated, Room{RoomId: id, RoomName: roomName, SiteID: site, Version: 1})
+	if err != nil {
+		return 0, err
+	}
+	return id, tx.Commit()
 }
 
 // GET
 
-func getSuppliers() (res []Supplier, err error) {
-	row, err := db.Query("SELECT * FROM suppliers")
+// rowScanner is a *sql.Row or *sql.Rows
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+const selectSuppliers = `SELECT supplierID, supplierName, supplierContact_no, leadTime,
+	mondayDeliver, tuesdayDeliver, wednesdayDeliver, thursdayDeliver, fridayDeliver, saturdayDeliver, sundayDeliver, version,
+	(SELECT GROUP_CONCAT(siteID ORDER BY siteID SEPARATOR ',') FROM supplierSites WHERE supplierSites.supplierID = suppliers.supplierID)
+	FROM suppliers`
+
+func scanSupplier(row rowScanner) (data Supplier, err error) {
+	var contactNo, sites sql.NullString
+	err = row.Scan(&data.SupplierID, &data.SupplierName, &contactNo, &data.LeadTime,
+		&data.MondayDeliver, &data.TuesdayDeliver, &data.WednesdayDeliver, &data.ThursdayDeliver, &data.FridayDeliver, &data.SaturdayDeliver, &data.SundayDeliver,
+		&data.Version, &sites)
+	if err != nil {
+		return data, err
+	}
+	data.SiteIDs = []int{}
+	if sites.Valid {
+		data.SiteIDs, err = parseIDList(sites.String)
+		if err != nil {
+			return data, err
+		}
+	}
+
+	if contactNo.Valid {
+		data.SupplierContactNo = contactNo.String
+	} else {
+		data.SupplierContactNo = "N/A"
+	}
+	return data, nil
+}
+
+// getSuppliers returns the suppliers shared with site, or every supplier for
+// allSites
+func getSuppliers(site int) (res []Supplier, err error) {
+	query := selectSuppliers
+	var args []any
+	if site != allSites {
+		query += " WHERE supplierID IN (SELECT supplierID FROM supplierSites WHERE siteID=?)"
+		args = append(args, site)
+	}
+	row, err := db.Query(query, args...)
 	if err != nil {
 		return res, err
 	}
 	defer row.Close()
 
-	var data Supplier
-	var contactNo sql.NullString
 	for row.Next() {
-
-		err := row.Scan(&data.SupplierID, &data.SupplierName, &contactNo, &data.LeadTime,
-			&data.MondayDeliver, &data.TuesdayDeliver, &data.WednesdayDeliver, &data.ThursdayDeliver, &data.FridayDeliver, &data.SaturdayDeliver, &data.SundayDeliver)
+		data, err := scanSupplier(row)
 		if err != nil {
 			return res, err
 		}
+		res = append(res, data)
+	}
+	return res, nil
+}
+func getSupplier(id int) (data Supplier, err error) {
+	return scanSupplier(db.QueryRow(selectSuppliers+" WHERE supplierID=?", id))
+}
 
-		if contactNo.Valid {
-			data.SupplierContactNo = contactNo.String
-		} else {
-			data.SupplierContactNo = "N/A"
+// getRooms returns the rooms of site, or of every site for allSites
+func getRooms(site int) (res []Room, err error) {
+	query := "SELECT roomID, roomName, siteID, version FROM rooms"
+	var args []any
+	if site != allSites {
+		query += " WHERE siteID=?"
+		args = append(args, site)
+	}
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return res, err
+	}
+	defer rows.Close()
+
+	var data Room
+	for rows.Next() {
+		err = rows.Scan(&data.RoomId, &data.RoomName, &data.SiteID, &data.Version)
+		if err != nil {
+			return res, err
 		}
 		res = append(res, data)
 	}
 	return res, nil
 }
-func getRooms() (res []Room, err error) {
+func getRoom(id int) (data Room, err error) {
+	err = db.QueryRow("SELECT roomID, roomName, siteID, version FROM rooms WHERE roomID=?", id).Scan(&data.RoomId, &data.RoomName, &data.SiteID, &data.Version)
+	return data, err
+}
+func getRoomName(id int) (name string, err error) {
+	err = db.QueryRow("SELECT roomName FROM rooms WHERE roomID=?", id).Scan(&name)
+	return name, err
+}
+
+const selectStock = "SELECT stockID, itemName, level, roomID, supplierID, incidentLevel, lastLogID, unit, shelfOrder, sku, categoryID, version FROM stock"
+
+func scanStock(row rowScanner) (data Stock, err error) {
+	var log sql.NullInt64
+	var sku sql.NullString
+	var category sql.NullInt64
+	err = row.Scan(&data.StockID, &data.ItemName, &data.Level, &data.RoomID, &data.SupplierID, &data.IncidentLevel, &log, &data.Unit, &data.ShelfOrder, &sku, &category, &data.Version)
+	data.SKU = sku.String
+	data.CategoryID = int(category.Int64)
+
+	if log.Valid {
+		data.LastLogID = int(log.Int64)
+	} else {
+		data.LastLogID = 0
+	}
+	return data, err
+}
 
-	rows, err := db.Query("SELECT * FROM rooms")
+// getStock returns the stock of site, or of every site for allSites
+func getStock(site int) (res []Stock, err error) {
+	query := selectStock
+	var args []any
+	if site != allSites {
+		query += " WHERE roomID IN (SELECT roomID FROM rooms WHERE siteID=?)"
+		args = append(args, site)
+	}
+	rows, err := db.Query(query, args...)
 	if err != nil {
 		return res, err
 	}
-	defer rows.Close()
-
-	var data Room
-	for rows.Next() {
-		err = rows.Scan(&data.RoomId, &data.RoomName)
-		if err != nil {
-			return res, err
+	defer rows.Close()
+
+	for rows.Next() {
+		data, err := scanStock(rows)
+		if err != nil {
+			return res, err
+		}
+		res = append(res, data)
+	}
+	return res, rows.Err()
+}
+func getStockByID(id int) (data Stock, err error) {
+	return scanStock(db.QueryRow(selectStock+" WHERE stockID=?", id))
+}
+func getStockFull(filter stockFilter) (res []FullStock, err error) {
+	err = eachFullStock(filter, func(data FullStock) error {
+		res = append(res, data)
+		return nil
+	})
+	return res, err
+}
+
+// stockFilter limits which stock rows are returned, zero values mean no limit
+type stockFilter struct {
+	StockID       int
+	RoomID        int
+	SupplierID    int
+	SiteID        int   // allSites IS NO LIMIT
+	StockIDs      []int // ANY OF, FOR LOADING MANY PARENTS' ITEMS AT ONCE
+	RoomIDs       []int
+	SupplierIDs   []int
+	CategoryIDs   []int // A CATEGORY AND ITS SUBCATEGORIES
+	Tag           string
+	NameLike      string // SQL LIKE PATTERN FOR itemName
+	BelowIncident bool
+	ChangedSince  time.Time
+	OrderBy       string // SQL ORDER BY CLAUSE, DEFAULTS TO stockID
+	Limit         int
+	Offset        int
+}
+
+// categoryFilterFromQuery reads ?category= (including its subcategories) and
+// ?tag=, shared by the stock and log filters
+func categoryFilterFromQuery(q url.Values) (categoryIDs []int, tag string, err error) {
+	if v := q.Get("category"); v != "" {
+		id, err := strconv.Atoi(v)
+		if err != nil {
+			return nil, "", fmt.Errorf("invalid category %q", v)
+		}
+		categoryIDs, err = categoryAndDescendants(id)
+		if err != nil {
+			return nil, "", err
+		}
+	}
+	return categoryIDs, normaliseTag(q.Get("tag")), nil
+}
+
+const fullStockFrom = `
+		FROM
+		    stock
+		JOIN
+		    rooms ON stock.roomID = rooms.roomID
+		JOIN
+		    suppliers ON stock.supplierID = suppliers.supplierID
+		LEFT JOIN
+		    logs ON stock.lastLogID = logs.logID
+		LEFT JOIN
+		    categories ON stock.categoryID = categories.categoryID`
+
+// where builds the WHERE clause for a query over fullStockFrom
+func (filter stockFilter) where() (query string, args []any) {
+	query = " WHERE 1=1"
+	if filter.StockID != 0 {
+		query += " AND stock.stockID = ?"
+		args = append(args, filter.StockID)
+	}
+	if filter.RoomID != 0 {
+		query += " AND stock.roomID = ?"
+		args = append(args, filter.RoomID)
+	}
+	if filter.SupplierID != 0 {
+		query += " AND stock.supplierID = ?"
+		args = append(args, filter.SupplierID)
+	}
+	if filter.SiteID != allSites {
+		query += " AND rooms.siteID = ?"
+		args = append(args, filter.SiteID)
+	}
+	for _, in := range []struct {
+		column string
+		ids    []int
+	}{{"stock.stockID", filter.StockIDs}, {"stock.roomID", filter.RoomIDs}, {"stock.supplierID", filter.SupplierIDs}} {
+		if len(in.ids) > 0 {
+			clause, inArgs := sqlIn(in.column, in.ids)
+			query += " AND " + clause
+			args = append(args, inArgs...)
 		}
-		res = append(res, data)
 	}
-	return res, nil
-}
-func getStock() (res []Stock, err error) {
-	rows, err := db.Query("SELECT * FROM stock")
-	if err != nil {
-		return res, err
+	if len(filter.CategoryIDs) > 0 {
+		in, inArgs := sqlIn("stock.categoryID", filter.CategoryIDs)
+		query += " AND " + in
+		args = append(args, inArgs...)
 	}
-	defer rows.Close()
-
-	var data Stock
-	for rows.Next() {
-		var log sql.NullInt64
-		rows.Scan(&data.StockID, &data.ItemName, &data.Level, &data.RoomID, &data.SupplierID, &data.IncidentLevel, &log)
-
-		if log.Valid {
-			data.LastLogID = int(log.Int64)
-		} else {
-			data.LastLogID = 0
-		}
-
-		res = append(res, data)
+	if filter.Tag != "" {
+		query += " AND stock.stockID IN (SELECT stockID FROM stockTags WHERE tag = ?)"
+		args = append(args, filter.Tag)
 	}
-	return res, nil
+	if filter.NameLike != "" {
+		query += " AND stock.itemName LIKE ?"
+		args = append(args, filter.NameLike)
+	}
+	if filter.BelowIncident {
+		query += " AND stock.level < stock.incidentLevel"
+	}
+	if !filter.ChangedSince.IsZero() {
+		query += " AND logs.incidentTime >= ?"
+		args = append(args, filter.ChangedSince)
+	}
+	return query, args
 }
-func getStockFull() (res []FullStock, err error) {
-	rows, err := db.Query(`
+
+// eachFullStock calls fn for every stock row matching filter, joined with its
+// room, supplier and last log
+func eachFullStock(filter stockFilter, fn func(FullStock) error) (err error) {
+	query := `
 		SELECT
 		    stock.stockID,
 		    stock.itemName,
 		    stock.level,
 			rooms.roomID,
 		    rooms.roomName AS room,
+		    rooms.siteID,
 			suppliers.supplierID,
 		    suppliers.supplierName AS supplier,
 		    stock.incidentLevel,
 		    stock.lastLogID,
-		    logs.incidentTime AS "last changed"
-		FROM
-		    stock
-		JOIN
-		    rooms ON stock.roomID = rooms.roomID
-		JOIN
-		    suppliers ON stock.supplierID = suppliers.supplierID
-		LEFT JOIN
-		    logs ON stock.lastLogID = logs.logID;`)
+		    logs.incidentTime AS "last changed",
+		    stock.unit,
+		    stock.shelfOrder,
+		    stock.sku,
+		    stock.categoryID,
+		    categories.categoryName AS category,
+		    stock.version,
+		    (SELECT GROUP_CONCAT(tag ORDER BY tag SEPARATOR ',') FROM stockTags WHERE stockTags.stockID = stock.stockID) AS tags` + fullStockFrom
+	where, args := filter.where()
+	query += where
+	if filter.OrderBy != "" {
+		query += " ORDER BY " + filter.OrderBy
+	} else {
+		query += " ORDER BY stock.stockID"
+	}
+	if filter.Limit > 0 {
+		query += " LIMIT ? OFFSET ?"
+		args = append(args, filter.Limit, filter.Offset)
+	}
+
+	rows, err := db.Query(query, args...)
 	if err != nil {
-		return res, err
+		return err
 	}
 	defer rows.Close()
 
-	var data FullStock
-	var log sql.NullInt64
 	for rows.Next() {
-		err = rows.Scan(&data.StockID, &data.ItemName, &data.Level, &data.RoomID, &data.Room, &data.SupplierID, &data.Supplier, &data.IncidentLevel, &log, &data.LastChanged)
+		var data FullStock
+		var log sql.NullInt64
+		var sku, category, tags sql.NullString
+		var categoryID sql.NullInt64
+		err = rows.Scan(&data.StockID, &data.ItemName, &data.Level, &data.RoomID, &data.Room, &data.SiteID, &data.SupplierID, &data.Supplier, &data.IncidentLevel, &log, &data.LastChanged, &data.Unit, &data.ShelfOrder, &sku,
+			&categoryID, &category, &data.Version, &tags)
 		if err != nil {
-			return res, err
+			return err
+		}
+		data.SKU = sku.String
+		data.CategoryID = int(categoryID.Int64)
+		data.Category = category.String
+		data.Tags = []string{}
+		if tags.Valid {
+			data.Tags = strings.Split(tags.String, ",")
 		}
 		if log.Valid {
 			data.LastLogID = int(log.Int64)
@@ -625,14 +1261,17 @@ func getStockFull() (res []FullStock, err error) {
 		} else {
 			data.LastLogID = 0
 		}
-		res = append(res, data)
+		err = fn(data)
+		if err != nil {
+			return err
+		}
 	}
 
-	return res, err
+	return rows.Err()
 }
 func getLogs() (res []LogRow, err error) {
 
-	rows, err := db.Query("SELECT * FROM logs")
+	rows, err := db.Query("SELECT logID, stockID, differance, totalAfter, incidentTime, daily, reason FROM logs")
 	if err != nil {
 		return res, err
 	}
@@ -641,7 +1280,7 @@ func getLogs() (res []LogRow, err error) {
 	var data LogRow
 
 	for rows.Next() {
-		err = rows.Scan(&data.LogID, &data.StockID, &data.Differance, &data.TotalAfter, &data.IncidentTime, &data.Daily)
+		err = rows.Scan(&data.LogID, &data.StockID, &data.Differance, &data.TotalAfter, &data.IncidentTime, &data.Daily, &data.Reason)
 		if err != nil {
 			return res, err
 		}
@@ -649,222 +1288,399 @@ func getLogs() (res []LogRow, err error) {
 	}
 	return res, nil
 }
-func getLogNames() (res []Log, err error) {
+func getLogNames(filter logFilter) (res []Log, err error) {
+	err = eachLogName(filter, func(data Log) error {
+		res = append(res, data)
+		return nil
+	})
+	return res, err
+}
+
+// logFilter limits which logs are returned, zero values mean no limit
+type logFilter struct {
+	StockID     int
+	StockIDs    []int // ANY OF
+	SiteID      int   // allSites IS NO LIMIT
+	From        time.Time
+	To          time.Time // EXCLUSIVE
+	CategoryIDs []int
+	Tag         string
+}
+
+// logFilterFromQuery reads ?stockID=, ?from=, ?to= (YYYY-MM-DD), ?month=
+// (YYYY-MM), ?category= and ?tag=
+func logFilterFromQuery(q url.Values) (filter logFilter, err error) {
+	filter.CategoryIDs, filter.Tag, err = categoryFilterFromQuery(q)
+	if err != nil {
+		return filter, err
+	}
+	if v := q.Get("stockID"); v != "" {
+		filter.StockID, err = strconv.Atoi(v)
+		if err != nil {
+			return filter, fmt.Errorf("invalid stockID %q", v)
+		}
+	}
+	if v := q.Get("month"); v != "" {
+		filter.From, err = time.Parse("2006-01", v)
+		if err != nil {
+			return filter, fmt.Errorf("invalid month %q, expected YYYY-MM", v)
+		}
+		filter.To = filter.From.AddDate(0, 1, 0)
+	}
+	if v := q.Get("from"); v != "" {
+		filter.From, err = time.Parse("2006-01-02", v)
+		if err != nil {
+			return filter, fmt.Errorf("invalid from %q, expected YYYY-MM-DD", v)
+		}
+	}
+	if v := q.Get("to"); v != "" {
+		filter.To, err = time.Parse("2006-01-02", v)
+		if err != nil {
+			return filter, fmt.Errorf("invalid to %q, expected YYYY-MM-DD", v)
+		}
+	}
+	return filter, nil
+}
 
-	rows, err := db.Query(`SELECT 
+// eachLogName calls fn for every log matching filter, with the item name of
+// its stock, without holding the whole result in memory
+func eachLogName(filter logFilter, fn func(Log) error) (err error) {
+	query := `SELECT 
     logs.logID,
     logs.stockID,
     stock.itemName, 
     logs.differance,
     logs.totalAfter,
     logs.incidentTime,
-    logs.daily
+    logs.daily,
+    logs.reason
 	FROM 
 		logs
 	LEFT JOIN 
 		stock
 	ON 
-		logs.stockID = stock.stockID;
-	`)
+		logs.stockID = stock.stockID
+	WHERE 1=1`
+	var args []any
+	if filter.StockID != 0 {
+		query += " AND logs.stockID = ?"
+		args = append(args, filter.StockID)
+	}
+	if len(filter.StockIDs) > 0 {
+		in, inArgs := sqlIn("logs.stockID", filter.StockIDs)
+		query += " AND " + in
+		args = append(args, inArgs...)
+	}
+	if filter.SiteID != allSites {
+		query += " AND stock.roomID IN (SELECT roomID FROM rooms WHERE siteID = ?)"
+		args = append(args, filter.SiteID)
+	}
+	if !filter.From.IsZero() {
+		query += " AND logs.incidentTime >= ?"
+		args = append(args, filter.From)
+	}
+	if !filter.To.IsZero() {
+		query += " AND logs.incidentTime < ?"
+		args = append(args, filter.To)
+	}
+	if len(filter.CategoryIDs) > 0 {
+		in, inArgs := sqlIn("stock.categoryID", filter.CategoryIDs)
+		query += " AND " + in
+		args = append(args, inArgs...)
+	}
+	if filter.Tag != "" {
+		query += " AND logs.stockID IN (SELECT stockID FROM stockTags WHERE tag = ?)"
+		args = append(args, filter.Tag)
+	}
+	query += " ORDER BY logs.logID"
+
+	rows, err := db.Query(query, args...)
 	if err != nil {
-		return res, err
+		return err
 	}
 	defer rows.Close()
 
 	for rows.Next() {
 		var data Log
-		err = rows.Scan(&data.LogID, &data.StockID, &data.ItemName, &data.Differance, &data.TotalAfter, &data.IncidentTime, &data.Daily)
+		err = rows.Scan(&data.LogID, &data.StockID, &data.ItemName, &data.Differance, &data.TotalAfter, &data.IncidentTime, &data.Daily, &data.Reason)
 		if err != nil {
-			return res, err
+			return err
+		}
+		err = fn(data)
+		if err != nil {
+			return err
 		}
-		res = append(res, data)
 	}
 
-	return res, nil
+	return rows.Err()
+}
+
+// countFullStock counts the rows matching filter, ignoring Limit and Offset
+func countFullStock(filter stockFilter) (count int, err error) {
+	where, args := filter.where()
+	err = db.QueryRow("SELECT COUNT(*)"+fullStockFrom+where, args...).Scan(&count)
+	return count, err
 }
 func getFullStockById(id int) (res []FullStock, err error) {
-	row, err := db.Query(`
-		SELECT
-		    stock.stockID,
-		    stock.itemName,
-		    stock.level,
-			rooms.roomID,
-		    rooms.roomName AS room,
-			suppliers.supplierID,
-		    suppliers.supplierName AS supplier,
-		    stock.incidentLevel,
-		    stock.lastLogID,
-		    logs.incidentTime AS "last changed"
-		FROM
-		    stock
-		JOIN
-		    rooms ON stock.roomID = rooms.roomID
-		JOIN
-		    suppliers ON stock.supplierID = suppliers.supplierID
-		LEFT JOIN
-		    logs ON stock.lastLogID = logs.logID
-		WHERE
-		    stock.stockID = ?;
-		`, id)
+	err = eachFullStock(stockFilter{StockID: id}, func(data FullStock) error {
+		res = append(res, data)
+		return nil
+	})
+	return res, err
+}
+
+// UPDATE
+
+func updateFullStockLevel(data FullStock) (res levelChange, err error) {
+	tx, err := db.Begin()
 	if err != nil {
 		return res, err
 	}
-	defer row.Close()
+	defer tx.Rollback()
 
+	res, alert, err := setStockLevel(tx, data)
 	if err != nil {
 		return res, err
 	}
-	var data FullStock
-	var log sql.NullInt64
-	if row.Next() {
-		err = row.Scan(&data.StockID, &data.ItemName, &data.Level, &data.RoomID, &data.Room, &data.SupplierID, &data.Supplier, &data.IncidentLevel, &log, &data.LastChanged)
-		if err != nil {
-			return res, err
-		}
-		if log.Valid {
-			data.LastLogID = int(log.Int64)
-		} else {
-			data.LastLogID = 0
-		}
-		res = append(res, data)
+
+	if err = tx.Commit(); err != nil {
+		return res, err
 	}
+	notifyLowStock(alert)
+
 	return res, nil
 }
 
-// UPDATE
-
-func updateFullStockLevel(data FullStock) (err error) {
-	const selectOldLevel = `SELECT level FROM stock WHERE stockID=? LIMIT 1 FOR UPDATE`
+// setStockLevel sets the level of data.StockID to data.Level inside tx and
+// logs the difference. data.Version is checked unless it is 0 and the item
+// is only found at data.SiteID unless that is allSites. The alert, if any,
+// should be sent with notifyLowStock once tx commits.
+func setStockLevel(tx *sql.Tx, data FullStock) (res levelChange, alert *Alert, err error) {
+	const selectOldLevel = `SELECT stock.level, stock.roomID, stock.version FROM stock JOIN rooms ON stock.roomID = rooms.roomID
+		WHERE stock.stockID=? AND (? = 0 OR rooms.siteID = ?) LIMIT 1 FOR UPDATE`
 	const insertLog = `INSERT INTO logs(stockID,differance,totalAfter,incidentTime,daily) VALUES (?,?,?,NOW(),0);`
 	const selectLog = `SELECT LAST_INSERT_ID();`
-	const updateQuery = `UPDATE stock SET level=?, lastLogID=? WHERE stockID=?;`
-
-	tx, err := db.Begin()
-	if err != nil {
-		return err
-	}
-	defer tx.Rollback()
+	const updateQuery = `UPDATE stock SET level=?, lastLogID=?, version=version+1 WHERE stockID=?;`
 
 	stockId := data.StockID
 	var oldlevel float64
-	err = tx.QueryRow(selectOldLevel, stockId).Scan(&oldlevel)
+	var roomID, version int
+	err = tx.QueryRow(selectOldLevel, stockId, data.SiteID, data.SiteID).Scan(&oldlevel, &roomID, &version)
 	if err != nil {
-		return err
+		return res, nil, err
+	}
+	err = checkVersion(version, data.Version)
+	if err != nil {
+		return res, nil, err
 	}
 	stockLevel := data.Level
 	differance := stockLevel - oldlevel
 
 	_, err = tx.Exec(insertLog, stockId, differance, stockLevel)
 	if err != nil {
-		return err
+		return res, nil, err
 	}
 
 	var logID int
 	err = tx.QueryRow(selectLog).Scan(&logID)
 	if err != nil {
-		return err
+		return res, nil, err
 	}
 
 	_, err = tx.Exec(updateQuery, stockLevel, logID, stockId)
 	if err != nil {
-		return err
+		return res, nil, err
 	}
 
-	if err = tx.Commit(); err != nil {
-		return err
+	alert, err = checkLowStock(tx, stockId, oldlevel, stockLevel)
+	if err != nil {
+		return res, nil, err
 	}
 
-	return nil
+	res = levelChange{StockID: stockId, RoomID: roomID, Level: stockLevel, Differance: differance, LogID: logID}
+	err = emitEvent(tx, eventStockLevelChanged, res)
+	if err != nil {
+		return res, nil, err
+	}
+
+	return res, alert, nil
+}
+
+// levelChange is the data of a stock.levelChanged event
+type levelChange struct {
+	StockID    int     `json:"stockID"`
+	RoomID     int     `json:"roomID"`
+	Level      float64 `json:"level"`
+	Differance float64 `json:"differance"`
+	LogID      int     `json:"logID"`
+	Reason     string  `json:"reason,omitempty"`
 }
-func updateRoom(id int, name string) (err error) {
-	query := ("UPDATE rooms SET roomName=? WHERE roomID=? ")
 
-	_, err = db.Exec(query, name, id)
+// updateRoom renames a room, version is the one the client expects to
+// change (0 for any) and the new version is returned
+func updateRoom(id int, name string, version int) (newVersion int, err error) {
+	tx, err := db.Begin()
 	if err != nil {
-		return err
+		return 0, err
 	}
+	defer tx.Rollback()
 
-	return nil
+	err = tx.QueryRow("SELECT version FROM rooms WHERE roomID=? FOR UPDATE", id).Scan(&newVersion)
+	if err != nil {
+		return 0, err
+	}
+	err = checkVersion(newVersion, version)
+	if err != nil {
+		return 0, err
+	}
+	newVersion++
+
+	query := ("UPDATE rooms SET roomName=?, version=? WHERE roomID=? ")
+	_, err = tx.Exec(query, name, newVersion, id)
+	if err != nil {
+		return 0, err
+	}
+
+	err = emitEvent(tx, eventRoomUpdated, Room{RoomId: id, RoomName: name, Version: newVersion})
+	if err != nil {
+		return 0, err
+	}
+
+	return newVersion, tx.Commit()
 }
-func updateStock(data Stock) (err error) {
-	const selectOldLevel = `SELECT level FROM stock WHERE stockID=? LIMIT 1 FOR UPDATE`
+
+// updateStock sets every field of data in one transaction, logging a level
+// change. data.Version is the version the client expects to change (0 for
+// any) and the new version is returned.
+func updateStock(data Stock) (version int, err error) {
+	const selectOld = `SELECT level, roomID, version FROM stock WHERE stockID=? LIMIT 1 FOR UPDATE`
 	const insertLog = `INSERT INTO logs(stockID,differance,totalAfter,incidentTime,daily) VALUES (?,?,?,NOW(),0);`
 	const selectLog = `SELECT LAST_INSERT_ID();`
 	const updateQuery = `UPDATE stock SET level=?, lastLogID=? WHERE stockID=?;`
 
-	// CHECK IF LEVEL HAS CHANGED
-	query := "SELECT level FROM stock WHERE stockID=?"
-	var old_level float64
-	err = db.QueryRow(query, data.StockID).Scan(&old_level)
+	tx, err := db.Begin()
 	if err != nil {
-		return err
+		return 0, err
 	}
-	if old_level != data.Level {
+	defer tx.Rollback()
 
-		tx, err := db.Begin()
-		if err != nil {
-			return err
-		}
-		defer tx.Rollback()
+	stockId := data.StockID
+	var oldlevel float64
+	var roomID int
+	err = tx.QueryRow(selectOld, stockId).Scan(&oldlevel, &roomID, &version)
+	if err != nil {
+		return 0, err
+	}
+	err = checkVersion(version, data.Version)
+	if err != nil {
+		return 0, err
+	}
 
-		stockId := data.StockID
-		var oldlevel float64
-		err = tx.QueryRow(selectOldLevel, stockId).Scan(&oldlevel)
-		if err != nil {
-			return err
-		}
+	// CHECK IF LEVEL HAS CHANGED
+	var alert *Alert
+	if oldlevel != data.Level {
 		stockLevel := data.Level
 		differance := stockLevel - oldlevel
 
 		_, err = tx.Exec(insertLog, stockId, differance, stockLevel)
 		if err != nil {
-			return err
+			return 0, err
 		}
 
 		var logID int
 		err = tx.QueryRow(selectLog).Scan(&logID)
 		if err != nil {
-			return err
+			return 0, err
 		}
 
 		_, err = tx.Exec(updateQuery, stockLevel, logID, stockId)
 		if err != nil {
-			return err
+			return 0, err
 		}
 
-		if err = tx.Commit(); err != nil {
-			return err
+		err = emitEvent(tx, eventStockLevelChanged, levelChange{StockID: stockId, RoomID: roomID, Level: stockLevel, Differance: differance, LogID: logID})
+		if err != nil {
+			return 0, err
 		}
-
 	}
 
 	// set everything else
-	query = "UPDATE stock SET itemName=?, roomID=?, supplierID=?, incidentLevel=? WHERE stockID=?"
-	_, err = db.Exec(query, data.ItemName, data.RoomID, data.SupplierID, data.IncidentLevel, data.StockID)
+	data.Version = version + 1
+	query := "UPDATE stock SET itemName=?, roomID=?, supplierID=?, incidentLevel=?, unit=?, shelfOrder=?, sku=?, categoryID=?, version=? WHERE stockID=?"
+	_, err = tx.Exec(query, data.ItemName, data.RoomID, data.SupplierID, data.IncidentLevel, data.Unit, data.ShelfOrder, nullString(data.SKU), nullInt(data.CategoryID), data.Version, data.StockID)
+	if isDuplicateKey(err) {
+		return 0, errSKUInUse
+	}
 	if err != nil {
-		return err
+		return 0, err
 	}
 
-	return nil
+	// AFTER THE UPDATE, SO A NEW incidentLevel IS WHAT THE LEVEL IS CHECKED AGAINST
+	if oldlevel != data.Level {
+		alert, err = checkLowStock(tx, stockId, oldlevel, data.Level)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	err = emitEvent(tx, eventStockUpdated, data)
+	if err != nil {
+		return 0, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return 0, err
+	}
+	notifyLowStock(alert)
+
+	return data.Version, nil
 }
 
 // DELETE
 
-func deleteStock(id int) (err error) {
+// deleteStock deletes an item and everything recorded against it, version
+// is the one the client expects to delete (0 for any)
+func deleteStock(id int, version int) (err error) {
 	tx, err := db.Begin()
 	if err != nil {
 		return err
 	}
 	defer tx.Rollback()
 
+	var roomID, current int
+	err = tx.QueryRow("SELECT roomID, version FROM stock WHERE stockID=? FOR UPDATE", id).Scan(&roomID, &current)
+	if err != nil {
+		return err
+	}
+	err = checkVersion(current, version)
+	if err != nil {
+		return err
+	}
+
 	_, err = tx.Exec("DELETE FROM logs WHERE stockID=?", id)
 	if err != nil {
 		return err
 	}
+	_, err = tx.Exec("DELETE FROM barcodes WHERE stockID=?", id)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec("DELETE FROM stockTags WHERE stockID=?", id)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec("DELETE FROM alerts WHERE stockID=?", id)
+	if err != nil {
+		return err
+	}
 	_, err = tx.Exec("DELETE FROM stock WHERE stockID=?", id)
 	if err != nil {
 		return err
 	}
+	err = emitEvent(tx, eventStockDeleted, stockDeleted{StockID: id, RoomID: roomID})
+	if err != nil {
+		return err
+	}
 	err = tx.Commit()
 	if err != nil {
 		return err
@@ -873,7 +1689,7 @@ func deleteStock(id int) (err error) {
 	return nil
 
 }
-func deleteRoom(id int) (err error) {
+func deleteRoom(id int, version int) (err error) {
 	// OI YOU MAKE SURE WE CHANGE ALL THE ROOMS OF EXISTING STOCK
 
 	tx, err := db.Begin()
@@ -882,11 +1698,33 @@ func deleteRoom(id int) (err error) {
 	}
 	defer tx.Rollback()
 
-	_, err = tx.Exec("UPDATE stock SET roomID=1 WHERE roomID=?", id)
+	var current int
+	err = tx.QueryRow("SELECT version FROM rooms WHERE roomID=? FOR UPDATE", id).Scan(&current)
+	if err != nil {
+		return err
+	}
+	err = checkVersion(current, version)
+	if err != nil {
+		return err
+	}
+
+	// STOCK MOVES TO THE GENERIC ROOM OF THE SAME SITE
+	_, err = tx.Exec(`UPDATE stock SET roomID=(SELECT genericRoomID FROM sites JOIN rooms ON rooms.siteID = sites.siteID WHERE rooms.roomID=?),
+		version=version+1 WHERE roomID=?`, id, id)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec("DELETE FROM alertChannels WHERE roomID=?", id)
 	if err != nil {
 		return err
 	}
 
+	// THE EVENT IS ADDED FIRST, WHILE ITS SITE CAN STILL BE LOOKED UP
+	err = emitEvent(tx, eventRoomDeleted, Room{RoomId: id})
+	if err != nil {
+		return err
+	}
 	_, err = tx.Exec("DELETE FROM rooms WHERE roomID=?", id)
 	if err != nil {
 		return err
@@ -905,26 +1743,36 @@ func deleteLog(id int) (err error) {
 	}
 	defer tx.Rollback()
 	var log LogRow
-	err = tx.QueryRow("SELECT * FROM logs WHERE logID=?;", id).Scan(&log.LogID, &log.StockID, &log.Differance, &log.TotalAfter, &log.IncidentTime, &log.Daily)
+	err = tx.QueryRow("SELECT logID, stockID, differance, totalAfter, incidentTime, daily, reason FROM logs WHERE logID=?;", id).Scan(&log.LogID, &log.StockID, &log.Differance, &log.TotalAfter, &log.IncidentTime, &log.Daily, &log.Reason)
 	if err != nil {
 		return err
 	}
 	var level float64
-	err = tx.QueryRow("SELECT level FROM stock WHERE stockID=?", log.StockID).Scan(&level)
+	var roomID int
+	err = tx.QueryRow("SELECT level, roomID FROM stock WHERE stockID=? FOR UPDATE", log.StockID).Scan(&level, &roomID)
 	if err != nil {
 		return err
 	}
 	level = level - log.Differance
 
-	_, err = tx.Exec("UPDATE stock SET level=? WHERE stockID=?", level, log.StockID)
+	_, err = tx.Exec("UPDATE stock SET level=?, version=version+1 WHERE stockID=?", level, log.StockID)
 	if err != nil {
-		return nil
+		return err
 	}
 
 	_, err = tx.Exec("DELETE FROM logs WHERE logID=?", id)
 	if err != nil {
 		return err
 	}
+	// THE LATEST CHANGE IS NOW THE LOG BEFORE IT, OR NONE
+	_, err = tx.Exec("UPDATE stock SET lastLogID=(SELECT MAX(logID) FROM logs WHERE stockID=?) WHERE stockID=? AND lastLogID=?", log.StockID, log.StockID, id)
+	if err != nil {
+		return err
+	}
+	err = emitEvent(tx, eventLogDeleted, logDeleted{LogID: id, StockID: log.StockID, RoomID: roomID, Level: level})
+	if err != nil {
+		return err
+	}
 	err = tx.Commit()
 	if err != nil {
 		return err
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"net"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+// openTestDB points db at the database in TEST_DB_DSN for the rest of the
+// test, skipping it when there is none. The tables are created as on startup.
+func openTestDB(t *testing.T) {
+	t.Helper()
+	dsn := os.Getenv("TEST_DB_DSN")
+	if dsn == "" {
+		t.Skip("TEST_DB_DSN is not set")
+	}
+	cfg, err := mysql.ParseDSN(dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testDB, err := sql.Open("mysql", inUTC(cfg))
+	if err != nil {
+		t.Fatal(err)
+	}
+	old := db
+	db = testDB
+	t.Cleanup(func() {
+		// LET ALERTS SENT BY THE TEST FINISH WITH ITS DATABASE
+		background.Wait()
+		db = old
+		testDB.Close()
+	})
+	err = initialiseTables()
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// openDownDB points db at a database that cannot be reached for the rest of
+// the test, so every query fails
+func openDownDB(t *testing.T) {
+	t.Helper()
+	// NOTHING LISTENS ON THE PORT OF A CLOSED LISTENER
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	lis.Close()
+	down, err := sql.Open("mysql", "u:p@tcp("+lis.Addr().String()+")/inventory")
+	if err != nil {
+		t.Fatal(err)
+	}
+	old := db
+	db = down
+	t.Cleanup(func() {
+		db = old
+		down.Close()
+	})
+}
+
+// testKey is unique to this run of the test, for keys and names that must
+// not clash with rows left by earlier runs
+func testKey(t *testing.T) string {
+	return fmt.Sprintf("%s-%d", t.Name(), time.Now().UnixNano())
+}
+
+// testStock adds a stock item at level in a room of its own
+func testStock(t *testing.T, level float64) (stockID int) {
+	t.Helper()
+	name := testKey(t)
+	res, err := db.Exec("INSERT INTO rooms(roomName) VALUES (?)", name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	roomID, err := res.LastInsertId()
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err = db.Exec("INSERT INTO stock(itemName,level,roomID,supplierID,incidentLevel,unit) VALUES (?,?,?,1,0,'each')", name, level, roomID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return int(id)
+}
+
+// testSite adds a site of its own
+func testSite(t *testing.T) (siteID int) {
+	t.Helper()
+	siteID, err := addSite(testKey(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return siteID
+}
+
+// stockLevel returns the level of a stock item
+func stockLevel(t *testing.T, stockID int) (level float64) {
+	t.Helper()
+	err := db.QueryRow("SELECT level FROM stock WHERE stockID=?", stockID).Scan(&level)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return level
+}
+
+func TestSetPrimaryKey(t *testing.T) {
+	openTestDB(t)
+	table := fmt.Sprintf("pkTest%d", time.Now().UnixNano())
+	_, err := db.Exec("CREATE TABLE " + table + " (a int NOT NULL, b int NOT NULL, PRIMARY KEY (a))")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Exec("DROP TABLE " + table) })
+
+	// RUN TWICE AS ON EVERY STARTUP, THE SECOND MUST LEAVE THE KEY ALONE
+	for i := 0; i < 2; i++ {
+		err = setPrimaryKey(table, "b", "a")
+		if err != nil {
+			t.Fatalf("run %d: %v", i+1, err)
+		}
+	}
+	var columns string
+	err = db.QueryRow(`SELECT GROUP_CONCAT(COLUMN_NAME ORDER BY SEQ_IN_INDEX) FROM information_schema.STATISTICS
+		WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = ? AND INDEX_NAME = 'PRIMARY'`, table).Scan(&columns)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if columns != "b,a" {
+		t.Errorf("primary key is (%s), want (b,a)", columns)
+	}
+}
+
+func TestAddForeignKey(t *testing.T) {
+	openTestDB(t)
+	table := fmt.Sprintf("fkTest%d", time.Now().UnixNano())
+	_, err := db.Exec("CREATE TABLE " + table + " (siteID int NOT NULL)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Exec("DROP TABLE " + table) })
+
+	// RUN TWICE AS ON EVERY STARTUP, THE SECOND MUST NOT ADD ANOTHER KEY
+	for i := 0; i < 2; i++ {
+		err = addForeignKey(table, "siteID", "sites", "siteID")
+		if err != nil {
+			t.Fatalf("run %d: %v", i+1, err)
+		}
+	}
+	var count int
+	err = db.QueryRow(`SELECT COUNT(*) FROM information_schema.KEY_COLUMN_USAGE
+		WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = ? AND REFERENCED_TABLE_NAME = 'sites'`, table).Scan(&count)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 1 {
+		t.Errorf("got %d foreign keys, want 1", count)
+	}
+}
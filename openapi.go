@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	_ "embed"
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/getkin/kin-openapi/openapi3filter"
+	"github.com/getkin/kin-openapi/routers"
+	"github.com/getkin/kin-openapi/routers/legacy"
+)
+
+// THE CLIENT IN client/ IS GENERATED FROM THIS, RUN go generate ./client
+// AFTER CHANGING IT
+//
+//go:embed openapi.yaml
+var openAPISpec []byte
+
+// loadOpenAPI parses and checks the embedded spec and builds a router
+// matching requests to its operations
+func loadOpenAPI() (doc *openapi3.T, router routers.Router, err error) {
+	// KEEP 400 RESPONSES TO ONE LINE PER PROBLEM, NOT THE WHOLE SCHEMA
+	openapi3.SchemaErrorDetailsDisabled = true
+	doc, err = openapi3.NewLoader().LoadFromData(openAPISpec)
+	if err != nil {
+		return nil, nil, err
+	}
+	err = doc.Validate(context.Background())
+	if err != nil {
+		return nil, nil, err
+	}
+	router, err = legacy.NewRouter(doc)
+	return doc, router, err
+}
+
+// validateRequests rejects requests to an operation in the spec whose
+// parameters or body do not match it with 400. Requests to paths or methods
+// the spec does not describe are passed on for the handler to answer.
+func validateRequests(router routers.Router) middleware {
+	options := &openapi3filter.Options{
+		AuthenticationFunc: openapi3filter.NoopAuthenticationFunc,
+		MultiError:         true,
+	}
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			route, pathParams, err := router.FindRoute(r)
+			if err != nil {
+				next.ServeHTTP(w, r)
+				return
+			}
+			// THE HANDLERS HAVE ALWAYS READ A BODY WITHOUT A TYPE AS JSON
+			if r.ContentLength != 0 && r.Header.Get("Content-Type") == "" {
+				r.Header.Set("Content-Type", "application/json")
+			}
+			err = openapi3filter.ValidateRequest(r.Context(), &openapi3filter.RequestValidationInput{
+				Request:    r,
+				PathParams: pathParams,
+				Route:      route,
+				Options:    options,
+			})
+			if err != nil {
+				http.Error(w, "invalid request: "+err.Error(), http.StatusBadRequest)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// openAPI serves the spec as YAML on /openapi.yaml and as JSON on
+// /openapi.json
+func openAPI(doc *openapi3.T) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		if strings.HasSuffix(r.URL.Path, ".json") {
+			w.Header().Set("Content-Type", "application/json")
+			err := json.NewEncoder(w).Encode(doc)
+			if err != nil {
+				logRequestError(r, err)
+			}
+			return
+		}
+		w.Header().Set("Content-Type", "application/yaml")
+		w.Write(openAPISpec)
+	}
+}
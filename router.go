@@ -0,0 +1,192 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// apiPrefix is where the API is served, a breaking change gets a new version
+const apiPrefix = "/api/v1"
+
+// legacyPaths are the unversioned paths served before /api/v1. They are still
+// answered, as deprecated aliases of the same path under apiPrefix.
+var legacyPaths = []string{
+	"/logs/", "/suppliers/", "/rooms/", "/stock/", "/fullStock/", "/import/", "/labels/",
+	"/categories/", "/reports/categories", "/alerts/", "/webhooks/", "/events",
+	"/sync/snapshot", "/sync/upload", "/openapi.yaml", "/openapi.json",
+}
+
+// legacyDeprecatedAt is sent in the Deprecation header of legacy responses
+var legacyDeprecatedAt = time.Date(2026, time.October, 19, 0, 0, 0, 0, time.UTC)
+
+// middleware wraps a handler to run code around it
+type middleware func(http.Handler) http.Handler
+
+// chain wraps h in middlewares, the first one runs first
+func chain(h http.Handler, middlewares ...middleware) http.Handler {
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		h = middlewares[i](h)
+	}
+	return h
+}
+
+// routeGroup registers the routes under one path, each wrapped in the
+// group's middlewares
+type routeGroup struct {
+	mux         *http.ServeMux
+	path        string
+	middlewares []middleware
+}
+
+func (g routeGroup) handle(method string, path string, h http.HandlerFunc) {
+	g.mux.Handle(method+" "+g.path+path, chain(h, g.middlewares...))
+}
+
+// newRouter routes every endpoint by method and path, graphql is nil when it
+// is turned off. OPTIONS is answered by the cors middleware before it gets
+// here. Every group is scoped to the request's site.
+func newRouter(spec http.HandlerFunc, graphql http.HandlerFunc) *http.ServeMux {
+	mux := http.NewServeMux()
+	group := func(path string, middlewares ...middleware) routeGroup {
+		return routeGroup{mux: mux, path: apiPrefix + path, middlewares: append([]middleware{siteScoped}, middlewares...)}
+	}
+
+	logs := group("/logs")
+	logs.handle(http.MethodGet, "", logsList)
+	logs.handle(http.MethodDelete, "/{logID}", logsDelete)
+
+	suppliers := group("/suppliers")
+	suppliers.handle(http.MethodGet, "", suppliersList)
+	suppliers.handle(http.MethodGet, "/{supplierID}", suppliersGet)
+
+	rooms := group("/rooms")
+	rooms.handle(http.MethodGet, "", roomsList)
+	rooms.handle(http.MethodPost, "", roomsCreate)
+	rooms.handle(http.MethodGet, "/{roomID}", roomsGet)
+	rooms.handle(http.MethodPatch, "/{roomID}", roomsUpdate)
+	rooms.handle(http.MethodDelete, "/{roomID}", roomsDelete)
+	rooms.handle(http.MethodGet, "/{roomID}/countSheet", roomCountSheet)
+
+	stock := group("/stock")
+	stock.handle(http.MethodGet, "", stockList)
+	stock.handle(http.MethodPost, "", stockCreate)
+	stock.handle(http.MethodGet, "/lookup", stockLookup)
+	stock.handle(http.MethodPatch, "/lookup", stockLookupSetLevel)
+	stock.handle(http.MethodGet, "/{stockID}", stockGet)
+	stock.handle(http.MethodPatch, "/{stockID}", stockUpdate)
+	stock.handle(http.MethodDelete, "/{stockID}", stockDelete)
+	stock.handle(http.MethodPost, "/{stockID}/adjust", stockAdjust)
+	stock.handle(http.MethodGet, "/{stockID}/tags", stockTagsList)
+	stock.handle(http.MethodPut, "/{stockID}/tags", stockTagsSet)
+	stock.handle(http.MethodGet, "/{stockID}/barcodes", stockBarcodesList)
+	stock.handle(http.MethodPost, "/{stockID}/barcodes", stockBarcodesAdd)
+	stock.handle(http.MethodDelete, "/{stockID}/barcodes/{barcode}", stockBarcodesDelete)
+
+	fullStock := group("/fullStock")
+	fullStock.handle(http.MethodGet, "", fullStockList)
+	fullStock.handle(http.MethodPatch, "", fullStockSetLevel)
+	fullStock.handle(http.MethodPost, "/batch", stockBatch)
+	fullStock.handle(http.MethodGet, "/{stockID}", fullStockGet)
+
+	imports := group("/import")
+	imports.handle(http.MethodPost, "", importHandler)
+	imports.handle(http.MethodPost, "/{kind}", importHandler)
+
+	group("/labels").handle(http.MethodGet, "", labels)
+
+	categories := group("/categories")
+	categories.handle(http.MethodGet, "", categoriesList)
+	categories.handle(http.MethodPost, "", categoriesCreate)
+	categories.handle(http.MethodPatch, "/{categoryID}", categoriesUpdate)
+	categories.handle(http.MethodDelete, "/{categoryID}", categoriesDelete)
+
+	reports := group("/reports")
+	reports.handle(http.MethodGet, "/categories", categoryReport)
+	reports.handle(http.MethodGet, "/sites", siteReport)
+
+	group("/sites").handle(http.MethodGet, "", sitesList)
+
+	// HEAD OFFICE WORKS ACROSS SITES, SO THESE ARE NOT SCOPED TO ONE
+	headOffice := routeGroup{mux: mux, path: apiPrefix, middlewares: []middleware{headOfficeOnly}}
+	headOffice.handle(http.MethodPost, "/sites", sitesCreate)
+	headOffice.handle(http.MethodPut, "/suppliers/{supplierID}/sites", supplierSitesSet)
+
+	alerts := group("/alerts")
+	alerts.handle(http.MethodGet, "", alertsList)
+	alerts.handle(http.MethodPost, "/{alertID}/acknowledge", alertsAcknowledge)
+	alerts.handle(http.MethodGet, "/channels", alertChannelsList)
+	alerts.handle(http.MethodPost, "/channels", alertChannelsCreate)
+	alerts.handle(http.MethodDelete, "/channels/{channelID}", alertChannelsDelete)
+
+	// WEBHOOKS GET EVERY SITE'S EVENTS
+	webhooks := group("/webhooks", headOfficeOnly)
+	webhooks.handle(http.MethodGet, "", webhooksList)
+	webhooks.handle(http.MethodPost, "", webhooksCreate)
+	webhooks.handle(http.MethodDelete, "/{webhookID}", webhooksDelete)
+	webhooks.handle(http.MethodGet, "/{webhookID}/deliveries", webhookDeliveries)
+	webhooks.handle(http.MethodPost, "/deliveries/{deliveryID}/replay", webhookDeliveryReplay)
+
+	group("/events").handle(http.MethodGet, "", events)
+
+	sync := group("/sync")
+	sync.handle(http.MethodGet, "/snapshot", syncSnapshot)
+	sync.handle(http.MethodPost, "/upload", syncUpload)
+
+	if graphql != nil {
+		group("/graphql").handle(http.MethodPost, "", graphql)
+	}
+
+	group("").handle(http.MethodGet, "/openapi.yaml", spec)
+	group("").handle(http.MethodGet, "/openapi.json", spec)
+
+	mux.HandleFunc("GET /{$}", root)
+	mux.HandleFunc("GET /healthz", healthz)
+	mux.HandleFunc("GET /readyz", readyz)
+	mux.Handle("GET /metrics", metricsHandler())
+	return mux
+}
+
+// legacyAliases serves a legacy path by rewriting it to its path under
+// apiPrefix, e.g. /stock/5 to /api/v1/stock/5. Responses say the legacy path
+// is deprecated and link to the new one.
+func legacyAliases(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path, ok := versionedPath(r.URL.Path)
+		if !ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+		w.Header().Set("Deprecation", fmt.Sprintf("@%d", legacyDeprecatedAt.Unix()))
+		w.Header().Set("Link", fmt.Sprintf("<%s>; rel=\"successor-version\"", path))
+
+		r = r.Clone(r.Context())
+		r.URL.Path = path
+		r.URL.RawPath = ""
+		next.ServeHTTP(w, r)
+	})
+}
+
+// versionedPath returns the path under apiPrefix for a legacy path
+func versionedPath(path string) (string, bool) {
+	for _, legacy := range legacyPaths {
+		collection := strings.TrimSuffix(legacy, "/")
+		if path == collection || (collection != legacy && strings.HasPrefix(path, legacy)) {
+			return apiPrefix + strings.TrimSuffix(path, "/"), true
+		}
+	}
+	return "", false
+}
+
+// pathID reads the numeric path parameter name, answering 400 when it is not
+// a number
+func pathID(w http.ResponseWriter, r *http.Request, name string) (id int, ok bool) {
+	id, err := strconv.Atoi(r.PathValue(name))
+	if err != nil {
+		http.Error(w, fmt.Sprintf("invalid %s %q", name, r.PathValue(name)), http.StatusBadRequest)
+		return 0, false
+	}
+	return id, true
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestVersionedPath(t *testing.T) {
+	tests := []struct {
+		path   string
+		want   string
+		wantOK bool
+	}{
+		{"/stock/", "/api/v1/stock", true},
+		{"/stock", "/api/v1/stock", true},
+		{"/stock/5", "/api/v1/stock/5", true},
+		{"/stock/5/adjust", "/api/v1/stock/5/adjust", true},
+		{"/fullStock/batch", "/api/v1/fullStock/batch", true},
+		{"/reports/categories", "/api/v1/reports/categories", true},
+		{"/events", "/api/v1/events", true},
+		{"/openapi.json", "/api/v1/openapi.json", true},
+		{"/events/extra", "", false},
+		{"/stockroom", "", false},
+		{"/api/v1/stock", "", false},
+		{"/", "", false},
+	}
+	for _, test := range tests {
+		got, ok := versionedPath(test.path)
+		if got != test.want || ok != test.wantOK {
+			t.Errorf("versionedPath(%q) = %q, %v, want %q, %v", test.path, got, ok, test.want, test.wantOK)
+		}
+	}
+}
+
+func TestLegacyAliases(t *testing.T) {
+	var gotPath string
+	handler := legacyAliases(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotPath = r.URL.Path
+	}))
+
+	tests := []struct {
+		url        string
+		wantPath   string
+		deprecated bool
+	}{
+		{"/stock/5?x=1", "/api/v1/stock/5", true},
+		{"/logs/", "/api/v1/logs", true},
+		{"/api/v1/logs", "/api/v1/logs", false},
+		{"/", "/", false},
+	}
+	for _, test := range tests {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest("GET", test.url, nil))
+		if gotPath != test.wantPath {
+			t.Errorf("%s was served as %s, want %s", test.url, gotPath, test.wantPath)
+		}
+		if deprecated := w.Header().Get("Deprecation") != ""; deprecated != test.deprecated {
+			t.Errorf("%s: Deprecation = %q", test.url, w.Header().Get("Deprecation"))
+		}
+		if test.deprecated && w.Header().Get("Link") != "<"+test.wantPath+`>; rel="successor-version"` {
+			t.Errorf("%s: Link = %q", test.url, w.Header().Get("Link"))
+		}
+	}
+}
+
+func TestChain(t *testing.T) {
+	var order []string
+	mark := func(name string) middleware {
+		return func(next http.Handler) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				order = append(order, name)
+				next.ServeHTTP(w, r)
+			})
+		}
+	}
+	h := chain(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		order = append(order, "handler")
+	}), mark("first"), mark("second"))
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+	if got := strings.Join(order, " "); got != "first second handler" {
+		t.Errorf("ran %s", got)
+	}
+}
+
+func TestRouter(t *testing.T) {
+	ok := func(w http.ResponseWriter, r *http.Request) {}
+	router := newRouter(ok, ok)
+	tests := []struct {
+		method string
+		url    string
+		want   int
+	}{
+		{"GET", "/api/v1/openapi.yaml", http.StatusOK},
+		{"GET", "/api/v1/nothing", http.StatusNotFound},
+		{"PUT", "/api/v1/fullStock/batch", http.StatusMethodNotAllowed},
+		{"DELETE", "/api/v1/suppliers", http.StatusMethodNotAllowed},
+		{"OPTIONS", "/api/v1/stock/5", http.StatusMethodNotAllowed},  // ANSWERED BY cors
+		{"POST", "/api/v1/stock/five/adjust", http.StatusBadRequest}, // pathID
+	}
+	for _, test := range tests {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(test.method, test.url, strings.NewReader(`{"delta":1}`)))
+		if w.Code != test.want {
+			t.Errorf("%s %s: got %d, want %d", test.method, test.url, w.Code, test.want)
+		}
+	}
+}
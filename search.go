@@ -0,0 +1,124 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// stockSortColumns maps the sortable /fullStock/ fields to their SQL column
+var stockSortColumns = map[string]string{
+	"stockID":       "stock.stockID",
+	"itemName":      "stock.itemName",
+	"level":         "stock.level",
+	"roomID":        "stock.roomID",
+	"room":          "rooms.roomName",
+	"supplierID":    "stock.supplierID",
+	"supplier":      "suppliers.supplierName",
+	"incidentLevel": "stock.incidentLevel",
+	"lastLogID":     "stock.lastLogID",
+	"lastChange":    "logs.incidentTime",
+	"unit":          "stock.unit",
+	"shelfOrder":    "stock.shelfOrder",
+	"sku":           "stock.sku",
+	"categoryID":    "stock.categoryID",
+	"category":      "categories.categoryName",
+}
+
+const maxPageSize = 500
+
+// stockFilterFromQuery reads the /fullStock/ query parameters
+//
+//	?search=      item name, matched as a prefix, or fuzzily with ?match=fuzzy
+//	?roomID=      ?supplierID=  ?category=  ?tag=
+//	?belowIncident=true
+//	?changedSince= YYYY-MM-DD or RFC 3339
+//	?sort=        comma separated fields, prefixed with - for descending
+//	?limit=       ?offset=
+func stockFilterFromQuery(q url.Values) (filter stockFilter, err error) {
+	filter.CategoryIDs, filter.Tag, err = categoryFilterFromQuery(q)
+	if err != nil {
+		return filter, err
+	}
+
+	for name, field := range map[string]*int{"roomID": &filter.RoomID, "supplierID": &filter.SupplierID, "limit": &filter.Limit, "offset": &filter.Offset} {
+		if v := q.Get(name); v != "" {
+			*field, err = strconv.Atoi(v)
+			if err != nil || *field < 0 {
+				return filter, fmt.Errorf("invalid %s %q", name, v)
+			}
+		}
+	}
+	if filter.Limit > maxPageSize {
+		filter.Limit = maxPageSize
+	}
+	if filter.Offset > 0 && filter.Limit == 0 {
+		filter.Limit = maxPageSize
+	}
+
+	if v := q.Get("search"); v != "" {
+		switch q.Get("match") {
+		case "", "prefix":
+			filter.NameLike = escapeLike(v) + "%"
+		case "fuzzy":
+			filter.NameLike = fuzzyLike(v)
+		default:
+			return filter, fmt.Errorf("match must be prefix or fuzzy")
+		}
+	}
+
+	if v := q.Get("belowIncident"); v != "" {
+		filter.BelowIncident, err = strconv.ParseBool(v)
+		if err != nil {
+			return filter, fmt.Errorf("invalid belowIncident %q", v)
+		}
+	}
+
+	if v := q.Get("changedSince"); v != "" {
+		filter.ChangedSince, err = time.Parse(time.RFC3339, v)
+		if err != nil {
+			filter.ChangedSince, err = time.Parse("2006-01-02", v)
+		}
+		if err != nil {
+			return filter, fmt.Errorf("invalid changedSince %q, expected YYYY-MM-DD or RFC 3339", v)
+		}
+	}
+
+	if v := q.Get("sort"); v != "" {
+		var order []string
+		for _, field := range strings.Split(v, ",") {
+			direction := "ASC"
+			if strings.HasPrefix(field, "-") {
+				direction = "DESC"
+				field = field[1:]
+			}
+			column, ok := stockSortColumns[strings.TrimPrefix(field, "+")]
+			if !ok {
+				return filter, fmt.Errorf("cannot sort by %q", field)
+			}
+			order = append(order, column+" "+direction)
+		}
+		// KEEP PAGES STABLE WHEN THE SORT COLUMNS HAVE TIES
+		filter.OrderBy = strings.Join(append(order, "stock.stockID"), ", ")
+	}
+	return filter, nil
+}
+
+// escapeLike escapes the LIKE wildcards in s
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
+
+// fuzzyLike matches names containing the letters of s in order, so "chdr"
+// finds "cheddar"
+func fuzzyLike(s string) string {
+	var b strings.Builder
+	b.WriteString("%")
+	for _, r := range strings.Join(strings.Fields(s), "") {
+		b.WriteString(escapeLike(string(r)))
+		b.WriteString("%")
+	}
+	return b.String()
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"net/url"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestStockFilterFromQuery(t *testing.T) {
+	tests := []struct {
+		query   string
+		want    stockFilter
+		wantErr bool
+	}{
+		{"", stockFilter{}, false},
+		{"roomID=3&supplierID=2", stockFilter{RoomID: 3, SupplierID: 2}, false},
+		{"search=50%25_off", stockFilter{NameLike: `50\%\_off%`}, false},
+		{"search=ch dr&match=fuzzy", stockFilter{NameLike: "%c%h%d%r%"}, false},
+		{"search=x&match=exact", stockFilter{}, true},
+		{"belowIncident=true", stockFilter{BelowIncident: true}, false},
+		{"belowIncident=maybe", stockFilter{}, true},
+		{"changedSince=2026-09-01", stockFilter{ChangedSince: time.Date(2026, 9, 1, 0, 0, 0, 0, time.UTC)}, false},
+		{"changedSince=2026-09-01T08:30:00Z", stockFilter{ChangedSince: time.Date(2026, 9, 1, 8, 30, 0, 0, time.UTC)}, false},
+		{"changedSince=yesterday", stockFilter{}, true},
+		{"sort=-level,itemName", stockFilter{OrderBy: "stock.level DESC, stock.itemName ASC, stock.stockID"}, false},
+		{"sort=%2Broom", stockFilter{OrderBy: "rooms.roomName ASC, stock.stockID"}, false},
+		{"sort=price", stockFilter{}, true},
+		{"limit=20&offset=40", stockFilter{Limit: 20, Offset: 40}, false},
+		{"limit=100000", stockFilter{Limit: maxPageSize}, false},
+		{"offset=10", stockFilter{Limit: maxPageSize, Offset: 10}, false}, // AN OFFSET NEEDS A LIMIT IN MYSQL
+		{"limit=-1", stockFilter{}, true},
+		{"roomID=kitchen", stockFilter{}, true},
+	}
+	for _, test := range tests {
+		q, err := url.ParseQuery(test.query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := stockFilterFromQuery(q)
+		if (err != nil) != test.wantErr {
+			t.Errorf("%q: error = %v, want error %v", test.query, err, test.wantErr)
+			continue
+		}
+		if !test.wantErr && !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%q: got %+v, want %+v", test.query, got, test.want)
+		}
+	}
+}
+
+func TestFuzzyLike(t *testing.T) {
+	tests := []struct {
+		search string
+		want   string
+	}{
+		{"chdr", "%c%h%d%r%"},
+		{" red  wine ", "%r%e%d%w%i%n%e%"},
+		{"5%", `%5%\%%`},
+		{"", "%"},
+	}
+	for _, test := range tests {
+		if got := fuzzyLike(test.search); got != test.want {
+			t.Errorf("fuzzyLike(%q) = %q, want %q", test.search, got, test.want)
+		}
+	}
+}
+
+func TestStockFilterWhere(t *testing.T) {
+	since := time.Date(2026, 9, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		filter    stockFilter
+		wantQuery string
+		wantArgs  []any
+	}{
+		{stockFilter{}, " WHERE 1=1", nil},
+		{stockFilter{RoomID: 3, NameLike: "ch%"}, " WHERE 1=1 AND stock.roomID = ? AND stock.itemName LIKE ?", []any{3, "ch%"}},
+		{stockFilter{BelowIncident: true, ChangedSince: since}, " WHERE 1=1 AND stock.level < stock.incidentLevel AND logs.incidentTime >= ?", []any{since}},
+		{stockFilter{Tag: "frozen"}, " WHERE 1=1 AND stock.stockID IN (SELECT stockID FROM stockTags WHERE tag = ?)", []any{"frozen"}},
+	}
+	for _, test := range tests {
+		query, args := test.filter.where()
+		if query != test.wantQuery || !reflect.DeepEqual(args, test.wantArgs) {
+			t.Errorf("%+v: got %q %v, want %q %v", test.filter, query, args, test.wantQuery, test.wantArgs)
+		}
+	}
+}
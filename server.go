@@ -0,0 +1,164 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// maxConnectBackoff is the longest wait between attempts to connect to the
+// database at startup
+const maxConnectBackoff = 30 * time.Second
+
+// ServerConfig limits how long a connection may take, so slow or stuck
+// clients cannot hold connections open forever. 0 means no limit.
+type ServerConfig struct {
+	ReadHeaderTimeout time.Duration `yaml:"readHeaderTimeout" toml:"readHeaderTimeout"`
+	ReadTimeout       time.Duration `yaml:"readTimeout" toml:"readTimeout"`   // HEADERS AND BODY
+	WriteTimeout      time.Duration `yaml:"writeTimeout" toml:"writeTimeout"` // NOT FOR /events, WHICH STREAMS
+	IdleTimeout       time.Duration `yaml:"idleTimeout" toml:"idleTimeout"`   // BETWEEN KEEP ALIVE REQUESTS
+	ShutdownTimeout   time.Duration `yaml:"shutdownTimeout" toml:"shutdownTimeout"`
+}
+
+func (config ServerConfig) validate() error {
+	for _, timeout := range []time.Duration{config.ReadHeaderTimeout, config.ReadTimeout, config.WriteTimeout, config.IdleTimeout, config.ShutdownTimeout} {
+		if timeout < 0 {
+			return fmt.Errorf("server: timeouts cannot be negative")
+		}
+	}
+	return nil
+}
+
+// background tracks the goroutines using the database outside of requests,
+// so shutdown can wait for them before closing it
+var background sync.WaitGroup
+
+// every runs fn now and then every interval in the background, until ctx is
+// done
+func every(ctx context.Context, interval time.Duration, fn func()) {
+	background.Add(1)
+	go func() {
+		defer background.Done()
+		for {
+			fn()
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(interval):
+			}
+		}
+	}()
+}
+
+// serve serves HTTP, and gRPC when it is on, until ctx is done, then stops
+// taking new connections and waits up to the shutdown timeout for requests,
+// streams and background work to finish
+func serve(ctx context.Context, config Config, handler http.Handler) error {
+	server := &http.Server{
+		Addr:              config.Listen,
+		Handler:           handler,
+		ReadHeaderTimeout: config.Server.ReadHeaderTimeout,
+		ReadTimeout:       config.Server.ReadTimeout,
+		WriteTimeout:      config.Server.WriteTimeout,
+		IdleTimeout:       config.Server.IdleTimeout,
+	}
+	// STREAMS NEVER FINISH ON THEIR OWN, CLOSE THEM SO SHUTDOWN CAN
+	server.RegisterOnShutdown(hub.close)
+
+	errs := make(chan error, 2)
+	go func() {
+		slog.Info("serving http", "addr", config.Listen, "tls", config.TLS.CertFile != "")
+		if config.TLS.CertFile != "" {
+			errs <- server.ListenAndServeTLS(config.TLS.CertFile, config.TLS.KeyFile)
+		} else {
+			errs <- server.ListenAndServe()
+		}
+	}()
+
+	grpcServer, err := newGRPCServer(config)
+	if err != nil {
+		return err
+	}
+	if config.Features.GRPC {
+		lis, err := net.Listen("tcp", config.GRPCListen)
+		if err != nil {
+			return err
+		}
+		go func() {
+			slog.Info("serving grpc", "addr", config.GRPCListen)
+			errs <- grpcServer.Serve(lis)
+		}()
+	}
+
+	select {
+	case err := <-errs:
+		return err
+	case <-ctx.Done():
+	}
+
+	slog.Info("shutting down, draining requests", "timeout", config.Server.ShutdownTimeout)
+	shutdownCtx := context.Background()
+	if config.Server.ShutdownTimeout > 0 {
+		var cancel context.CancelFunc
+		shutdownCtx, cancel = context.WithTimeout(shutdownCtx, config.Server.ShutdownTimeout)
+		defer cancel()
+	}
+
+	err = server.Shutdown(shutdownCtx)
+	if err != nil {
+		slog.Warn("requests still running at the shutdown timeout", "err", err)
+	}
+	waitUntil(shutdownCtx, "grpc calls", grpcServer.GracefulStop, grpcServer.Stop)
+	waitUntil(shutdownCtx, "background work", background.Wait, nil)
+	slog.Info("shut down")
+	return nil
+}
+
+// waitUntil runs wait until it returns or ctx is done, when it runs
+// giveUp if it is not nil
+func waitUntil(ctx context.Context, what string, wait func(), giveUp func()) {
+	done := make(chan struct{})
+	go func() {
+		wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-ctx.Done():
+		slog.Warn(what + " still running at the shutdown timeout, stopping anyway")
+		if giveUp != nil {
+			giveUp()
+		}
+	}
+}
+
+// connectWithRetry keeps trying to connect to the database with a growing
+// wait between attempts, so a database that is briefly unavailable, e.g.
+// while RDS restarts, does not stop the server starting. It gives up after
+// the connect timeout, 0 for never, or when ctx is done.
+func connectWithRetry(ctx context.Context, config DBConfig) (*sql.DB, error) {
+	start := time.Now()
+	backoff := time.Second
+	for {
+		db, err := connection(config)
+		if err == nil {
+			return db, nil
+		}
+		if config.ConnectTimeout > 0 && time.Since(start)+backoff > config.ConnectTimeout {
+			return nil, fmt.Errorf("giving up connecting to the database after %v: %w", config.ConnectTimeout, err)
+		}
+		slog.Warn("could not connect to the database, retrying", "err", err, "retryIn", backoff)
+		select {
+		case <-ctx.Done():
+			return nil, errors.Join(ctx.Err(), err)
+		case <-time.After(backoff):
+		}
+		backoff = min(backoff*2, maxConnectBackoff)
+	}
+}
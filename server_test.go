@@ -0,0 +1,222 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestServerConfigValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  ServerConfig
+		wantErr bool
+	}{
+		{"default", defaultConfig().Server, false},
+		{"no limits", ServerConfig{}, false},
+		{"negative read", ServerConfig{ReadTimeout: -time.Second}, true},
+		{"negative shutdown", ServerConfig{ShutdownTimeout: -time.Second}, true},
+	}
+	for _, test := range tests {
+		if err := test.config.validate(); (err != nil) != test.wantErr {
+			t.Errorf("%s: got %v", test.name, err)
+		}
+	}
+}
+
+func TestEvery(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	var runs atomic.Int32
+	every(ctx, time.Millisecond, func() { runs.Add(1) })
+	for runs.Load() < 3 {
+		time.Sleep(time.Millisecond)
+	}
+	cancel()
+	// SHUTDOWN WAITS FOR IT TO STOP
+	waitUntil(context.Background(), "every", background.Wait, nil)
+	stopped := runs.Load()
+	time.Sleep(10 * time.Millisecond)
+	if runs.Load() != stopped {
+		t.Error("kept running after ctx was done")
+	}
+}
+
+func TestWaitUntil(t *testing.T) {
+	tests := []struct {
+		name       string
+		wait       time.Duration
+		timeout    time.Duration
+		wantGaveUp bool
+	}{
+		{"finishes", 0, time.Second, false},
+		{"times out", time.Second, 10 * time.Millisecond, true},
+	}
+	for _, test := range tests {
+		ctx, cancel := context.WithTimeout(context.Background(), test.timeout)
+		gaveUp := false
+		start := time.Now()
+		waitUntil(ctx, test.name, func() { time.Sleep(test.wait) }, func() { gaveUp = true })
+		cancel()
+		if gaveUp != test.wantGaveUp || time.Since(start) > 500*time.Millisecond {
+			t.Errorf("%s: gave up %v after %v", test.name, gaveUp, time.Since(start))
+		}
+	}
+}
+
+func TestEventHubClose(t *testing.T) {
+	h := &eventHub{subscribers: map[chan Event]bool{}}
+	ch := h.subscribe()
+	h.close()
+	if _, ok := <-ch; ok {
+		t.Error("a stream was left open")
+	}
+	if _, ok := <-h.subscribe(); ok {
+		t.Error("a stream was opened after close")
+	}
+	h.publish(Event{EventID: 1}) // MUST NOT PANIC ON CLOSED CHANNELS
+}
+
+func TestConnectWithRetryGivesUp(t *testing.T) {
+	// NOTHING LISTENS ON THE PORT OF A CLOSED LISTENER
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	lis.Close()
+	config := DBConfig{User: "u", Name: "n", Endpoint: lis.Addr().String(), ConnectTimeout: time.Millisecond}
+
+	_, err = connectWithRetry(context.Background(), config)
+	if err == nil || !strings.Contains(err.Error(), "giving up") {
+		t.Errorf("got %v, want it to give up", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	config.ConnectTimeout = 0
+	_, err = connectWithRetry(ctx, config)
+	if err == nil || !strings.Contains(err.Error(), context.Canceled.Error()) {
+		t.Errorf("got %v, want it to stop with ctx", err)
+	}
+}
+
+// freeAddr returns a local address nothing is listening on
+func freeAddr(t *testing.T) string {
+	t.Helper()
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lis.Close()
+	return lis.Addr().String()
+}
+
+func TestServeDrains(t *testing.T) {
+	// serve CLOSES THE HUB'S STREAMS ON SHUTDOWN
+	oldHub := hub
+	hub = &eventHub{subscribers: map[chan Event]bool{}}
+	t.Cleanup(func() { hub = oldHub })
+	stream := hub.subscribe()
+
+	started := make(chan struct{})
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/slow" {
+			close(started)
+			time.Sleep(100 * time.Millisecond)
+		}
+		io.WriteString(w, "done")
+	})
+
+	config := defaultConfig()
+	config.Listen = freeAddr(t)
+	config.Features.GRPC = false
+	ctx, cancel := context.WithCancel(context.Background())
+	served := make(chan error, 1)
+	go func() { served <- serve(ctx, config, handler) }()
+
+	url := "http://" + config.Listen
+	for {
+		res, err := http.Get(url + "/")
+		if err == nil {
+			res.Body.Close()
+			break
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	slow := make(chan string, 1)
+	go func() {
+		res, err := http.Get(url + "/slow")
+		if err != nil {
+			slow <- err.Error()
+			return
+		}
+		defer res.Body.Close()
+		body, _ := io.ReadAll(res.Body)
+		slow <- string(body)
+	}()
+	<-started
+	cancel()
+
+	if got := <-slow; got != "done" {
+		t.Errorf("the request running at shutdown got %q", got)
+	}
+	if err := <-served; err != nil {
+		t.Errorf("serve returned %v", err)
+	}
+	if _, ok := <-stream; ok {
+		t.Error("an event stream was left open")
+	}
+	if res, err := http.Get(url + "/"); err == nil {
+		res.Body.Close()
+		t.Error("still serving after shutdown")
+	}
+}
+
+func TestServeShutdownTimeout(t *testing.T) {
+	oldHub := hub
+	hub = &eventHub{subscribers: map[chan Event]bool{}}
+	t.Cleanup(func() { hub = oldHub })
+
+	stuck := make(chan struct{})
+	t.Cleanup(func() { close(stuck) })
+	started := make(chan struct{}, 1)
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		started <- struct{}{}
+		<-stuck
+	})
+
+	config := defaultConfig()
+	config.Listen = freeAddr(t)
+	config.Features.GRPC = false
+	config.Server.ShutdownTimeout = 50 * time.Millisecond
+	ctx, cancel := context.WithCancel(context.Background())
+	served := make(chan error, 1)
+	go func() { served <- serve(ctx, config, handler) }()
+
+	go func() {
+		for {
+			res, err := http.Get("http://" + config.Listen + "/")
+			if err == nil {
+				res.Body.Close()
+				return
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+	}()
+	<-started
+	cancel()
+
+	select {
+	case err := <-served:
+		if err != nil {
+			t.Errorf("serve returned %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("serve waited past the shutdown timeout")
+	}
+}
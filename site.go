@@ -0,0 +1,676 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// Site is one restaurant with its own rooms, stock and logs. Each site has a
+// generic room of its own, where stock goes when its room is deleted.
+type Site struct {
+	SiteID        int    `json:"siteID"`
+	SiteName      string `json:"siteName"`
+	GenericRoomID int    `json:"genericRoomID"`
+}
+
+// SiteReport is one row of the head office report comparing sites
+type SiteReport struct {
+	SiteID        int    `json:"siteID"`
+	SiteName      string `json:"siteName"`
+	Rooms         int    `json:"rooms"`
+	Items         int    `json:"items"`
+	BelowIncident int    `json:"belowIncident"`
+	OpenAlerts    int    `json:"openAlerts"` // NEITHER ACKNOWLEDGED NOR RESOLVED
+}
+
+const (
+	// defaultSite is the site everything from before sites belongs to
+	defaultSite = 1
+	// allSites is a head office read across every site, X-Site-ID: all. It
+	// is 0 so filters given it have no limit.
+	allSites = 0
+
+	siteHeader = "X-Site-ID"
+
+	createSites = `
+	CREATE TABLE IF NOT EXISTS sites (
+		siteID int NOT NULL AUTO_INCREMENT,
+		siteName varchar(255) NOT NULL,
+		genericRoomID int NOT NULL,
+		PRIMARY KEY (siteID),
+		UNIQUE (siteName));
+	`
+	genericSite = `
+	INSERT IGNORE INTO sites(siteID,siteName,genericRoomID) VALUES (1,'default',1);
+	`
+	createSupplierSites = `
+	CREATE TABLE IF NOT EXISTS supplierSites (
+		supplierID int NOT NULL,
+		siteID int NOT NULL,
+		PRIMARY KEY (supplierID, siteID),
+		FOREIGN KEY (supplierID) REFERENCES suppliers(supplierID),
+		FOREIGN KEY (siteID) REFERENCES sites(siteID));
+	`
+	// SUPPLIERS FROM BEFORE SITES ARE AT THE DEFAULT SITE AND THE GENERIC
+	// SUPPLIER, THE DEFAULT FOR NEW STOCK, IS AT EVERY SITE
+	linkSuppliers = `
+	INSERT IGNORE INTO supplierSites(supplierID,siteID)
+		SELECT supplierID, 1 FROM suppliers WHERE supplierID NOT IN (SELECT supplierID FROM supplierSites)
+		UNION SELECT 1, siteID FROM sites;
+	`
+)
+
+var (
+	errSiteForbidden = errors.New("you are not a member of that site")
+	errSiteNotFound  = errors.New("no such site")
+	errAllSitesRead  = errors.New("X-Site-ID: all is only for reading, pick one site to make changes")
+	errNotAtSite     = errors.New("the room or supplier is not at this site")
+)
+
+// siteScopes count whether the row with an ID is at a site, by the path
+// parameter naming the ID
+var siteScopes = map[string]string{
+	"roomID":     "SELECT COUNT(*) FROM rooms WHERE roomID=? AND siteID=?",
+	"stockID":    "SELECT COUNT(*) FROM stock JOIN rooms ON stock.roomID = rooms.roomID WHERE stock.stockID=? AND rooms.siteID=?",
+	"logID":      "SELECT COUNT(*) FROM logs JOIN stock ON logs.stockID = stock.stockID JOIN rooms ON stock.roomID = rooms.roomID WHERE logs.logID=? AND rooms.siteID=?",
+	"alertID":    "SELECT COUNT(*) FROM alerts JOIN stock ON alerts.stockID = stock.stockID JOIN rooms ON stock.roomID = rooms.roomID WHERE alerts.alertID=? AND rooms.siteID=?",
+	"supplierID": "SELECT COUNT(*) FROM supplierSites WHERE supplierID=? AND siteID=?",
+	"channelID":  "SELECT COUNT(*) FROM alertChannels WHERE channelID=? AND siteID=?",
+}
+
+// initialiseSites creates the site tables and puts rooms and suppliers from
+// before sites at the default site
+func initialiseSites() (err error) {
+	_, err = db.Exec(createSites)
+	if err != nil {
+		return err
+	}
+	_, err = db.Exec(genericSite)
+	if err != nil {
+		return err
+	}
+	err = addColumn("rooms", "siteID", "int NOT NULL DEFAULT 1")
+	if err != nil {
+		return err
+	}
+	err = addForeignKey("rooms", "siteID", "sites", "siteID")
+	if err != nil {
+		return err
+	}
+	_, err = db.Exec(createSupplierSites)
+	if err != nil {
+		return err
+	}
+	_, err = db.Exec(linkSuppliers)
+	return err
+}
+
+// siteAccess is the site a request works on, and whether its user may work
+// across sites
+type siteAccess struct {
+	site       int
+	headOffice bool
+}
+
+type siteKey struct{}
+
+func withSite(ctx context.Context, access siteAccess) context.Context {
+	return context.WithValue(ctx, siteKey{}, access)
+}
+
+// siteFrom returns the site a request works on, allSites for a head office
+// read and defaultSite outside a request, e.g. for the import command
+func siteFrom(ctx context.Context) int {
+	access, ok := ctx.Value(siteKey{}).(siteAccess)
+	if !ok {
+		return defaultSite
+	}
+	return access.site
+}
+
+// headOfficeFrom reports whether the request's user may work across sites
+func headOfficeFrom(ctx context.Context) bool {
+	access, _ := ctx.Value(siteKey{}).(siteAccess)
+	return access.headOffice
+}
+
+// resolveSite picks the site a request works on from the one asked for, ""
+// for the user's first. Head office, and everyone when auth is off, may use
+// every site and read across all of them.
+func resolveSite(ctx context.Context, config AuthConfig, asked string, read bool) (access siteAccess, err error) {
+	user := AuthUser{HeadOffice: true}
+	if config.Enabled {
+		user, _ = authUserFrom(ctx)
+	}
+	access.headOffice = user.HeadOffice
+
+	switch asked {
+	case "":
+		access.site = user.sites()[0]
+	case "all":
+		if !user.HeadOffice {
+			return access, errSiteForbidden
+		}
+		if !read {
+			return access, errAllSitesRead
+		}
+		return access, nil
+	default:
+		access.site, err = strconv.Atoi(asked)
+		if err != nil || access.site <= 0 {
+			return access, errSiteNotFound
+		}
+		if !user.HeadOffice && !containsInt(user.sites(), access.site) {
+			return access, errSiteForbidden
+		}
+	}
+
+	exists, err := siteExists(ctx, access.site)
+	if err == nil && !exists {
+		err = errSiteNotFound
+	}
+	return access, err
+}
+
+func siteExists(ctx context.Context, site int) (bool, error) {
+	var count int
+	err := db.QueryRowContext(ctx, "SELECT COUNT(*) FROM sites WHERE siteID=?", site).Scan(&count)
+	return count > 0, err
+}
+
+// selectSite puts the site of each request, from X-Site-ID or ?site= (for
+// EventSource, which cannot send headers), on its context. It runs after
+// authenticate, which says whose sites they are.
+func selectSite(config AuthConfig) middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			// /metrics IS SERVED WHILE THE DATABASE IS DOWN
+			if publicPaths[r.URL.Path] || !strings.HasPrefix(r.URL.Path, apiPrefix+"/") {
+				next.ServeHTTP(w, r)
+				return
+			}
+			asked := r.Header.Get(siteHeader)
+			if asked == "" {
+				asked = r.URL.Query().Get("site")
+			}
+			// GRAPHQL READS ARE POSTED TOO, ITS MUTATIONS CHECK FOR THEMSELVES
+			read := r.Method == http.MethodGet || r.Method == http.MethodHead || r.URL.Path == apiPrefix+"/graphql"
+			access, err := resolveSite(r.Context(), config, strings.TrimSpace(asked), read)
+			if err != nil {
+				writeSiteError(w, r, err)
+				return
+			}
+			next.ServeHTTP(w, r.WithContext(withSite(r.Context(), access)))
+		})
+	}
+}
+
+func writeSiteError(w http.ResponseWriter, r *http.Request, err error) {
+	switch err {
+	case errSiteForbidden:
+		http.Error(w, err.Error(), http.StatusForbidden)
+	case errSiteNotFound:
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errAllSitesRead:
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	default:
+		internalError(w, r, err)
+	}
+}
+
+// atSite reports whether the row named by the siteScopes parameter param is
+// at the request's site. Every row is when reading across sites.
+func atSite(ctx context.Context, param string, id int) (bool, error) {
+	site := siteFrom(ctx)
+	if site == allSites {
+		return true, nil
+	}
+	var count int
+	err := db.QueryRowContext(ctx, siteScopes[param], id, site).Scan(&count)
+	return count > 0, err
+}
+
+// siteScoped answers 404 for a path naming a room, stock item, supplier,
+// log, alert or alert channel of another site, so handlers only see their own
+func siteScoped(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for param := range siteScopes {
+			id, err := strconv.Atoi(r.PathValue(param))
+			if err != nil {
+				// NOT IN THIS PATH, OR NOT A NUMBER WHICH THE HANDLER ANSWERS
+				continue
+			}
+			ok, err := atSite(r.Context(), param, id)
+			if err != nil {
+				internalError(w, r, err)
+				return
+			}
+			if !ok {
+				http.Error(w, "not found", http.StatusNotFound)
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// headOfficeOnly answers 403 to users who are not head office
+func headOfficeOnly(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !headOfficeFrom(r.Context()) {
+			http.Error(w, "only head office may do this", http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// checkStockRefs returns errNotAtSite when the room or supplier of data is
+// not at the request's site, so stock cannot be put in another site's room
+func checkStockRefs(ctx context.Context, data Stock) error {
+	for param, id := range map[string]int{"roomID": data.RoomID, "supplierID": data.SupplierID} {
+		ok, err := atSite(ctx, param, id)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return errNotAtSite
+		}
+	}
+	return nil
+}
+
+// grpcSites picks the site of gRPC calls from the "x-site-id" metadata the
+// same way, and answers NotFound for requests naming a row of another site.
+// List, Get and Watch methods are reads.
+func grpcSites(config AuthConfig) []grpc.ServerOption {
+	check := func(ctx context.Context, method string, req any) (context.Context, error) {
+		md, _ := metadata.FromIncomingContext(ctx)
+		var asked string
+		if v := md.Get(strings.ToLower(siteHeader)); len(v) > 0 {
+			asked = strings.TrimSpace(v[0])
+		}
+		name := method[strings.LastIndex(method, "/")+1:]
+		read := strings.HasPrefix(name, "List") || strings.HasPrefix(name, "Get") || strings.HasPrefix(name, "Watch")
+		access, err := resolveSite(ctx, config, asked, read)
+		switch err {
+		case nil:
+		case errSiteForbidden:
+			return nil, status.Error(codes.PermissionDenied, err.Error())
+		case errSiteNotFound:
+			return nil, status.Error(codes.NotFound, err.Error())
+		case errAllSitesRead:
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		default:
+			return nil, grpcError(ctx, err)
+		}
+		ctx = withSite(ctx, access)
+
+		for param, id := range grpcScopedIDs(req) {
+			ok, err := atSite(ctx, param, id)
+			if err != nil {
+				return nil, grpcError(ctx, err)
+			}
+			if !ok {
+				return nil, status.Error(codes.NotFound, "not found")
+			}
+		}
+		return ctx, nil
+	}
+	return []grpc.ServerOption{
+		grpc.ChainUnaryInterceptor(func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+			ctx, err := check(ctx, info.FullMethod, req)
+			if err != nil {
+				return nil, err
+			}
+			return handler(ctx, req)
+		}),
+		grpc.ChainStreamInterceptor(func(srv any, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+			ctx, err := check(stream.Context(), info.FullMethod, nil)
+			if err != nil {
+				return err
+			}
+			return handler(srv, contextStream{stream, ctx})
+		}),
+	}
+}
+
+// grpcScopedIDs returns the non zero room, stock, supplier and log IDs of a
+// request message, keyed like siteScopes
+func grpcScopedIDs(req any) map[string]int {
+	ids := map[string]int{}
+	if v, ok := req.(interface{ GetRoomId() int32 }); ok && v.GetRoomId() != 0 {
+		ids["roomID"] = int(v.GetRoomId())
+	}
+	if v, ok := req.(interface{ GetStockId() int32 }); ok && v.GetStockId() != 0 {
+		ids["stockID"] = int(v.GetStockId())
+	}
+	if v, ok := req.(interface{ GetSupplierId() int32 }); ok && v.GetSupplierId() != 0 {
+		ids["supplierID"] = int(v.GetSupplierId())
+	}
+	if v, ok := req.(interface{ GetLogId() int32 }); ok && v.GetLogId() != 0 {
+		ids["logID"] = int(v.GetLogId())
+	}
+	return ids
+}
+
+// sitesList serves GET /sites, the sites the user may use
+func sitesList(w http.ResponseWriter, r *http.Request) {
+	res, err := getSites()
+	if err != nil {
+		internalError(w, r, err)
+		return
+	}
+	if !headOfficeFrom(r.Context()) {
+		user, _ := authUserFrom(r.Context())
+		mine := []Site{}
+		for _, site := range res {
+			if containsInt(user.sites(), site.SiteID) {
+				mine = append(mine, site)
+			}
+		}
+		res = mine
+	}
+	json.NewEncoder(w).Encode(res)
+}
+
+// sitesCreate serves POST /sites for head office, adding a site with its
+// generic room
+func sitesCreate(w http.ResponseWriter, r *http.Request) {
+	var data Site
+	err := json.NewDecoder(r.Body).Decode(&data)
+	if err != nil {
+		http.Error(w, "invalid body", http.StatusBadRequest)
+		return
+	}
+	data.SiteName = strings.TrimSpace(data.SiteName)
+	if data.SiteName == "" {
+		http.Error(w, "siteName is required", http.StatusBadRequest)
+		return
+	}
+	_, err = addSite(data.SiteName)
+	if isDuplicateKey(err) {
+		http.Error(w, "siteName is already in use", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		internalError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte("data written sucesfuly"))
+}
+
+// supplierSitesSet serves PUT /suppliers/{id}/sites for head office with a
+// JSON array of the site IDs to share the supplier with
+func supplierSitesSet(w http.ResponseWriter, r *http.Request) {
+	supplierID, ok := pathID(w, r, "supplierID")
+	if !ok {
+		return
+	}
+	if supplierID == 1 {
+		// THE GENERIC SUPPLIER IS THE DEFAULT FOR NEW STOCK AT EVERY SITE
+		http.Error(w, "Cannot change this value", http.StatusBadRequest)
+		return
+	}
+	var sites []int
+	err := json.NewDecoder(r.Body).Decode(&sites)
+	if err != nil {
+		http.Error(w, "expected a JSON array of site IDs", http.StatusBadRequest)
+		return
+	}
+	if len(sites) == 0 {
+		http.Error(w, "a supplier must be at one site at least", http.StatusBadRequest)
+		return
+	}
+	version, err := parseIfMatch(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	version, err = setSupplierSites(supplierID, sites, version)
+	if err == errSiteNotFound || err == errSupplierInUse {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		writeUpdateError(w, r, err)
+		return
+	}
+	w.Header().Set("ETag", etag(version))
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte("data updated sucesfully"))
+}
+
+// siteReport serves GET /reports/sites, rooms, stock and open alerts of
+// each site the user may use, as JSON or an export format like other reports
+func siteReport(w http.ResponseWriter, r *http.Request) {
+	res, err := getSiteReport()
+	if err != nil {
+		logRequestError(r, err)
+		http.Error(w, "could not build report", http.StatusInternalServerError)
+		return
+	}
+	if !headOfficeFrom(r.Context()) {
+		user, _ := authUserFrom(r.Context())
+		mine := []SiteReport{}
+		for _, row := range res {
+			if containsInt(user.sites(), row.SiteID) {
+				mine = append(mine, row)
+			}
+		}
+		res = mine
+	}
+
+	if format := exportFormat(r); format != formatJSON {
+		out, err := newRowWriter(w, format, "sites", []string{
+			"siteID", "siteName", "rooms", "items", "belowIncident", "openAlerts",
+		})
+		if err == nil {
+			for _, row := range res {
+				err = out.WriteRow([]any{row.SiteID, row.SiteName, row.Rooms, row.Items, row.BelowIncident, row.OpenAlerts})
+				if err != nil {
+					break
+				}
+			}
+		}
+		if err == nil {
+			err = out.Close()
+		}
+		if err != nil {
+			logRequestError(r, err)
+		}
+		return
+	}
+	json.NewEncoder(w).Encode(res)
+}
+
+// CREATE
+
+// addSite adds a site, its generic room and links it to the generic supplier
+func addSite(name string) (id int, err error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	// THE GENERIC ROOM NEEDS THE SITE'S ID, SO IS SET ONCE IT EXISTS
+	res, err := tx.Exec("INSERT INTO sites(siteName,genericRoomID) VALUES (?,0)", name)
+	if err != nil {
+		return 0, err
+	}
+	newID, err := res.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+	id = int(newID)
+
+	res, err = tx.Exec("INSERT INTO rooms(roomName,siteID) VALUES ('generic',?)", id)
+	if err != nil {
+		return 0, err
+	}
+	roomID, err := res.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+	_, err = tx.Exec("UPDATE sites SET genericRoomID=? WHERE siteID=?", roomID, id)
+	if err != nil {
+		return 0, err
+	}
+	_, err = tx.Exec("INSERT INTO supplierSites(supplierID,siteID) VALUES (1,?)", id)
+	if err != nil {
+		return 0, err
+	}
+
+	err = emitEvent(tx, eventRoomCreated, Room{RoomId: int(roomID), RoomName: "generic", SiteID: id, Version: 1})
+	if err != nil {
+		return 0, err
+	}
+	return id, tx.Commit()
+}
+
+// GET
+
+func getSites() (res []Site, err error) {
+	res = []Site{}
+	rows, err := db.Query("SELECT siteID, siteName, genericRoomID FROM sites ORDER BY siteID")
+	if err != nil {
+		return res, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var data Site
+		err = rows.Scan(&data.SiteID, &data.SiteName, &data.GenericRoomID)
+		if err != nil {
+			return res, err
+		}
+		res = append(res, data)
+	}
+	return res, rows.Err()
+}
+
+// isGenericRoom reports whether id is the generic room of a site, which
+// cannot be renamed or deleted
+func isGenericRoom(id int) (bool, error) {
+	var count int
+	err := db.QueryRow("SELECT COUNT(*) FROM sites WHERE genericRoomID=?", id).Scan(&count)
+	return count > 0, err
+}
+
+func getSiteReport() (res []SiteReport, err error) {
+	res = []SiteReport{}
+	rows, err := db.Query(`
+		SELECT
+		    sites.siteID,
+		    sites.siteName,
+		    COUNT(DISTINCT rooms.roomID),
+		    COUNT(stock.stockID),
+		    COALESCE(SUM(stock.level < stock.incidentLevel), 0),
+		    (SELECT COUNT(*) FROM alerts
+		        JOIN stock ON alerts.stockID = stock.stockID
+		        JOIN rooms ON stock.roomID = rooms.roomID
+		        WHERE rooms.siteID = sites.siteID AND alerts.acknowledgedAt IS NULL AND alerts.resolvedAt IS NULL)
+		FROM
+		    sites
+		LEFT JOIN
+		    rooms ON rooms.siteID = sites.siteID
+		LEFT JOIN
+		    stock ON stock.roomID = rooms.roomID
+		GROUP BY
+		    sites.siteID, sites.siteName
+		ORDER BY
+		    sites.siteID`)
+	if err != nil {
+		return res, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var data SiteReport
+		err = rows.Scan(&data.SiteID, &data.SiteName, &data.Rooms, &data.Items, &data.BelowIncident, &data.OpenAlerts)
+		if err != nil {
+			return res, err
+		}
+		res = append(res, data)
+	}
+	return res, rows.Err()
+}
+
+// UPDATE
+
+var errSupplierInUse = errors.New("the supplier still has stock at a site it would be removed from")
+
+// setSupplierSites replaces the sites a supplier is shared with, version is
+// the one the client expects to change (0 for any) and the new version is
+// returned
+func setSupplierSites(supplierID int, sites []int, version int) (newVersion int, err error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	err = tx.QueryRow("SELECT version FROM suppliers WHERE supplierID=? FOR UPDATE", supplierID).Scan(&newVersion)
+	if err != nil {
+		return 0, err
+	}
+	err = checkVersion(newVersion, version)
+	if err != nil {
+		return 0, err
+	}
+
+	in, args := sqlIn("siteID", sites)
+	var found int
+	err = tx.QueryRow("SELECT COUNT(*) FROM sites WHERE "+in, args...).Scan(&found)
+	if err != nil {
+		return 0, err
+	}
+	distinct := map[int]bool{}
+	for _, site := range sites {
+		distinct[site] = true
+	}
+	if found != len(distinct) {
+		return 0, errSiteNotFound
+	}
+
+	// STOCK CANNOT BE LEFT WITH A SUPPLIER ITS SITE NO LONGER HAS
+	in, args = sqlIn("rooms.siteID", sites)
+	var stranded int
+	err = tx.QueryRow("SELECT COUNT(*) FROM stock JOIN rooms ON stock.roomID = rooms.roomID WHERE stock.supplierID=? AND NOT "+in,
+		append([]any{supplierID}, args...)...).Scan(&stranded)
+	if err != nil {
+		return 0, err
+	}
+	if stranded > 0 {
+		return 0, errSupplierInUse
+	}
+
+	_, err = tx.Exec("DELETE FROM supplierSites WHERE supplierID=?", supplierID)
+	if err != nil {
+		return 0, err
+	}
+	for site := range distinct {
+		_, err = tx.Exec("INSERT INTO supplierSites(supplierID,siteID) VALUES (?,?)", supplierID, site)
+		if err != nil {
+			return 0, err
+		}
+	}
+	newVersion++
+	_, err = tx.Exec("UPDATE suppliers SET version=? WHERE supplierID=?", newVersion, supplierID)
+	if err != nil {
+		return 0, err
+	}
+	return newVersion, tx.Commit()
+}
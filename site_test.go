@@ -0,0 +1,335 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/ingar2005/inventory-backend-go/inventorypb"
+	"google.golang.org/grpc/codes"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+var siteAuth = AuthConfig{Enabled: true, Users: []AuthUser{
+	{Name: "pos", Token: "pos-0123456789abcdef"},
+	{Name: "bar", Token: "bar-0123456789abcdef", Sites: []int{2, 3}},
+	{Name: "office", Token: "office-0123456789abcdef", HeadOffice: true},
+}}
+
+// asUser is ctx for a request made by the siteAuth user name
+func asUser(ctx context.Context, name string) context.Context {
+	for _, user := range siteAuth.Users {
+		if user.Name == name {
+			return withUser(ctx, user)
+		}
+	}
+	panic("no user " + name)
+}
+
+func TestAuthUserSites(t *testing.T) {
+	tests := []struct {
+		user AuthUser
+		want []int
+	}{
+		{AuthUser{}, []int{defaultSite}},
+		{AuthUser{Sites: []int{3, 2}}, []int{3, 2}},
+		{AuthUser{HeadOffice: true}, []int{defaultSite}},
+	}
+	for _, test := range tests {
+		if got := test.user.sites(); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%+v sites() = %v, want %v", test.user, got, test.want)
+		}
+	}
+}
+
+func TestSiteFrom(t *testing.T) {
+	// OUTSIDE A REQUEST, E.G. THE IMPORT COMMAND
+	if siteFrom(context.Background()) != defaultSite || headOfficeFrom(context.Background()) {
+		t.Error("a context without a site is not the default site")
+	}
+	ctx := withSite(context.Background(), siteAccess{site: allSites, headOffice: true})
+	if siteFrom(ctx) != allSites || !headOfficeFrom(ctx) {
+		t.Error("the site was not kept")
+	}
+}
+
+// TestResolveSiteRejects covers the sites refused before the database is
+// asked whether they exist
+func TestResolveSiteRejects(t *testing.T) {
+	tests := []struct {
+		name   string
+		config AuthConfig
+		user   string
+		asked  string
+		read   bool
+		want   error
+	}{
+		{"all without head office", siteAuth, "pos", "all", true, errSiteForbidden},
+		{"all for a change", siteAuth, "office", "all", false, errAllSitesRead},
+		{"auth off, all for a change", AuthConfig{}, "", "all", false, errAllSitesRead},
+		{"not a number", siteAuth, "office", "two", true, errSiteNotFound},
+		{"zero", siteAuth, "office", "0", true, errSiteNotFound},
+		{"negative", siteAuth, "office", "-2", true, errSiteNotFound},
+		{"not a member", siteAuth, "bar", "1", true, errSiteForbidden},
+		{"not a member, for a change", siteAuth, "bar", "4", false, errSiteForbidden},
+	}
+	for _, test := range tests {
+		ctx := context.Background()
+		if test.user != "" {
+			ctx = asUser(ctx, test.user)
+		}
+		_, err := resolveSite(ctx, test.config, test.asked, test.read)
+		if err != test.want {
+			t.Errorf("%s: got %v, want %v", test.name, err, test.want)
+		}
+	}
+
+	// READING ACROSS SITES NEEDS NO SITE TO EXIST
+	for _, config := range []AuthConfig{siteAuth, {}} {
+		access, err := resolveSite(asUser(context.Background(), "office"), config, "all", true)
+		if err != nil || access.site != allSites || !access.headOffice {
+			t.Errorf("head office reading all sites: got %+v, %v", access, err)
+		}
+	}
+}
+
+func TestResolveSite(t *testing.T) {
+	openTestDB(t)
+	site := testSite(t)
+	tests := []struct {
+		name     string
+		user     string
+		asked    string
+		wantSite int
+		wantErr  error
+	}{
+		{"the default site", "pos", "", defaultSite, nil},
+		{"head office picks a site", "office", strconv.Itoa(site), site, nil},
+		{"no such site", "office", "999999999", 0, errSiteNotFound},
+	}
+	for _, test := range tests {
+		access, err := resolveSite(asUser(context.Background(), test.user), siteAuth, test.asked, true)
+		if err != test.wantErr || (err == nil && access.site != test.wantSite) {
+			t.Errorf("%s: got %+v, %v", test.name, access, err)
+		}
+	}
+}
+
+func TestSelectSite(t *testing.T) {
+	tests := []struct {
+		name     string
+		method   string
+		url      string
+		token    string
+		header   string
+		want     int
+		wantSite int
+	}{
+		{"public path", "GET", "/api/v1/openapi.yaml", "", "all", http.StatusOK, -1},
+		{"not the api", "GET", "/metrics", "bar-0123456789abcdef", "1", http.StatusOK, -1},
+		{"head office reads all", "GET", "/api/v1/stock", "office-0123456789abcdef", "all", http.StatusOK, allSites},
+		{"all from ?site=", "GET", "/api/v1/events?site=all", "office-0123456789abcdef", "", http.StatusOK, allSites},
+		{"graphql reads all", "POST", "/api/v1/graphql", "office-0123456789abcdef", "all", http.StatusOK, allSites},
+		{"changes to all", "POST", "/api/v1/rooms", "office-0123456789abcdef", "all", http.StatusBadRequest, -1},
+		{"all without head office", "GET", "/api/v1/stock", "pos-0123456789abcdef", "all", http.StatusForbidden, -1},
+		{"another site", "GET", "/api/v1/stock", "bar-0123456789abcdef", "1", http.StatusForbidden, -1},
+		{"not a site", "GET", "/api/v1/stock", "bar-0123456789abcdef", "two", http.StatusNotFound, -1},
+	}
+	for _, test := range tests {
+		site := -1
+		h := chain(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			site = siteFrom(r.Context())
+			if _, ok := r.Context().Value(siteKey{}).(siteAccess); !ok {
+				site = -1
+			}
+		}), authenticate(siteAuth), selectSite(siteAuth))
+
+		r := httptest.NewRequest(test.method, test.url, nil)
+		if test.token != "" {
+			r.Header.Set("Authorization", "Bearer "+test.token)
+		}
+		if test.header != "" {
+			r.Header.Set(siteHeader, test.header)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		if w.Code != test.want || site != test.wantSite {
+			t.Errorf("%s: got %d at site %d, want %d at %d", test.name, w.Code, site, test.want, test.wantSite)
+		}
+	}
+}
+
+func TestWriteSiteError(t *testing.T) {
+	tests := []struct {
+		err  error
+		want int
+	}{
+		{errSiteForbidden, http.StatusForbidden},
+		{errSiteNotFound, http.StatusNotFound},
+		{errAllSitesRead, http.StatusBadRequest},
+		{errors.New("connection refused"), http.StatusInternalServerError},
+	}
+	for _, test := range tests {
+		w := httptest.NewRecorder()
+		writeSiteError(w, httptest.NewRequest("GET", "/api/v1/stock", nil), test.err)
+		if w.Code != test.want {
+			t.Errorf("writeSiteError(%v) wrote %d, want %d", test.err, w.Code, test.want)
+		}
+	}
+}
+
+func TestHeadOfficeOnly(t *testing.T) {
+	tests := []struct {
+		access siteAccess
+		want   int
+	}{
+		{siteAccess{site: 2}, http.StatusForbidden},
+		{siteAccess{site: 2, headOffice: true}, http.StatusOK},
+		{siteAccess{site: allSites, headOffice: true}, http.StatusOK},
+	}
+	for _, test := range tests {
+		r := httptest.NewRequest("POST", "/api/v1/sites", nil)
+		r = r.WithContext(withSite(r.Context(), test.access))
+		w := httptest.NewRecorder()
+		headOfficeOnly(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})).ServeHTTP(w, r)
+		if w.Code != test.want {
+			t.Errorf("%+v: got %d, want %d", test.access, w.Code, test.want)
+		}
+	}
+}
+
+func TestSiteScoped(t *testing.T) {
+	openTestDB(t)
+	stockID := testStock(t, 1)
+	site := testSite(t)
+	_, err := db.Exec("UPDATE rooms SET siteID=? WHERE roomID=(SELECT roomID FROM stock WHERE stockID=?)", site, stockID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		site int
+		id   string
+		want int
+	}{
+		{"its own site", site, strconv.Itoa(stockID), http.StatusOK},
+		{"another site", defaultSite, strconv.Itoa(stockID), http.StatusNotFound},
+		{"head office across sites", allSites, strconv.Itoa(stockID), http.StatusOK},
+		{"not a number, for the handler", defaultSite, "five", http.StatusOK},
+	}
+	mux := http.NewServeMux()
+	mux.Handle("GET /api/v1/stock/{stockID}", siteScoped(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})))
+	for _, test := range tests {
+		r := httptest.NewRequest("GET", "/api/v1/stock/"+test.id, nil)
+		r = r.WithContext(withSite(r.Context(), siteAccess{site: test.site}))
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, r)
+		if w.Code != test.want {
+			t.Errorf("%s: got %d, want %d", test.name, w.Code, test.want)
+		}
+	}
+}
+
+func TestAddSite(t *testing.T) {
+	openTestDB(t)
+	site := testSite(t)
+
+	var roomID, roomSite, suppliers int
+	err := db.QueryRow("SELECT sites.genericRoomID, rooms.siteID FROM sites JOIN rooms ON rooms.roomID = sites.genericRoomID WHERE sites.siteID=?", site).Scan(&roomID, &roomSite)
+	if err != nil {
+		t.Fatal(err)
+	}
+	generic, err := isGenericRoom(roomID)
+	if err != nil || !generic || roomSite != site {
+		t.Errorf("generic room %d is at site %d, generic %v, %v", roomID, roomSite, generic, err)
+	}
+	err = db.QueryRow("SELECT COUNT(*) FROM supplierSites WHERE supplierID=1 AND siteID=?", site).Scan(&suppliers)
+	if err != nil || suppliers != 1 {
+		t.Errorf("the generic supplier is not at the new site: %d, %v", suppliers, err)
+	}
+}
+
+func TestGrpcScopedIDs(t *testing.T) {
+	tests := []struct {
+		req  any
+		want map[string]int
+	}{
+		{&inventorypb.ListRoomsRequest{}, map[string]int{}},
+		{&inventorypb.GetRoomRequest{RoomId: 3}, map[string]int{"roomID": 3}},
+		{&inventorypb.GetSupplierRequest{SupplierId: 4}, map[string]int{"supplierID": 4}},
+		{&inventorypb.AdjustStockRequest{StockId: 5}, map[string]int{"stockID": 5}},
+		{&inventorypb.DeleteLogRequest{LogId: 6}, map[string]int{"logID": 6}},
+		{&inventorypb.ListStockRequest{RoomId: 3, SupplierId: 4}, map[string]int{"roomID": 3, "supplierID": 4}},
+		{&inventorypb.ListLogsRequest{}, map[string]int{}}, // ZERO IS NOT FILTERING
+		{nil, map[string]int{}}, // STREAMS
+	}
+	for _, test := range tests {
+		if got := grpcScopedIDs(test.req); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("grpcScopedIDs(%T) = %v, want %v", test.req, got, test.want)
+		}
+	}
+}
+
+// TestGrpcSites covers the sites refused before the database is asked, the
+// health service's Check is a change and Watch a read by their names
+func TestGrpcSites(t *testing.T) {
+	client := testHealthClient(t, append(grpcAuth(siteAuth), grpcSites(siteAuth)...)...)
+	tests := []struct {
+		name  string
+		token string
+		site  string
+		watch bool
+		want  codes.Code
+	}{
+		{"head office reads all", "office-0123456789abcdef", "all", true, codes.OK},
+		{"changes to all", "office-0123456789abcdef", "all", false, codes.InvalidArgument},
+		{"all without head office", "pos-0123456789abcdef", "all", true, codes.PermissionDenied},
+		{"another site", "bar-0123456789abcdef", "1", false, codes.PermissionDenied},
+		{"not a site", "bar-0123456789abcdef", "two", false, codes.NotFound},
+	}
+	for _, test := range tests {
+		ctx, cancel := context.WithCancel(context.Background())
+		ctx = metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer "+test.token, strings.ToLower(siteHeader), test.site)
+		var err error
+		if test.watch {
+			var stream healthpb.Health_WatchClient
+			stream, err = client.Watch(ctx, &healthpb.HealthCheckRequest{})
+			if err == nil {
+				_, err = stream.Recv()
+			}
+		} else {
+			_, err = client.Check(ctx, &healthpb.HealthCheckRequest{})
+		}
+		cancel()
+		if status.Code(err) != test.want {
+			t.Errorf("%s: got %v, want %v", test.name, err, test.want)
+		}
+	}
+}
+
+func TestGraphqlAllSitesReadOnly(t *testing.T) {
+	schema, err := loadGraphQL()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := withSite(context.Background(), siteAccess{site: allSites, headOffice: true})
+	ctx = context.WithValue(ctx, graphqlLoadersKey{}, newGraphqlLoaders(allSites))
+
+	for _, mutation := range []string{
+		"mutation { setLevel(stockID: 1, level: 2) { level } }",
+		"mutation { adjustLevel(stockID: 1, delta: 2) { level } }",
+	} {
+		res := schema.Exec(ctx, mutation, "", nil)
+		if len(res.Errors) != 1 || res.Errors[0].Message != errAllSitesRead.Error() {
+			t.Errorf("%s: got %v", mutation, res.Errors)
+		}
+	}
+}
@@ -0,0 +1,298 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"time"
+)
+
+// SyncSnapshot is what a counting device downloads before going offline
+type SyncSnapshot struct {
+	ServerTime time.Time   `json:"serverTime"` // LETS THE DEVICE ALLOW FOR ITS CLOCK BEING OFF
+	Stock      []FullStock `json:"stock"`
+}
+
+// SyncChange is one level change recorded on a device while offline. Kind
+// is "adjust" for a signed Delta or "set" for a counted Level.
+type SyncChange struct {
+	ChangeID    string    `json:"changeID"` // MADE BY THE DEVICE, UNIQUE PER CHANGE ON IT
+	StockID     int       `json:"stockID"`
+	Kind        string    `json:"kind"`
+	Delta       float64   `json:"delta"`
+	Level       float64   `json:"level"`
+	Reason      string    `json:"reason"`
+	RecordedAt  time.Time `json:"recordedAt"`
+	BaseVersion int       `json:"baseVersion"` // THE STOCK VERSION FROM THE SNAPSHOT
+}
+
+type SyncUpload struct {
+	DeviceID string       `json:"deviceID"`
+	Changes  []SyncChange `json:"changes"`
+}
+
+// SyncResult reports what happened to one uploaded change. Level is the
+// server's level for the item afterwards, whatever the status.
+type SyncResult struct {
+	ChangeID string  `json:"changeID"`
+	StockID  int     `json:"stockID"`
+	Status   string  `json:"status"`
+	Level    float64 `json:"level"`
+	LogID    int     `json:"logID,omitempty"`
+	Message  string  `json:"message,omitempty"`
+}
+
+const (
+	syncAdjust = "adjust"
+	syncSet    = "set"
+
+	// applied: logged as sent. merged: an adjustment added on top of server
+	// changes made since the snapshot. conflict: a count older than a server
+	// change, not applied. duplicate: already uploaded. rejected: invalid.
+	syncApplied   = "applied"
+	syncMerged    = "merged"
+	syncConflict  = "conflict"
+	syncDuplicate = "duplicate"
+	syncRejected  = "rejected"
+
+	maxSyncChanges = 1000
+
+	createSyncChanges = `
+	CREATE TABLE IF NOT EXISTS syncChanges (
+		changeID varchar(64) NOT NULL,
+		deviceID varchar(64) NOT NULL,
+		stockID int NOT NULL,
+		status varchar(16) NOT NULL,
+		level float NOT NULL,
+		logID int,
+		message varchar(255) NOT NULL DEFAULT '',
+		receivedAt datetime NOT NULL,
+		PRIMARY KEY (deviceID, changeID));
+	`
+)
+
+// syncSnapshot serves GET /sync/snapshot?rooms=1,2, the stock of those rooms
+// (all rooms without ?rooms=) with the version of each item
+func syncSnapshot(w http.ResponseWriter, r *http.Request) {
+	var rooms []int
+	if v := r.URL.Query().Get("rooms"); v != "" {
+		var err error
+		rooms, err = parseIDList(v)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	res := SyncSnapshot{ServerTime: time.Now().UTC(), Stock: []FullStock{}}
+	filter := stockFilter{SiteID: siteFrom(r.Context()), OrderBy: "stock.roomID, stock.shelfOrder, stock.itemName"}
+	err := eachFullStock(filter, func(data FullStock) error {
+		if rooms == nil || containsInt(rooms, data.RoomID) {
+			res.Stock = append(res.Stock, data)
+		}
+		return nil
+	})
+	if err != nil {
+		logRequestError(r, err)
+		http.Error(w, "could not load stock", http.StatusInternalServerError)
+		return
+	}
+	json.NewEncoder(w).Encode(res)
+}
+
+// syncUpload serves POST /sync/upload. Changes are applied oldest first by
+// RecordedAt and logged at that time, and a SyncResult is returned for each
+// in the order they were sent. Uploading the same changes again is safe.
+func syncUpload(w http.ResponseWriter, r *http.Request) {
+	var data SyncUpload
+	err := json.NewDecoder(r.Body).Decode(&data)
+	if err != nil {
+		http.Error(w, "invalid body", http.StatusBadRequest)
+		return
+	}
+	if data.DeviceID == "" || len(data.DeviceID) > 64 {
+		http.Error(w, "deviceID is required, at most 64 characters", http.StatusBadRequest)
+		return
+	}
+	if len(data.Changes) > maxSyncChanges {
+		http.Error(w, fmt.Sprintf("at most %d changes per upload", maxSyncChanges), http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	order := make([]int, len(data.Changes))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool {
+		return data.Changes[order[a]].RecordedAt.Before(data.Changes[order[b]].RecordedAt)
+	})
+
+	res := make([]SyncResult, len(data.Changes))
+	for _, i := range order {
+		res[i], err = applySyncChange(data.DeviceID, siteFrom(r.Context()), data.Changes[i])
+		if err != nil {
+			// CHANGES ALREADY APPLIED ARE RECORDED, RETRYING THE UPLOAD IS SAFE
+			logRequestError(r, err)
+			http.Error(w, "sync failed, upload again", http.StatusInternalServerError)
+			return
+		}
+	}
+	json.NewEncoder(w).Encode(res)
+}
+
+// validateSyncChange returns why a change cannot be applied, or ""
+func validateSyncChange(change SyncChange) string {
+	switch {
+	case change.ChangeID == "" || len(change.ChangeID) > 64:
+		return "changeID is required, at most 64 characters"
+	case change.RecordedAt.IsZero():
+		return "recordedAt is required"
+	case len(change.Reason) > maxReasonLength:
+		return fmt.Sprintf("reason must be at most %d characters", maxReasonLength)
+	case change.Kind == syncAdjust && (change.Delta == 0 || math.IsNaN(change.Delta) || math.IsInf(change.Delta, 0)):
+		return "delta must be a non zero number"
+	case change.Kind == syncSet && (math.IsNaN(change.Level) || math.IsInf(change.Level, 0)):
+		return "level must be a number"
+	case change.Kind != syncAdjust && change.Kind != syncSet:
+		return "kind must be adjust or set"
+	}
+	return ""
+}
+
+// applySyncChange applies and records one change, to stock at site, in its
+// own transaction
+func applySyncChange(deviceID string, site int, change SyncChange) (res SyncResult, err error) {
+	res = SyncResult{ChangeID: change.ChangeID, StockID: change.StockID}
+	if res.Message = validateSyncChange(change); res.Message != "" {
+		res.Status = syncRejected
+		return res, nil
+	}
+	// A DEVICE CLOCK AHEAD OF THE SERVER CANNOT LOG IN THE FUTURE. LOGS ARE
+	// KEPT TO THE SECOND, SO COMPARE AT THAT
+	recordedAt := change.RecordedAt.UTC().Truncate(time.Second)
+	if now := time.Now().UTC(); recordedAt.After(now) {
+		recordedAt = now
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return res, err
+	}
+	defer tx.Rollback()
+
+	var logID sql.NullInt64
+	err = tx.QueryRow("SELECT status, level, logID, message FROM syncChanges WHERE deviceID=? AND changeID=?", deviceID, change.ChangeID).Scan(&res.Status, &res.Level, &logID, &res.Message)
+	if err == nil {
+		res.LogID = int(logID.Int64)
+		res.Message = "already uploaded as " + res.Status
+		res.Status = syncDuplicate
+		return res, nil
+	}
+	if err != sql.ErrNoRows {
+		return res, err
+	}
+
+	var oldlevel float64
+	var roomID, version, stockSite int
+	err = tx.QueryRow("SELECT stock.level, stock.roomID, stock.version, rooms.siteID FROM stock JOIN rooms ON stock.roomID = rooms.roomID WHERE stock.stockID=? FOR UPDATE OF stock",
+		change.StockID).Scan(&oldlevel, &roomID, &version, &stockSite)
+	if err == sql.ErrNoRows {
+		res.Status = syncRejected
+		res.Message = "stock item no longer exists"
+		return res, recordSyncChange(tx, deviceID, change, res)
+	}
+	if err != nil {
+		return res, err
+	}
+	if stockSite != site {
+		// NOT RECORDED, THE SAME CHANGE MAY STILL BE UPLOADED TO THE RIGHT SITE
+		res.Status = syncRejected
+		res.Message = "stock item is not at this site"
+		return res, nil
+	}
+	res.Level = oldlevel
+
+	// A SERVER CHANGE LOGGED AFTER THE DEVICE RECORDED ITS CHANGE IS NEWER
+	var newer int
+	err = tx.QueryRow("SELECT COUNT(*) FROM logs WHERE stockID=? AND incidentTime > ?", change.StockID, recordedAt).Scan(&newer)
+	if err != nil {
+		return res, err
+	}
+
+	var update string
+	var arg float64
+	var differance float64
+	switch change.Kind {
+	case syncSet:
+		if newer > 0 {
+			// THE COUNT NO LONGER DESCRIBES THE SHELF, KEEP THE SERVER'S LEVEL
+			res.Status = syncConflict
+			res.Message = fmt.Sprintf("%d newer change(s) on the server, count again", newer)
+			return res, recordSyncChange(tx, deviceID, change, res)
+		}
+		update, arg = "UPDATE stock SET level = ?, version = version + 1 WHERE stockID=?", change.Level
+		differance = change.Level - oldlevel
+	case syncAdjust:
+		// ADJUSTMENTS ADD UP IN ANY ORDER SO ALWAYS APPLY
+		update, arg = "UPDATE stock SET level = level + ?, version = version + 1 WHERE stockID=?", change.Delta
+		differance = change.Delta
+	}
+	res.Status = syncApplied
+	if change.BaseVersion != 0 && version != change.BaseVersion {
+		res.Status = syncMerged
+	}
+
+	_, err = tx.Exec(update, arg, change.StockID)
+	if err != nil {
+		return res, err
+	}
+	err = tx.QueryRow("SELECT level FROM stock WHERE stockID=?", change.StockID).Scan(&res.Level)
+	if err != nil {
+		return res, err
+	}
+	inserted, err := tx.Exec("INSERT INTO logs(stockID,differance,totalAfter,incidentTime,daily,reason) VALUES (?,?,?,?,0,?)",
+		change.StockID, differance, res.Level, recordedAt, change.Reason)
+	if err != nil {
+		return res, err
+	}
+	id, err := inserted.LastInsertId()
+	if err != nil {
+		return res, err
+	}
+	res.LogID = int(id)
+	// A BACKDATED LOG IS NOT THE LATEST WHEN THE SERVER HAS LOGGED SINCE
+	_, err = tx.Exec("UPDATE stock SET lastLogID=? WHERE stockID=? AND NOT EXISTS (SELECT 1 FROM logs WHERE stockID=? AND incidentTime > ?)",
+		res.LogID, change.StockID, change.StockID, recordedAt)
+	if err != nil {
+		return res, err
+	}
+
+	alert, err := checkLowStock(tx, change.StockID, oldlevel, res.Level)
+	if err != nil {
+		return res, err
+	}
+	err = emitEvent(tx, eventStockLevelChanged, levelChange{StockID: change.StockID, RoomID: roomID, Level: res.Level, Differance: differance, LogID: res.LogID, Reason: change.Reason})
+	if err != nil {
+		return res, err
+	}
+	err = recordSyncChange(tx, deviceID, change, res)
+	if err != nil {
+		return res, err
+	}
+	notifyLowStock(alert)
+	return res, nil
+}
+
+// recordSyncChange remembers a change's result so a repeated upload of it is
+// reported, not applied twice, then commits tx
+func recordSyncChange(tx *sql.Tx, deviceID string, change SyncChange, res SyncResult) (err error) {
+	_, err = tx.Exec("INSERT INTO syncChanges(changeID,deviceID,stockID,status,level,logID,message,receivedAt) VALUES (?,?,?,?,?,?,?,NOW())",
+		change.ChangeID, deviceID, change.StockID, res.Status, res.Level, nullInt(res.LogID), res.Message)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"math"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestValidateSyncChange(t *testing.T) {
+	valid := SyncChange{ChangeID: "c1", StockID: 1, Kind: syncAdjust, Delta: -2, RecordedAt: time.Now()}
+	tests := []struct {
+		name   string
+		change func(*SyncChange)
+		want   string
+	}{
+		{"valid adjust", func(c *SyncChange) {}, ""},
+		{"valid set to zero", func(c *SyncChange) { c.Kind, c.Level = syncSet, 0 }, ""},
+		{"no changeID", func(c *SyncChange) { c.ChangeID = "" }, "changeID"},
+		{"long changeID", func(c *SyncChange) { c.ChangeID = strings.Repeat("x", 65) }, "changeID"},
+		{"no time", func(c *SyncChange) { c.RecordedAt = time.Time{} }, "recordedAt"},
+		{"long reason", func(c *SyncChange) { c.Reason = strings.Repeat("x", maxReasonLength+1) }, "reason"},
+		{"zero delta", func(c *SyncChange) { c.Delta = 0 }, "delta"},
+		{"infinite delta", func(c *SyncChange) { c.Delta = math.Inf(1) }, "delta"},
+		{"NaN level", func(c *SyncChange) { c.Kind, c.Level = syncSet, math.NaN() }, "level"},
+		{"unknown kind", func(c *SyncChange) { c.Kind = "count" }, "kind"},
+	}
+	for _, test := range tests {
+		change := valid
+		test.change(&change)
+		got := validateSyncChange(change)
+		if (test.want == "") != (got == "") || !strings.Contains(got, test.want) {
+			t.Errorf("%s: got %q, want %q", test.name, got, test.want)
+		}
+	}
+}
+
+func TestApplySyncChange(t *testing.T) {
+	openTestDB(t)
+	prefix := testKey(t)
+	// MINUTES BACK, SO A TIME ZONE MIX UP BETWEEN GO AND NOW() WOULD SHOW
+	offline := time.Now().Add(-5 * time.Minute)
+
+	tests := []struct {
+		name        string
+		serverLevel float64 // SET ON THE SERVER AFTER THE SNAPSHOT WHEN NOT 0
+		change      SyncChange
+		wantStatus  string
+		wantLevel   float64
+	}{
+		{"count applied", 0, SyncChange{Kind: syncSet, Level: 4, BaseVersion: 1}, syncApplied, 4},
+		{"adjust applied", 0, SyncChange{Kind: syncAdjust, Delta: -3, BaseVersion: 1}, syncApplied, 7},
+		{"older count conflicts", 12, SyncChange{Kind: syncSet, Level: 4, BaseVersion: 1}, syncConflict, 12},
+		{"older adjust merges", 20, SyncChange{Kind: syncAdjust, Delta: -3, BaseVersion: 1}, syncMerged, 17},
+	}
+	for _, test := range tests {
+		stockID := testStock(t, 10)
+		if test.serverLevel != 0 {
+			_, err := updateFullStockLevel(FullStock{StockID: stockID, Level: test.serverLevel})
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+		change := test.change
+		change.ChangeID = prefix + test.name
+		change.StockID = stockID
+		change.RecordedAt = offline
+
+		res, err := applySyncChange("device", defaultSite, change)
+		if err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+		if res.Status != test.wantStatus || res.Level != test.wantLevel {
+			t.Errorf("%s: got %s at %v (%s), want %s at %v", test.name, res.Status, res.Level, res.Message, test.wantStatus, test.wantLevel)
+		}
+		if level := stockLevel(t, stockID); level != test.wantLevel {
+			t.Errorf("%s: stock level is %v, want %v", test.name, level, test.wantLevel)
+		}
+		if (res.LogID != 0) != (test.wantStatus != syncConflict) {
+			t.Errorf("%s: logID %d for a change that was %s", test.name, res.LogID, res.Status)
+		}
+		// THE SERVER'S CHANGE STAYS THE LATEST LOG OVER A BACKDATED ONE
+		var lastLogID int
+		err = db.QueryRow("SELECT lastLogID FROM stock WHERE stockID=?", stockID).Scan(&lastLogID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if (lastLogID == res.LogID) != (test.serverLevel == 0) {
+			t.Errorf("%s: lastLogID is %d for a change logged as %d", test.name, lastLogID, res.LogID)
+		}
+
+		// UPLOADING THE SAME CHANGE AGAIN CHANGES NOTHING
+		again, err := applySyncChange("device", defaultSite, change)
+		if err != nil {
+			t.Fatalf("%s again: %v", test.name, err)
+		}
+		if again.Status != syncDuplicate || again.LogID != res.LogID || !strings.Contains(again.Message, test.wantStatus) {
+			t.Errorf("%s again: got %+v, want a duplicate of %+v", test.name, again, res)
+		}
+		if level := stockLevel(t, stockID); level != test.wantLevel {
+			t.Errorf("%s again: stock level is %v, want %v", test.name, level, test.wantLevel)
+		}
+	}
+}
+
+func TestApplySyncChangeDevices(t *testing.T) {
+	openTestDB(t)
+	stockID := testStock(t, 10)
+	change := SyncChange{ChangeID: testKey(t), StockID: stockID, Kind: syncAdjust, Delta: -1, RecordedAt: time.Now()}
+
+	// ANOTHER DEVICE MAY MAKE THE SAME changeID, IT IS STILL ANOTHER CHANGE
+	for _, device := range []string{"tablet", "phone"} {
+		res, err := applySyncChange(device, defaultSite, change)
+		if err != nil {
+			t.Fatalf("%s: %v", device, err)
+		}
+		if res.Status != syncApplied {
+			t.Errorf("%s: got %+v, want applied", device, res)
+		}
+	}
+	if level := stockLevel(t, stockID); level != 8 {
+		t.Errorf("stock level is %v, want 8", level)
+	}
+}
+
+func TestApplySyncChangeStockGone(t *testing.T) {
+	openTestDB(t)
+	change := SyncChange{ChangeID: testKey(t), StockID: -1, Kind: syncAdjust, Delta: 1, RecordedAt: time.Now()}
+	res, err := applySyncChange("device", defaultSite, change)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Status != syncRejected || !strings.Contains(res.Message, "no longer exists") {
+		t.Errorf("change to a deleted item: got %+v", res)
+	}
+}
+
+func TestApplySyncChangeStockElsewhere(t *testing.T) {
+	openTestDB(t)
+	stockID := testStock(t, 5)
+	site := testSite(t)
+	_, err := db.Exec("UPDATE rooms SET siteID=? WHERE roomID=(SELECT roomID FROM stock WHERE stockID=?)", site, stockID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	change := SyncChange{ChangeID: testKey(t), StockID: stockID, Kind: syncAdjust, Delta: 1, RecordedAt: time.Now()}
+	res, err := applySyncChange("device", defaultSite, change)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Status != syncRejected || stockLevel(t, stockID) != 5 {
+		t.Errorf("change to another site's item: got %+v, level %v", res, stockLevel(t, stockID))
+	}
+	// NOT RECORDED, SO THE SAME CHANGE CAN STILL BE UPLOADED TO THE RIGHT SITE
+	res, err = applySyncChange("device", site, change)
+	if err != nil || res.Status != syncApplied || stockLevel(t, stockID) != 6 {
+		t.Errorf("change at the item's site: got %+v, %v, level %v", res, err, stockLevel(t, stockID))
+	}
+}
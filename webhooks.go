@@ -0,0 +1,600 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Event is a change to the inventory, written to the outbox table in the
+// same transaction as the change itself
+type Event struct {
+	EventID   int             `json:"eventID"`
+	Type      string          `json:"type"`
+	RoomID    int             `json:"roomID,omitempty"` // 0 FOR EVENTS NOT ABOUT ONE ROOM
+	SiteID    int             `json:"siteID,omitempty"` // THE SITE OF THE ROOM OR NEW SUPPLIER
+	CreatedAt NullTime        `json:"createdAt"`
+	Data      json.RawMessage `json:"data"`
+}
+
+// roomScoped is implemented by event data about something in a room, so the
+// room can be stored with the event for filtering
+type roomScoped interface {
+	eventRoomID() int
+}
+
+func (data Stock) eventRoomID() int       { return data.RoomID }
+func (data Room) eventRoomID() int        { return data.RoomId }
+func (data levelChange) eventRoomID() int { return data.RoomID }
+
+// stockDeleted is the data of a stock.deleted event
+type stockDeleted struct {
+	StockID int `json:"stockID"`
+	RoomID  int `json:"roomID"`
+}
+
+func (data stockDeleted) eventRoomID() int { return data.RoomID }
+
+// logDeleted is the data of a log.deleted event, Level is the stock level
+// after the log was undone
+type logDeleted struct {
+	LogID   int     `json:"logID"`
+	StockID int     `json:"stockID"`
+	RoomID  int     `json:"roomID"`
+	Level   float64 `json:"level"`
+}
+
+func (data logDeleted) eventRoomID() int { return data.RoomID }
+
+// siteEvent is implemented by event data that belongs to a site without
+// being in a room, so live streams send it to that site only
+type siteEvent interface {
+	eventSiteID() int
+}
+
+// eventSiteID is the site a new supplier is created at. One shared with
+// several sites has none, and only head office streams get it.
+func (data Supplier) eventSiteID() int {
+	if len(data.SiteIDs) != 1 {
+		return 0
+	}
+	return data.SiteIDs[0]
+}
+
+type Webhook struct {
+	WebhookID int      `json:"webhookID"`
+	URL       string   `json:"url"`
+	Secret    string   `json:"secret,omitempty"` // ONLY ACCEPTED, NEVER RETURNED
+	Events    []string `json:"events"`           // EVENT TYPES, EMPTY FOR ALL
+}
+type WebhookDelivery struct {
+	DeliveryID    int      `json:"deliveryID"`
+	WebhookID     int      `json:"webhookID"`
+	EventID       int      `json:"eventID"`
+	EventType     string   `json:"eventType"`
+	Status        string   `json:"status"` // pending, delivered OR failed
+	Attempts      int      `json:"attempts"`
+	ResponseCode  int      `json:"responseCode"`
+	Error         string   `json:"error"`
+	NextAttemptAt NullTime `json:"nextAttemptAt"`
+	DeliveredAt   NullTime `json:"deliveredAt"`
+}
+
+const (
+	eventStockCreated      = "stock.created"
+	eventStockUpdated      = "stock.updated"
+	eventStockDeleted      = "stock.deleted"
+	eventStockLevelChanged = "stock.levelChanged"
+	eventLogDeleted        = "log.deleted"
+	eventRoomCreated       = "room.created"
+	eventRoomUpdated       = "room.updated"
+	eventRoomDeleted       = "room.deleted"
+	eventSupplierCreated   = "supplier.created"
+
+	deliveryPending   = "pending"
+	deliveryDelivered = "delivered"
+	deliveryFailed    = "failed"
+
+	maxDeliveryAttempts = 8
+	// DELIVERIES CLAIMED AND SENT ONE AFTER ANOTHER IN EACH RUN
+	deliveryBatch  = 20
+	webhookTimeout = 10 * time.Second
+	// A CLAIM OUTLASTS SENDING THE WHOLE BATCH, SO ANOTHER INSTANCE CANNOT
+	// CLAIM A DELIVERY AGAIN BEFORE ITS RESULT IS RECORDED
+	deliveryClaim = deliveryBatch*webhookTimeout + 30*time.Second
+	// HOW LONG DISPATCHED EVENTS AND FINISHED DELIVERIES ARE KEPT
+	outboxRetention = 7 * 24 * time.Hour
+
+	createOutbox = `
+	CREATE TABLE IF NOT EXISTS outbox (
+		eventID int NOT NULL AUTO_INCREMENT,
+		type varchar(64) NOT NULL,
+		payload json NOT NULL,
+		createdAt datetime NOT NULL,
+		dispatchedAt datetime,
+		roomID int,
+		PRIMARY KEY (eventID),
+		INDEX (dispatchedAt));
+	`
+	createWebhooks = `
+	CREATE TABLE IF NOT EXISTS webhooks (
+		webhookID int NOT NULL AUTO_INCREMENT,
+		url varchar(512) NOT NULL,
+		secret varchar(255) NOT NULL,
+		events varchar(1024) NOT NULL,
+		PRIMARY KEY (webhookID));
+	`
+	createWebhookDeliveries = `
+	CREATE TABLE IF NOT EXISTS webhookDeliveries (
+		deliveryID int NOT NULL AUTO_INCREMENT,
+		webhookID int NOT NULL,
+		eventID int NOT NULL,
+		status varchar(16) NOT NULL,
+		attempts int NOT NULL DEFAULT 0,
+		responseCode int NOT NULL DEFAULT 0,
+		error varchar(1024) NOT NULL DEFAULT '',
+		nextAttemptAt datetime,
+		deliveredAt datetime,
+		PRIMARY KEY (deliveryID),
+		INDEX (status, nextAttemptAt),
+		FOREIGN KEY (webhookID) REFERENCES webhooks(webhookID),
+		FOREIGN KEY (eventID) REFERENCES outbox(eventID));
+	`
+)
+
+var webhookClient = &http.Client{Timeout: webhookTimeout}
+
+// emitEvent adds an event to the outbox as part of tx, so it is only sent if
+// the change it describes commits
+func emitEvent(tx *sql.Tx, eventType string, data any) (err error) {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	roomID, siteID := 0, 0
+	if scoped, ok := data.(roomScoped); ok {
+		roomID = scoped.eventRoomID()
+	}
+	if scoped, ok := data.(siteEvent); ok {
+		siteID = scoped.eventSiteID()
+	}
+	_, err = tx.Exec("INSERT INTO outbox(type,payload,createdAt,roomID,siteID) VALUES (?,?,NOW(),?,COALESCE((SELECT siteID FROM rooms WHERE roomID=?),?))",
+		eventType, payload, nullInt(roomID), roomID, nullInt(siteID))
+	return err
+}
+
+// DISPATCH
+
+// startWebhookDispatcher turns outbox events into deliveries for the
+// subscribed webhooks and sends due deliveries, every interval
+func startWebhookDispatcher(ctx context.Context, interval time.Duration) {
+	every(ctx, interval, func() {
+		err := dispatchOutbox()
+		if err != nil {
+			slog.Error("webhooks", "err", err)
+		}
+		err = sendDueDeliveries()
+		if err != nil {
+			slog.Error("webhooks", "err", err)
+		}
+	})
+}
+
+// startOutboxSweeper prunes the outbox every interval, see pruneOutbox
+func startOutboxSweeper(ctx context.Context, interval time.Duration, webhooks bool) {
+	every(ctx, interval, func() {
+		err := pruneOutbox(webhooks)
+		if err != nil {
+			slog.Error("webhooks", "err", err)
+		}
+	})
+}
+
+// pruneOutbox deletes dispatched events older than outboxRetention, with
+// their finished deliveries. With webhooks off nothing dispatches events, so
+// undispatched ones older than that go too, keeping only what an /events
+// client reconnecting with Last-Event-ID may still ask for.
+func pruneOutbox(webhooks bool) (err error) {
+	retention := int(outboxRetention / time.Second)
+	_, err = db.Exec(`DELETE webhookDeliveries FROM webhookDeliveries JOIN outbox ON webhookDeliveries.eventID = outbox.eventID
+		WHERE outbox.dispatchedAt < NOW() - INTERVAL ? SECOND AND webhookDeliveries.status <> ?`, retention, deliveryPending)
+	if err != nil {
+		return err
+	}
+	_, err = db.Exec(`DELETE FROM outbox WHERE dispatchedAt < NOW() - INTERVAL ? SECOND
+		AND NOT EXISTS (SELECT 1 FROM webhookDeliveries WHERE webhookDeliveries.eventID = outbox.eventID)`, retention)
+	if err != nil || webhooks {
+		return err
+	}
+	_, err = db.Exec("DELETE FROM outbox WHERE dispatchedAt IS NULL AND createdAt < NOW() - INTERVAL ? SECOND", retention)
+	return err
+}
+
+// dispatchOutbox creates a pending delivery per subscribed webhook for each
+// event not yet dispatched
+func dispatchOutbox() (err error) {
+	hooks, err := getWebhooks()
+	if err != nil {
+		return err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.Query("SELECT eventID, type FROM outbox WHERE dispatchedAt IS NULL ORDER BY eventID LIMIT 100 FOR UPDATE SKIP LOCKED")
+	if err != nil {
+		return err
+	}
+	type pending struct {
+		id        int
+		eventType string
+	}
+	var events []pending
+	for rows.Next() {
+		var event pending
+		err = rows.Scan(&event.id, &event.eventType)
+		if err != nil {
+			rows.Close()
+			return err
+		}
+		events = append(events, event)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return err
+	}
+
+	for _, event := range events {
+		for _, hook := range hooks {
+			if !hook.subscribed(event.eventType) {
+				continue
+			}
+			_, err = tx.Exec("INSERT INTO webhookDeliveries(webhookID,eventID,status,nextAttemptAt) VALUES (?,?,?,NOW())",
+				hook.WebhookID, event.id, deliveryPending)
+			if err != nil {
+				return err
+			}
+		}
+		_, err = tx.Exec("UPDATE outbox SET dispatchedAt=NOW() WHERE eventID=?", event.id)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (hook Webhook) subscribed(eventType string) bool {
+	if len(hook.Events) == 0 {
+		return true
+	}
+	for _, subscribed := range hook.Events {
+		// "stock.*" MATCHES EVERY STOCK EVENT
+		if subscribed == eventType || strings.HasSuffix(subscribed, ".*") && strings.HasPrefix(eventType, strings.TrimSuffix(subscribed, "*")) {
+			return true
+		}
+	}
+	return false
+}
+
+// sendDueDeliveries claims pending deliveries whose next attempt is due and
+// sends them. Claiming pushes nextAttemptAt forward so another instance, or
+// the next run, does not send the same delivery at the same time.
+func sendDueDeliveries() (err error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.Query(`
+		SELECT webhookDeliveries.deliveryID, webhookDeliveries.attempts, webhooks.url, webhooks.secret,
+		    outbox.eventID, outbox.type, outbox.roomID, outbox.siteID, outbox.payload, outbox.createdAt
+		FROM webhookDeliveries
+		JOIN webhooks ON webhookDeliveries.webhookID = webhooks.webhookID
+		JOIN outbox ON webhookDeliveries.eventID = outbox.eventID
+		WHERE webhookDeliveries.status = ? AND webhookDeliveries.nextAttemptAt <= NOW()
+		ORDER BY webhookDeliveries.deliveryID
+		LIMIT ?
+		FOR UPDATE OF webhookDeliveries SKIP LOCKED`, deliveryPending, deliveryBatch)
+	if err != nil {
+		return err
+	}
+	type claimed struct {
+		deliveryID int
+		attempts   int
+		url        string
+		secret     string
+		event      Event
+	}
+	var due []claimed
+	for rows.Next() {
+		var c claimed
+		var payload []byte
+		var roomID, siteID sql.NullInt64
+		err = rows.Scan(&c.deliveryID, &c.attempts, &c.url, &c.secret, &c.event.EventID, &c.event.Type, &roomID, &siteID, &payload, &c.event.CreatedAt)
+		if err != nil {
+			rows.Close()
+			return err
+		}
+		c.event.RoomID = int(roomID.Int64)
+		c.event.SiteID = int(siteID.Int64)
+		c.event.Data = payload
+		due = append(due, c)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return err
+	}
+	for _, c := range due {
+		_, err = tx.Exec("UPDATE webhookDeliveries SET nextAttemptAt = NOW() + INTERVAL ? SECOND WHERE deliveryID=?", int(deliveryClaim/time.Second), c.deliveryID)
+		if err != nil {
+			return err
+		}
+	}
+	if err = tx.Commit(); err != nil {
+		return err
+	}
+
+	for _, c := range due {
+		code, sendErr := sendWebhook(c.url, c.secret, c.deliveryID, c.event)
+		err = recordDelivery(c.deliveryID, c.attempts+1, code, sendErr)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// sendWebhook POSTs the event, signed with an HMAC-SHA256 of the body in
+// X-Inventory-Signature
+func sendWebhook(url string, secret string, deliveryID int, event Event) (code int, err error) {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return 0, err
+	}
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Inventory-Event", event.Type)
+	req.Header.Set("X-Inventory-Delivery", strconv.Itoa(deliveryID))
+	req.Header.Set("X-Inventory-Signature", "sha256="+signPayload(secret, body))
+
+	res, err := webhookClient.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer res.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(res.Body, 64<<10))
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return res.StatusCode, fmt.Errorf("responded %s", res.Status)
+	}
+	return res.StatusCode, nil
+}
+func signPayload(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// recordDelivery stores the result of an attempt, scheduling a retry with
+// exponential backoff (30s, 1m, 2m ... ) until maxDeliveryAttempts
+func recordDelivery(deliveryID int, attempts int, code int, sendErr error) (err error) {
+	if sendErr == nil {
+		_, err = db.Exec("UPDATE webhookDeliveries SET status=?, attempts=?, responseCode=?, error='', deliveredAt=NOW(), nextAttemptAt=NULL WHERE deliveryID=?",
+			deliveryDelivered, attempts, code, deliveryID)
+		return err
+	}
+
+	message := sendErr.Error()
+	if len(message) > 1024 {
+		message = message[:1024]
+	}
+	if attempts >= maxDeliveryAttempts {
+		_, err = db.Exec("UPDATE webhookDeliveries SET status=?, attempts=?, responseCode=?, error=?, nextAttemptAt=NULL WHERE deliveryID=?",
+			deliveryFailed, attempts, code, message, deliveryID)
+		return err
+	}
+	backoff := 30 * (1 << (attempts - 1))
+	_, err = db.Exec("UPDATE webhookDeliveries SET attempts=?, responseCode=?, error=?, nextAttemptAt = NOW() + INTERVAL ? SECOND WHERE deliveryID=?",
+		attempts, code, message, backoff, deliveryID)
+	return err
+}
+
+// HANDLERS
+
+// webhooksList serves GET /webhooks/, without their secrets
+func webhooksList(w http.ResponseWriter, r *http.Request) {
+	res, err := getWebhooks()
+	if err != nil {
+		logRequestError(r, err)
+		http.Error(w, "could not load webhooks", http.StatusInternalServerError)
+		return
+	}
+	for i := range res {
+		res[i].Secret = ""
+	}
+	json.NewEncoder(w).Encode(res)
+}
+
+// webhooksCreate serves POST /webhooks/ with {"url", "secret", "events"}
+func webhooksCreate(w http.ResponseWriter, r *http.Request) {
+	var data Webhook
+	err := json.NewDecoder(r.Body).Decode(&data)
+	if err != nil {
+		http.Error(w, "invalid body", http.StatusBadRequest)
+		return
+	}
+	if !strings.HasPrefix(data.URL, "http://") && !strings.HasPrefix(data.URL, "https://") {
+		http.Error(w, "url must be http or https", http.StatusBadRequest)
+		return
+	}
+	if data.Secret == "" {
+		http.Error(w, "secret is required to sign payloads", http.StatusBadRequest)
+		return
+	}
+	err = addWebhook(data)
+	if err != nil {
+		logRequestError(r, err)
+		http.Error(w, "could not add webhook", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte("data written sucesfuly"))
+}
+func webhooksDelete(w http.ResponseWriter, r *http.Request) {
+	idnum, ok := pathID(w, r, "webhookID")
+	if !ok {
+		return
+	}
+	err := deleteWebhook(idnum)
+	if err != nil {
+		logRequestError(r, err)
+		http.Error(w, "could not delete webhook", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte("data deleated sucesfuly"))
+}
+
+// webhookDeliveries serves GET /webhooks/{id}/deliveries
+func webhookDeliveries(w http.ResponseWriter, r *http.Request) {
+	idnum, ok := pathID(w, r, "webhookID")
+	if !ok {
+		return
+	}
+	res, err := getWebhookDeliveries(idnum)
+	if err != nil {
+		logRequestError(r, err)
+		http.Error(w, "could not load deliveries", http.StatusInternalServerError)
+		return
+	}
+	json.NewEncoder(w).Encode(res)
+}
+
+// webhookDeliveryReplay serves POST /webhooks/deliveries/{id}/replay
+func webhookDeliveryReplay(w http.ResponseWriter, r *http.Request) {
+	idnum, ok := pathID(w, r, "deliveryID")
+	if !ok {
+		return
+	}
+	err := replayDelivery(idnum)
+	if err == sql.ErrNoRows {
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		logRequestError(r, err)
+		http.Error(w, "could not replay delivery", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte("delivery queued"))
+}
+
+// CREATE
+
+func addWebhook(data Webhook) (err error) {
+	_, err = db.Exec("INSERT INTO webhooks(url,secret,events) VALUES (?,?,?)", data.URL, data.Secret, strings.Join(data.Events, ","))
+	return err
+}
+
+// replayDelivery queues the event of a delivery to be sent to its webhook
+// again, as a new delivery
+func replayDelivery(deliveryID int) (err error) {
+	var webhookID, eventID int
+	err = db.QueryRow("SELECT webhookID, eventID FROM webhookDeliveries WHERE deliveryID=?", deliveryID).Scan(&webhookID, &eventID)
+	if err != nil {
+		return err
+	}
+	_, err = db.Exec("INSERT INTO webhookDeliveries(webhookID,eventID,status,nextAttemptAt) VALUES (?,?,?,NOW())", webhookID, eventID, deliveryPending)
+	return err
+}
+
+// GET
+
+func getWebhooks() (res []Webhook, err error) {
+	res = []Webhook{}
+	rows, err := db.Query("SELECT webhookID, url, secret, events FROM webhooks ORDER BY webhookID")
+	if err != nil {
+		return res, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var data Webhook
+		var events string
+		err = rows.Scan(&data.WebhookID, &data.URL, &data.Secret, &events)
+		if err != nil {
+			return res, err
+		}
+		data.Events = []string{}
+		if events != "" {
+			data.Events = strings.Split(events, ",")
+		}
+		res = append(res, data)
+	}
+	return res, rows.Err()
+}
+func getWebhookDeliveries(webhookID int) (res []WebhookDelivery, err error) {
+	res = []WebhookDelivery{}
+	rows, err := db.Query(`
+		SELECT webhookDeliveries.deliveryID, webhookDeliveries.webhookID, webhookDeliveries.eventID, outbox.type,
+		    webhookDeliveries.status, webhookDeliveries.attempts, webhookDeliveries.responseCode, webhookDeliveries.error,
+		    webhookDeliveries.nextAttemptAt, webhookDeliveries.deliveredAt
+		FROM webhookDeliveries
+		JOIN outbox ON webhookDeliveries.eventID = outbox.eventID
+		WHERE webhookDeliveries.webhookID = ?
+		ORDER BY webhookDeliveries.deliveryID DESC
+		LIMIT 200`, webhookID)
+	if err != nil {
+		return res, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var data WebhookDelivery
+		err = rows.Scan(&data.DeliveryID, &data.WebhookID, &data.EventID, &data.EventType, &data.Status, &data.Attempts,
+			&data.ResponseCode, &data.Error, &data.NextAttemptAt, &data.DeliveredAt)
+		if err != nil {
+			return res, err
+		}
+		res = append(res, data)
+	}
+	return res, rows.Err()
+}
+
+// DELETE
+
+func deleteWebhook(id int) (err error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec("DELETE FROM webhookDeliveries WHERE webhookID=?", id)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec("DELETE FROM webhooks WHERE webhookID=?", id)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestSignPayload(t *testing.T) {
+	// HMAC-SHA256 TEST VECTOR
+	got := signPayload("key", []byte("The quick brown fox jumps over the lazy dog"))
+	if want := "f7bc83f430538424b13298e6aa6fb143ef4d59a14946175997479dbc2d1a3cd8"; got != want {
+		t.Errorf("signPayload = %s, want %s", got, want)
+	}
+}
+
+func TestWebhookSubscribed(t *testing.T) {
+	tests := []struct {
+		events    []string
+		eventType string
+		want      bool
+	}{
+		{nil, eventStockDeleted, true},
+		{[]string{eventStockLevelChanged}, eventStockLevelChanged, true},
+		{[]string{eventStockLevelChanged}, eventStockUpdated, false},
+		{[]string{"stock.*"}, eventStockCreated, true},
+		{[]string{"stock.*"}, eventRoomCreated, false},
+		{[]string{"room.*", eventLogDeleted}, eventLogDeleted, true},
+		{[]string{"stock"}, eventStockCreated, false},
+	}
+	for _, test := range tests {
+		hook := Webhook{Events: test.events}
+		if got := hook.subscribed(test.eventType); got != test.want {
+			t.Errorf("%v subscribed to %s = %v, want %v", test.events, test.eventType, got, test.want)
+		}
+	}
+}
+
+func TestSendWebhook(t *testing.T) {
+	const secret = "shh"
+	status := http.StatusNoContent
+	var header http.Header
+	var body []byte
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header = r.Header
+		body, _ = io.ReadAll(r.Body)
+		w.WriteHeader(status)
+	}))
+	defer server.Close()
+
+	event := Event{EventID: 9, Type: eventStockLevelChanged, Data: json.RawMessage(`{"stockID":12,"level":3}`)}
+	code, err := sendWebhook(server.URL, secret, 41, event)
+	if err != nil || code != http.StatusNoContent {
+		t.Fatalf("got %d, %v", code, err)
+	}
+	if header.Get("X-Inventory-Event") != eventStockLevelChanged || header.Get("X-Inventory-Delivery") != "41" {
+		t.Errorf("wrong headers: %v", header)
+	}
+
+	// A RECEIVER CHECKS THE SIGNATURE LIKE THIS
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	if want := "sha256=" + hex.EncodeToString(mac.Sum(nil)); !hmac.Equal([]byte(header.Get("X-Inventory-Signature")), []byte(want)) {
+		t.Errorf("signature %s does not match the body, want %s", header.Get("X-Inventory-Signature"), want)
+	}
+	var sent Event
+	if err = json.Unmarshal(body, &sent); err != nil || sent.EventID != 9 || string(sent.Data) != string(event.Data) {
+		t.Errorf("sent %s, %v", body, err)
+	}
+
+	for _, status = range []int{http.StatusMovedPermanently, http.StatusGone, http.StatusBadGateway} {
+		code, err = sendWebhook(server.URL, secret, 41, event)
+		if err == nil || code != status {
+			t.Errorf("a %d response gave %d, %v, want it as an error", status, code, err)
+		}
+	}
+}
+
+func TestSupplierEventSiteID(t *testing.T) {
+	tests := []struct {
+		sites []int
+		want  int
+	}{
+		{nil, 0},
+		{[]int{3}, 3},
+		{[]int{2, 3}, 0}, // SHARED, HEAD OFFICE ONLY
+	}
+	for _, test := range tests {
+		var data any = Supplier{SiteIDs: test.sites}
+		scoped, ok := data.(siteEvent)
+		if !ok || scoped.eventSiteID() != test.want {
+			t.Errorf("supplier at %v: got site %v, want %d", test.sites, scoped, test.want)
+		}
+	}
+}
+
+func TestPruneOutbox(t *testing.T) {
+	openTestDB(t)
+	// MADE PAST THE RETENTION, ONE NEVER DISPATCHED AND ONE DISPATCHED JUST NOW
+	age := int(outboxRetention/time.Second) + 60
+	var undispatched, dispatched int64
+	for _, event := range []struct {
+		id           *int64
+		dispatchedAt string
+	}{{&undispatched, "NULL"}, {&dispatched, "NOW()"}} {
+		res, err := db.Exec("INSERT INTO outbox(type,payload,createdAt,dispatchedAt) VALUES (?,'{}',NOW() - INTERVAL ? SECOND,"+event.dispatchedAt+")", eventStockCreated, age)
+		if err != nil {
+			t.Fatal(err)
+		}
+		*event.id, err = res.LastInsertId()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		webhooks         bool
+		wantUndispatched bool
+	}{
+		{true, true}, // WAITING FOR THE DISPATCHER
+		{false, false},
+	}
+	for _, test := range tests {
+		err := pruneOutbox(test.webhooks)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := outboxHas(t, undispatched); got != test.wantUndispatched {
+			t.Errorf("webhooks %v: undispatched event kept %v, want %v", test.webhooks, got, test.wantUndispatched)
+		}
+		if !outboxHas(t, dispatched) {
+			t.Errorf("webhooks %v: event dispatched just now was deleted", test.webhooks)
+		}
+	}
+}
+
+// outboxHas reports whether the event is still in the outbox
+func outboxHas(t *testing.T, eventID int64) bool {
+	t.Helper()
+	var count int
+	err := db.QueryRow("SELECT COUNT(*) FROM outbox WHERE eventID=?", eventID).Scan(&count)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return count == 1
+}